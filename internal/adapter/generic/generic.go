@@ -0,0 +1,208 @@
+// Package generic provides a source for a plain directory tree or zip file of
+// media files that doesn't follow the Google Takeout layout.
+package generic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fileinfo"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+)
+
+// Directory is a source that uploads every media file under a root,
+// preserving relative paths. Metadata comes from the files themselves; JSON
+// sidecar files are not resolved.
+type Directory struct {
+	fsys       fs.FS
+	mu         sync.RWMutex
+	mediaFiles map[string]*source.MediaFile
+	extractor  *metadata.Extractor
+	rootPath   string
+	options    Options
+}
+
+var _ source.Source = (*Directory)(nil)
+
+// Options configures how a directory is scanned
+type Options struct {
+	// ScanConcurrency is the number of files to read metadata from in parallel
+	ScanConcurrency int
+
+	// HashFiles computes the SHA-256 of every media file during the scan
+	HashFiles bool
+
+	// NameEncoding is the encoding of zip entry names not marked as UTF-8.
+	// Empty guesses it per name.
+	NameEncoding string
+}
+
+// New scans a directory or zip file for media files
+func New(ctx context.Context, path string, opts Options) (*Directory, error) {
+	var fsys fs.FS
+	var err error
+
+	if fshelper.IsArchive(path) {
+		fsys, err = fshelper.OpenArchive(path, fshelper.ArchiveOptions{NameEncoding: opts.NameEncoding})
+	} else {
+		fsys = os.DirFS(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open directory: %w", err)
+	}
+
+	if opts.ScanConcurrency < 1 {
+		opts.ScanConcurrency = 1
+	}
+
+	d := &Directory{
+		fsys:       fsys,
+		mediaFiles: make(map[string]*source.MediaFile),
+		extractor:  metadata.NewExtractor(time.UTC),
+		rootPath:   path,
+		options:    opts,
+	}
+
+	if err := d.scan(ctx); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// scan indexes the media files, reading metadata and hashes concurrently
+func (d *Directory) scan(ctx context.Context) error {
+	pool := worker.NewPool(d.options.ScanConcurrency)
+	var wg sync.WaitGroup
+
+	err := fshelper.WalkDir(d.fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if entry.IsDir() || !fileinfo.IsMediaFile(path) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			logger.Warn("Failed to get file info for %s: %v", path, err)
+			return nil
+		}
+
+		mediaFile := &source.MediaFile{
+			Path:    path,
+			Size:    info.Size(),
+			Archive: filepath.Base(d.rootPath),
+		}
+
+		wg.Add(1)
+		pool.Submit(func() {
+			defer wg.Done()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			mediaFile.Metadata = d.extractEmbedded(path)
+
+			if d.options.HashFiles {
+				sum, err := source.HashFile(d.fsys, path)
+				if err != nil {
+					logger.Warn("Failed to hash %s: %v", path, err)
+				} else {
+					mediaFile.SHA256 = sum
+				}
+			}
+
+			d.mu.Lock()
+			d.mediaFiles[path] = mediaFile
+			d.mu.Unlock()
+		})
+
+		return nil
+	})
+
+	// Wait for in-flight extractions before reporting the outcome
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	source.PairLivePhotos(d.mediaFiles)
+	return nil
+}
+
+// extractEmbedded reads the EXIF data of an image or the atoms of a video,
+// returning nil if the file has no metadata
+func (d *Directory) extractEmbedded(path string) *metadata.Metadata {
+	meta, err := d.extractor.ExtractEmbedded(d.fsys, path)
+	if err != nil {
+		logger.Debug("No embedded metadata for %s: %v", path, err)
+		return nil
+	}
+	return meta
+}
+
+// ListFiles returns all media files in the directory, sorted by path
+func (d *Directory) ListFiles() []*source.MediaFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return source.SortedFiles(d.mediaFiles)
+}
+
+// OpenFile opens a file from the directory
+func (d *Directory) OpenFile(path string) (io.ReadCloser, error) {
+	return d.fsys.Open(path)
+}
+
+// GetMetadata returns the embedded metadata for a file
+func (d *Directory) GetMetadata(path string) *metadata.Metadata {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if file, ok := d.mediaFiles[path]; ok {
+		return file.Metadata
+	}
+	return nil
+}
+
+// GetSize returns the size of a file
+func (d *Directory) GetSize(path string) int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if file, ok := d.mediaFiles[path]; ok {
+		return file.Size
+	}
+	return 0
+}
+
+// Close releases the archive the files are read from
+func (d *Directory) Close() error {
+	if closer, ok := d.fsys.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
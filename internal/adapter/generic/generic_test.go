@@ -0,0 +1,42 @@
+package generic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_ListsMediaFilesWithRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"2021/beach.mp4":            "video",
+		"2021/Trip/notes.txt":       "not media",
+		"2021/Trip/sunset.png":      "image",
+		"2021/Trip/sunset.png.json": `{"title": "sunset.png"}`,
+		"top.gif":                   "image",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	d, err := New(context.Background(), dir, Options{ScanConcurrency: 2, HashFiles: true})
+	require.NoError(t, err)
+
+	var paths []string
+	for _, file := range d.ListFiles() {
+		paths = append(paths, file.Path)
+		assert.NotEmpty(t, file.SHA256, file.Path)
+	}
+	assert.Equal(t, []string{"2021/Trip/sunset.png", "2021/beach.mp4", "top.gif"}, paths)
+
+	// Sidecar JSON is not resolved, so there is no metadata without EXIF data
+	assert.Nil(t, d.GetMetadata("2021/Trip/sunset.png"))
+	assert.Equal(t, int64(len("video")), d.GetSize("2021/beach.mp4"))
+	assert.Equal(t, int64(0), d.GetSize("2021/Trip/notes.txt"))
+}
@@ -0,0 +1,117 @@
+package googletakeout
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
+)
+
+// IgnoreFile is the name of the file at the root of an archive that lists
+// glob patterns of paths to leave out of the scan
+const IgnoreFile = ".s3takeoutignore"
+
+// ignoreRule is one pattern of an ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool // re-includes paths that an earlier rule ignored
+	dirOnly  bool // only matches directories, with a trailing "/"
+	anchored bool // only matches from the archive root, with a leading "/"
+}
+
+// ignoreRules decides which paths an ignore file leaves out. Like
+// .gitignore, the last rule matching a path or one of its parent directories
+// wins, so "!" can re-include a file inside an ignored folder.
+type ignoreRules []ignoreRule
+
+// readIgnoreFile reads the ignore file at the root of fsys, returning no rules
+// if there isn't one
+func readIgnoreFile(fsys fs.FS) (ignoreRules, error) {
+	data, err := fs.ReadFile(fsys, IgnoreFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFile, err)
+	}
+	return parseIgnoreRules(data)
+}
+
+// parseIgnoreRules parses the lines of an ignore file. Blank lines and lines
+// starting with "#" are skipped.
+func parseIgnoreRules(data []byte) (ignoreRules, error) {
+	var rules ignoreRules
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if rest, ok := strings.CutPrefix(text, "!"); ok {
+			rule.negate = true
+			text = rest
+		}
+		if rest, ok := strings.CutSuffix(text, "/"); ok {
+			rule.dirOnly = true
+			text = rest
+		}
+		if rest, ok := strings.CutPrefix(text, "/"); ok {
+			rule.anchored = true
+			text = rest
+		}
+
+		if _, err := path.Match(text, ""); err != nil || text == "" {
+			return nil, fmt.Errorf("invalid pattern %q on line %d of %s", scanner.Text(), line, IgnoreFile)
+		}
+		rule.pattern = text
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFile, err)
+	}
+	return rules, nil
+}
+
+// Ignored reports whether the rules leave out a file at path p in the archive
+func (r ignoreRules) Ignored(p string) bool {
+	ignored := false
+	for _, rule := range r {
+		if rule.matches(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the rule matches the file or one of its parent
+// directories
+func (rule ignoreRule) matches(p string) bool {
+	if !rule.dirOnly && rule.matchPath(p) {
+		return true
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if rule.matchPath(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a single path against the pattern
+func (rule ignoreRule) matchPath(p string) bool {
+	if rule.anchored && !strings.Contains(rule.pattern, "/") {
+		// Anchored to the root, so the pattern must match the whole path
+		matched, _ := path.Match(rule.pattern, p)
+		return matched
+	}
+	return fshelper.MatchGlob(rule.pattern, p)
+}
@@ -0,0 +1,62 @@
+package googletakeout
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreRules_Ignored(t *testing.T) {
+	rules, err := parseIgnoreRules([]byte(`
+# Screenshots and the trash are not worth keeping
+Screenshot_*.png
+Takeout/Google Photos/Trash/
+!Takeout/Google Photos/Trash/keep.jpg
+
+/*.html
+**/Archive/**
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"Takeout/Google Photos/Photos from 2023/Screenshot_20230101.png", true},
+		{"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg", false},
+		{"Takeout/Google Photos/Trash/IMG_0002.jpg", true},
+		{"Takeout/Google Photos/Trash/keep.jpg", false},
+		{"Takeout/Google Photos/Trash", false}, // only folders match a trailing slash
+		{"index.html", true},
+		{"Takeout/index.html", false},
+		{"Takeout/Google Photos/Archive/IMG_0003.jpg", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, rules.Ignored(tt.path), tt.path)
+	}
+}
+
+func TestParseIgnoreRules_InvalidPattern(t *testing.T) {
+	_, err := parseIgnoreRules([]byte("*.jpg\n[\n"))
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = parseIgnoreRules([]byte("!\n"))
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestNew_IgnoreFile(t *testing.T) {
+	dir := writeTakeout(t, map[string]string{
+		IgnoreFile: "**/Trash/\n*.png\n",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg": "jpeg",
+		"Takeout/Google Photos/Photos from 2023/IMG_0002.png": "png",
+		"Takeout/Google Photos/Trash/IMG_0003.jpg":            "jpeg",
+	})
+
+	takeout, err := New(context.Background(), dir, Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg"}, listedPaths(takeout))
+}
@@ -6,65 +6,121 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
 	"github.com/bstardust/google-takeout-s3-importer/internal/fileinfo"
 	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
 	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
 	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
 )
 
-// Takeout represents a Google Takeout archive
+// Takeout is a source for a Google Takeout archive, with metadata resolved
+// from the JSON sidecar files and EXIF data
 type Takeout struct {
 	fsys        fs.FS
-	mediaFiles  map[string]*MediaFile
+	mu          sync.RWMutex
+	mediaFiles  map[string]*source.MediaFile
 	extractor   *metadata.Extractor
 	archivePath string // Add this field to track the source archive
+	options     Options
 }
 
-// MediaFile represents a media file in the takeout
-type MediaFile struct {
-	Path     string
-	Metadata *metadata.Metadata
-	Size     int64
-	Archive  string // Add this field to track source archive
+var _ source.Source = (*Takeout)(nil)
+
+// Options configures how a takeout is scanned
+type Options struct {
+	// ScanConcurrency is the number of files to extract metadata from in parallel
+	ScanConcurrency int
+
+	// HashFiles computes the SHA-256 of every media file during the scan
+	HashFiles bool
+
+	// UploadMetadataJSON lists the JSON sidecars as files of their own, with
+	// the metadata of the media file they describe
+	UploadMetadataJSON bool
+
+	// NameEncoding is the encoding of zip entry names not marked as UTF-8.
+	// Empty guesses it per name.
+	NameEncoding string
+
+	// TimeDivergence is how far the capture times of a JSON sidecar and its
+	// media file may be apart before a warning is logged. Zero turns the
+	// check off.
+	TimeDivergence time.Duration
 }
 
 // New creates a new Takeout adapter
-func New(ctx context.Context, path string, isZip bool) (*Takeout, error) {
+func New(ctx context.Context, path string, opts Options) (*Takeout, error) {
+	return NewFromParts(ctx, []string{path}, opts)
+}
+
+// NewFromParts creates a Takeout adapter for an export split into numbered
+// archives. The parts are scanned as one, since a JSON sidecar can be in a
+// different part than its media file.
+func NewFromParts(ctx context.Context, parts []string, opts Options) (*Takeout, error) {
 	var fsys fs.FS
 	var err error
 
-	if isZip {
-		fsys, err = fshelper.OpenZip(path)
-	} else {
+	path := parts[0]
+	if len(parts) == 1 && !fshelper.IsArchive(path) {
 		fsys = os.DirFS(path)
+	} else {
+		fsys, err = fshelper.OpenArchiveParts(parts, fshelper.ArchiveOptions{NameEncoding: opts.NameEncoding})
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to open takeout: %w", err)
 	}
 
+	if opts.ScanConcurrency < 1 {
+		opts.ScanConcurrency = 1
+	}
+
 	t := &Takeout{
 		fsys:        fsys,
-		mediaFiles:  make(map[string]*MediaFile),
+		mediaFiles:  make(map[string]*source.MediaFile),
 		extractor:   metadata.NewExtractor(time.UTC),
 		archivePath: path, // Store the archive path
+		options:     opts,
 	}
+	t.extractor.SetTimeDivergence(opts.TimeDivergence)
 
 	if err := t.scanTakeout(ctx); err != nil {
+		t.Close()
 		return nil, err
 	}
 
 	return t, nil
 }
 
-// scanTakeout scans the takeout archive and builds the media file index
+// scanTakeout scans the takeout archive and builds the media file index.
+// Metadata extraction runs concurrently on a bounded worker pool.
 func (t *Takeout) scanTakeout(ctx context.Context) error {
+	pool := worker.NewPool(t.options.ScanConcurrency)
+	var wg sync.WaitGroup
+
+	// Album metadata by the directory it describes
+	albums := make(map[string]*metadata.Album)
+
+	// JSON files are sorted into sidecars and artifacts once all media files are known
+	var jsonFiles []*source.MediaFile
+	artifacts := 0
+
+	ignore, err := readIgnoreFile(t.fsys)
+	if err != nil {
+		return err
+	}
+	ignored := 0
+
 	// Walk through the filesystem
-	return fshelper.WalkDir(t.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+	err = fshelper.WalkDir(t.fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -77,40 +133,219 @@ func (t *Takeout) scanTakeout(ctx context.Context) error {
 			return nil
 		}
 
+		if ignore.Ignored(path) {
+			logger.Debug("Skipping %s, which matches %s", path, IgnoreFile)
+			ignored++
+			return nil
+		}
+
+		if dir, ok := metadata.AlbumDir(path); ok {
+			if isYearFolder(dir) {
+				logger.Debug("Skipping metadata of year folder %s", dir)
+				artifacts++
+				return nil
+			}
+			if album := t.readAlbum(path); album != nil {
+				albums[dir] = album
+			}
+			return nil
+		}
+
+		if fileinfo.IsArtifact(path) {
+			logger.Debug("Skipping Takeout artifact %s", path)
+			artifacts++
+			return nil
+		}
+
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			info, err := d.Info()
+			if err != nil {
+				logger.Warn("Failed to get file info for %s: %v", path, err)
+				return nil
+			}
+			jsonFiles = append(jsonFiles, &source.MediaFile{
+				Path:    path,
+				Size:    info.Size(),
+				Archive: t.archiveName(path),
+			})
+			return nil
+		}
+
 		// Check if it's a media file
-		if fileinfo.IsMediaFile(path) && !strings.HasSuffix(path, ".json") {
+		if fileinfo.IsMediaFile(path) {
 			info, err := d.Info()
 			if err != nil {
 				logger.Warn("Failed to get file info for %s: %v", path, err)
 				return nil
 			}
 
-			t.mediaFiles[path] = &MediaFile{
+			mediaFile := &source.MediaFile{
 				Path:    path,
 				Size:    info.Size(),
-				Archive: filepath.Base(t.archivePath), // Set the archive name
+				Archive: t.archiveName(path),
+			}
+
+			wg.Add(1)
+			pool.Submit(func() {
+				defer wg.Done()
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				// Extract metadata
+				meta, err := t.extractor.ExtractFromFile(t.fsys, path)
+				if err != nil {
+					logger.Warn("Failed to extract metadata for %s: %v", path, err)
+				} else {
+					mediaFile.Metadata = meta
+				}
+
+				if t.options.HashFiles {
+					sum, err := source.HashFile(t.fsys, path)
+					if err != nil {
+						logger.Warn("Failed to hash %s: %v", path, err)
+					} else {
+						mediaFile.SHA256 = sum
+					}
+				}
+
+				t.mu.Lock()
+				t.mediaFiles[path] = mediaFile
+				t.mu.Unlock()
+			})
+		}
+
+		return nil
+	})
+
+	// Wait for in-flight extractions before reporting the outcome
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if ignored > 0 {
+		logger.Info("Skipped %d files matching %s in archive %s", ignored, IgnoreFile, filepath.Base(t.archivePath))
+	}
+
+	t.applyAlbums(albums)
+	source.PairLivePhotos(t.mediaFiles)
+
+	sidecars, jsonArtifacts := t.addSidecars(jsonFiles)
+	artifacts += jsonArtifacts
+	if artifacts > 0 || sidecars > 0 {
+		logger.Info("Skipped %d Takeout artifacts and %d JSON sidecars in archive %s",
+			artifacts, sidecars, filepath.Base(t.archivePath))
+	}
+	return nil
+}
+
+// addSidecars lists the JSON sidecars as files to upload if that is enabled,
+// returning the number of sidecars skipped and of JSON files that aren't
+// sidecars
+func (t *Takeout) addSidecars(jsonFiles []*source.MediaFile) (skipped int, artifacts int) {
+	for _, file := range jsonFiles {
+		// Sidecars may name the extension in another case than the media file
+		mediaPath, _ := metadata.SidecarMedia(file.Path)
+		var media *source.MediaFile
+		var ok bool
+		for _, candidate := range metadata.ExtCaseVariants(mediaPath) {
+			if media, ok = t.mediaFiles[candidate]; ok {
+				break
 			}
+		}
+		if !ok {
+			logger.Debug("Skipping Takeout artifact %s", file.Path)
+			artifacts++
+			continue
+		}
+
+		if !t.options.UploadMetadataJSON {
+			skipped++
+			continue
+		}
 
-			// Extract metadata
-			meta, err := t.extractor.ExtractFromFile(t.fsys, path)
+		// Share the metadata so key templates put the sidecar next to its media file
+		file.Metadata = media.Metadata
+		if t.options.HashFiles {
+			sum, err := source.HashFile(t.fsys, file.Path)
 			if err != nil {
-				logger.Warn("Failed to extract metadata for %s: %v", path, err)
+				logger.Warn("Failed to hash %s: %v", file.Path, err)
 			} else {
-				t.mediaFiles[path].Metadata = meta
+				file.SHA256 = sum
 			}
 		}
+		t.mediaFiles[file.Path] = file
+	}
+	return skipped, artifacts
+}
+
+// archiveName returns the name of the archive a file is in, which is the
+// part it is read from for a split export
+func (t *Takeout) archiveName(path string) string {
+	if parts, ok := t.fsys.(*fshelper.MultiFS); ok {
+		if part := parts.Part(path); part != "" {
+			return part
+		}
+	}
+	return filepath.Base(t.archivePath)
+}
 
+// yearFolderPattern matches the folders Google Photos sorts files into by the
+// year they were taken, which aren't albums even if they have a metadata.json
+var yearFolderPattern = regexp.MustCompile(`^Photos from [0-9]{4}$`)
+
+// isYearFolder reports whether a directory is a "Photos from YYYY" folder
+func isYearFolder(dir string) bool {
+	return yearFolderPattern.MatchString(path.Base(dir))
+}
+
+// readAlbum reads the metadata of an album, returning nil if it can't be read
+func (t *Takeout) readAlbum(path string) *metadata.Album {
+	file, err := t.fsys.Open(path)
+	if err != nil {
+		logger.Warn("Failed to open album metadata %s: %v", path, err)
 		return nil
-	})
+	}
+	defer file.Close()
+
+	album, err := t.extractor.ExtractAlbum(file)
+	if err != nil {
+		logger.Warn("Failed to read album metadata %s: %v", path, err)
+		return nil
+	}
+	return album
 }
 
-// ListFiles returns all media files in the takeout
-func (t *Takeout) ListFiles() []*MediaFile {
-	var files []*MediaFile
+// applyAlbums adds the album of its directory to the metadata of each file
+func (t *Takeout) applyAlbums(albums map[string]*metadata.Album) {
+	if len(albums) == 0 {
+		return
+	}
+
 	for _, file := range t.mediaFiles {
-		files = append(files, file)
+		album, ok := albums[path.Dir(file.Path)]
+		if !ok {
+			continue
+		}
+		if file.Metadata == nil {
+			file.Metadata = &metadata.Metadata{}
+		}
+		file.Metadata.AddAlbum(album)
 	}
-	return files
+}
+
+// ListFiles returns all media files in the takeout, sorted by path
+func (t *Takeout) ListFiles() []*source.MediaFile {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return source.SortedFiles(t.mediaFiles)
 }
 
 // OpenFile opens a file from the takeout
@@ -124,6 +359,9 @@ func (t *Takeout) OpenFile(path string) (io.ReadCloser, error) {
 
 // GetMetadata returns the metadata for a file
 func (t *Takeout) GetMetadata(path string) *metadata.Metadata {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
 	if file, ok := t.mediaFiles[path]; ok {
 		return file.Metadata
 	}
@@ -132,8 +370,19 @@ func (t *Takeout) GetMetadata(path string) *metadata.Metadata {
 
 // GetSize returns the size of a file
 func (t *Takeout) GetSize(path string) int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
 	if file, ok := t.mediaFiles[path]; ok {
 		return file.Size
 	}
 	return 0
 }
+
+// Close releases the archive the files are read from
+func (t *Takeout) Close() error {
+	if closer, ok := t.fsys.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package googletakeout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTakeout(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func listedPaths(t *Takeout) []string {
+	var paths []string
+	for _, file := range t.ListFiles() {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+func TestNew_SkipsArtifacts(t *testing.T) {
+	dir := writeTakeout(t, map[string]string{
+		"Takeout/archive_browser.html":                                      "<html>",
+		"Takeout/Google Photos/print-subscriptions.vcf":                     "BEGIN:VCARD",
+		"Takeout/Google Photos/user-generated-memory-titles.json":           "{}",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg":               "jpeg",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json":          `{"title":"IMG_0001.jpg","photoTakenTime":{"timestamp":"1672531200"}}`,
+		"Takeout/Google Photos/Photos from 2023/PXL_20230101_120000000.MP":  "mp4",
+		"Takeout/Google Photos/Photos from 2023/PXL_20230101_120000000.MP~": "partial",
+	})
+
+	takeout, err := New(context.Background(), dir, Options{ScanConcurrency: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg",
+		"Takeout/Google Photos/Photos from 2023/PXL_20230101_120000000.MP",
+	}, listedPaths(takeout))
+}
+
+func TestNew_UploadMetadataJSON(t *testing.T) {
+	dir := writeTakeout(t, map[string]string{
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg":      "jpeg",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json": `{"title":"IMG_0001.jpg","photoTakenTime":{"timestamp":"1672531200"}}`,
+		"Takeout/Google Photos/shared_album_comments.json":         "{}",
+		"Takeout/Google Photos/orphan.jpg.json":                    "{}",
+	})
+
+	takeout, err := New(context.Background(), dir, Options{ScanConcurrency: 1, UploadMetadataJSON: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json",
+	}, listedPaths(takeout))
+
+	// The sidecar carries the metadata of its photo
+	media := takeout.GetMetadata("Takeout/Google Photos/Photos from 2023/IMG_0001.jpg")
+	require.NotNil(t, media)
+	assert.Same(t, media, takeout.GetMetadata("Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json"))
+}
+
+func TestNew_Albums(t *testing.T) {
+	dir := writeTakeout(t, map[string]string{
+		"Takeout/Google Photos/Trip to Rome/IMG_0001.jpg":      "jpeg",
+		"Takeout/Google Photos/Trip to Rome/metadata.json":     `{"title":"Trip to Rome"}`,
+		"Takeout/Google Photos/Photos from 2023/IMG_0002.jpg":  "jpeg",
+		"Takeout/Google Photos/Photos from 2023/metadata.json": `{"title":"Photos from 2023"}`,
+	})
+
+	takeout, err := New(context.Background(), dir, Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	meta := takeout.GetMetadata("Takeout/Google Photos/Trip to Rome/IMG_0001.jpg")
+	require.NotNil(t, meta)
+	assert.Equal(t, []string{"Trip to Rome"}, meta.Albums)
+
+	// Year folders aren't albums
+	meta = takeout.GetMetadata("Takeout/Google Photos/Photos from 2023/IMG_0002.jpg")
+	if meta != nil {
+		assert.Empty(t, meta.Albums)
+	}
+}
+
+func TestNew_SidecarNames(t *testing.T) {
+	dir := writeTakeout(t, map[string]string{
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.HEIC":                           "heic",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.heic.json":                      `{"title":"IMG_0001.HEIC","description":"lower case"}`,
+		"Takeout/Google Photos/Photos from 2023/img_0002.mov":                            "mov",
+		"Takeout/Google Photos/Photos from 2023/img_0002.MOV.supplemental-metadata.json": `{"title":"img_0002.MOV","description":"upper case"}`,
+		"Takeout/Google Photos/Photos from 2023/IMG_0003.HEIC":                           "heic",
+		"Takeout/Google Photos/Photos from 2023/IMG_0003.MOV":                            "mov",
+		"Takeout/Google Photos/Photos from 2023/IMG_0003.HEIC.json":                      `{"title":"IMG_0003.HEIC","description":"live photo"}`,
+	})
+
+	takeout, err := New(context.Background(), dir, Options{ScanConcurrency: 1, UploadMetadataJSON: true})
+	require.NoError(t, err)
+
+	folder := "Takeout/Google Photos/Photos from 2023/"
+	for path, want := range map[string]string{
+		"IMG_0001.HEIC": "lower case",
+		"img_0002.mov":  "upper case",
+		"IMG_0003.HEIC": "live photo",
+		"IMG_0003.MOV":  "live photo",
+	} {
+		meta := takeout.GetMetadata(folder + path)
+		require.NotNil(t, meta, path)
+		assert.Equal(t, want, meta.Description, path)
+	}
+
+	// The video isn't titled after the photo whose sidecar it shares
+	assert.NotEqual(t, "IMG_0003.HEIC", takeout.GetMetadata(folder+"IMG_0003.MOV").Title)
+
+	// Sidecars whose extension differs in case are still listed next to their file
+	assert.Contains(t, listedPaths(takeout), folder+"IMG_0001.heic.json")
+	assert.Contains(t, listedPaths(takeout), folder+"img_0002.MOV.supplemental-metadata.json")
+}
@@ -0,0 +1,54 @@
+package source
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/fileinfo"
+)
+
+// pixelMotionMarker is the suffix Pixel phones add before the extension of
+// both halves of a Motion Photo, e.g. PXL_20230101_120000000.MP.jpg
+const pixelMotionMarker = ".mp"
+
+// livePhotoBase returns the path of a file without its extension and any
+// Motion Photo marker, which is shared by the still and video of a pair
+func livePhotoBase(p string) string {
+	base := strings.TrimSuffix(p, path.Ext(p))
+	if strings.HasSuffix(strings.ToLower(base), pixelMotionMarker) {
+		base = base[:len(base)-len(pixelMotionMarker)]
+	}
+	return base
+}
+
+// PairLivePhotos links Pixel Motion Photos and iPhone Live Photos, which are
+// exported as an image and a video with the same base name in the same
+// directory. Only unambiguous pairs of exactly one image and one video are linked.
+func PairLivePhotos(files map[string]*MediaFile) {
+	groups := make(map[string][]*MediaFile)
+	for p, file := range files {
+		key := strings.ToLower(livePhotoBase(p))
+		groups[key] = append(groups[key], file)
+	}
+
+	for _, group := range groups {
+		if len(group) != 2 {
+			continue
+		}
+
+		image, video := group[0], group[1]
+		if fileinfo.IsVideoFile(image.Path) {
+			image, video = video, image
+		}
+		if !fileinfo.IsImageFile(image.Path) || !fileinfo.IsVideoFile(video.Path) {
+			continue
+		}
+
+		// Name the group after the still image so both halves share it
+		groupName := livePhotoBase(image.Path)
+		image.LivePhotoGroup = groupName
+		image.RelatedFiles = []string{video.Path}
+		video.LivePhotoGroup = groupName
+		video.RelatedFiles = []string{image.Path}
+	}
+}
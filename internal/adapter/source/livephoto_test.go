@@ -0,0 +1,58 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairLivePhotos(t *testing.T) {
+	paths := []string{
+		// Pixel Motion Photo
+		"Photos from 2023/PXL_20230101_120000000.MP.jpg",
+		"Photos from 2023/PXL_20230101_120000000.MP.mp4",
+		// Older Pixel naming without the marker on the video
+		"Photos from 2019/IMG_20190101_123456.jpg",
+		"Photos from 2019/IMG_20190101_123456.MP4",
+		// iPhone Live Photo
+		"Photos from 2022/IMG_1234.HEIC",
+		"Photos from 2022/IMG_1234.MOV",
+		// Same name in another directory is not a pair
+		"Trip/IMG_5678.JPG",
+		"Photos from 2022/IMG_5678.MOV",
+		// Two images are not a pair
+		"Photos from 2022/IMG_9999.jpg",
+		"Photos from 2022/IMG_9999.png",
+	}
+
+	files := make(map[string]*MediaFile)
+	for _, p := range paths {
+		files[p] = &MediaFile{Path: p}
+	}
+
+	PairLivePhotos(files)
+
+	tests := []struct {
+		image string
+		video string
+		group string
+	}{
+		{"Photos from 2023/PXL_20230101_120000000.MP.jpg", "Photos from 2023/PXL_20230101_120000000.MP.mp4", "Photos from 2023/PXL_20230101_120000000"},
+		{"Photos from 2019/IMG_20190101_123456.jpg", "Photos from 2019/IMG_20190101_123456.MP4", "Photos from 2019/IMG_20190101_123456"},
+		{"Photos from 2022/IMG_1234.HEIC", "Photos from 2022/IMG_1234.MOV", "Photos from 2022/IMG_1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.group, files[tt.image].LivePhotoGroup)
+			assert.Equal(t, tt.group, files[tt.video].LivePhotoGroup)
+			assert.Equal(t, []string{tt.video}, files[tt.image].RelatedFiles)
+			assert.Equal(t, []string{tt.image}, files[tt.video].RelatedFiles)
+		})
+	}
+
+	for _, p := range paths[6:] {
+		assert.Empty(t, files[p].LivePhotoGroup, p)
+		assert.Empty(t, files[p].RelatedFiles, p)
+	}
+}
@@ -0,0 +1,67 @@
+// Package source defines the media sources the uploader reads from and the
+// helpers shared by their implementations.
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"sort"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+)
+
+// Source is a collection of media files to upload
+type Source interface {
+	// ListFiles returns all media files, sorted by path
+	ListFiles() []*MediaFile
+	// OpenFile opens a media file for reading
+	OpenFile(path string) (io.ReadCloser, error)
+	// GetMetadata returns the metadata for a file, or nil if there is none
+	GetMetadata(path string) *metadata.Metadata
+	// GetSize returns the size of a file in bytes
+	GetSize(path string) int64
+}
+
+// MediaFile represents a media file in a source
+type MediaFile struct {
+	Path     string
+	Metadata *metadata.Metadata
+	Size     int64
+	Archive  string // Name of the archive or directory the file came from
+	SHA256   string // Hex encoded content hash, set when hashing is enabled
+
+	// RelatedFiles are the other halves of a Motion Photo or Live Photo, and
+	// LivePhotoGroup is the path without extension that all of them share
+	RelatedFiles   []string
+	LivePhotoGroup string
+}
+
+// SortedFiles returns the files of an index sorted by path
+func SortedFiles(files map[string]*MediaFile) []*MediaFile {
+	sorted := make([]*MediaFile, 0, len(files))
+	for _, file := range files {
+		sorted = append(sorted, file)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	return sorted
+}
+
+// HashFile streams a file through SHA-256 and returns the hex encoded sum
+func HashFile(fsys fs.FS, path string) (string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -1,55 +1,237 @@
 package config
 
-import (
-	"time"
+import "time"
+
+// Source types accepted by --source-type
+const (
+	// SourceTypeTakeout reads a Google Takeout export and its JSON sidecars
+	SourceTypeTakeout = "takeout"
+
+	// SourceTypeGeneric uploads every media file as is, using EXIF metadata only
+	SourceTypeGeneric = "generic"
+)
+
+// Modes accepted by --transcode-heic
+const (
+	// TranscodeHEICAlongside uploads a JPEG copy next to each HEIC photo
+	TranscodeHEICAlongside = "alongside"
+
+	// TranscodeHEICReplace uploads a JPEG in place of each HEIC photo
+	TranscodeHEICReplace = "replace"
+)
+
+// Modes accepted by --flatten
+const (
+	// FlattenTakeout drops the Takeout/Google Photos/ folders from object keys
+	FlattenTakeout = "takeout"
+
+	// FlattenAlbum keeps only the folder a file is in, its album or year
+	FlattenAlbum = "album"
+)
+
+// Policies accepted by --no-date-policy
+const (
+	// NoDateInclude uploads files without a capture date whatever the date range
+	NoDateInclude = "include"
+
+	// NoDateExclude leaves files without a capture date out of a date range
+	NoDateExclude = "exclude"
+)
+
+// Shorthands accepted by --only-types besides extensions
+const (
+	// OnlyTypesImages stands for every image format, such as jpg and heic
+	OnlyTypesImages = "images"
+
+	// OnlyTypesVideos stands for every video format, such as mp4 and mov
+	OnlyTypesVideos = "videos"
+)
+
+// Orders accepted by --sort-by
+const (
+	// SortByPath uploads the files of an archive in order of their path
+	SortByPath = "path"
+
+	// SortByDate uploads the oldest photos first and files without a
+	// capture date last
+	SortByDate = "date"
+
+	// SortBySize uploads the smallest files first
+	SortBySize = "size"
+)
+
+// Policies accepted by --metadata-overflow
+const (
+	// MetadataOverflowTrim drops the least useful fields until the metadata fits
+	MetadataOverflowTrim = "trim"
+
+	// MetadataOverflowSidecar stores the full metadata in a JSON object next
+	// to the file and keeps only the essential fields on it
+	MetadataOverflowSidecar = "sidecar"
+
+	// MetadataOverflowError fails the upload of the file
+	MetadataOverflowError = "error"
+)
+
+// Modes accepted by --sanitize-keys
+const (
+	// SanitizeKeysPassthrough stores keys as they are
+	SanitizeKeysPassthrough = "passthrough"
+
+	// SanitizeKeysPercentEncode percent-encodes the characters S3 or its
+	// clients mishandle, which can be decoded back to the original path
+	SanitizeKeysPercentEncode = "percent-encode"
+
+	// SanitizeKeysReplace replaces those characters with an underscore
+	SanitizeKeysReplace = "replace"
 )
 
 // Config represents the application configuration
 type Config struct {
-	LogLevel string
-	S3       S3Config
-	Upload   UploadConfig
+	LogLevel   string
+	LogFormat  string
+	ConfigFile string
+	S3         S3Config
+	Upload     UploadConfig
 }
 
 // S3Config represents S3 connection configuration
 type S3Config struct {
-	Endpoint         string
-	Region           string
-	Bucket           string
-	AccessKey        string
-	SecretKey        string
-	UseSSL           bool
-	Prefix           string
-	DisableChecksums bool
+	Endpoint           string
+	Region             string
+	Bucket             string
+	AccessKey          string
+	SecretKey          string
+	AccessKeyFile      string
+	SecretKeyFile      string
+	SecretKeyStdin     bool
+	SessionToken       string
+	Profile            string
+	UseInstanceRole    bool
+	UseSSL             bool
+	Prefix             string
+	DisableChecksums   bool
+	PathStyle          bool
+	MultipartThreshold int64
+	PartSize           int64
+	PartConcurrency    int
+	ACL                string
+	CreateBucket       bool
+	Backend            string
+	CACert             string
+	TLSSkipVerify      bool
+	MaxIdleConns       int
+	MaxConnsPerHost    int
 }
 
 // UploadConfig represents upload configuration
 type UploadConfig struct {
 	Concurrency           int
 	MaxConcurrentArchives int
+	MaxTotalUploads       int
+	ScanConcurrency       int
 	DryRun                bool
+	DryRunFormat          string
+	Plan                  bool
 	Resume                bool
+	VerifyOnResume        bool
+	RetryFailedOnly       bool
 	JournalPath           string
 	PreserveMetadata      bool
+	PreserveTimestamps    bool
+	StripGPS              bool
+	BlurGPS               float64
+	TimeDivergence        time.Duration
 	SkipExisting          bool
+	Overwrite             bool
+	ListExisting          bool
+	ListExistingMax       int
+	AbortIncomplete       bool
+	Dedupe                bool
+	VerifyChecksums       bool
+	ObjectTags            bool
+	TagSourceArchive      bool
+	SplitLivePhotos       bool
+	UploadMetadataJSON    bool
+	MetadataOverflow      string
+	SidecarMetadata       bool
+	CompressMetadataJSON  bool
+	ContentDisposition    string
+	ContinueOnCorrupt     bool
+	TmpDir                string
+	SpillThreshold        int64
+	TranscodeHEIC         string
+	Manifest              string
+	ErrorLog              string
+	Progress              string
+	MetricsAddr           string
+	WebhookURL            string
+	WebhookOnError        bool
+	SourceType            string
+	KeyEncoding           string
+	KeyTemplate           string
+	PrefixDate            bool
+	Flatten               string
+	SanitizeKeys          string
+	ResumableMultipart    bool
+	Include               []string
+	Exclude               []string
+	OnlyTypes             []string
+	MinSize               int64
+	MaxSize               int64
+	Since                 time.Time
+	Until                 time.Time
+	NoDatePolicy          string
+	SortBy                string
 	Timeout               time.Duration
+	MaxDuration           time.Duration
+	MinUploadRate         int64
+	MaxRetries            int
+	InitialBackoff        time.Duration
+	MaxBackoff            time.Duration
+	BreakerThreshold      int
+	BreakerCooldown       time.Duration
+	MaxBandwidth          int64
 }
 
 // New creates a new configuration with default values
 func New() *Config {
 	return &Config{
-		LogLevel: "info",
+		LogLevel:  "info",
+		LogFormat: "text",
 		S3: S3Config{
-			Region: "us-east-1",
-			UseSSL: true,
+			Region:          "us-east-1",
+			UseSSL:          true,
+			PathStyle:       true,
+			ACL:             "private",
+			PartConcurrency: 4,
 		},
 		Upload: UploadConfig{
 			Concurrency:           4,
 			MaxConcurrentArchives: 3,
+			ScanConcurrency:       4,
+			DryRunFormat:          "text",
 			Resume:                true,
 			PreserveMetadata:      true,
+			PreserveTimestamps:    true,
 			SkipExisting:          true,
+			ListExistingMax:       100000,
+			SplitLivePhotos:       true,
+			Progress:              "log",
+			SourceType:            SourceTypeTakeout,
+			SanitizeKeys:          SanitizeKeysPassthrough,
+			NoDatePolicy:          NoDateInclude,
+			SortBy:                SortByPath,
+			MetadataOverflow:      MetadataOverflowTrim,
+			TimeDivergence:        24 * time.Hour,
+			ContinueOnCorrupt:     true,
+			SpillThreshold:        100 * 1024 * 1024,
 			Timeout:               30 * time.Minute,
+			MaxRetries:            5,
+			InitialBackoff:        1 * time.Second,
+			MaxBackoff:            1 * time.Minute,
+			BreakerThreshold:      20,
+			BreakerCooldown:       1 * time.Minute,
 		},
 	}
 }
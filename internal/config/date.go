@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayout is the layout of dates without a time
+const dateLayout = "2006-01-02"
+
+// ParseDate parses a date such as "2020-01-31", taken as UTC, or an RFC3339
+// time. A date is the start of the day, or its last instant if end is set,
+// so a range that ends on a date includes the whole day.
+func ParseDate(value string, end bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or RFC3339)", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// FormatDate formats a time from ParseDate, as a date if it is the start or
+// the end of a day in UTC
+func FormatDate(t time.Time) string {
+	t = t.UTC()
+	if start := t.Truncate(24 * time.Hour); t.Equal(start) || t.Equal(start.AddDate(0, 0, 1).Add(-time.Nanosecond)) {
+		return start.Format(dateLayout)
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDate(t *testing.T) {
+	since, err := ParseDate("2020-01-31", false)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), since)
+	assert.Equal(t, "2020-01-31", FormatDate(since))
+
+	// A date that ends a range includes the whole day
+	until, err := ParseDate("2020-12-31", true)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 12, 31, 23, 59, 59, 999999999, time.UTC), until)
+	assert.Equal(t, "2020-12-31", FormatDate(until))
+
+	exact, err := ParseDate("2020-06-01T12:30:00+02:00", true)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC), exact.UTC())
+	assert.Equal(t, "2020-06-01T10:30:00Z", FormatDate(exact))
+
+	_, err = ParseDate("31/01/2020", false)
+	assert.ErrorContains(t, err, "invalid date")
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables that map to command-line flags
+const EnvPrefix = "S3TAKEOUT_"
+
+// envAliases are additional environment variables accepted for S3 settings
+var envAliases = map[string]string{
+	"endpoint":          "S3_ENDPOINT",
+	"region":            "S3_REGION",
+	"bucket":            "S3_BUCKET",
+	"access-key":        "S3_ACCESS_KEY",
+	"secret-key":        "S3_SECRET_KEY",
+	"session-token":     "S3_SESSION_TOKEN",
+	"profile":           "S3_PROFILE",
+	"use-ssl":           "S3_USE_SSL",
+	"prefix":            "S3_PREFIX",
+	"disable-checksums": "S3_DISABLE_CHECKSUMS",
+}
+
+// LoadConfig reads settings for the given flag names from an optional YAML or
+// JSON config file and from the environment. The returned values are keyed by
+// flag name, with environment variables taking precedence over the file.
+func LoadConfig(path string, names []string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	if path != "" {
+		fileValues, err := loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+
+	for _, name := range names {
+		if value, ok := lookupEnv(name); ok {
+			values[name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// EnvName returns the environment variable that sets the given flag
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// lookupEnv returns the environment value for a flag, preferring the prefixed
+// variable over the S3_* alias
+func lookupEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(EnvName(name)); ok {
+		return value, true
+	}
+	if alias, ok := envAliases[name]; ok {
+		return os.LookupEnv(alias)
+	}
+	return "", false
+}
+
+// loadFile reads a flat map of flag names to values. JSON is a subset of YAML,
+// so both formats are handled by the YAML decoder.
+func loadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("config file %s: %s must be a single value", path, name)
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+
+	return values, nil
+}
+
+// ResolveCredentials sets the access and secret keys from the files named by
+// AccessKeyFile and SecretKeyFile, or the secret key from stdin with
+// SecretKeyStdin, such as Docker secrets. Surrounding whitespace, including
+// the trailing newline, is trimmed. A key can only come from one source.
+func ResolveCredentials(cfg *S3Config, stdin io.Reader) error {
+	if cfg.SecretKeyStdin && cfg.SecretKeyFile != "" {
+		return fmt.Errorf("--secret-key-file and --secret-key-stdin can't be combined")
+	}
+
+	if cfg.AccessKeyFile != "" {
+		if cfg.AccessKey != "" {
+			return fmt.Errorf("--access-key and --access-key-file can't be combined")
+		}
+		key, err := readSecret("--access-key-file", cfg.AccessKeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.AccessKey = key
+	}
+
+	if cfg.SecretKeyFile != "" {
+		if cfg.SecretKey != "" {
+			return fmt.Errorf("--secret-key and --secret-key-file can't be combined")
+		}
+		key, err := readSecret("--secret-key-file", cfg.SecretKeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.SecretKey = key
+	}
+
+	if cfg.SecretKeyStdin {
+		if cfg.SecretKey != "" {
+			return fmt.Errorf("--secret-key and --secret-key-stdin can't be combined")
+		}
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read the secret key from stdin: %w", err)
+		}
+		if cfg.SecretKey = strings.TrimSpace(string(data)); cfg.SecretKey == "" {
+			return fmt.Errorf("--secret-key-stdin: no secret key on stdin")
+		}
+	}
+
+	return nil
+}
+
+// readSecret reads a key from a file, rejecting empty files
+func readSecret(flag string, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", flag, err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("%s: %s is empty", flag, path)
+	}
+	return key, nil
+}
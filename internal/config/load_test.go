@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+endpoint: s3.example.com
+bucket: from-file
+access-key: file-key
+concurrency: 8
+use-ssl: false
+`), 0600))
+
+	t.Setenv("S3_BUCKET", "from-alias")
+	t.Setenv("S3TAKEOUT_ACCESS_KEY", "prefixed-key")
+	t.Setenv("S3_ACCESS_KEY", "alias-key")
+
+	values, err := LoadConfig(path, []string{"endpoint", "bucket", "access-key", "secret-key"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "s3.example.com", values["endpoint"])
+	assert.Equal(t, "from-alias", values["bucket"])
+	assert.Equal(t, "prefixed-key", values["access-key"])
+	assert.Equal(t, "8", values["concurrency"])
+	assert.Equal(t, "false", values["use-ssl"])
+	assert.NotContains(t, values, "secret-key")
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"bucket": "photos", "max-archives": 2}`), 0600))
+
+	values, err := LoadConfig(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "photos", values["bucket"])
+	assert.Equal(t, "2", values["max-archives"])
+}
+
+func TestLoadConfigRejectsNestedValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("s3:\n  bucket: photos\n"), 0600))
+
+	_, err := LoadConfig(path, nil)
+	assert.Error(t, err)
+}
+
+func TestResolveCredentials(t *testing.T) {
+	dir := t.TempDir()
+	accessFile := filepath.Join(dir, "access_key")
+	secretFile := filepath.Join(dir, "secret_key")
+	emptyFile := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(accessFile, []byte("file-access\n"), 0600))
+	require.NoError(t, os.WriteFile(secretFile, []byte("  file-secret\r\n"), 0600))
+	require.NoError(t, os.WriteFile(emptyFile, []byte("\n"), 0600))
+
+	cfg := &S3Config{AccessKeyFile: accessFile, SecretKeyFile: secretFile}
+	require.NoError(t, ResolveCredentials(cfg, strings.NewReader("")))
+	assert.Equal(t, "file-access", cfg.AccessKey)
+	assert.Equal(t, "file-secret", cfg.SecretKey)
+
+	cfg = &S3Config{AccessKey: "inline", SecretKeyStdin: true}
+	require.NoError(t, ResolveCredentials(cfg, strings.NewReader("stdin-secret\n")))
+	assert.Equal(t, "inline", cfg.AccessKey)
+	assert.Equal(t, "stdin-secret", cfg.SecretKey)
+
+	for _, tt := range []struct {
+		cfg     S3Config
+		wantErr string
+	}{
+		{S3Config{AccessKey: "inline", AccessKeyFile: accessFile}, "--access-key and --access-key-file"},
+		{S3Config{SecretKey: "inline", SecretKeyStdin: true}, "--secret-key and --secret-key-stdin"},
+		{S3Config{SecretKeyFile: secretFile, SecretKeyStdin: true}, "can't be combined"},
+		{S3Config{SecretKeyFile: emptyFile}, "is empty"},
+		{S3Config{AccessKeyFile: filepath.Join(dir, "missing")}, "--access-key-file"},
+		{S3Config{SecretKeyStdin: true}, "no secret key on stdin"},
+	} {
+		cfg := tt.cfg
+		assert.ErrorContains(t, ResolveCredentials(&cfg, strings.NewReader(" ")), tt.wantErr)
+	}
+}
@@ -3,6 +3,7 @@ package exif
 
 import (
 	"io"
+	"math/big"
 	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
@@ -14,6 +15,20 @@ type Data struct {
 	GPS      *GPSInfo
 	Make     string
 	Model    string
+
+	// Orientation is how the image has to be turned to display upright, as
+	// the EXIF values 1 to 8, or 0 if the file doesn't say
+	Orientation int
+
+	// Width and Height are the size of the image in pixels, or 0 if unknown
+	Width  int
+	Height int
+
+	// Exposure settings of the camera, left at zero if not recorded.
+	// ExposureTime is in seconds as a fraction, such as "1/250".
+	FNumber      float64
+	ISO          int
+	ExposureTime string
 }
 
 // GPSInfo represents GPS information from EXIF
@@ -66,5 +81,55 @@ func Extract(r io.Reader) (*Data, error) {
 		}
 	}
 
+	// Extract orientation and image size. Cameras record the size in the
+	// EXIF sub-IFD, while edited files may only have the TIFF width and length.
+	data.Orientation, _ = intField(x, exif.Orientation)
+	if width, ok := intField(x, exif.PixelXDimension); ok {
+		data.Width = width
+	} else {
+		data.Width, _ = intField(x, exif.ImageWidth)
+	}
+	if height, ok := intField(x, exif.PixelYDimension); ok {
+		data.Height = height
+	} else {
+		data.Height, _ = intField(x, exif.ImageLength)
+	}
+
+	// Extract exposure settings
+	if fNumber, ok := ratField(x, exif.FNumber); ok {
+		data.FNumber, _ = fNumber.Float64()
+	}
+	data.ISO, _ = intField(x, exif.ISOSpeedRatings)
+	if exposure, ok := ratField(x, exif.ExposureTime); ok {
+		data.ExposureTime = exposure.RatString()
+	}
+
 	return data, nil
 }
+
+// intField returns the first value of an integer field, if the file has it
+func intField(x *exif.Exif, name exif.FieldName) (int, bool) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0, false
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// ratField returns the first value of a rational field, if the file has it
+// with a denominator that isn't zero
+func ratField(x *exif.Exif, name exif.FieldName) (*big.Rat, bool) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return nil, false
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return nil, false
+	}
+	return big.NewRat(num, den), true
+}
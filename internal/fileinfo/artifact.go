@@ -0,0 +1,55 @@
+package fileinfo
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// takeoutArtifacts are the files Google adds to Takeout exports next to the
+// photos, which are neither media nor sidecars
+var takeoutArtifacts = map[string]bool{
+	"archive_browser.html":              true,
+	"print-subscriptions.json":          true,
+	"print-subscriptions.vcf":           true,
+	"shared_album_comments.json":        true,
+	"user-generated-memory-titles.json": true,
+}
+
+// systemArtifacts are the files operating systems leave in folders
+var systemArtifacts = map[string]bool{
+	".ds_store":   true,
+	"thumbs.db":   true,
+	"desktop.ini": true,
+}
+
+// artifactExtensions are the extensions of files that are never media
+var artifactExtensions = map[string]bool{
+	".html": true,
+	".htm":  true,
+	".vcf":  true,
+	".tmp":  true,
+}
+
+// tempSuffix matches the names editors and downloads give temporary and
+// backup copies, such as PXL_20230101_120000000.MP~ or IMG_1234.jpg~2
+var tempSuffix = regexp.MustCompile(`~\d*$`)
+
+// IsArtifact reports whether a file is one of the non-media files found in
+// Takeout archives and photo folders, such as archive_browser.html, that
+// should be skipped without a warning. JSON sidecars are not artifacts.
+func IsArtifact(p string) bool {
+	name := strings.ToLower(path.Base(p))
+
+	switch {
+	case takeoutArtifacts[name], systemArtifacts[name]:
+		return true
+	case strings.HasPrefix(name, "._"):
+		// AppleDouble files holding macOS resource forks
+		return true
+	case tempSuffix.MatchString(name):
+		return true
+	default:
+		return artifactExtensions[path.Ext(name)]
+	}
+}
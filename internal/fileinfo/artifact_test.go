@@ -0,0 +1,35 @@
+package fileinfo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsArtifact(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"Takeout/archive_browser.html", true},
+		{"Takeout/Google Photos/print-subscriptions.vcf", true},
+		{"Takeout/Google Photos/user-generated-memory-titles.json", true},
+		{"Takeout/Google Photos/Photos from 2023/PXL_20230101_120000000.MP~", true},
+		{"Takeout/Google Photos/Photos from 2023/IMG_1234.jpg~2", true},
+		{"Takeout/Google Photos/Photos from 2023/._IMG_1234.jpg", true},
+		{"Takeout/Google Photos/.DS_Store", true},
+		{"Takeout/Google Photos/Photos from 2023/IMG_1234.jpg", false},
+		{"Takeout/Google Photos/Photos from 2023/IMG_1234.jpg.json", false},
+		{"Takeout/Google Photos/Photos from 2023/PXL_20230101_120000000.MP", false},
+		{"Takeout/Google Photos/Vacation/metadata.json", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsArtifact(tt.path), tt.path)
+	}
+}
+
+func TestIsVideoFile_MotionPhoto(t *testing.T) {
+	assert.True(t, IsVideoFile("PXL_20230101_120000000.MP"))
+	assert.Equal(t, "video/mp4", GetContentType("PXL_20230101_120000000.MP"))
+}
@@ -83,13 +83,13 @@ func ParsePath(paths []string) ([]fs.FS, error) {
 					FS:   fsys,
 					name: filepath.Base(match),
 				})
-			} else if strings.HasSuffix(strings.ToLower(match), ".zip") {
-				// It's a zip file
-				zipFS, err := OpenZip(match)
+			} else if IsArchive(match) {
+				// It's a zip or tar file
+				archiveFS, err := OpenArchive(match, ArchiveOptions{})
 				if err != nil {
-					return nil, fmt.Errorf("error opening zip file %s: %w", match, err)
+					return nil, fmt.Errorf("error opening archive %s: %w", match, err)
 				}
-				fsyss = append(fsyss, zipFS)
+				fsyss = append(fsyss, archiveFS)
 			} else {
 				return nil, fmt.Errorf("unsupported file type: %s", match)
 			}
@@ -99,8 +99,35 @@ func ParsePath(paths []string) ([]fs.FS, error) {
 	return fsyss, nil
 }
 
-// OpenZip opens a zip file and returns a filesystem
-func OpenZip(path string) (fs.FS, error) {
+// IsArchive reports whether a path names a zip or gzipped tar archive
+func IsArchive(path string) bool {
+	return isZip(path) || isTarGz(path)
+}
+
+func isZip(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".zip")
+}
+
+func isTarGz(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".tar.gz")
+}
+
+// OpenArchive opens a zip or gzipped tar archive, depending on its extension
+func OpenArchive(path string, opts ArchiveOptions) (fs.FS, error) {
+	switch {
+	case isZip(path):
+		return OpenZip(path, opts)
+	case isTarGz(path):
+		return OpenTarGz(path)
+	default:
+		return nil, fmt.Errorf("unsupported archive type: %s", path)
+	}
+}
+
+// OpenZip opens a zip file and returns a filesystem. Entry names that aren't
+// UTF-8 are decoded as described by ArchiveOptions.
+func OpenZip(path string, opts ArchiveOptions) (fs.FS, error) {
 	zipFile, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("error opening zip file: %w", err)
@@ -118,6 +145,11 @@ func OpenZip(path string) (fs.FS, error) {
 		return nil, fmt.Errorf("error creating zip reader: %w", err)
 	}
 
+	if err := fixZipNames(zipReader, opts); err != nil {
+		zipFile.Close()
+		return nil, fmt.Errorf("error reading zip entry names: %w", err)
+	}
+
 	return &ZipFS{
 		Reader: zipReader,
 		name:   filepath.Base(path),
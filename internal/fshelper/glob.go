@@ -0,0 +1,45 @@
+package fshelper
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob matches a slash-separated path against a glob pattern. Patterns
+// use path.Match syntax, with "**" matching any number of directories.
+// Patterns without a slash are matched against the last element only. An
+// invalid pattern matches nothing.
+func MatchGlob(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(p))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+// matchSegments matches path segments, letting "**" stand for zero or more of them
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every number of segments for the wildcard to consume
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+
+	return len(segments) == 0
+}
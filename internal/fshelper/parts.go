@@ -0,0 +1,237 @@
+package fshelper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// partPattern matches the numbered parts Google splits large exports into,
+// such as takeout-20230101T000000Z-001.zip
+var partPattern = regexp.MustCompile(`(?i)^(.+)-(\d{3})(\.zip|\.tgz|\.tar\.gz)$`)
+
+// GroupParts groups the numbered parts of split archives, in the order the
+// first part of each archive appears. Parts are sorted by their number, and
+// paths that aren't parts are returned in a group of their own.
+func GroupParts(paths []string) [][]string {
+	var groups [][]string
+	index := make(map[string]int)
+
+	for _, path := range paths {
+		match := partPattern.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			groups = append(groups, []string{path})
+			continue
+		}
+
+		key := filepath.Join(filepath.Dir(path), match[1]) + strings.ToLower(match[3])
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(groups)
+			groups = append(groups, []string{path})
+			continue
+		}
+		groups[i] = append(groups[i], path)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(a, b int) bool {
+			return partNumber(group[a]) < partNumber(group[b])
+		})
+	}
+
+	return groups
+}
+
+// partNumber returns the number of a part, or an empty string if the path
+// isn't one
+func partNumber(path string) string {
+	if match := partPattern.FindStringSubmatch(filepath.Base(path)); match != nil {
+		return match[2]
+	}
+	return ""
+}
+
+// PartsName names an archive after the prefix its parts share, such as
+// takeout-20230101T000000Z.zip. A single path keeps its own name.
+func PartsName(parts []string) string {
+	if len(parts) == 1 {
+		return filepath.Base(parts[0])
+	}
+
+	match := partPattern.FindStringSubmatch(filepath.Base(parts[0]))
+	if match == nil {
+		return filepath.Base(parts[0])
+	}
+	return match[1] + strings.ToLower(match[3])
+}
+
+// MultiFS overlays the parts of a split archive, so files in one part can be
+// found next to files in another. A file in several parts is read from the
+// first of them.
+type MultiFS struct {
+	name  string
+	parts []fs.FS
+	names []string
+}
+
+var (
+	_ fs.ReadDirFS = (*MultiFS)(nil)
+	_ NameFS       = (*MultiFS)(nil)
+)
+
+// OpenArchiveParts opens the parts of a split archive as one filesystem. A
+// single archive is opened on its own.
+func OpenArchiveParts(paths []string, opts ArchiveOptions) (fs.FS, error) {
+	if len(paths) == 1 {
+		return OpenArchive(paths[0], opts)
+	}
+
+	m := &MultiFS{name: PartsName(paths)}
+	for _, path := range paths {
+		part, err := OpenArchive(path, opts)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.parts = append(m.parts, part)
+		m.names = append(m.names, filepath.Base(path))
+	}
+
+	return m, nil
+}
+
+// Name returns the name of the filesystem
+func (m *MultiFS) Name() string {
+	return m.name
+}
+
+// Part returns the name of the part a file is read from, or an empty string
+// if no part has it
+func (m *MultiFS) Part(name string) string {
+	for i, part := range m.parts {
+		if _, err := fs.Stat(part, name); err == nil {
+			return m.names[i]
+		}
+	}
+	return ""
+}
+
+// Open opens a file from the first part that has it. Directories list the
+// entries of all parts.
+func (m *MultiFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for _, part := range m.parts {
+		file, err := part.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := file.Stat()
+		if err != nil || !info.IsDir() {
+			return file, err
+		}
+		file.Close()
+
+		entries, err := m.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &multiDir{info: info, entries: entries}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir reads a directory from all parts that have it, sorted by name
+func (m *MultiFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+
+	for _, part := range m.parts {
+		partEntries, err := fs.ReadDir(part, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		found = true
+		for _, entry := range partEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Close closes all parts
+func (m *MultiFS) Close() error {
+	var errs []error
+	for _, part := range m.parts {
+		if closer, ok := part.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error closing %s: %w", m.name, err)
+	}
+	return nil
+}
+
+// multiDir is an open directory of a split archive
+type multiDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *multiDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *multiDir) Close() error               { return nil }
+
+func (d *multiDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+// ReadDir reads the next n entries of the directory, or all of them if n <= 0
+func (d *multiDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset += len(remaining)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,103 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeZip writes a zip with the given files, in order
+func writeZip(t *testing.T, path string, files [][2]string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		require.NoError(t, err)
+		_, err = w.Write([]byte(f[1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
+
+func TestGroupParts(t *testing.T) {
+	groups := GroupParts([]string{
+		"exports/takeout-20230101T000000Z-002.zip",
+		"exports/Takeout",
+		"exports/takeout-20230101T000000Z-001.zip",
+		"exports/takeout-20240101T000000Z-001.tgz",
+		"exports/takeout-20230101T000000Z-003.ZIP",
+		"other/takeout-20230101T000000Z-004.zip",
+	})
+
+	assert.Equal(t, [][]string{
+		{"exports/takeout-20230101T000000Z-001.zip", "exports/takeout-20230101T000000Z-002.zip", "exports/takeout-20230101T000000Z-003.ZIP"},
+		{"exports/Takeout"},
+		{"exports/takeout-20240101T000000Z-001.tgz"},
+		{"other/takeout-20230101T000000Z-004.zip"},
+	}, groups)
+
+	assert.Equal(t, "takeout-20230101T000000Z.zip", PartsName(groups[0]))
+	assert.Equal(t, "Takeout", PartsName(groups[1]))
+	assert.Equal(t, "takeout-20240101T000000Z-001.tgz", PartsName(groups[2]))
+}
+
+func TestOpenArchiveParts(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "takeout-20230101T000000Z-001.zip")
+	second := filepath.Join(dir, "takeout-20230101T000000Z-002.zip")
+
+	// The sidecar of IMG_0001.jpg ended up in the second part
+	writeZip(t, first, [][2]string{
+		{"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg", "first photo"},
+		{"Takeout/Google Photos/Photos from 2023/IMG_0002.jpg", "second photo"},
+	})
+	writeZip(t, second, [][2]string{
+		{"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json", `{"title":"IMG_0001.jpg"}`},
+		{"Takeout/Google Photos/Photos from 2023/IMG_0002.jpg", "duplicate"},
+	})
+
+	fsys, err := OpenArchiveParts([]string{first, second}, ArchiveOptions{})
+	require.NoError(t, err)
+	multi := fsys.(*MultiFS)
+	defer multi.Close()
+
+	assert.Equal(t, "takeout-20230101T000000Z.zip", multi.Name())
+	require.NoError(t, fstest.TestFS(fsys,
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg",
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json",
+		"Takeout/Google Photos/Photos from 2023/IMG_0002.jpg",
+	))
+
+	entries, err := fs.ReadDir(fsys, "Takeout/Google Photos/Photos from 2023")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// A file in both parts is read from the first
+	data, err := fs.ReadFile(fsys, "Takeout/Google Photos/Photos from 2023/IMG_0002.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "second photo", string(data))
+
+	assert.Equal(t, "takeout-20230101T000000Z-001.zip", multi.Part("Takeout/Google Photos/Photos from 2023/IMG_0002.jpg"))
+	assert.Equal(t, "takeout-20230101T000000Z-002.zip", multi.Part("Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json"))
+	assert.Empty(t, multi.Part("Takeout/missing.jpg"))
+}
+
+func TestOpenArchiveParts_MissingPart(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "takeout-001.zip")
+	writeZip(t, first, [][2]string{{"photo.jpg", "data"}})
+
+	_, err := OpenArchiveParts([]string{first, filepath.Join(dir, "takeout-002.zip")}, ArchiveOptions{})
+	assert.Error(t, err)
+}
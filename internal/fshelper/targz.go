@@ -0,0 +1,253 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TarFS represents a gzipped tar archive with a name. Tar streams can't be
+// seeked, so the archive is decompressed once into a temporary file and its
+// entries are read from there by offset.
+type TarFS struct {
+	name    string
+	tmp     *os.File
+	entries map[string]*tarEntry
+}
+
+// tarEntry is a file or directory in the index of a tar archive
+type tarEntry struct {
+	name     string
+	offset   int64
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	children []fs.DirEntry
+}
+
+var (
+	_ fs.ReadDirFS = (*TarFS)(nil)
+	_ NameFS       = (*TarFS)(nil)
+)
+
+// OpenTarGz opens a .tgz or .tar.gz file and returns a filesystem. Close the
+// filesystem to remove its temporary file.
+func OpenTarGz(path string) (fs.FS, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening tar file: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	tmp, err := os.CreateTemp("", "takeout-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %w", err)
+	}
+
+	t := &TarFS{
+		name:    filepath.Base(path),
+		tmp:     tmp,
+		entries: map[string]*tarEntry{".": {name: ".", mode: fs.ModeDir | 0o555}},
+	}
+
+	if err := t.index(tar.NewReader(gz)); err != nil {
+		t.Close()
+		return nil, fmt.Errorf("error reading tar file: %w", err)
+	}
+
+	return t, nil
+}
+
+// index copies the regular files of the archive to the temporary file and
+// records where each of them starts
+func (t *TarFS) index(reader *tar.Reader) error {
+	var offset int64
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			dir := t.dir(name)
+			dir.modTime = header.ModTime
+		case tar.TypeReg:
+			n, err := io.Copy(t.tmp, reader)
+			if err != nil {
+				return err
+			}
+
+			// A later entry for the same path replaces the earlier one, as
+			// it would when extracting
+			entry, exists := t.entries[name]
+			if !exists {
+				entry = &tarEntry{name: path.Base(name)}
+				t.entries[name] = entry
+				parent := t.dir(path.Dir(name))
+				parent.children = append(parent.children, fs.FileInfoToDirEntry(entry.info()))
+			}
+			entry.offset = offset
+			entry.size = n
+			entry.mode = fs.FileMode(header.Mode).Perm()
+			entry.modTime = header.ModTime
+			offset += n
+		}
+	}
+
+	for _, entry := range t.entries {
+		sort.Slice(entry.children, func(i, j int) bool {
+			return entry.children[i].Name() < entry.children[j].Name()
+		})
+	}
+
+	return nil
+}
+
+// dir returns the index entry of a directory, adding it and its parents if
+// the archive has no entries for them
+func (t *TarFS) dir(name string) *tarEntry {
+	if entry, ok := t.entries[name]; ok {
+		return entry
+	}
+
+	entry := &tarEntry{name: path.Base(name), mode: fs.ModeDir | 0o555}
+	t.entries[name] = entry
+
+	parent := t.dir(path.Dir(name))
+	parent.children = append(parent.children, fs.FileInfoToDirEntry(entry.info()))
+	return entry
+}
+
+// Name returns the name of the filesystem
+func (t *TarFS) Name() string {
+	return t.name
+}
+
+// Open opens a file or directory of the archive
+func (t *TarFS) Open(name string) (fs.File, error) {
+	entry, err := t.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.mode.IsDir() {
+		return &tarDir{entry: entry}, nil
+	}
+	return &tarFile{
+		SectionReader: io.NewSectionReader(t.tmp, entry.offset, entry.size),
+		entry:         entry,
+	}, nil
+}
+
+// ReadDir reads a directory of the archive, sorted by name
+func (t *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := t.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return append([]fs.DirEntry(nil), entry.children...), nil
+}
+
+// Close removes the temporary file
+func (t *TarFS) Close() error {
+	closeErr := t.tmp.Close()
+	if err := os.Remove(t.tmp.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (t *TarFS) lookup(op, name string) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+func (e *tarEntry) info() fs.FileInfo {
+	return tarFileInfo{e}
+}
+
+// tarFileInfo describes an entry of a tar archive
+type tarFileInfo struct {
+	*tarEntry
+}
+
+func (i tarFileInfo) Name() string       { return i.name }
+func (i tarFileInfo) Size() int64        { return i.size }
+func (i tarFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i tarFileInfo) ModTime() time.Time { return i.modTime }
+func (i tarFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i tarFileInfo) Sys() any           { return nil }
+
+// tarFile is an open file of a tar archive
+type tarFile struct {
+	*io.SectionReader
+	entry *tarEntry
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry.info(), nil }
+func (f *tarFile) Close() error               { return nil }
+
+// tarDir is an open directory of a tar archive
+type tarDir struct {
+	entry  *tarEntry
+	offset int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.entry.info(), nil }
+func (d *tarDir) Close() error               { return nil }
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir reads the next n entries of the directory, or all of them if n <= 0
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entry.children[d.offset:]
+	if n <= 0 {
+		d.offset += len(remaining)
+		return append([]fs.DirEntry(nil), remaining...), nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return append([]fs.DirEntry(nil), remaining[:n]...), nil
+}
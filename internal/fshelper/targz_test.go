@@ -0,0 +1,120 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTarGz writes a gzipped tar with the given files, in order
+func writeTarGz(t *testing.T, path string, files [][2]string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     f[0],
+			Mode:     0o644,
+			Size:     int64(len(f[1])),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(f[1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+}
+
+func TestOpenTarGz(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "takeout-001.tgz")
+	writeTarGz(t, path, [][2]string{
+		{"Takeout/Google Photos/Photos from 2019/IMG_1234.jpg", "jpeg data"},
+		{"Takeout/Google Photos/Photos from 2019/IMG_1234.jpg.json", `{"title":"IMG_1234.jpg"}`},
+		{"./Takeout/archive_browser.html", "<html>"},
+	})
+
+	fsys, err := OpenTarGz(path)
+	require.NoError(t, err)
+	tarFS := fsys.(*TarFS)
+
+	assert.Equal(t, "takeout-001.tgz", tarFS.Name())
+	require.NoError(t, fstest.TestFS(fsys,
+		"Takeout/Google Photos/Photos from 2019/IMG_1234.jpg",
+		"Takeout/Google Photos/Photos from 2019/IMG_1234.jpg.json",
+		"Takeout/archive_browser.html",
+	))
+
+	data, err := fs.ReadFile(fsys, "Takeout/Google Photos/Photos from 2019/IMG_1234.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg data", string(data))
+
+	// Files can be read out of order, which a tar stream can't do
+	file, err := fsys.Open("Takeout/Google Photos/Photos from 2019/IMG_1234.jpg.json")
+	require.NoError(t, err)
+	seeker, ok := file.(io.Seeker)
+	require.True(t, ok)
+	_, err = seeker.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	data, err = io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, `title":"IMG_1234.jpg"}`, string(data))
+	require.NoError(t, file.Close())
+
+	_, err = fsys.Open("Takeout/missing.jpg")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	tmpName := tarFS.tmp.Name()
+	require.NoError(t, tarFS.Close())
+	_, err = os.Stat(tmpName)
+	assert.True(t, os.IsNotExist(err), "temporary file should be removed")
+}
+
+func TestOpenTarGz_LaterEntryReplacesEarlier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "takeout.tar.gz")
+	writeTarGz(t, path, [][2]string{
+		{"photo.jpg", "old"},
+		{"photo.jpg", "newer"},
+	})
+
+	fsys, err := OpenTarGz(path)
+	require.NoError(t, err)
+	defer fsys.(*TarFS).Close()
+
+	entries, err := fs.ReadDir(fsys, ".")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	data, err := fs.ReadFile(fsys, "photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "newer", string(data))
+}
+
+func TestOpenTarGz_NotGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "takeout.tgz")
+	require.NoError(t, os.WriteFile(path, []byte("not a tarball"), 0o644))
+
+	_, err := OpenTarGz(path)
+	assert.Error(t, err)
+}
+
+func TestIsArchive(t *testing.T) {
+	assert.True(t, IsArchive("takeout-001.zip"))
+	assert.True(t, IsArchive("takeout-001.ZIP"))
+	assert.True(t, IsArchive("takeout-001.tgz"))
+	assert.True(t, IsArchive("takeout-001.tar.gz"))
+	assert.False(t, IsArchive("takeout-001.gz"))
+	assert.False(t, IsArchive("Takeout"))
+}
@@ -0,0 +1,134 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// ArchiveOptions configures how archives are read
+type ArchiveOptions struct {
+	// NameEncoding is the encoding of zip entry names that aren't marked as
+	// UTF-8, such as "shift_jis" or "latin1". Empty guesses it per name.
+	NameEncoding string
+}
+
+// zipUnicodePathExtra is the ID of the Info-ZIP Unicode Path extra field,
+// which holds the UTF-8 name of an entry stored under a legacy encoding
+const zipUnicodePathExtra = 0x7075
+
+// LookupEncoding returns the text encoding with the given name, accepting the
+// WHATWG and IANA names and aliases such as "shift_jis", "latin1" or "cp437"
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	if enc, err := htmlindex.Get(name); err == nil {
+		return enc, nil
+	}
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", name)
+}
+
+// fixZipNames decodes the names of entries that aren't marked as UTF-8 and
+// cleans every name, before the reader indexes them on first use
+func fixZipNames(r *zip.Reader, opts ArchiveOptions) error {
+	var enc encoding.Encoding
+	if opts.NameEncoding != "" {
+		var err error
+		if enc, err = LookupEncoding(opts.NameEncoding); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.File {
+		f.Name = CleanName(zipEntryName(f, enc))
+	}
+	return nil
+}
+
+// zipEntryName returns the name of a zip entry as UTF-8. The Unicode Path
+// extra field is used if there is one, since its legacy name is often plain
+// ASCII with "?" for every other character. Names marked as UTF-8 or that
+// only use ASCII are kept. Others are decoded with enc if it is set, or are
+// kept if they are valid UTF-8 since many writers don't set the flag.
+// Otherwise the name is decoded as Shift-JIS if it is valid Shift-JIS, and as
+// Windows-1252, a superset of Latin-1, if it isn't.
+func zipEntryName(f *zip.File, enc encoding.Encoding) string {
+	if name, ok := unicodePath(f); ok {
+		return name
+	}
+	if !f.NonUTF8 {
+		return f.Name
+	}
+	if enc != nil {
+		if name, err := enc.NewDecoder().String(f.Name); err == nil {
+			return name
+		}
+	}
+	if utf8.ValidString(f.Name) {
+		return f.Name
+	}
+	if name, ok := decodeStrict(japanese.ShiftJIS, f.Name); ok {
+		return name
+	}
+	name, _ := charmap.Windows1252.NewDecoder().String(f.Name)
+	return name
+}
+
+// unicodePath returns the name in the Unicode Path extra field of an entry,
+// if it has one that was written for its current name
+func unicodePath(f *zip.File) (string, bool) {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return "", false
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		// Version 1, the CRC-32 of the legacy name and the UTF-8 name
+		if id != zipUnicodePathExtra || len(field) < 5 || field[0] != 1 {
+			continue
+		}
+		if binary.LittleEndian.Uint32(field[1:]) != crc32.ChecksumIEEE([]byte(f.Name)) {
+			continue
+		}
+		if name := string(field[5:]); utf8.ValidString(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// decodeStrict decodes s, failing if any of it isn't valid in the encoding
+func decodeStrict(enc encoding.Encoding, s string) (string, bool) {
+	decoded, err := enc.NewDecoder().String(s)
+	if err != nil || strings.ContainsRune(decoded, utf8.RuneError) {
+		return "", false
+	}
+	return decoded, true
+}
+
+// CleanName makes a path safe to use in an object key: invalid UTF-8 is
+// replaced with U+FFFD and control characters, such as newlines, are removed
+func CleanName(name string) string {
+	name = strings.ToValidUTF8(name, string(utf8.RuneError))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,119 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// writeRawZip writes a zip whose entry names are stored as the given bytes,
+// without the UTF-8 flag unless utf8 is set
+func writeRawZip(t *testing.T, path string, headers []*zip.FileHeader) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, header := range headers {
+		w, err := zw.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("content"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
+
+// unicodePathField builds an Info-ZIP Unicode Path extra field
+func unicodePathField(legacy, name string) []byte {
+	field := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(field, zipUnicodePathExtra)
+	binary.LittleEndian.PutUint16(field[2:], uint16(5+len(name)))
+	field[4] = 1
+	binary.LittleEndian.PutUint32(field[5:], crc32.ChecksumIEEE([]byte(legacy)))
+	return append(field, name...)
+}
+
+// zipNames opens a zip and lists its files
+func zipNames(t *testing.T, path string, opts ArchiveOptions) []string {
+	t.Helper()
+
+	fsys, err := OpenZip(path, opts)
+	require.NoError(t, err)
+	defer fsys.(*ZipFS).Close()
+
+	var names []string
+	require.NoError(t, fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, p)
+		}
+		return err
+	}))
+	sort.Strings(names)
+	return names
+}
+
+func TestOpenZip_NonUTF8Names(t *testing.T) {
+	sjis, err := japanese.ShiftJIS.NewEncoder().String("写真/猫.jpg")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "takeout.zip")
+	writeRawZip(t, path, []*zip.FileHeader{
+		{Name: sjis, NonUTF8: true},
+		{Name: "Caf\xe9.jpg", NonUTF8: true},
+		{Name: "Über.jpg"},
+		{Name: "Photos/?.jpg", NonUTF8: true, Extra: unicodePathField("Photos/?.jpg", "Photos/日本.jpg")},
+		{Name: "bad\nname.jpg"},
+	})
+
+	assert.Equal(t, []string{
+		"Café.jpg",
+		"Photos/日本.jpg",
+		"badname.jpg",
+		"Über.jpg",
+		"写真/猫.jpg",
+	}, zipNames(t, path, ArchiveOptions{}))
+
+	// Files can be opened under their decoded names
+	fsys, err := OpenZip(path, ArchiveOptions{})
+	require.NoError(t, err)
+	defer fsys.(*ZipFS).Close()
+	content, err := fs.ReadFile(fsys, "写真/猫.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
+
+func TestOpenZip_NameEncoding(t *testing.T) {
+	// "étét" in Latin-1 is also valid Shift-JIS, so the guess gets it wrong
+	path := filepath.Join(t.TempDir(), "takeout.zip")
+	writeRawZip(t, path, []*zip.FileHeader{{Name: "\xe9t\xe9t.jpg", NonUTF8: true}})
+
+	assert.NotEqual(t, []string{"étét.jpg"}, zipNames(t, path, ArchiveOptions{}))
+	assert.Equal(t, []string{"étét.jpg"}, zipNames(t, path, ArchiveOptions{NameEncoding: "latin1"}))
+
+	_, err := OpenZip(path, ArchiveOptions{NameEncoding: "klingon"})
+	assert.ErrorContains(t, err, "unknown encoding")
+}
+
+func TestLookupEncoding(t *testing.T) {
+	for _, name := range []string{"shift_jis", "Shift_JIS", "latin1", "iso-8859-1", "windows-1252", "cp437", "gbk", "euc-kr"} {
+		_, err := LookupEncoding(name)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	assert.Equal(t, "Photos/IMG_0001.jpg", CleanName("Photos/IMG_0001.jpg"))
+	assert.Equal(t, "tabs and newlines.jpg", CleanName("tabs\t and\r\n newlines.jpg"))
+	assert.Equal(t, "caf�.jpg", CleanName("caf\xe9.jpg"))
+}
@@ -2,25 +2,43 @@
 package journal
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
 )
 
+// ErrCorrupt is returned by Load when the journal file can't be parsed, for
+// example after a crash while it was written by an older version
+var ErrCorrupt = errors.New("journal is corrupt")
+
 // Journal tracks upload progress for resumability
 type Journal struct {
 	mu           sync.Mutex
 	path         string
 	Uploads      map[string]UploadEntry `json:"uploads"`
+	Failed       map[string]FailedEntry `json:"failed,omitempty"`
+	Hashes       map[string]string      `json:"hashes,omitempty"`
 	lastSaveTime time.Time
 	saveInterval time.Duration
 	batchCount   int
 	cancelSave   context.CancelFunc // Add this to cancel the goroutine
+
+	// saveRequested asks the periodic saver for a save. It holds at most one
+	// request, so requests made while one is pending are coalesced.
+	saveRequested chan struct{}
+
+	// Multipart holds the multipart uploads that were started but not
+	// completed, by file path, so --resumable-multipart can continue them
+	Multipart map[string]MultipartEntry `json:"multipart,omitempty"`
 }
 
 // UploadEntry represents a journal entry for an uploaded file
@@ -29,25 +47,68 @@ type UploadEntry struct {
 	Uploaded  bool      `json:"uploaded"`
 	Timestamp time.Time `json:"timestamp"`
 	Archive   string    `json:"archive"`
+	Size      int64     `json:"size,omitempty"`
+	ETag      string    `json:"etag,omitempty"`
+	SHA256    string    `json:"sha256,omitempty"`
+
+	// Key is the key of the uploaded object relative to the prefix, which
+	// differs from the path with a key template or --flatten. Entries written
+	// before keys were recorded don't have it.
+	Key string `json:"key,omitempty"`
+
+	// DuplicateOf is the key of the original object with identical content
+	// that was uploaded in place of this one, relative to the prefix
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// MultipartEntry is a multipart upload of a file that was started but not
+// completed, with the parts the server has confirmed
+type MultipartEntry struct {
+	Key       string      `json:"key"`
+	UploadID  string      `json:"upload_id"`
+	Size      int64       `json:"size"`
+	PartSize  int64       `json:"part_size"`
+	Parts     []PartEntry `json:"parts,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// PartEntry is an uploaded part of a multipart upload
+type PartEntry struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// DefaultPath returns the journal path used when none is given, in the
+// user's home directory
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".s3-takeout-upload-journal.json"
+	}
+	return filepath.Join(home, ".s3-takeout-upload-journal.json")
+}
+
+// FailedEntry represents a journal entry for a file that could not be uploaded
+type FailedEntry struct {
+	Path      string    `json:"path"`
+	Archive   string    `json:"archive"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // New creates a new journal
 func New(path string) *Journal {
 	if path == "" {
-		// Use default path in user's home directory
-		home, err := os.UserHomeDir()
-		if err == nil {
-			path = filepath.Join(home, ".s3-takeout-upload-journal.json")
-		} else {
-			path = ".s3-takeout-upload-journal.json"
-		}
+		path = DefaultPath()
 	}
 
-	logger.Info("Creating journal with path: %s", path)
+	logger.Debug("Creating journal with path: %s", path)
 
 	// Create an empty file if it doesn't exist
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		logger.Info("Journal file doesn't exist, creating empty file at %s", path)
+		logger.Debug("Journal file doesn't exist, creating empty file at %s", path)
 
 		// Create directory if it doesn't exist
 		dir := filepath.Dir(path)
@@ -60,7 +121,7 @@ func New(path string) *Journal {
 				logger.Error("Failed to create empty journal file: %v", err)
 			} else {
 				file.Close()
-				logger.Info("Successfully created empty journal file")
+				logger.Debug("Successfully created empty journal file")
 			}
 		}
 	}
@@ -68,22 +129,29 @@ func New(path string) *Journal {
 	return &Journal{
 		path:         path,
 		Uploads:      make(map[string]UploadEntry),
+		Failed:       make(map[string]FailedEntry),
+		Hashes:       make(map[string]string),
+		Multipart:    make(map[string]MultipartEntry),
 		saveInterval: 30 * time.Second,
+
+		saveRequested: make(chan struct{}, 1),
 	}
 }
 
-// Load loads the journal from disk
+// Load loads the journal from disk. A journal that can't be parsed is left
+// as it is and returns an error wrapping ErrCorrupt. Runs that go on to save
+// the journal use LoadOrBackup instead, so the file isn't overwritten.
 func (j *Journal) Load() error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	logger.Info("Attempting to load journal from %s", j.path)
+	logger.Debug("Attempting to load journal from %s", j.path)
 
 	// Check if journal file exists
 	if _, err := os.Stat(j.path); os.IsNotExist(err) {
 		logger.Info("No journal file found at %s, starting fresh", j.path)
 		// Try to create an empty journal file immediately
-		if err := j.Save(); err != nil {
+		if err := j.write(); err != nil {
 			logger.Error("Failed to create initial journal file: %v", err)
 		}
 		return nil
@@ -95,19 +163,66 @@ func (j *Journal) Load() error {
 		return err
 	}
 
+	// New creates an empty file, which is a journal without entries
+	if len(bytes.TrimSpace(data)) == 0 {
+		logger.Info("Journal file %s is empty, starting fresh", j.path)
+		return nil
+	}
+
 	// Parse journal
 	var journal Journal
 	if err := json.Unmarshal(data, &journal); err != nil {
-		return err
+		return fmt.Errorf("%w (%v)", ErrCorrupt, err)
 	}
 
 	j.Uploads = journal.Uploads
-	logger.Info("Loaded journal with %d entries from %s", len(j.Uploads), j.path)
+	j.Failed = journal.Failed
+	if j.Failed == nil {
+		j.Failed = make(map[string]FailedEntry)
+	}
+	j.Hashes = journal.Hashes
+	if j.Hashes == nil {
+		j.Hashes = make(map[string]string)
+	}
+	j.Multipart = journal.Multipart
+	if j.Multipart == nil {
+		j.Multipart = make(map[string]MultipartEntry)
+	}
+	// Journals written before hashes were tracked still know the hashes of
+	// their uploads, if they recorded the keys they were stored under
+	for _, entry := range j.Uploads {
+		if _, seen := j.Hashes[entry.SHA256]; entry.Uploaded && entry.SHA256 != "" && entry.Key != "" && entry.DuplicateOf == "" && !seen {
+			j.Hashes[entry.SHA256] = entry.Key
+		}
+	}
+	logger.Info("Loaded journal with %d entries and %d failures from %s", len(j.Uploads), len(j.Failed), j.path)
 
 	return nil
 }
 
-// 3. Add a method to start the periodic save with context
+// LoadOrBackup loads the journal like Load, but a journal that can't be
+// parsed is moved aside to a backup next to it so the next save doesn't
+// overwrite it, and the journal starts fresh. The error then wraps ErrCorrupt
+// and names the backup.
+func (j *Journal) LoadOrBackup() error {
+	loadErr := j.Load()
+	if !errors.Is(loadErr, ErrCorrupt) {
+		return loadErr
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	backup := fmt.Sprintf("%s.corrupt-%s", j.path, time.Now().Format("20060102T150405"))
+	if err := os.Rename(j.path, backup); err != nil {
+		return fmt.Errorf("%w and could not be moved aside: %w", loadErr, err)
+	}
+
+	logger.Warn("Journal %s: %v, moved it to %s and starting fresh", j.path, loadErr, backup)
+	return fmt.Errorf("%w, moved it to %s", loadErr, backup)
+}
+
+// StartPeriodicSave starts the goroutine that saves the journal every five
+// minutes and whenever record asks for a save, one save at a time
 func (j *Journal) StartPeriodicSave(ctx context.Context) {
 	// Create a child context we can cancel
 	saveCtx, cancel := context.WithCancel(ctx)
@@ -124,6 +239,10 @@ func (j *Journal) StartPeriodicSave(ctx context.Context) {
 				} else {
 					logger.Info("Performed periodic journal save with %d entries", len(j.Uploads))
 				}
+			case <-j.saveRequested:
+				if err := j.Save(); err != nil {
+					logger.Error("Failed to save journal: %v", err)
+				}
 			case <-saveCtx.Done():
 				logger.Debug("Stopping periodic journal save")
 				return
@@ -133,7 +252,7 @@ func (j *Journal) StartPeriodicSave(ctx context.Context) {
 	logger.Debug("Started periodic journal save")
 }
 
-// 4. Add a method to stop the periodic save
+// StopPeriodicSave stops the goroutine started by StartPeriodicSave
 func (j *Journal) StopPeriodicSave() {
 	if j.cancelSave != nil {
 		j.cancelSave()
@@ -146,12 +265,46 @@ func (j *Journal) Save() error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	now := time.Now()
-	if now.Sub(j.lastSaveTime) < j.saveInterval && len(j.Uploads) > 0 {
+	if time.Since(j.lastSaveTime) < j.saveInterval && len(j.Uploads) > 0 {
 		return nil // Don't save too frequently
 	}
 
-	j.lastSaveTime = now
+	return j.write()
+}
+
+// Flush saves the journal to disk right away, however recently it was last
+// saved, such as when an upload finishes or fails
+func (j *Journal) Flush() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.write()
+}
+
+// FlushTimeout bounds the final save of a run, so a slow or failing disk
+// can't keep it from exiting
+const FlushTimeout = 30 * time.Second
+
+// FlushContext is Flush bounded by a context. If the context ends first it
+// returns its error while the save carries on in the background, so the
+// journal on disk may not have the latest progress.
+func (j *Journal) FlushContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Flush()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("journal save did not finish: %w", ctx.Err())
+	}
+}
+
+// write saves the journal to disk. The caller must hold the lock.
+func (j *Journal) write() error {
+	j.lastSaveTime = time.Now()
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(j.path)
@@ -168,7 +321,7 @@ func (j *Journal) Save() error {
 	}
 
 	// Write journal file
-	if err := os.WriteFile(j.path, data, 0644); err != nil {
+	if err := writeFileAtomic(j.path, data); err != nil {
 		logger.Error("Failed to write journal file: %v", err)
 		return err
 	}
@@ -177,24 +330,163 @@ func (j *Journal) Save() error {
 	return nil
 }
 
-// MarkUploaded marks a file as uploaded
-func (j *Journal) MarkUploaded(path string, archive string) {
-	j.mu.Lock()
-	defer j.mu.Unlock()
+// writeFileAtomic replaces a file with data by writing a temporary file in
+// the same directory, syncing it and renaming it over the file, so a crash
+// leaves either the old or the new content and never a truncated file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
 
-	j.Uploads[path] = UploadEntry{
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// CreateTemp makes files only the owner can read
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// MarkUploaded marks a file as uploaded under key along with the size and
+// ETag of the stored object and the content hash, if known
+func (j *Journal) MarkUploaded(path string, key string, archive string, size int64, etag string, sha256 string) {
+	j.record(UploadEntry{
 		Path:      path,
 		Uploaded:  true,
 		Timestamp: time.Now(),
 		Archive:   archive,
-	}
+		Size:      size,
+		ETag:      etag,
+		SHA256:    sha256,
+		Key:       key,
+	})
+}
 
-	// Save after every 100 files
+// MarkDuplicate marks a file as handled by the upload of another file with the same content
+func (j *Journal) MarkDuplicate(path string, archive string, size int64, sha256 string, original string) {
+	j.record(UploadEntry{
+		Path:        path,
+		Uploaded:    true,
+		Timestamp:   time.Now(),
+		Archive:     archive,
+		Size:        size,
+		SHA256:      sha256,
+		DuplicateOf: original,
+	})
+}
+
+// record stores an entry and periodically saves the journal
+func (j *Journal) record(entry UploadEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Uploads[entry.Path] = entry
+	delete(j.Failed, entry.Path)
+	delete(j.Multipart, entry.Path)
+
+	// Ask for a save after every 100 files
 	j.batchCount++
 	if j.batchCount >= 100 {
 		j.batchCount = 0
-		go j.Save() // Save in background to not block
+		j.requestSave()
+	}
+}
+
+// requestSave asks the periodic saver for a save, unless one is already
+// pending. Without a periodic saver, the journal is saved when it is flushed.
+// The caller must hold the lock.
+func (j *Journal) requestSave() {
+	select {
+	case j.saveRequested <- struct{}{}:
+	default:
+	}
+}
+
+// MultipartUpload returns the unfinished multipart upload of a file, if there is one
+func (j *Journal) MultipartUpload(path string) (MultipartEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, exists := j.Multipart[path]
+	return entry, exists
+}
+
+// SetMultipartUpload records the progress of the multipart upload of a file
+// and asks for a save, so a run that dies can continue it. The entry is
+// removed once the file is marked as uploaded.
+func (j *Journal) SetMultipartUpload(path string, entry MultipartEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
 	}
+	j.Multipart[path] = entry
+	j.requestSave()
+}
+
+// ClearMultipartUpload forgets the multipart upload of a file, such as when
+// it can't be continued
+func (j *Journal) ClearMultipartUpload(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.Multipart, path)
+}
+
+// MarkFailed records that a file could not be uploaded, counting the runs in
+// which it failed
+func (j *Journal) MarkFailed(path string, archive string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := j.Failed[path]
+	j.Failed[path] = FailedEntry{
+		Path:      path,
+		Archive:   archive,
+		Error:     err.Error(),
+		Attempts:  entry.Attempts + 1,
+		Timestamp: time.Now(),
+	}
+}
+
+// IsFailed checks if the last attempt to upload a file failed
+func (j *Journal) IsFailed(path string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, failed := j.Failed[path]
+	return failed
+}
+
+// FailedEntries returns the files that could not be uploaded, sorted by archive and path
+func (j *Journal) FailedEntries() []FailedEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]FailedEntry, 0, len(j.Failed))
+	for _, entry := range j.Failed {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Archive != entries[b].Archive {
+			return entries[a].Archive < entries[b].Archive
+		}
+		return entries[a].Path < entries[b].Path
+	})
+	return entries
 }
 
 // IsUploaded checks if a file has been uploaded
@@ -206,12 +498,59 @@ func (j *Journal) IsUploaded(path string) bool {
 	return exists && entry.Uploaded
 }
 
+// GetEntry returns the journal entry for a file
+func (j *Journal) GetEntry(path string) (UploadEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, exists := j.Uploads[path]
+	return entry, exists
+}
+
+// UploadedHashes returns the key of the uploaded object for each content
+// hash in the journal. Entries written before keys were recorded are left out.
+func (j *Journal) UploadedHashes() map[string]string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	hashes := make(map[string]string)
+	for _, entry := range j.Uploads {
+		if entry.Uploaded && entry.SHA256 != "" && entry.Key != "" && entry.DuplicateOf == "" {
+			hashes[entry.SHA256] = entry.Key
+		}
+	}
+	return hashes
+}
+
+// SeenHash returns the object that holds content with the given SHA-256, if
+// it was uploaded from any archive that shares the journal
+func (j *Journal) SeenHash(sha256 string) (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, seen := j.Hashes[sha256]
+	return key, seen
+}
+
+// MarkHash records that content with the given SHA-256 is stored under key
+func (j *Journal) MarkHash(sha256 string, key string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, seen := j.Hashes[sha256]; !seen {
+		j.Hashes[sha256] = key
+	}
+}
+
 // Clear clears the journal
 func (j *Journal) Clear() {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
 	j.Uploads = make(map[string]UploadEntry)
+	j.Failed = make(map[string]FailedEntry)
+	j.Hashes = make(map[string]string)
+	j.Multipart = make(map[string]MultipartEntry)
 	j.Save()
 }
 
@@ -230,6 +569,69 @@ func (j *Journal) Stats() (total int, uploaded int) {
 	return total, uploaded
 }
 
+// ArchiveStats summarizes the journal entries of one archive
+type ArchiveStats struct {
+	Archive    string    `json:"archive"`
+	Entries    int       `json:"entries"`
+	Uploaded   int       `json:"uploaded"`
+	Duplicates int       `json:"duplicates"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+}
+
+// ArchiveStats returns statistics for each archive in the journal, sorted by
+// archive name. Bytes counts the files that were uploaded, not their duplicates.
+func (j *Journal) ArchiveStats() []ArchiveStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	byArchive := make(map[string]*ArchiveStats)
+	for _, entry := range j.Uploads {
+		stats, ok := byArchive[entry.Archive]
+		if !ok {
+			stats = &ArchiveStats{Archive: entry.Archive}
+			byArchive[entry.Archive] = stats
+		}
+
+		stats.Entries++
+		if entry.Uploaded {
+			stats.Uploaded++
+		}
+		if entry.DuplicateOf != "" {
+			stats.Duplicates++
+		} else if entry.Uploaded {
+			stats.Bytes += entry.Size
+		}
+		if stats.First.IsZero() || entry.Timestamp.Before(stats.First) {
+			stats.First = entry.Timestamp
+		}
+		if entry.Timestamp.After(stats.Last) {
+			stats.Last = entry.Timestamp
+		}
+	}
+
+	// Failures are counted but don't affect the time range of the uploads
+	for _, entry := range j.Failed {
+		stats, ok := byArchive[entry.Archive]
+		if !ok {
+			stats = &ArchiveStats{Archive: entry.Archive}
+			byArchive[entry.Archive] = stats
+		}
+		stats.Failed++
+	}
+
+	archives := make([]ArchiveStats, 0, len(byArchive))
+	for _, stats := range byArchive {
+		archives = append(archives, *stats)
+	}
+	sort.Slice(archives, func(a, b int) bool {
+		return archives[a].Archive < archives[b].Archive
+	})
+	return archives
+}
+
 // ListCompleted returns a list of all completed uploads
 func (j *Journal) ListCompleted() []string {
 	j.mu.Lock()
@@ -0,0 +1,228 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveStats(t *testing.T) {
+	j := New(filepath.Join(t.TempDir(), "journal.json"))
+	first := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	j.Uploads = map[string]UploadEntry{
+		"a.jpg": {Path: "a.jpg", Uploaded: true, Archive: "takeout-002.zip", Size: 100, Timestamp: first.Add(time.Hour)},
+		"b.jpg": {Path: "b.jpg", Uploaded: true, Archive: "takeout-002.zip", Size: 100, Timestamp: first.Add(2 * time.Hour), DuplicateOf: "c.jpg"},
+		"c.jpg": {Path: "c.jpg", Uploaded: true, Archive: "takeout-001.zip", Size: 100, Timestamp: first},
+		"d.jpg": {Path: "d.jpg", Archive: "takeout-001.zip", Size: 50, Timestamp: first.Add(30 * time.Minute)},
+	}
+	j.MarkFailed("e.jpg", "takeout-003.zip", errors.New("access denied"))
+
+	assert.Equal(t, []ArchiveStats{
+		{Archive: "takeout-001.zip", Entries: 2, Uploaded: 1, Bytes: 100, First: first, Last: first.Add(30 * time.Minute)},
+		{Archive: "takeout-002.zip", Entries: 2, Uploaded: 2, Duplicates: 1, Bytes: 100, First: first.Add(time.Hour), Last: first.Add(2 * time.Hour)},
+		{Archive: "takeout-003.zip", Failed: 1},
+	}, j.ArchiveStats())
+}
+
+func TestMultipartUpload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j := New(path)
+
+	entry := MultipartEntry{
+		Key:      "Takeout/video.mp4",
+		UploadID: "upload-1",
+		Size:     25 << 20,
+		PartSize: 10 << 20,
+		Parts:    []PartEntry{{Number: 1, ETag: `"etag-1"`, Size: 10 << 20}},
+	}
+	j.SetMultipartUpload("video.mp4", entry)
+	j.MarkFailed("video.mp4", "takeout.zip", errors.New("connection reset"))
+
+	// The upload is saved and loaded with the failure that interrupted it
+	require.NoError(t, j.Flush())
+	loaded := New(path)
+	require.NoError(t, loaded.Load())
+
+	got, ok := loaded.MultipartUpload("video.mp4")
+	require.True(t, ok)
+	assert.Equal(t, entry.Parts, got.Parts)
+	assert.Equal(t, "upload-1", got.UploadID)
+	assert.False(t, got.Timestamp.IsZero())
+
+	// Completing the file forgets the upload
+	loaded.MarkUploaded("video.mp4", "video.mp4", "takeout.zip", 25<<20, `"etag-3"`, "")
+	_, ok = loaded.MultipartUpload("video.mp4")
+	assert.False(t, ok)
+}
+
+func TestMarkFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j := New(path)
+
+	j.MarkFailed("a.jpg", "takeout.zip", errors.New("timeout"))
+	j.MarkFailed("a.jpg", "takeout.zip", errors.New("access denied"))
+	j.MarkFailed("b.jpg", "takeout.zip", errors.New("timeout"))
+	require.True(t, j.IsFailed("a.jpg"))
+
+	// Failures are saved and loaded with the uploads
+	require.NoError(t, j.Save())
+	loaded := New(path)
+	require.NoError(t, loaded.Load())
+
+	entries := loaded.FailedEntries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "a.jpg", entries[0].Path)
+	assert.Equal(t, "access denied", entries[0].Error)
+	assert.Equal(t, 2, entries[0].Attempts)
+
+	// A later successful upload clears the failure
+	loaded.MarkUploaded("a.jpg", "a.jpg", "takeout.zip", 10, "", "")
+	assert.False(t, loaded.IsFailed("a.jpg"))
+	assert.True(t, loaded.IsFailed("b.jpg"))
+}
+
+func TestHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j := New(path)
+
+	j.MarkHash("abc", "2023/a.jpg")
+	j.MarkHash("abc", "2024/a.jpg")
+	key, seen := j.SeenHash("abc")
+	assert.True(t, seen)
+	assert.Equal(t, "2023/a.jpg", key)
+
+	// Hashes are saved, and journals from before they were tracked fill them
+	// in from their uploads. Only entries that know their key are used.
+	j.Uploads["Trip/b.jpg"] = UploadEntry{Path: "Trip/b.jpg", Key: "2023/b.jpg", Uploaded: true, SHA256: "def"}
+	j.Uploads["Trip/c.jpg"] = UploadEntry{Path: "Trip/c.jpg", Key: "2023/c.jpg", Uploaded: true, SHA256: "def", DuplicateOf: "2023/b.jpg"}
+	j.Uploads["Trip/d.jpg"] = UploadEntry{Path: "Trip/d.jpg", Uploaded: true, SHA256: "jkl"}
+	require.NoError(t, j.Save())
+
+	loaded := New(path)
+	require.NoError(t, loaded.Load())
+	assert.Equal(t, map[string]string{"abc": "2023/a.jpg", "def": "2023/b.jpg"}, loaded.Hashes)
+	assert.Equal(t, map[string]string{"def": "2023/b.jpg"}, loaded.UploadedHashes())
+
+	_, seen = loaded.SeenHash("ghi")
+	assert.False(t, seen)
+}
+
+func TestFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j := New(path)
+	j.MarkUploaded("a.jpg", "a.jpg", "takeout.zip", 10, "", "")
+	require.NoError(t, j.Save())
+
+	// Save skips writes within the save interval, Flush doesn't
+	j.MarkUploaded("b.jpg", "b.jpg", "takeout.zip", 10, "", "")
+	require.NoError(t, j.Save())
+	loaded := New(path)
+	require.NoError(t, loaded.Load())
+	assert.False(t, loaded.IsUploaded("b.jpg"))
+
+	require.NoError(t, j.Flush())
+	loaded = New(path)
+	require.NoError(t, loaded.Load())
+	assert.True(t, loaded.IsUploaded("b.jpg"))
+}
+
+func TestLoad_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"uploads": {"a.jpg": {"path": "a.j`), 0644))
+
+	// Reading the journal, as stats does, leaves the file alone
+	err := New(path).Load()
+	assert.ErrorIs(t, err, ErrCorrupt)
+	backups, err := filepath.Glob(path + ".corrupt-*")
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+
+	j := New(path)
+	err = j.LoadOrBackup()
+	assert.ErrorIs(t, err, ErrCorrupt)
+	assert.False(t, j.IsUploaded("a.jpg"))
+
+	// The corrupt file is kept aside and the journal can be written again
+	backups, err = filepath.Glob(path + ".corrupt-*")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	content, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "a.j")
+
+	j.MarkUploaded("b.jpg", "b.jpg", "takeout.zip", 10, "", "")
+	require.NoError(t, j.Flush())
+	loaded := New(path)
+	require.NoError(t, loaded.Load())
+	assert.True(t, loaded.IsUploaded("b.jpg"))
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestLoad_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j := New(path)
+	require.NoError(t, j.Load())
+	assert.Empty(t, j.ListCompleted())
+}
+
+func TestRecord_CoalescesSaves(t *testing.T) {
+	j := New(filepath.Join(t.TempDir(), "journal.json"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	j.StartPeriodicSave(ctx)
+	defer j.StopPeriodicSave()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10000; i++ {
+		j.MarkUploaded(fmt.Sprintf("%d.jpg", i), fmt.Sprintf("%d.jpg", i), "takeout.zip", 10, "", "")
+	}
+
+	// Saves are requested from the saver rather than started in new goroutines
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before+1)
+	assert.LessOrEqual(t, len(j.saveRequested), 1)
+
+	require.NoError(t, j.Flush())
+	loaded := New(j.path)
+	require.NoError(t, loaded.Load())
+	assert.Len(t, loaded.ListCompleted(), 10000)
+}
+
+func TestFlushContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j := New(path)
+	j.MarkUploaded("a.jpg", "a.jpg", "takeout.zip", 10, "", "")
+	require.NoError(t, j.FlushContext(context.Background()))
+
+	loaded := New(path)
+	require.NoError(t, loaded.Load())
+	assert.True(t, loaded.IsUploaded("a.jpg"))
+
+	// A save stuck behind a held lock gives up at the deadline
+	j.mu.Lock()
+	saved := j.lastSaveTime
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := j.FlushContext(ctx)
+	j.mu.Unlock()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The save still finishes once the lock is released
+	assert.Eventually(t, func() bool {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		return j.lastSaveTime.After(saved)
+	}, time.Second, 5*time.Millisecond)
+}
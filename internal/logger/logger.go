@@ -2,12 +2,15 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Log levels
@@ -18,8 +21,22 @@ const (
 	LevelError
 )
 
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levelNames = map[int]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
 var (
 	level    = LevelInfo
+	format   = FormatText
 	mu       sync.Mutex
 	debugLog = log.New(os.Stdout, "[DEBUG] ", log.LstdFlags)
 	infoLog  = log.New(os.Stdout, "[INFO] ", log.LstdFlags)
@@ -62,30 +79,119 @@ func SetLevel(levelStr string) {
 	}
 }
 
+// SetFormat sets the log format, either "text" or "json"
+func SetFormat(formatStr string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch strings.ToLower(formatStr) {
+	case "", FormatText:
+		format = FormatText
+	case FormatJSON:
+		format = FormatJSON
+	default:
+		return fmt.Errorf("unknown log format %q (expected text or json)", formatStr)
+	}
+	return nil
+}
+
 // Debug logs a debug message
 func Debug(format string, v ...interface{}) {
-	if level <= LevelDebug {
-		debugLog.Output(2, fmt.Sprintf(format, v...))
-	}
+	output(LevelDebug, debugLog, fmt.Sprintf(format, v...), nil)
 }
 
 // Info logs an info message
 func Info(format string, v ...interface{}) {
-	if level <= LevelInfo {
-		infoLog.Output(2, fmt.Sprintf(format, v...))
-	}
+	output(LevelInfo, infoLog, fmt.Sprintf(format, v...), nil)
 }
 
 // Warn logs a warning message
 func Warn(format string, v ...interface{}) {
-	if level <= LevelWarn {
-		warnLog.Output(2, fmt.Sprintf(format, v...))
-	}
+	output(LevelWarn, warnLog, fmt.Sprintf(format, v...), nil)
 }
 
 // Error logs an error message
 func Error(format string, v ...interface{}) {
-	if level <= LevelError {
-		errorLog.Output(2, fmt.Sprintf(format, v...))
+	output(LevelError, errorLog, fmt.Sprintf(format, v...), nil)
+}
+
+// DebugKV logs a debug message with structured fields
+func DebugKV(msg string, kv map[string]any) {
+	output(LevelDebug, debugLog, msg, kv)
+}
+
+// InfoKV logs an info message with structured fields
+func InfoKV(msg string, kv map[string]any) {
+	output(LevelInfo, infoLog, msg, kv)
+}
+
+// WarnKV logs a warning message with structured fields
+func WarnKV(msg string, kv map[string]any) {
+	output(LevelWarn, warnLog, msg, kv)
+}
+
+// ErrorKV logs an error message with structured fields
+func ErrorKV(msg string, kv map[string]any) {
+	output(LevelError, errorLog, msg, kv)
+}
+
+// output writes a message at the given level in the configured format
+func output(msgLevel int, l *log.Logger, msg string, kv map[string]any) {
+	if level > msgLevel {
+		return
+	}
+
+	if format == FormatJSON {
+		writeJSON(l.Writer(), msgLevel, msg, kv)
+		return
+	}
+
+	l.Output(3, msg+formatFields(kv))
+}
+
+// writeJSON writes one JSON object per line with the level, timestamp, message and fields
+func writeJSON(w io.Writer, msgLevel int, msg string, kv map[string]any) {
+	entry := make(map[string]any, len(kv)+3)
+	for k, v := range kv {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["level"] = levelNames[msgLevel]
+	entry["ts"] = time.Now().Format(time.RFC3339Nano)
+	entry["msg"] = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{
+			"level": levelNames[msgLevel],
+			"ts":    entry["ts"],
+			"msg":   msg,
+			"error": fmt.Sprintf("failed to encode log fields: %v", err),
+		})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	w.Write(append(data, '\n'))
+}
+
+// formatFields renders structured fields as sorted key=value pairs for text output
+func formatFields(kv map[string]any) string {
+	if len(kv) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, kv[k])
 	}
+	return b.String()
 }
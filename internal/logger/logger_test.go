@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetLevel("info")
+	require.NoError(t, SetFormat(FormatJSON))
+	defer func() {
+		SetOutput(os.Stdout)
+		SetFormat(FormatText)
+	}()
+
+	Debug("hidden")
+	InfoKV("Upload complete", map[string]any{"uploaded_files": 3, "archive": "takeout-001.zip"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "Upload complete", entry["msg"])
+	assert.Equal(t, "takeout-001.zip", entry["archive"])
+	assert.EqualValues(t, 3, entry["uploaded_files"])
+	assert.NotEmpty(t, entry["ts"])
+}
+
+func TestTextFormatFields(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetLevel("info")
+	defer SetOutput(os.Stdout)
+
+	WarnKV("Retrying", map[string]any{"path": "a.jpg", "attempt": 2})
+
+	assert.Contains(t, buf.String(), "[WARN] ")
+	assert.Contains(t, buf.String(), "Retrying attempt=2 path=a.jpg")
+}
+
+func TestSetFormatInvalid(t *testing.T) {
+	assert.Error(t, SetFormat("xml"))
+}
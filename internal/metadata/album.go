@@ -0,0 +1,55 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+)
+
+// AlbumFile is the name of the file describing the album in its directory
+const AlbumFile = "metadata.json"
+
+// Album represents the metadata of an album directory in a takeout
+type Album struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// AlbumDir returns the directory of the album that a path is the metadata
+// file of, or false if it isn't an album metadata file
+func AlbumDir(p string) (string, bool) {
+	if path.Base(p) != AlbumFile {
+		return "", false
+	}
+	return path.Dir(p), true
+}
+
+// ExtractAlbum extracts the metadata of an album from its metadata.json file
+func (e *Extractor) ExtractAlbum(r io.Reader) (*Album, error) {
+	var album Album
+	if err := json.NewDecoder(r).Decode(&album); err != nil {
+		return nil, fmt.Errorf("failed to decode album metadata: %w", err)
+	}
+	return &album, nil
+}
+
+// AddAlbum records that the file belongs to the album of the directory it is
+// in, listing it before any other albums
+func (m *Metadata) AddAlbum(album *Album) {
+	if album.Title == "" {
+		return
+	}
+
+	albums := []string{album.Title}
+	for _, name := range m.Albums {
+		if name != album.Title {
+			albums = append(albums, name)
+		}
+	}
+	m.Albums = albums
+
+	if m.AlbumDescription == "" {
+		m.AlbumDescription = album.Description
+	}
+}
@@ -0,0 +1,65 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlbumDir(t *testing.T) {
+	dir, ok := AlbumDir("Takeout/Google Photos/Trip to Rome/metadata.json")
+	assert.True(t, ok)
+	assert.Equal(t, "Takeout/Google Photos/Trip to Rome", dir)
+
+	_, ok = AlbumDir("Takeout/Google Photos/Trip to Rome/IMG_1234.jpg.json")
+	assert.False(t, ok)
+}
+
+func TestAddAlbum(t *testing.T) {
+	album, err := NewExtractor(nil).ExtractAlbum(strings.NewReader(`{"title": "Trip to Rome", "description": "Summer 2019", "access": "protected"}`))
+	require.NoError(t, err)
+
+	m := &Metadata{Albums: []string{"Favorites", "Trip to Rome"}}
+	m.AddAlbum(album)
+
+	assert.Equal(t, []string{"Trip to Rome", "Favorites"}, m.Albums)
+	assert.Equal(t, "Summer 2019", m.AlbumDescription)
+}
+
+func TestExtractFromFile_SupplementalSidecar(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Photos/IMG_1234.jpg":                            {Data: []byte("not a jpeg")},
+		"Photos/IMG_1234.jpg.supplemental-metadata.json": {Data: []byte(`{"title": "IMG_1234.jpg", "description": "New format"}`)},
+		"Photos/IMG_5678.jpg":                            {Data: []byte("not a jpeg")},
+		"Photos/IMG_5678.jpg.json":                       {Data: []byte(`{"title": "IMG_5678.jpg", "description": "Old format"}`)},
+	}
+	e := NewExtractor(nil)
+
+	meta, err := e.ExtractFromFile(fsys, "Photos/IMG_1234.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "New format", meta.Description)
+
+	meta, err = e.ExtractFromFile(fsys, "Photos/IMG_5678.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "Old format", meta.Description)
+}
+
+func TestSidecarNames(t *testing.T) {
+	names := sidecarNames("Photos/IMG_0001.HEIC")
+	assert.Equal(t, []string{
+		"Photos/IMG_0001.HEIC.json",
+		"Photos/IMG_0001.HEIC.supplemental-metadata.json",
+		"Photos/IMG_0001.heic.json",
+		"Photos/IMG_0001.heic.supplemental-metadata.json",
+	}, names[:4])
+
+	// The still image of a Live Photo is tried for a video
+	assert.Contains(t, sidecarNames("Photos/IMG_0001.mov"), "Photos/IMG_0001.HEIC.json")
+	assert.NotContains(t, sidecarNames("Photos/IMG_0001.mov"), "Photos/IMG_0001.MP4.json")
+
+	assert.Equal(t, []string{"a.Jpg", "a.jpg", "a.JPG"}, ExtCaseVariants("a.Jpg"))
+	assert.Equal(t, []string{"a.jpg", "a.JPG"}, ExtCaseVariants("a.jpg"))
+}
@@ -0,0 +1,59 @@
+package metadata
+
+import (
+	"math"
+)
+
+// kmPerDegree is the length of a degree of latitude, and of longitude at the equator
+const kmPerDegree = 111.32
+
+// WithoutLocation returns a copy of the metadata without GPS coordinates
+func (m *Metadata) WithoutLocation() *Metadata {
+	stripped := *m
+	stripped.GeoData = nil
+	stripped.GeoDataExif = nil
+	return &stripped
+}
+
+// WithBlurredLocation returns a copy of the metadata with the GPS coordinates
+// snapped to a grid of cells about km kilometers wide. Altitude and the
+// viewport spans are dropped since they would narrow the location down again.
+func (m *Metadata) WithBlurredLocation(km float64) *Metadata {
+	blurred := *m
+	blurred.GeoData = blurLocation(m.GeoData, km)
+	blurred.GeoDataExif = blurLocation(m.GeoDataExif, km)
+	return &blurred
+}
+
+// blurLocation snaps coordinates to the center of their grid cell
+func blurLocation(geo *GeoData, km float64) *GeoData {
+	if geo == nil {
+		return nil
+	}
+
+	// Takeout uses 0,0 for files without a location
+	if geo.Latitude == 0 && geo.Longitude == 0 {
+		return &GeoData{}
+	}
+
+	latStep := km / kmPerDegree
+	lat := math.Max(-90, math.Min(90, snap(geo.Latitude, latStep)))
+
+	// Degrees of longitude get shorter towards the poles, so widen the cells
+	// to keep them about km wide
+	lonStep := 360.0
+	if scale := math.Cos(lat * math.Pi / 180); scale > 0 && latStep/scale < lonStep {
+		lonStep = latStep / scale
+	}
+	lon := snap(geo.Longitude, lonStep)
+	if lon > 180 {
+		lon -= 360
+	}
+
+	return &GeoData{Latitude: lat, Longitude: lon}
+}
+
+// snap rounds a coordinate to the center of the cell of size step it is in
+func snap(value, step float64) float64 {
+	return math.Floor(value/step)*step + step/2
+}
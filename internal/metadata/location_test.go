@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutLocation(t *testing.T) {
+	m := &Metadata{
+		Title:       "IMG_1234.jpg",
+		GeoData:     &GeoData{Latitude: 41.8902, Longitude: 12.4922, Altitude: 21},
+		GeoDataExif: &GeoData{Latitude: 41.8902, Longitude: 12.4922},
+	}
+
+	stripped := m.WithoutLocation()
+	values := stripped.ToMap()
+	assert.NotContains(t, values, "geo-latitude")
+	assert.NotContains(t, values, "geo-longitude")
+	assert.NotContains(t, values, "geo-altitude")
+	assert.Equal(t, "IMG_1234.jpg", values["title"])
+	assert.Nil(t, stripped.GeoDataExif)
+
+	// The original is left alone for other uses such as key templates
+	assert.NotNil(t, m.GeoData)
+}
+
+func TestWithBlurredLocation(t *testing.T) {
+	m := &Metadata{GeoData: &GeoData{Latitude: 41.8902, Longitude: 12.4922, Altitude: 21}}
+
+	blurred := m.WithBlurredLocation(10).GeoData
+	assert.InDelta(t, 41.8902, blurred.Latitude, 10/kmPerDegree)
+	assert.InDelta(t, 12.4922, blurred.Longitude, 10/kmPerDegree/math.Cos(41.9*math.Pi/180))
+	assert.Zero(t, blurred.Altitude)
+
+	// Nearby points end up in the same cell
+	nearby := (&Metadata{GeoData: &GeoData{Latitude: 41.8905, Longitude: 12.4925}}).WithBlurredLocation(10).GeoData
+	assert.Equal(t, blurred, nearby)
+
+	// Files without a location keep Takeout's 0,0
+	assert.Equal(t, &GeoData{}, (&Metadata{GeoData: &GeoData{}}).WithBlurredLocation(10).GeoData)
+
+	// Coordinates stay in range near the antimeridian and the poles
+	edge := (&Metadata{GeoData: &GeoData{Latitude: 89.99, Longitude: 179.99}}).WithBlurredLocation(50).GeoData
+	assert.LessOrEqual(t, edge.Latitude, 90.0)
+	assert.LessOrEqual(t, edge.Longitude, 180.0)
+	assert.GreaterOrEqual(t, edge.Longitude, -180.0)
+}
@@ -7,36 +7,79 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/bstardust/google-takeout-s3-importer/internal/exif"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fileinfo"
 	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
 )
 
 // Metadata represents file metadata
 type Metadata struct {
-	Title          string      `json:"title,omitempty"`
-	Description    string      `json:"description,omitempty"`
-	ImageViews     string      `json:"imageViews,omitempty"`
-	CreationTime   *TimeInfo   `json:"creationTime,omitempty"`
-	PhotoTakenTime *TimeInfo   `json:"photoTakenTime,omitempty"`
-	GeoData        *GeoData    `json:"geoData,omitempty"`
-	GeoDataExif    *GeoData    `json:"geoDataExif,omitempty"`
-	CameraData     *CameraData `json:"cameraData,omitempty"`
-	Tags           []string    `json:"tags,omitempty"`
-	Albums         []string    `json:"albums,omitempty"`
-	People         []Person    `json:"people,omitempty"`
-	Source         string      `json:"source,omitempty"`
-	URL            string      `json:"url,omitempty"`
+	Title            string      `json:"title,omitempty"`
+	Description      string      `json:"description,omitempty"`
+	ImageViews       string      `json:"imageViews,omitempty"`
+	CreationTime     *TimeInfo   `json:"creationTime,omitempty"`
+	PhotoTakenTime   *TimeInfo   `json:"photoTakenTime,omitempty"`
+	GeoData          *GeoData    `json:"geoData,omitempty"`
+	GeoDataExif      *GeoData    `json:"geoDataExif,omitempty"`
+	CameraData       *CameraData `json:"cameraData,omitempty"`
+	Image            *ImageData  `json:"image,omitempty"`
+	Video            *VideoData  `json:"video,omitempty"`
+	Tags             []string    `json:"tags,omitempty"`
+	Albums           []string    `json:"albums,omitempty"`
+	AlbumDescription string      `json:"albumDescription,omitempty"`
+	People           []Person    `json:"people,omitempty"`
+	Source           string      `json:"source,omitempty"`
+	URL              string      `json:"url,omitempty"`
+
+	// Warnings lists problems found while the metadata was extracted, such as
+	// capture times that disagree, for the manifest
+	Warnings []string `json:"-"`
 }
 
-// TimeInfo represents timestamp information
+// TimeInfo represents timestamp information. Timestamp is Unix epoch
+// seconds in Takeout JSON and RFC3339 when read from EXIF, while Formatted is
+// always RFC3339 once extracted.
 type TimeInfo struct {
 	Timestamp string `json:"timestamp"`
 	Formatted string `json:"formatted"`
 }
 
+// Time parses the timestamp, whether it is Unix epoch seconds or RFC3339.
+// Epoch seconds are returned in UTC.
+func (t *TimeInfo) Time() (time.Time, error) {
+	if t == nil || t.Timestamp == "" {
+		return time.Time{}, fmt.Errorf("no timestamp")
+	}
+
+	if seconds, err := strconv.ParseInt(t.Timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, t.Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp %q is neither epoch seconds nor RFC3339", t.Timestamp)
+	}
+	return parsed, nil
+}
+
+// normalize replaces the locale dependent Formatted time of Takeout JSON,
+// such as "Apr 7, 2020, 8:00:00 PM UTC", with RFC3339. It is left as is if
+// the timestamp can't be parsed.
+func (t *TimeInfo) normalize() {
+	if t == nil {
+		return
+	}
+	if parsed, err := t.Time(); err == nil {
+		t.Formatted = parsed.Format(time.RFC3339)
+	}
+}
+
 // GeoData represents geographical data
 type GeoData struct {
 	Latitude      float64 `json:"latitude"`
@@ -51,15 +94,28 @@ type Person struct {
 	Name string `json:"name"`
 }
 
-// CameraData represents camera information
+// CameraData represents camera information and the exposure settings of a
+// photo. ExposureTime is in seconds as a fraction, such as "1/250".
 type CameraData struct {
-	Make  string `json:"make,omitempty"`
-	Model string `json:"model,omitempty"`
+	Make         string  `json:"make,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	FNumber      float64 `json:"fNumber,omitempty"`
+	ISO          int     `json:"iso,omitempty"`
+	ExposureTime string  `json:"exposureTime,omitempty"`
+}
+
+// ImageData represents the size of a photo in pixels and its EXIF
+// orientation, 1 to 8
+type ImageData struct {
+	Width       int `json:"width,omitempty"`
+	Height      int `json:"height,omitempty"`
+	Orientation int `json:"orientation,omitempty"`
 }
 
 // Extractor extracts metadata from files
 type Extractor struct {
-	timezone *time.Location
+	timezone       *time.Location
+	timeDivergence time.Duration
 }
 
 // NewExtractor creates a new metadata extractor
@@ -72,12 +128,22 @@ func NewExtractor(timezone *time.Location) *Extractor {
 	}
 }
 
+// SetTimeDivergence sets how far the capture time in the JSON sidecar of a
+// file may be from the one embedded in the file before ExtractFromFile warns
+// about it. Zero turns the check off.
+func (e *Extractor) SetTimeDivergence(d time.Duration) {
+	e.timeDivergence = d
+}
+
 // ExtractFromJSON extracts metadata from a JSON file
 func (e *Extractor) ExtractFromJSON(r io.Reader) (*Metadata, error) {
 	var metadata Metadata
 	if err := json.NewDecoder(r).Decode(&metadata); err != nil {
 		return nil, fmt.Errorf("failed to decode JSON metadata: %w", err)
 	}
+
+	metadata.CreationTime.normalize()
+	metadata.PhotoTakenTime.normalize()
 	return &metadata, nil
 }
 
@@ -108,11 +174,25 @@ func (e *Extractor) ExtractFromEXIF(r io.Reader) (*Metadata, error) {
 	}
 
 	// Set camera data
-	if exifData.Make != "" || exifData.Model != "" {
-		metadata.CameraData = &CameraData{
-			Make:  exifData.Make,
-			Model: exifData.Model,
-		}
+	camera := CameraData{
+		Make:         exifData.Make,
+		Model:        exifData.Model,
+		FNumber:      exifData.FNumber,
+		ISO:          exifData.ISO,
+		ExposureTime: exifData.ExposureTime,
+	}
+	if camera != (CameraData{}) {
+		metadata.CameraData = &camera
+	}
+
+	// Set image size and orientation
+	image := ImageData{
+		Width:       exifData.Width,
+		Height:      exifData.Height,
+		Orientation: exifData.Orientation,
+	}
+	if image != (ImageData{}) {
+		metadata.Image = &image
 	}
 
 	return metadata, nil
@@ -121,8 +201,7 @@ func (e *Extractor) ExtractFromEXIF(r io.Reader) (*Metadata, error) {
 // ExtractFromFile extracts metadata from a file
 func (e *Extractor) ExtractFromFile(fsys fs.FS, path string) (*Metadata, error) {
 	// First, check if there's a corresponding JSON metadata file
-	jsonPath := path + ".json"
-	jsonExists, _ := Exists(fsys, jsonPath)
+	jsonPath, jsonExists := findSidecar(fsys, path)
 
 	var metadata *Metadata
 
@@ -137,28 +216,27 @@ func (e *Extractor) ExtractFromFile(fsys fs.FS, path string) (*Metadata, error)
 			if err != nil {
 				logger.Warn("Failed to extract metadata from JSON file %s: %v", jsonPath, err)
 			}
+
+			// The sidecar of the other half of a Live Photo is titled after it
+			if media, _ := SidecarMedia(jsonPath); metadata != nil && !strings.EqualFold(media, path) {
+				metadata.Title = ""
+			}
 		}
 	}
 
-	// If no metadata from JSON or incomplete, try EXIF
+	// If no metadata from JSON or incomplete, try EXIF or the video atoms
 	if metadata == nil {
 		metadata = &Metadata{}
 	}
 
-	// Try to extract EXIF data
-	file, err := fsys.Open(path)
+	embedded, err := e.ExtractEmbedded(fsys, path)
 	if err != nil {
 		return metadata, nil // Return what we have so far
 	}
-	defer file.Close()
 
-	exifMetadata, err := e.ExtractFromEXIF(file)
-	if err != nil {
-		return metadata, nil // Return what we have so far
-	}
-
-	// Merge EXIF metadata with JSON metadata (JSON takes precedence)
-	e.mergeMetadata(metadata, exifMetadata)
+	// Merge embedded metadata with JSON metadata (JSON takes precedence)
+	e.checkTimeDivergence(path, metadata, embedded)
+	e.mergeMetadata(metadata, embedded)
 
 	// Set title from filename if not set
 	if metadata.Title == "" {
@@ -168,6 +246,141 @@ func (e *Extractor) ExtractFromFile(fsys fs.FS, path string) (*Metadata, error)
 	return metadata, nil
 }
 
+// Suffixes of the JSON sidecar of a media file. Newer exports use the
+// supplemental metadata name.
+var sidecarSuffixes = []string{".json", ".supplemental-metadata.json"}
+
+// Extensions of the still and video halves of Live Photos and Motion Photos.
+// Google sometimes only exports a sidecar for one of the halves.
+var (
+	livePhotoImageExts = []string{".heic", ".heif", ".jpg", ".jpeg"}
+	livePhotoVideoExts = []string{".mov", ".mp4"}
+)
+
+// findSidecar returns the path of the JSON sidecar of a media file. Sidecars
+// may name the extension in another case than the file, as for IMG_1234.HEIC
+// and IMG_1234.heic.json, or be named after the other half of a Live Photo.
+func findSidecar(fsys fs.FS, path string) (string, bool) {
+	for _, name := range sidecarNames(path) {
+		if exists, _ := Exists(fsys, name); exists {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// sidecarNames returns the paths the JSON sidecar of a media file may have,
+// those named after the file itself first
+func sidecarNames(path string) []string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+
+	partnerExts := livePhotoVideoExts
+	if fileinfo.IsVideoFile(path) {
+		partnerExts = livePhotoImageExts
+	}
+
+	var names []string
+	for _, media := range append(ExtCaseVariants(path), partnerPaths(stem, partnerExts)...) {
+		for _, suffix := range sidecarSuffixes {
+			names = append(names, media+suffix)
+		}
+	}
+	return names
+}
+
+// partnerPaths returns the paths the other half of a Live Photo may have,
+// with each extension in lower and upper case
+func partnerPaths(stem string, exts []string) []string {
+	paths := make([]string, 0, 2*len(exts))
+	for _, ext := range exts {
+		paths = append(paths, stem+ext, stem+strings.ToUpper(ext))
+	}
+	return paths
+}
+
+// ExtCaseVariants returns path followed by the same path with its extension
+// in lower and in upper case, leaving out duplicates
+func ExtCaseVariants(path string) []string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+
+	variants := []string{path}
+	for _, variant := range []string{stem + strings.ToLower(ext), stem + strings.ToUpper(ext)} {
+		if !slices.Contains(variants, variant) {
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// SidecarMedia returns the path of the media file that a JSON file would be
+// the sidecar of, or false if it isn't a JSON file. Whether that media file
+// exists is up to the caller.
+func SidecarMedia(path string) (string, bool) {
+	// Check the longest suffix first, since they all end in .json
+	for i := len(sidecarSuffixes) - 1; i >= 0; i-- {
+		if media, ok := strings.CutSuffix(path, sidecarSuffixes[i]); ok && media != "" {
+			return media, true
+		}
+	}
+	return "", false
+}
+
+// ExtractEmbedded extracts the metadata stored in a media file itself, from
+// the EXIF data of images or the atoms of videos
+func (e *Extractor) ExtractEmbedded(fsys fs.FS, path string) (*Metadata, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if !fileinfo.IsVideoFile(path) {
+		return e.ExtractFromEXIF(file)
+	}
+
+	// Files in zip archives can't seek, so skip through them by reading
+	reader, ok := file.(io.ReadSeeker)
+	if !ok {
+		reader = forwardSeeker{file}
+	}
+	return e.ExtractFromVideo(reader)
+}
+
+// checkTimeDivergence warns if the capture time of the JSON sidecar and the
+// one embedded in the file are further apart than the extractor allows. The
+// JSON time is still used, but a large difference often means the camera
+// clock or time zone was wrong or one of them is damaged.
+func (e *Extractor) checkTimeDivergence(path string, fromJSON, embedded *Metadata) {
+	if e.timeDivergence <= 0 {
+		return
+	}
+
+	// EXIF dates are read as the creation time and video dates as the capture time
+	embeddedTime := embedded.PhotoTakenTime
+	if embeddedTime == nil {
+		embeddedTime = embedded.CreationTime
+	}
+	jsonTaken, err := fromJSON.PhotoTakenTime.Time()
+	if err != nil {
+		return
+	}
+	embeddedTaken, err := embeddedTime.Time()
+	if err != nil {
+		return
+	}
+
+	diff := jsonTaken.Sub(embeddedTaken).Abs()
+	if diff <= e.timeDivergence {
+		return
+	}
+	warning := fmt.Sprintf("capture time in JSON (%s) and embedded metadata (%s) differ by %v",
+		jsonTaken.Format(time.RFC3339), embeddedTaken.Format(time.RFC3339), diff)
+	logger.Warn("%s: %s, using the JSON time", path, warning)
+	fromJSON.Warnings = append(fromJSON.Warnings, warning)
+}
+
 // mergeMetadata merges two metadata objects
 func (e *Extractor) mergeMetadata(target, source *Metadata) {
 	if target.Title == "" {
@@ -191,6 +404,12 @@ func (e *Extractor) mergeMetadata(target, source *Metadata) {
 	if target.CameraData == nil {
 		target.CameraData = source.CameraData
 	}
+	if target.Image == nil {
+		target.Image = source.Image
+	}
+	if target.Video == nil {
+		target.Video = source.Video
+	}
 	if len(target.Tags) == 0 {
 		target.Tags = source.Tags
 	}
@@ -243,6 +462,36 @@ func (m *Metadata) ToMap() map[string]string {
 		if m.CameraData.Model != "" {
 			result["camera-model"] = m.CameraData.Model
 		}
+		if m.CameraData.FNumber > 0 {
+			result["camera-f-number"] = strconv.FormatFloat(m.CameraData.FNumber, 'f', -1, 64)
+		}
+		if m.CameraData.ISO > 0 {
+			result["camera-iso"] = strconv.Itoa(m.CameraData.ISO)
+		}
+		if m.CameraData.ExposureTime != "" {
+			result["camera-exposure-time"] = m.CameraData.ExposureTime
+		}
+	}
+	if m.Image != nil {
+		if m.Image.Width > 0 && m.Image.Height > 0 {
+			result["image-width"] = strconv.Itoa(m.Image.Width)
+			result["image-height"] = strconv.Itoa(m.Image.Height)
+		}
+		if m.Image.Orientation > 0 {
+			result["image-orientation"] = strconv.Itoa(m.Image.Orientation)
+		}
+	}
+	if m.Video != nil {
+		if m.Video.Duration > 0 {
+			result["video-duration"] = fmt.Sprintf("%.3f", m.Video.Duration)
+		}
+		if m.Video.Width > 0 && m.Video.Height > 0 {
+			result["video-width"] = fmt.Sprintf("%d", m.Video.Width)
+			result["video-height"] = fmt.Sprintf("%d", m.Video.Height)
+		}
+		if m.Video.Codec != "" {
+			result["video-codec"] = m.Video.Codec
+		}
 	}
 	if len(m.Tags) > 0 {
 		result["tags"] = strings.Join(m.Tags, ",")
@@ -267,6 +516,84 @@ func (m *Metadata) ToMap() map[string]string {
 	return result
 }
 
+// S3 object tag limits
+const (
+	MaxTags           = 10
+	MaxTagKeyLength   = 128
+	MaxTagValueLength = 256
+)
+
+// SourceArchiveTag is the object tag naming the archive a file came from
+const SourceArchiveTag = "source-archive"
+
+// ToTags converts albums and people to S3 object tags keyed "album:<name>" and
+// "person:<name>". Tags over the S3 limits are dropped or shortened, which is
+// reported by the second return value.
+func (m *Metadata) ToTags() (map[string]string, bool) {
+	tags := make(map[string]string)
+	truncated := false
+
+	add := func(prefix string, name string) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return
+		}
+
+		key := []rune(sanitizeTagKey(prefix + name))
+		if len(key) > MaxTagKeyLength {
+			key = key[:MaxTagKeyLength]
+			truncated = true
+		}
+
+		if _, exists := tags[string(key)]; exists {
+			return
+		}
+		if len(tags) >= MaxTags {
+			truncated = true
+			return
+		}
+		tags[string(key)] = "true"
+	}
+
+	for _, album := range m.Albums {
+		add("album:", album)
+	}
+	for _, person := range m.People {
+		add("person:", person.Name)
+	}
+
+	return tags, truncated
+}
+
+// AddSourceArchiveTag tags an object with the archive it came from. The tag is
+// left out if the object already has as many tags as S3 allows, which is
+// reported by the second return value.
+func AddSourceArchiveTag(tags map[string]string, archive string) (map[string]string, bool) {
+	if len(tags) >= MaxTags {
+		return tags, false
+	}
+	if tags == nil {
+		tags = make(map[string]string, 1)
+	}
+
+	value := []rune(sanitizeTagKey(archive))
+	if len(value) > MaxTagValueLength {
+		value = value[:MaxTagValueLength]
+	}
+	tags[SourceArchiveTag] = string(value)
+	return tags, true
+}
+
+// sanitizeTagKey replaces characters that aren't allowed in S3 tag keys
+func sanitizeTagKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune("+-=._:/@", r) {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
 // Exists checks if a path exists in a filesystem
 func Exists(fsys fs.FS, path string) (bool, error) {
 	_, err := fs.Stat(fsys, path)
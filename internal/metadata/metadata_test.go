@@ -0,0 +1,239 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToTags(t *testing.T) {
+	m := &Metadata{
+		Albums: []string{"Summer 2019", "Trip (Italy)", "Summer 2019"},
+		People: []Person{{Name: "Alex"}, {Name: " "}},
+	}
+
+	tags, truncated := m.ToTags()
+	assert.False(t, truncated)
+	assert.Equal(t, map[string]string{
+		"album:Summer 2019":  "true",
+		"album:Trip _Italy_": "true",
+		"person:Alex":        "true",
+	}, tags)
+}
+
+func TestToTags_Limits(t *testing.T) {
+	m := &Metadata{Albums: []string{strings.Repeat("ä", 200)}}
+	for i := 0; i < 12; i++ {
+		m.People = append(m.People, Person{Name: fmt.Sprintf("Person %d", i)})
+	}
+
+	tags, truncated := m.ToTags()
+	assert.True(t, truncated)
+	assert.Len(t, tags, MaxTags)
+	for key := range tags {
+		assert.LessOrEqual(t, len([]rune(key)), MaxTagKeyLength)
+	}
+}
+
+func TestAddSourceArchiveTag(t *testing.T) {
+	tags, added := AddSourceArchiveTag(nil, "takeout-20240101T000000Z-001 (1).zip")
+	assert.True(t, added)
+	assert.Equal(t, map[string]string{SourceArchiveTag: "takeout-20240101T000000Z-001 _1_.zip"}, tags)
+
+	// Tags at the limit are left alone
+	full := make(map[string]string, MaxTags)
+	for i := 0; i < MaxTags; i++ {
+		full[fmt.Sprintf("album:%d", i)] = "true"
+	}
+	tags, added = AddSourceArchiveTag(full, "takeout.zip")
+	assert.False(t, added)
+	assert.NotContains(t, tags, SourceArchiveTag)
+}
+
+func TestTimeInfo_Time(t *testing.T) {
+	epoch, err := (&TimeInfo{Timestamp: "1586289600"}).Time()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 4, 7, 20, 0, 0, 0, time.UTC), epoch)
+
+	rfc, err := (&TimeInfo{Timestamp: "2020-04-07T22:00:00+02:00"}).Time()
+	assert.NoError(t, err)
+	assert.True(t, rfc.Equal(epoch))
+
+	_, err = (&TimeInfo{Timestamp: "Apr 7, 2020"}).Time()
+	assert.Error(t, err)
+
+	var missing *TimeInfo
+	_, err = missing.Time()
+	assert.Error(t, err)
+}
+
+func TestExtractFromJSON_NormalizesTimes(t *testing.T) {
+	meta, err := NewExtractor(nil).ExtractFromJSON(strings.NewReader(`{
+		"title": "IMG_0001.jpg",
+		"creationTime": {"timestamp": "1586289600", "formatted": "Apr 7, 2020, 8:00:00 PM UTC"},
+		"photoTakenTime": {"timestamp": "not a time", "formatted": "sometime"}
+	}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "2020-04-07T20:00:00Z", meta.CreationTime.Formatted)
+	assert.Equal(t, "1586289600", meta.CreationTime.Timestamp)
+	assert.Equal(t, "sometime", meta.PhotoTakenTime.Formatted)
+}
+
+// tiffEntry is a field of a TIFF IFD with its little-endian value
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func shortEntry(tag uint16, v uint16) tiffEntry {
+	return tiffEntry{tag, 3, 1, binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func longEntry(tag uint16, v uint32) tiffEntry {
+	return tiffEntry{tag, 4, 1, binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func ratEntry(tag uint16, num, den uint32) tiffEntry {
+	return tiffEntry{tag, 5, 1, binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, num), den)}
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+// buildTIFF encodes a TIFF header with the fields of IFD0 and, if there are
+// any, an EXIF sub-IFD, as EXIF data is stored in a JPEG
+func buildTIFF(ifd0, exifIFD []tiffEntry) []byte {
+	ifdSize := func(entries []tiffEntry) uint32 { return uint32(2 + 12*len(entries) + 4) }
+	exifOffset := 8 + ifdSize(ifd0) + 12
+	if len(exifIFD) > 0 {
+		ifd0 = append(ifd0, longEntry(0x8769, exifOffset))
+	} else {
+		exifOffset -= 12
+	}
+	dataOffset := exifOffset
+	if len(exifIFD) > 0 {
+		dataOffset += ifdSize(exifIFD)
+	}
+
+	var data []byte
+	writeIFD := func(buf *bytes.Buffer, entries []tiffEntry) {
+		binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(buf, binary.LittleEndian, e.tag)
+			binary.Write(buf, binary.LittleEndian, e.typ)
+			binary.Write(buf, binary.LittleEndian, e.count)
+			if len(e.value) <= 4 {
+				buf.Write(append(e.value, make([]byte, 4-len(e.value))...))
+				continue
+			}
+			binary.Write(buf, binary.LittleEndian, dataOffset+uint32(len(data)))
+			data = append(data, e.value...)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(0))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	writeIFD(&buf, ifd0)
+	if len(exifIFD) > 0 {
+		writeIFD(&buf, exifIFD)
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestExtractFromEXIF_ImageAndExposure(t *testing.T) {
+	extractor := NewExtractor(nil)
+
+	// A camera records the size and exposure in the EXIF sub-IFD
+	meta, err := extractor.ExtractFromEXIF(bytes.NewReader(buildTIFF(
+		[]tiffEntry{asciiEntry(0x010F, "Canon"), shortEntry(0x0112, 6)},
+		[]tiffEntry{
+			ratEntry(0x829A, 1, 250),
+			ratEntry(0x829D, 28, 10),
+			shortEntry(0x8827, 400),
+			longEntry(0xA002, 4000),
+			longEntry(0xA003, 3000),
+		},
+	)))
+	require.NoError(t, err)
+	assert.Equal(t, &CameraData{Make: "Canon", FNumber: 2.8, ISO: 400, ExposureTime: "1/250"}, meta.CameraData)
+	assert.Equal(t, &ImageData{Width: 4000, Height: 3000, Orientation: 6}, meta.Image)
+
+	m := meta.ToMap()
+	assert.Equal(t, "2.8", m["camera-f-number"])
+	assert.Equal(t, "400", m["camera-iso"])
+	assert.Equal(t, "1/250", m["camera-exposure-time"])
+	assert.Equal(t, "4000", m["image-width"])
+	assert.Equal(t, "3000", m["image-height"])
+	assert.Equal(t, "6", m["image-orientation"])
+
+	// An edited file may only have the TIFF size, and no camera at all
+	meta, err = extractor.ExtractFromEXIF(bytes.NewReader(buildTIFF(
+		[]tiffEntry{longEntry(0x0100, 1200), longEntry(0x0101, 800)}, nil,
+	)))
+	require.NoError(t, err)
+	assert.Nil(t, meta.CameraData)
+	assert.Equal(t, &ImageData{Width: 1200, Height: 800}, meta.Image)
+	assert.NotContains(t, meta.ToMap(), "image-orientation")
+
+	// Fields that are missing or can't be read are left out
+	meta, err = extractor.ExtractFromEXIF(bytes.NewReader(buildTIFF(
+		[]tiffEntry{asciiEntry(0x0110, "Pixel 7")},
+		[]tiffEntry{ratEntry(0x829D, 18, 0)},
+	)))
+	require.NoError(t, err)
+	assert.Equal(t, &CameraData{Model: "Pixel 7"}, meta.CameraData)
+	assert.Nil(t, meta.Image)
+}
+
+func TestExtractFromFile_TimeDivergence(t *testing.T) {
+	photo := buildTIFF([]tiffEntry{asciiEntry(0x0132, "2020:04:07 20:00:00")}, nil)
+	sidecar := func(taken time.Time) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(fmt.Sprintf(`{"photoTakenTime": {"timestamp": "%d"}}`, taken.Unix()))}
+	}
+	embedded, err := NewExtractor(nil).ExtractFromEXIF(bytes.NewReader(photo))
+	require.NoError(t, err)
+	exifTime, err := embedded.CreationTime.Time()
+	require.NoError(t, err)
+
+	fsys := fstest.MapFS{
+		"far.jpg":       {Data: photo},
+		"far.jpg.json":  sidecar(exifTime.Add(72 * time.Hour)),
+		"near.jpg":      {Data: photo},
+		"near.jpg.json": sidecar(exifTime.Add(time.Hour)),
+	}
+
+	extractor := NewExtractor(nil)
+	extractor.SetTimeDivergence(24 * time.Hour)
+
+	// The JSON time is kept, but the conflict is noted
+	meta, err := extractor.ExtractFromFile(fsys, "far.jpg")
+	require.NoError(t, err)
+	taken, err := meta.PhotoTakenTime.Time()
+	require.NoError(t, err)
+	assert.Equal(t, exifTime.Add(72*time.Hour).Unix(), taken.Unix())
+	require.Len(t, meta.Warnings, 1)
+	assert.Contains(t, meta.Warnings[0], "differ by 72h0m0s")
+
+	meta, err = extractor.ExtractFromFile(fsys, "near.jpg")
+	require.NoError(t, err)
+	assert.Empty(t, meta.Warnings)
+
+	// The check is off by default
+	meta, err = NewExtractor(nil).ExtractFromFile(fsys, "far.jpg")
+	require.NoError(t, err)
+	assert.Empty(t, meta.Warnings)
+}
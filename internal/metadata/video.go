@@ -0,0 +1,255 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// VideoData represents the properties of a video stream
+type VideoData struct {
+	Duration float64 `json:"duration,omitempty"` // In seconds
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	Codec    string  `json:"codec,omitempty"`
+}
+
+// mp4Epoch is the origin of the times stored in MP4 and MOV atoms
+var mp4Epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Containers that hold the atoms we read
+var mp4Containers = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+}
+
+// Largest atom read into memory; media data is skipped, never read
+const maxAtomSize = 1 << 20
+
+// mp4Info collects the values read from the atoms of a video
+type mp4Info struct {
+	created  time.Time
+	duration float64
+	width    int
+	height   int
+	codec    string
+
+	// The track being read, as tkhd and hdlr come before stsd
+	trackWidth   int
+	trackHeight  int
+	trackIsVideo bool
+}
+
+// ExtractFromVideo extracts the capture time, duration, dimensions and codec
+// from the atoms of an MP4 or MOV file
+func (e *Extractor) ExtractFromVideo(r io.ReadSeeker) (*Metadata, error) {
+	info := &mp4Info{}
+	foundMoov, err := info.readAtoms(r, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read video atoms: %w", err)
+	}
+	if !foundMoov {
+		return nil, errors.New("no movie header found")
+	}
+
+	metadata := &Metadata{
+		Video: &VideoData{
+			Duration: info.duration,
+			Width:    info.width,
+			Height:   info.height,
+			Codec:    info.codec,
+		},
+	}
+
+	// The creation time is left at zero by devices that don't set it
+	if info.created.After(mp4Epoch) {
+		metadata.PhotoTakenTime = &TimeInfo{
+			Timestamp: strconv.FormatInt(info.created.Unix(), 10),
+			Formatted: info.created.Format(time.RFC3339),
+		}
+	}
+
+	return metadata, nil
+}
+
+// readAtoms reads the atoms in the next size bytes, or up to the end of the
+// file if size is negative. It reports whether a movie header was found.
+func (info *mp4Info) readAtoms(r io.ReadSeeker, size int64) (bool, error) {
+	foundMoov := false
+	var header [16]byte
+
+	for size < 0 || size >= 8 {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if size < 0 && errors.Is(err, io.EOF) {
+				return foundMoov, nil
+			}
+			return foundMoov, err
+		}
+
+		atomSize := int64(binary.BigEndian.Uint32(header[:4]))
+		atomType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch atomSize {
+		case 0:
+			// The atom extends to the end of the file
+			if size >= 0 {
+				atomSize = size
+			} else {
+				atomSize = -1
+			}
+		case 1:
+			// The real size follows as 64 bits
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return foundMoov, err
+			}
+			atomSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		if (atomSize >= 0 && atomSize < headerSize) || (size >= 0 && atomSize > size) {
+			return foundMoov, fmt.Errorf("invalid size %d for atom %q", atomSize, atomType)
+		}
+
+		bodySize := int64(-1)
+		if atomSize >= 0 {
+			bodySize = atomSize - headerSize
+		}
+
+		var err error
+		switch {
+		case mp4Containers[atomType]:
+			if atomType == "moov" {
+				foundMoov = true
+			}
+			if atomType == "trak" {
+				info.trackWidth, info.trackHeight, info.trackIsVideo = 0, 0, false
+			}
+			_, err = info.readAtoms(r, bodySize)
+		case atomType == "mvhd" || atomType == "tkhd" || atomType == "hdlr" || atomType == "stsd":
+			err = info.readLeaf(r, atomType, bodySize)
+		default:
+			err = skip(r, bodySize)
+		}
+		if err != nil {
+			return foundMoov, err
+		}
+
+		// The movie header holds all we need, so don't read the media data after it
+		if atomType == "moov" || bodySize < 0 {
+			return foundMoov, nil
+		}
+
+		if size >= 0 {
+			size -= atomSize
+		}
+	}
+
+	// Skip any padding at the end of a container
+	return foundMoov, skip(r, size)
+}
+
+// readLeaf parses one of the atoms holding the values we need
+func (info *mp4Info) readLeaf(r io.Reader, atomType string, size int64) error {
+	if size < 0 || size > maxAtomSize {
+		return fmt.Errorf("invalid size %d for atom %q", size, atomType)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+
+	switch atomType {
+	case "mvhd":
+		info.parseMovieHeader(body)
+	case "tkhd":
+		info.parseTrackHeader(body)
+	case "hdlr":
+		// Version and flags, pre-defined, then the handler type. QuickTime
+		// files also have a data handler, which must not reset the track type.
+		if len(body) >= 12 && string(body[8:12]) == "vide" {
+			info.trackIsVideo = true
+		}
+	case "stsd":
+		// Version and flags, entry count, then the first entry's size and format
+		if info.trackIsVideo && info.codec == "" && len(body) >= 16 {
+			info.codec = string(body[12:16])
+			info.width, info.height = info.trackWidth, info.trackHeight
+		}
+	}
+	return nil
+}
+
+// parseMovieHeader reads the creation time and duration from an mvhd atom
+func (info *mp4Info) parseMovieHeader(body []byte) {
+	var created, timescale, duration uint64
+
+	switch {
+	case len(body) >= 32 && body[0] == 1:
+		created = binary.BigEndian.Uint64(body[4:12])
+		timescale = uint64(binary.BigEndian.Uint32(body[20:24]))
+		duration = binary.BigEndian.Uint64(body[24:32])
+	case len(body) >= 20:
+		created = uint64(binary.BigEndian.Uint32(body[4:8]))
+		timescale = uint64(binary.BigEndian.Uint32(body[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(body[16:20]))
+	default:
+		return
+	}
+
+	info.created = time.Unix(mp4Epoch.Unix()+int64(created), 0).UTC()
+	if timescale > 0 {
+		info.duration = float64(duration) / float64(timescale)
+	}
+}
+
+// parseTrackHeader reads the display size of a track from a tkhd atom
+func (info *mp4Info) parseTrackHeader(body []byte) {
+	// The width and height are 16.16 fixed point numbers at the end
+	offset := 76
+	if len(body) > 0 && body[0] == 1 {
+		offset = 88
+	}
+	if len(body) < offset+8 {
+		return
+	}
+
+	info.trackWidth = int(binary.BigEndian.Uint32(body[offset:offset+4]) >> 16)
+	info.trackHeight = int(binary.BigEndian.Uint32(body[offset+4:offset+8]) >> 16)
+}
+
+// skip moves past size bytes, or to the end if size is negative
+func skip(r io.ReadSeeker, size int64) error {
+	if size < 0 {
+		_, err := r.Seek(0, io.SeekEnd)
+		return err
+	}
+	_, err := r.Seek(size, io.SeekCurrent)
+	return err
+}
+
+// forwardSeeker lets a reader that can't seek, such as a file in a zip
+// archive, be skipped through by reading and discarding data
+type forwardSeeker struct {
+	io.Reader
+}
+
+func (f forwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case whence == io.SeekCurrent && offset >= 0:
+		_, err := io.CopyN(io.Discard, f.Reader, offset)
+		return 0, err
+	case whence == io.SeekEnd && offset == 0:
+		_, err := io.Copy(io.Discard, f.Reader)
+		return 0, err
+	default:
+		return 0, errors.New("forwardSeeker: only forward seeks are supported")
+	}
+}
@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// atom builds an MP4 atom from its type and body
+func atom(atomType string, body ...[]byte) []byte {
+	content := bytes.Join(body, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	out = append(out, atomType...)
+	return append(out, content...)
+}
+
+// testVideo builds a minimal MOV file with the movie header after the media data
+func testVideo(created time.Time) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Unix()-mp4Epoch.Unix()))
+	binary.BigEndian.PutUint32(mvhd[12:], 600)  // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], 7500) // duration, 12.5s
+
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+
+	audioTkhd := make([]byte, 84)
+
+	stsd := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	stsd = append(stsd, atom("hvc1", make([]byte, 8))...)
+
+	video := atom("trak",
+		atom("tkhd", tkhd),
+		atom("mdia",
+			atom("hdlr", []byte("\x00\x00\x00\x00mhlrvide")),
+			atom("minf",
+				atom("hdlr", []byte("\x00\x00\x00\x00dhlralis")),
+				atom("stbl", atom("stsd", stsd)),
+			),
+		),
+	)
+
+	audioStsd := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	audioStsd = append(audioStsd, atom("mp4a", make([]byte, 8))...)
+
+	audio := atom("trak",
+		atom("tkhd", audioTkhd),
+		atom("mdia",
+			atom("hdlr", []byte("\x00\x00\x00\x00mhlrsoun")),
+			atom("minf", atom("stbl", atom("stsd", audioStsd))),
+		),
+	)
+
+	return bytes.Join([][]byte{
+		atom("ftyp", []byte("qt  \x00\x00\x00\x00")),
+		atom("mdat", make([]byte, 4096)),
+		atom("moov", atom("mvhd", mvhd), audio, video),
+	}, nil)
+}
+
+func TestExtractFromVideo(t *testing.T) {
+	created := time.Date(2021, time.July, 4, 18, 30, 0, 0, time.UTC)
+	data := testVideo(created)
+	e := NewExtractor(nil)
+
+	readers := map[string]io.ReadSeeker{
+		"seekable":     bytes.NewReader(data),
+		"not seekable": forwardSeeker{io.MultiReader(bytes.NewReader(data))},
+	}
+
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			meta, err := e.ExtractFromVideo(reader)
+			require.NoError(t, err)
+
+			assert.Equal(t, &VideoData{Duration: 12.5, Width: 1920, Height: 1080, Codec: "hvc1"}, meta.Video)
+			require.NotNil(t, meta.PhotoTakenTime)
+			assert.Equal(t, "1625423400", meta.PhotoTakenTime.Timestamp)
+
+			m := meta.ToMap()
+			assert.Equal(t, "12.500", m["video-duration"])
+			assert.Equal(t, "1920", m["video-width"])
+			assert.Equal(t, "hvc1", m["video-codec"])
+		})
+	}
+}
+
+func TestExtractFromVideo_Invalid(t *testing.T) {
+	e := NewExtractor(nil)
+
+	_, err := e.ExtractFromVideo(bytes.NewReader([]byte("not a video at all")))
+	assert.Error(t, err)
+
+	// A file without a movie header
+	_, err = e.ExtractFromVideo(bytes.NewReader(atom("mdat", make([]byte, 16))))
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	m := NewUpload(r)
+	m.Uploaded(2048, 300*time.Millisecond)
+	m.Uploaded(1024, 20*time.Second)
+	m.Failed()
+	m.Corrupt()
+	m.Skipped()
+
+	var out strings.Builder
+	require.NoError(t, r.Write(&out))
+	text := out.String()
+
+	assert.Contains(t, text, "# TYPE uploads_total counter\nuploads_total 2\n")
+	assert.Contains(t, text, "uploads_failed_total 1\n")
+	assert.Contains(t, text, "files_corrupt_total 1\n")
+	assert.Contains(t, text, "bytes_uploaded_total 3072\n")
+	assert.Contains(t, text, "files_skipped_total 1\n")
+	assert.Contains(t, text, "# TYPE upload_duration_seconds histogram\n")
+	assert.Contains(t, text, "upload_duration_seconds_bucket{le=\"0.1\"} 0\n")
+	assert.Contains(t, text, "upload_duration_seconds_bucket{le=\"0.5\"} 1\n")
+	assert.Contains(t, text, "upload_duration_seconds_bucket{le=\"30\"} 2\n")
+	assert.Contains(t, text, "upload_duration_seconds_bucket{le=\"+Inf\"} 2\n")
+	assert.Contains(t, text, "upload_duration_seconds_sum 20.3\n")
+	assert.Contains(t, text, "upload_duration_seconds_count 2\n")
+}
+
+func TestUpload_Nil(t *testing.T) {
+	var m *Upload
+	assert.NotPanics(t, func() {
+		m.Uploaded(1, time.Second)
+		m.Failed()
+		m.Corrupt()
+		m.Skipped()
+	})
+}
+
+func TestServe(t *testing.T) {
+	r := NewRegistry()
+	NewUpload(r).Uploaded(10, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := Serve(ctx, "127.0.0.1:0", r)
+	require.NoError(t, err)
+	resp, err := http.Get("http://" + s.Addr() + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "uploads_total 1\n")
+
+	// Cancelling the context stops the server
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case <-s.done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// shutdownTimeout bounds how long a scrape in progress may delay shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the metrics of a registry on /metrics
+type Server struct {
+	server *http.Server
+	addr   string
+	done   chan struct{}
+}
+
+// Serve starts serving metrics on addr until ctx is cancelled or Close is
+// called. It fails straight away if the address can't be listened on.
+func Serve(ctx context.Context, addr string, r *Registry) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+
+	s := &Server{
+		server: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		addr:   listener.Addr().String(),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed: %v", err)
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+
+	logger.Info("Serving metrics on http://%s/metrics", s.addr)
+	return s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Close stops the server, waiting briefly for scrapes in progress
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		logger.Warn("Failed to shut down metrics server: %v", err)
+	}
+	<-s.done
+}
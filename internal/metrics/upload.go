@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Upper bounds of the upload duration buckets in seconds, from small photos
+// to large videos on a slow connection
+var durationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// Upload holds the metrics recorded by the uploaders of all archives. A nil
+// *Upload records nothing, so callers don't need to check if metrics are on.
+type Upload struct {
+	uploads        *Counter
+	uploadsFailed  *Counter
+	filesCorrupt   *Counter
+	bytesUploaded  *Counter
+	filesSkipped   *Counter
+	uploadDuration *Histogram
+}
+
+// NewUpload creates the upload metrics in a registry
+func NewUpload(r *Registry) *Upload {
+	return &Upload{
+		uploads:        r.NewCounter("uploads_total", "Files uploaded successfully."),
+		uploadsFailed:  r.NewCounter("uploads_failed_total", "Files that failed to upload."),
+		filesCorrupt:   r.NewCounter("files_corrupt_total", "Files that could not be read because their archive entry is corrupt."),
+		bytesUploaded:  r.NewCounter("bytes_uploaded_total", "Bytes of the files uploaded successfully."),
+		filesSkipped:   r.NewCounter("files_skipped_total", "Files skipped because they were already uploaded or are duplicates."),
+		uploadDuration: r.NewHistogram("upload_duration_seconds", "Time taken to upload a file, including retries.", durationBuckets),
+	}
+}
+
+// Uploaded records a file uploaded successfully
+func (m *Upload) Uploaded(size int64, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.uploads.Inc()
+	m.bytesUploaded.Add(uint64(size))
+	m.uploadDuration.Observe(duration.Seconds())
+}
+
+// Failed records a file that failed to upload
+func (m *Upload) Failed() {
+	if m == nil {
+		return
+	}
+	m.uploadsFailed.Inc()
+}
+
+// Corrupt records a file that could not be read from its archive
+func (m *Upload) Corrupt() {
+	if m == nil {
+		return
+	}
+	m.filesCorrupt.Inc()
+}
+
+// Skipped records a file that didn't need to be uploaded
+func (m *Upload) Skipped() {
+	if m == nil {
+		return
+	}
+	m.filesSkipped.Inc()
+}
@@ -0,0 +1,125 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const barWidth = 30
+
+// Bar renders the combined progress of all its reporters as a single
+// terminal line that is redrawn in place
+type Bar struct {
+	mu        sync.Mutex
+	out       io.Writer
+	reporters []*Reporter
+	interval  time.Duration
+	startTime time.Time
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewBar creates a progress bar that writes to out
+func NewBar(out io.Writer) *Bar {
+	return &Bar{
+		out:      out,
+		interval: 200 * time.Millisecond,
+		stop:     make(chan struct{}),
+	}
+}
+
+// IsTerminal reports whether f is an interactive terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// NewReporter creates a reporter whose progress is shown on the bar instead of logged
+func (b *Bar) NewReporter() *Reporter {
+	r := New()
+	r.bar = b
+
+	b.mu.Lock()
+	b.reporters = append(b.reporters, r)
+	b.mu.Unlock()
+
+	return r
+}
+
+// Start begins redrawing the bar periodically
+func (b *Bar) Start() {
+	b.startTime = time.Now()
+	b.wg.Add(1)
+
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.render()
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the final state of the bar and moves to the next line
+func (b *Bar) Stop() {
+	close(b.stop)
+	b.wg.Wait()
+
+	b.render()
+	fmt.Fprintln(b.out)
+}
+
+// render draws the bar from the current state of all reporters
+func (b *Bar) render() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Combine all archives, measuring throughput since the bar started
+	combined := Snapshot{Elapsed: time.Since(b.startTime)}
+	for _, r := range b.reporters {
+		s := r.Snapshot()
+		combined.TotalFiles += s.TotalFiles
+		combined.Completed += s.Completed
+		combined.Skipped += s.Skipped
+		combined.Errors += s.Errors
+		combined.TotalBytes += s.TotalBytes
+		combined.UploadedBytes += s.UploadedBytes
+		combined.SkippedBytes += s.SkippedBytes
+	}
+
+	fmt.Fprint(b.out, "\r"+formatBar(combined)+"\x1b[K")
+}
+
+// formatBar formats a progress line with the files done, throughput and ETA
+func formatBar(s Snapshot) string {
+	fraction := 0.0
+	if s.TotalFiles > 0 {
+		fraction = float64(s.Processed()) / float64(s.TotalFiles)
+	}
+
+	filled := int(fraction * barWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+
+	eta := "unknown"
+	if remaining, ok := s.ETA(); ok && s.TotalFiles > 0 {
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("[%s] %3.0f%% %d/%d files  %.2f MB/s  ETA %s",
+		bar, fraction*100, s.Processed(), s.TotalFiles, s.Throughput()/(1024*1024), eta)
+}
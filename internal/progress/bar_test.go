@@ -0,0 +1,49 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBar(t *testing.T) {
+	line := formatBar(Snapshot{
+		TotalFiles:    10,
+		Completed:     5,
+		TotalBytes:    40 * 1024 * 1024,
+		UploadedBytes: 20 * 1024 * 1024,
+		Elapsed:       10 * time.Second,
+	})
+
+	assert.Contains(t, line, "["+strings.Repeat("=", 15)+strings.Repeat(" ", 15)+"]")
+	assert.Contains(t, line, " 50% 5/10 files")
+	assert.Contains(t, line, "2.00 MB/s")
+	assert.Contains(t, line, "ETA 10s")
+
+	assert.Contains(t, formatBar(Snapshot{}), "ETA unknown")
+	assert.Contains(t, formatBar(Snapshot{TotalFiles: 3, Skipped: 3, Elapsed: time.Second}), "ETA 0s")
+}
+
+func TestBar_CombinesReporters(t *testing.T) {
+	var out bytes.Buffer
+	bar := NewBar(&out)
+
+	first := bar.NewReporter()
+	first.Start(2, 2048)
+	first.AddBytes(1024)
+	first.Complete("a.jpg")
+
+	second := bar.NewReporter()
+	second.Start(2, 2048)
+	second.Skip("b.jpg", 1024)
+	second.Error("c.jpg", assert.AnError)
+
+	bar.Start()
+	bar.Stop()
+
+	assert.Contains(t, out.String(), "\r[")
+	assert.Contains(t, out.String(), "3/4 files")
+}
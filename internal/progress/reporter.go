@@ -2,6 +2,7 @@
 package progress
 
 import (
+	"io"
 	"sync"
 	"time"
 
@@ -15,10 +16,55 @@ type Reporter struct {
 	completed      int
 	skipped        int
 	errors         int
+	totalBytes     int64
+	uploadedBytes  int64
+	skippedBytes   int64
 	startTime      time.Time
 	lastUpdateTime time.Time
 	updateInterval time.Duration
 	archive        string
+	bar            *Bar // Renders progress instead of logging it, if set
+}
+
+// Snapshot is a point in time copy of the progress of a reporter
+type Snapshot struct {
+	Archive       string
+	TotalFiles    int
+	Completed     int
+	Skipped       int
+	Errors        int
+	TotalBytes    int64
+	UploadedBytes int64
+	SkippedBytes  int64
+	Elapsed       time.Duration
+}
+
+// Processed returns the number of files that have been handled in any way
+func (s Snapshot) Processed() int {
+	return s.Completed + s.Skipped + s.Errors
+}
+
+// Throughput returns the upload rate in bytes per second
+func (s Snapshot) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.UploadedBytes) / s.Elapsed.Seconds()
+}
+
+// ETA estimates the time left from the bytes still to upload and the byte
+// rate so far. It returns false if there is no rate to estimate from yet.
+func (s Snapshot) ETA() (time.Duration, bool) {
+	remaining := s.TotalBytes - s.UploadedBytes - s.SkippedBytes
+	if remaining <= 0 {
+		return 0, true
+	}
+
+	rate := s.Throughput()
+	if rate <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
 }
 
 // New creates a new progress reporter
@@ -28,8 +74,8 @@ func New() *Reporter {
 	}
 }
 
-// Start initializes the progress reporter with the total number of files
-func (r *Reporter) Start(total int) {
+// Start initializes the progress reporter with the total number and size of files
+func (r *Reporter) Start(total int, totalBytes int64) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -37,12 +83,33 @@ func (r *Reporter) Start(total int) {
 	r.completed = 0
 	r.skipped = 0
 	r.errors = 0
+	r.totalBytes = totalBytes
+	r.uploadedBytes = 0
+	r.skippedBytes = 0
 	r.startTime = time.Now()
 	r.lastUpdateTime = time.Now()
 
 	logger.Info("Starting upload of %d files", total)
 }
 
+// AddBytes records bytes sent to the bucket
+func (r *Reporter) AddBytes(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.uploadedBytes += n
+	r.updateProgress()
+}
+
+// Reader wraps a reader so that the bytes read from it are recorded as
+// uploaded. A nil reporter returns the reader unchanged.
+func (r *Reporter) Reader(reader io.Reader) io.Reader {
+	if r == nil {
+		return reader
+	}
+	return &countingReader{reader: reader, reporter: r}
+}
+
 // Complete marks a file as successfully uploaded
 func (r *Reporter) Complete(path string) {
 	r.mu.Lock()
@@ -52,12 +119,13 @@ func (r *Reporter) Complete(path string) {
 	r.updateProgress()
 }
 
-// Skip marks a file as skipped
-func (r *Reporter) Skip(path string) {
+// Skip marks a file of the given size as skipped
+func (r *Reporter) Skip(path string, size int64) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.skipped++
+	r.skippedBytes += size
 	r.updateProgress()
 }
 
@@ -81,35 +149,65 @@ func (r *Reporter) Finish() {
 		r.completed, r.total, r.skipped, r.errors, duration.Round(time.Second))
 }
 
+// Snapshot returns the current progress
+func (r *Reporter) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.snapshot()
+}
+
+// snapshot copies the counters, the caller must hold the lock
+func (r *Reporter) snapshot() Snapshot {
+	var elapsed time.Duration
+	if !r.startTime.IsZero() {
+		elapsed = time.Since(r.startTime)
+	}
+
+	return Snapshot{
+		Archive:       r.archive,
+		TotalFiles:    r.total,
+		Completed:     r.completed,
+		Skipped:       r.skipped,
+		Errors:        r.errors,
+		TotalBytes:    r.totalBytes,
+		UploadedBytes: r.uploadedBytes,
+		SkippedBytes:  r.skippedBytes,
+		Elapsed:       elapsed,
+	}
+}
+
 // updateProgress updates and displays the progress
 func (r *Reporter) updateProgress() {
+	// The bar redraws itself from the counters
+	if r.bar != nil {
+		return
+	}
+
 	now := time.Now()
 	if now.Sub(r.lastUpdateTime) < r.updateInterval {
 		return
 	}
 
 	r.lastUpdateTime = now
-	duration := now.Sub(r.startTime)
-	processed := r.completed + r.skipped + r.errors
+	s := r.snapshot()
+	processed := s.Processed()
 
-	if processed == 0 {
+	if processed == 0 && s.UploadedBytes == 0 {
 		return
 	}
 
-	percentage := float64(processed) / float64(r.total) * 100
+	percentage := float64(processed) / float64(s.TotalFiles) * 100
 
-	// Calculate estimated time remaining
-	var eta string
-	if r.completed > 0 {
-		timePerFile := duration / time.Duration(processed)
-		remaining := timePerFile * time.Duration(r.total-processed)
+	// Estimate the time remaining from the bytes left to upload
+	eta := "unknown"
+	if remaining, ok := s.ETA(); ok {
 		eta = remaining.Round(time.Second).String()
-	} else {
-		eta = "unknown"
 	}
 
-	logger.Info("Progress: %.1f%% (%d/%d, %d completed, %d skipped, %d errors) ETA: %s | Archive: %s",
-		percentage, processed, r.total, r.completed, r.skipped, r.errors, eta, r.archive)
+	logger.Info("Progress: %.1f%% (%d/%d, %d completed, %d skipped, %d errors) %.2f MB/s ETA: %s | Archive: %s",
+		percentage, processed, s.TotalFiles, s.Completed, s.Skipped, s.Errors,
+		s.Throughput()/(1024*1024), eta, s.Archive)
 }
 
 // SetArchive sets the current archive being processed
@@ -119,3 +217,17 @@ func (r *Reporter) SetArchive(archive string) {
 
 	r.archive = archive
 }
+
+// countingReader reports the bytes read through it to a reporter
+type countingReader struct {
+	reader   io.Reader
+	reporter *Reporter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	if n > 0 {
+		c.reporter.AddBytes(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,50 @@
+package progress
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter_Snapshot(t *testing.T) {
+	r := New()
+	r.SetArchive("takeout-001.zip")
+	r.Start(3, 1000)
+
+	// Bytes are counted as they are read
+	_, err := io.Copy(io.Discard, r.Reader(strings.NewReader(strings.Repeat("x", 600))))
+	require.NoError(t, err)
+	r.Complete("video.mp4")
+	r.Skip("thumb.jpg", 100)
+
+	s := r.Snapshot()
+	assert.Equal(t, "takeout-001.zip", s.Archive)
+	assert.Equal(t, 3, s.TotalFiles)
+	assert.Equal(t, 1, s.Completed)
+	assert.Equal(t, 1, s.Skipped)
+	assert.Equal(t, 2, s.Processed())
+	assert.Equal(t, int64(600), s.UploadedBytes)
+	assert.Equal(t, int64(100), s.SkippedBytes)
+}
+
+func TestSnapshot_ETA(t *testing.T) {
+	// 300 bytes left at 60 bytes per second
+	s := Snapshot{TotalBytes: 1000, UploadedBytes: 600, SkippedBytes: 100, Elapsed: 10 * time.Second}
+	eta, ok := s.ETA()
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, eta)
+	assert.Equal(t, 60.0, s.Throughput())
+
+	_, ok = Snapshot{TotalBytes: 1000, Elapsed: time.Second}.ETA()
+	assert.False(t, ok)
+}
+
+func TestReporter_NilReader(t *testing.T) {
+	var r *Reporter
+	reader := strings.NewReader("data")
+	assert.Same(t, reader, r.Reader(reader))
+}
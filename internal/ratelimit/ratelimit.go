@@ -0,0 +1,108 @@
+// internal/ratelimit/ratelimit.go
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// minBurst is the smallest burst size so low rates still read in reasonable chunks
+const minBurst = 32 * 1024
+
+// Limiter is a token bucket limiting throughput in bytes per second. A single
+// Limiter can be shared by any number of readers to cap their combined rate.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter allowing the given number of bytes per second.
+// A rate of zero or less disables limiting and returns nil.
+func New(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := float64(bytesPerSecond)
+	if burst < minBurst {
+		burst = minBurst
+	}
+
+	return &Limiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes may be transferred or the context is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// Reserve the tokens up front so concurrent callers queue behind each other
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader wraps r so reads from it are throttled by the limiter.
+// If the limiter is nil, r is returned unchanged.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, reader: r, limiter: l}
+}
+
+// reader is an io.Reader throttled by a Limiter
+type reader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *Limiter
+}
+
+// Read reads at most one burst at a time and waits for the bytes read
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > int(r.limiter.burst) {
+		p = p[:int(r.limiter.burst)]
+	}
+
+	n, err := r.reader.Read(p)
+	if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader_RespectsRate(t *testing.T) {
+	const rate = 256 * 1024
+	data := bytes.Repeat([]byte("x"), 3*rate)
+
+	limiter := New(rate)
+	start := time.Now()
+	content, err := io.ReadAll(limiter.Reader(context.Background(), bytes.NewReader(data)))
+	elapsed := time.Since(start)
+
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+
+	// The bucket starts full, so only the bytes beyond the first burst are throttled
+	minimum := time.Duration(float64(len(data)-rate) / rate * float64(time.Second))
+	assert.GreaterOrEqual(t, elapsed, minimum-50*time.Millisecond)
+}
+
+func TestReader_SharedLimiter(t *testing.T) {
+	const rate = 256 * 1024
+	limiter := New(rate)
+	ctx := context.Background()
+
+	// Two readers sharing a limiter are capped at the combined rate
+	start := time.Now()
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := io.Copy(io.Discard, limiter.Reader(ctx, bytes.NewReader(make([]byte, rate))))
+			done <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, <-done)
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 950*time.Millisecond)
+}
+
+func TestReader_Cancelled(t *testing.T) {
+	limiter := New(minBurst)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := io.ReadAll(limiter.Reader(ctx, bytes.NewReader(make([]byte, 4*minBurst))))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNew_Disabled(t *testing.T) {
+	assert.Nil(t, New(0))
+
+	var limiter *Limiter
+	r := bytes.NewReader([]byte("data"))
+	assert.Same(t, r, limiter.Reader(context.Background(), r))
+}
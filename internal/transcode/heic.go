@@ -0,0 +1,29 @@
+//go:build heic
+
+package transcode
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/jdeng/goheif"
+)
+
+func init() {
+	heicDecoder = decodeHEIC
+}
+
+// decodeHEIC decodes a HEIC photo with libde265 through goheif. Photos
+// without an EXIF block are still decoded.
+func decodeHEIC(data []byte) (image.Image, []byte, error) {
+	img, err := goheif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exifData, err := goheif.ExtractExif(bytes.NewReader(data))
+	if err != nil {
+		exifData = nil
+	}
+	return img, exifData, nil
+}
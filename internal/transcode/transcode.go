@@ -0,0 +1,103 @@
+// Package transcode converts photos to formats more viewers can display
+package transcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"path"
+	"strings"
+)
+
+// JPEGContentType is the content type of transcoded photos
+const JPEGContentType = "image/jpeg"
+
+// Quality is the JPEG quality transcoded photos are encoded with
+const Quality = 90
+
+// ErrUnavailable is returned when the program was built without HEIC support
+var ErrUnavailable = errors.New("HEIC decoding is not included in this build, rebuild with -tags heic")
+
+// exifHeader starts the APP1 segment that holds EXIF data in a JPEG
+var exifHeader = []byte("Exif\x00\x00")
+
+// heicDecoder decodes a HEIC image and returns its EXIF block, if it has one.
+// It is only set in builds with the heic tag.
+var heicDecoder func(data []byte) (image.Image, []byte, error)
+
+// Available reports whether HEIC photos can be transcoded in this build
+func Available() bool {
+	return heicDecoder != nil
+}
+
+// IsHEIC reports whether a file is a HEIC or HEIF photo
+func IsHEIC(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".heic", ".heif":
+		return true
+	default:
+		return false
+	}
+}
+
+// JPEGKey returns the key a transcoded photo is stored under: the key of the
+// original with a .jpg extension
+func JPEGKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".jpg"
+}
+
+// HEICToJPEG decodes a HEIC photo and encodes it as a JPEG, carrying over the
+// EXIF block so the capture time, camera and location are kept
+func HEICToJPEG(r io.Reader) ([]byte, error) {
+	if heicDecoder == nil {
+		return nil, ErrUnavailable
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEIC photo: %w", err)
+	}
+
+	img, exifData, err := heicDecoder(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode HEIC photo: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: Quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+
+	return withEXIF(buf.Bytes(), exifData)
+}
+
+// withEXIF inserts an EXIF block into a JPEG as an APP1 segment right after
+// the start of image marker
+func withEXIF(jpg, exifData []byte) ([]byte, error) {
+	if len(exifData) == 0 {
+		return jpg, nil
+	}
+	if len(jpg) < 2 || jpg[0] != 0xff || jpg[1] != 0xd8 {
+		return nil, errors.New("not a JPEG image")
+	}
+
+	if !bytes.HasPrefix(exifData, exifHeader) {
+		exifData = append(append([]byte{}, exifHeader...), exifData...)
+	}
+
+	// The segment length counts itself but not the marker
+	length := len(exifData) + 2
+	if length > 0xffff {
+		return nil, fmt.Errorf("EXIF block of %d bytes does not fit in a JPEG segment", len(exifData))
+	}
+
+	out := make([]byte, 0, len(jpg)+length+2)
+	out = append(out, jpg[:2]...)
+	out = append(out, 0xff, 0xe1, byte(length>>8), byte(length))
+	out = append(out, exifData...)
+	out = append(out, jpg[2:]...)
+	return out, nil
+}
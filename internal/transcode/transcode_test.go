@@ -0,0 +1,66 @@
+package transcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withDecoder replaces the HEIC decoder for the duration of a test
+func withDecoder(t *testing.T, decoder func(data []byte) (image.Image, []byte, error)) {
+	previous := heicDecoder
+	heicDecoder = decoder
+	t.Cleanup(func() { heicDecoder = previous })
+}
+
+func TestIsHEIC(t *testing.T) {
+	assert.True(t, IsHEIC("Photos from 2023/IMG_0001.HEIC"))
+	assert.True(t, IsHEIC("IMG_0001.heif"))
+	assert.False(t, IsHEIC("IMG_0001.jpg"))
+	assert.False(t, IsHEIC("heic"))
+}
+
+func TestJPEGKey(t *testing.T) {
+	assert.Equal(t, "2023/IMG_0001.jpg", JPEGKey("2023/IMG_0001.HEIC"))
+	assert.Equal(t, "album.v2/IMG_0001.jpg", JPEGKey("album.v2/IMG_0001.heic"))
+}
+
+func TestHEICToJPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	exifData := []byte("MM\x00\x2a\x00\x00\x00\x08")
+
+	withDecoder(t, func(data []byte) (image.Image, []byte, error) {
+		assert.Equal(t, []byte("heic"), data)
+		return img, exifData, nil
+	})
+
+	jpg, err := HEICToJPEG(bytes.NewReader([]byte("heic")))
+	require.NoError(t, err)
+
+	// The EXIF block follows the start of image marker in an APP1 segment
+	segment := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x10}, exifHeader...)
+	assert.Equal(t, append(segment, exifData...), jpg[:len(segment)+len(exifData)])
+
+	decoded, err := jpeg.Decode(bytes.NewReader(jpg))
+	require.NoError(t, err)
+	assert.Equal(t, img.Bounds(), decoded.Bounds())
+}
+
+func TestHEICToJPEG_Errors(t *testing.T) {
+	withDecoder(t, nil)
+	_, err := HEICToJPEG(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	withDecoder(t, func(data []byte) (image.Image, []byte, error) {
+		return nil, nil, errors.New("corrupt")
+	})
+	_, err = HEICToJPEG(bytes.NewReader(nil))
+	assert.ErrorContains(t, err, "corrupt")
+}
@@ -0,0 +1,122 @@
+package uploader
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// ErrCircuitOpen is returned for operations that weren't attempted because
+// too many operations failed in a row
+var ErrCircuitOpen = errors.New("circuit breaker is open after repeated failures")
+
+// CircuitBreaker stops operations against an endpoint that keeps failing.
+// After Threshold consecutive failed attempts it opens and fails operations
+// right away for the cool-down, then lets a single attempt through to test
+// the endpoint. That attempt closes the circuit if it succeeds and opens it
+// again if it fails. A nil breaker lets every operation through.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool // a half-open attempt is in flight
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold consecutive
+// failures, or nil to disable it if threshold is 0
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow returns an error wrapping ErrCircuitOpen if an attempt shouldn't be
+// made. An allowed attempt must be followed by Success, Failure or Release.
+func (cb *CircuitBreaker) Allow() error {
+	if cb == nil {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.open {
+		return nil
+	}
+
+	remaining := cb.cooldown - cb.now().Sub(cb.openedAt)
+	if remaining > 0 {
+		return fmt.Errorf("%w, trying again in %v", ErrCircuitOpen, remaining.Round(time.Second))
+	}
+
+	// Half-open: let one attempt test the endpoint while the rest keep failing fast
+	if cb.probing {
+		return fmt.Errorf("%w, waiting for a test request", ErrCircuitOpen)
+	}
+	cb.probing = true
+	logger.Info("Testing the endpoint after a %v cool-down", cb.cooldown)
+	return nil
+}
+
+// Success records an attempt that reached the endpoint, closing the circuit
+func (cb *CircuitBreaker) Success() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.open {
+		logger.Info("Endpoint is responding again, resuming uploads")
+	}
+	cb.failures = 0
+	cb.open = false
+	cb.probing = false
+}
+
+// Release records an attempt that ended without telling whether the
+// endpoint works, such as one whose context ran out. A half-open test is
+// given up, leaving the circuit open for the next attempt to test it.
+func (cb *CircuitBreaker) Release() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+}
+
+// Failure records a failed attempt, opening the circuit once the threshold
+// is reached or the half-open test fails
+func (cb *CircuitBreaker) Failure() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.open && !cb.probing {
+		// An attempt that started before the circuit opened
+		return
+	}
+	if cb.probing || cb.failures >= cb.threshold {
+		logger.Warn("%d S3 requests failed in a row, failing uploads for %v before trying again", cb.failures, cb.cooldown)
+		cb.open = true
+		cb.probing = false
+		cb.openedAt = cb.now()
+	}
+}
@@ -0,0 +1,114 @@
+package uploader
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// ErrChecksumMismatch is returned when an uploaded object doesn't match the
+// bytes that were sent. It is retryable so the file is uploaded again.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumReader computes the SHA-256 and MD5 of the bytes read through it
+type checksumReader struct {
+	reader io.Reader
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newChecksumReader(reader io.Reader) *checksumReader {
+	c := &checksumReader{
+		sha256: sha256.New(),
+		md5:    md5.New(),
+	}
+	c.reader = io.TeeReader(reader, io.MultiWriter(c.sha256, c.md5))
+	return c
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// SHA256 returns the hex encoded SHA-256 of the bytes read so far
+func (c *checksumReader) SHA256() string {
+	return hex.EncodeToString(c.sha256.Sum(nil))
+}
+
+// MD5 returns the hex encoded MD5 of the bytes read so far
+func (c *checksumReader) MD5() string {
+	return hex.EncodeToString(c.md5.Sum(nil))
+}
+
+// plainETag returns the MD5 an ETag holds. ETags of multipart uploads, which
+// end in the part count, are not a hash of the content and are rejected.
+func plainETag(etag string) (string, bool) {
+	etag = strings.ToLower(strings.Trim(etag, `"`))
+	if len(etag) != md5.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return "", false
+	}
+	return etag, true
+}
+
+// verifyUpload checks that the object written by an upload matches the bytes
+// read through sums. Objects with a plain MD5 ETag are checked against it,
+// unless they are encrypted with a KMS or customer key and the ETag is not an
+// MD5 after all. Other objects are downloaded and hashed if checksum
+// verification is on.
+func (u *Uploader) verifyUpload(ctx context.Context, key string, info s3client.UploadInfo, sums *checksumReader) error {
+	if etag, ok := plainETag(info.ETag); ok {
+		sse := info.ServerSideEncryption
+		if etag != sums.MD5() && sse == "" {
+			// Not every backend reports the encryption of an upload
+			stat, err := u.s3Client.StatObject(ctx, key)
+			if err != nil {
+				return fmt.Errorf("failed to check the encryption of %s: %w", key, err)
+			}
+			sse = stat.ServerSideEncryption
+		}
+
+		if !s3client.EncryptedWithKey(sse) {
+			if etag != sums.MD5() {
+				return fmt.Errorf("%w: ETag %s does not match MD5 %s of the uploaded data", ErrChecksumMismatch, etag, sums.MD5())
+			}
+			return nil
+		}
+
+		if !u.config.Upload.VerifyChecksums {
+			logger.Debug("Not checking %s, whose ETag isn't an MD5 with %s encryption", key, sse)
+			return nil
+		}
+	}
+
+	if !u.config.Upload.VerifyChecksums {
+		return nil
+	}
+
+	object, _, err := u.s3Client.GetObject(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to download %s for verification: %w", key, err)
+	}
+	defer object.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object); err != nil {
+		return fmt.Errorf("failed to download %s for verification: %w", key, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != sums.SHA256() {
+		return fmt.Errorf("%w: SHA-256 %s of the stored object does not match %s of the uploaded data", ErrChecksumMismatch, sum, sums.SHA256())
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumReader(t *testing.T) {
+	sums := newChecksumReader(strings.NewReader("hello"))
+	data, err := io.ReadAll(sums)
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", sums.MD5())
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sums.SHA256())
+}
+
+func TestPlainETag(t *testing.T) {
+	tests := []struct {
+		etag     string
+		expected string
+		ok       bool
+	}{
+		{`"5d41402abc4b2a76b9719d911017c592"`, "5d41402abc4b2a76b9719d911017c592", true},
+		{"5D41402ABC4B2A76B9719D911017C592", "5d41402abc4b2a76b9719d911017c592", true},
+		{`"5d41402abc4b2a76b9719d911017c592-3"`, "", false},
+		{"", "", false},
+		{"not-a-hash-but-32-characters-lon", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.etag, func(t *testing.T) {
+			etag, ok := plainETag(tt.etag)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, etag)
+		})
+	}
+}
+
+func TestVerifyUpload(t *testing.T) {
+	ctx := context.Background()
+	mockS3 := new(MockS3Client)
+	mockS3.On("StatObject", ctx, "photo.jpg").Return(s3client.ObjectInfo{}, nil).Once()
+	up := New(ctx, mockS3, nil, nil, nil, nil, &config.Config{})
+
+	sums := newChecksumReader(strings.NewReader("hello"))
+	_, err := io.Copy(io.Discard, sums)
+	require.NoError(t, err)
+
+	// Matching MD5 ETag
+	err = up.verifyUpload(ctx, "photo.jpg", s3client.UploadInfo{ETag: `"5d41402abc4b2a76b9719d911017c592"`}, sums)
+	assert.NoError(t, err)
+
+	// Corrupted object
+	err = up.verifyUpload(ctx, "photo.jpg", s3client.UploadInfo{ETag: `"00000000000000000000000000000000"`}, sums)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.True(t, DefaultRetryConfig().IsRetryable(fmt.Errorf("upload failed: %w", err)))
+
+	// Multipart ETags can't be checked without --verify-checksums
+	err = up.verifyUpload(ctx, "photo.jpg", s3client.UploadInfo{ETag: `"abc-2"`}, sums)
+	assert.NoError(t, err)
+
+	// A reported encryption saves looking it up
+	err = up.verifyUpload(ctx, "photo.jpg", s3client.UploadInfo{ETag: `"00000000000000000000000000000000"`, ServerSideEncryption: "AES256"}, sums)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	mockS3.AssertExpectations(t)
+}
+
+func TestVerifyUpload_EncryptedWithKey(t *testing.T) {
+	ctx := context.Background()
+	kmsETag := `"6b3ac4a05f4e2ac4d3b9d0e5f1a7c2e8"`
+
+	mockS3 := new(MockS3Client)
+	mockS3.On("StatObject", ctx, "minio.jpg").Return(s3client.ObjectInfo{ServerSideEncryption: "aws:kms"}, nil).Once()
+	up := New(ctx, mockS3, nil, nil, nil, nil, &config.Config{})
+
+	sums := newChecksumReader(strings.NewReader("hello"))
+	_, err := io.Copy(io.Discard, sums)
+	require.NoError(t, err)
+
+	// The ETags of SSE-KMS and SSE-C objects aren't compared with the MD5
+	assert.NoError(t, up.verifyUpload(ctx, "kms.jpg", s3client.UploadInfo{ETag: kmsETag, ServerSideEncryption: "aws:kms"}, sums))
+	assert.NoError(t, up.verifyUpload(ctx, "ssec.jpg", s3client.UploadInfo{ETag: kmsETag, ServerSideEncryption: s3client.SSECustomer}, sums))
+
+	// Backends that don't report the encryption of uploads are asked for it
+	assert.NoError(t, up.verifyUpload(ctx, "minio.jpg", s3client.UploadInfo{ETag: kmsETag}, sums))
+	mockS3.AssertExpectations(t)
+
+	// With --verify-checksums they are downloaded instead
+	mockS3 = new(MockS3Client)
+	mockS3.On("GetObject", ctx, "good.jpg").Return(io.NopCloser(strings.NewReader("hello")), s3client.ObjectInfo{}, nil).Once()
+	mockS3.On("GetObject", ctx, "bad.jpg").Return(io.NopCloser(strings.NewReader("hellp")), s3client.ObjectInfo{}, nil).Once()
+	cfg := &config.Config{}
+	cfg.Upload.VerifyChecksums = true
+	up = New(ctx, mockS3, nil, nil, nil, nil, cfg)
+
+	assert.NoError(t, up.verifyUpload(ctx, "good.jpg", s3client.UploadInfo{ETag: kmsETag, ServerSideEncryption: "aws:kms"}, sums))
+	assert.ErrorIs(t, up.verifyUpload(ctx, "bad.jpg", s3client.UploadInfo{ETag: kmsETag, ServerSideEncryption: "aws:kms"}, sums), ErrChecksumMismatch)
+	mockS3.AssertExpectations(t)
+}
+
+func TestVerifyUpload_Download(t *testing.T) {
+	ctx := context.Background()
+	mockS3 := new(MockS3Client)
+	mockS3.On("GetObject", ctx, "good.mp4").Return(io.NopCloser(strings.NewReader("hello")), s3client.ObjectInfo{}, nil).Once()
+	mockS3.On("GetObject", ctx, "bad.mp4").Return(io.NopCloser(strings.NewReader("hellp")), s3client.ObjectInfo{}, nil).Once()
+
+	cfg := &config.Config{}
+	cfg.Upload.VerifyChecksums = true
+	up := New(ctx, mockS3, nil, nil, nil, nil, cfg)
+
+	sums := newChecksumReader(strings.NewReader("hello"))
+	_, err := io.Copy(io.Discard, sums)
+	require.NoError(t, err)
+
+	assert.NoError(t, up.verifyUpload(ctx, "good.mp4", s3client.UploadInfo{ETag: `"abc-2"`}, sums))
+	assert.ErrorIs(t, up.verifyUpload(ctx, "bad.mp4", s3client.UploadInfo{ETag: `"abc-2"`}, sums), ErrChecksumMismatch)
+	mockS3.AssertExpectations(t)
+}
@@ -0,0 +1,65 @@
+package uploader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrCorruptEntry is returned for files whose archive entry can't be read
+// because it fails its checksum or doesn't decompress. Reading it again gives
+// the same result, so it isn't retried.
+var ErrCorruptEntry = errors.New("archive entry is corrupt")
+
+// isCorruption reports whether an error from reading an archive means the
+// entry itself is damaged rather than the read failed
+func isCorruption(err error) bool {
+	var flateErr flate.CorruptInputError
+	return errors.Is(err, ErrCorruptEntry) ||
+		errors.Is(err, zip.ErrChecksum) ||
+		errors.Is(err, zip.ErrFormat) ||
+		errors.Is(err, zip.ErrAlgorithm) ||
+		errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, gzip.ErrHeader) ||
+		errors.Is(err, tar.ErrHeader) ||
+		errors.As(err, &flateErr)
+}
+
+// corruptionReader remembers the first corruption error read from an archive
+// entry. S3 clients don't always wrap the errors of the body they send, so
+// the upload error alone can't tell a damaged entry from a failed request.
+type corruptionReader struct {
+	r io.Reader
+
+	mu  sync.Mutex
+	err error
+}
+
+func newCorruptionReader(r io.Reader) *corruptionReader {
+	return &corruptionReader{r: r}
+}
+
+func (c *corruptionReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && isCorruption(err) {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = fmt.Errorf("%w: %w", ErrCorruptEntry, err)
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// Err returns the corruption error seen so far, wrapping ErrCorruptEntry, or
+// nil if there was none
+func (c *corruptionReader) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -0,0 +1,88 @@
+package uploader
+
+import (
+	"context"
+	"sync"
+)
+
+// DedupeIndex tracks which object holds the content for each SHA-256 hash so
+// identical files are only uploaded once. It is safe for concurrent use and is
+// meant to be shared between the uploaders of all archives.
+type DedupeIndex struct {
+	mu      sync.Mutex
+	entries map[string]*dedupeEntry
+}
+
+// dedupeEntry is the upload of one piece of content
+type dedupeEntry struct {
+	key  string
+	done chan struct{}
+	ok   bool
+}
+
+// NewDedupeIndex creates an empty dedupe index
+func NewDedupeIndex() *DedupeIndex {
+	return &DedupeIndex{
+		entries: make(map[string]*dedupeEntry),
+	}
+}
+
+// Add records content that is already stored under key
+func (d *DedupeIndex) Add(sum string, key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.entries[sum]; exists {
+		return
+	}
+
+	done := make(chan struct{})
+	close(done)
+	d.entries[sum] = &dedupeEntry{key: key, done: done, ok: true}
+}
+
+// claim returns the object that holds the content for sum. If no other file
+// has the content yet, the caller becomes responsible for uploading it under
+// key, which claim reports by returning true, and must call release when done.
+// Otherwise claim waits until the owning upload finishes and returns its key.
+func (d *DedupeIndex) claim(ctx context.Context, sum string, key string) (string, bool, error) {
+	for {
+		d.mu.Lock()
+		entry, exists := d.entries[sum]
+		if !exists {
+			d.entries[sum] = &dedupeEntry{key: key, done: make(chan struct{})}
+			d.mu.Unlock()
+			return key, true, nil
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+
+		if entry.ok {
+			return entry.key, false, nil
+		}
+		// The owning upload failed and gave up its claim, so try to take it over
+	}
+}
+
+// release finishes a claim. Failed claims are dropped so that a later file
+// with the same content can upload it instead.
+func (d *DedupeIndex) release(sum string, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, exists := d.entries[sum]
+	if !exists {
+		return
+	}
+
+	entry.ok = ok
+	if !ok {
+		delete(d.entries, sum)
+	}
+	close(entry.done)
+}
@@ -0,0 +1,154 @@
+package uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/generic"
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeIndex(t *testing.T) {
+	ctx := context.Background()
+	index := NewDedupeIndex()
+	index.Add("seeded", "old/photo.jpg")
+
+	key, claimed, err := index.claim(ctx, "seeded", "new/photo.jpg")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "old/photo.jpg", key)
+
+	key, claimed, err = index.claim(ctx, "abc", "album/a.jpg")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, "album/a.jpg", key)
+
+	// A duplicate waits for the owning upload and takes over if it fails
+	result := make(chan bool, 1)
+	go func() {
+		_, claimed, _ := index.claim(ctx, "abc", "other/a.jpg")
+		result <- claimed
+	}()
+
+	select {
+	case <-result:
+		t.Fatal("duplicate did not wait for the owning upload")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	index.release("abc", false)
+	assert.True(t, <-result)
+
+	index.release("abc", true)
+	key, claimed, err = index.claim(ctx, "abc", "third/a.jpg")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "other/a.jpg", key)
+}
+
+func TestDedupeIndex_ClaimCancelled(t *testing.T) {
+	index := NewDedupeIndex()
+	_, claimed, err := index.claim(context.Background(), "abc", "a.jpg")
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = index.claim(ctx, "abc", "b.jpg")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestUploader_HashJournal(t *testing.T) {
+	ctx := context.Background()
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// Archives with their own journals share the hashes in the main one
+	shared := newJournal(t)
+	stats := NewStats()
+	cfg := &config.Config{}
+	cfg.Upload.Dedupe = true
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("same photo"), 0600))
+		src, err := generic.New(ctx, dir, generic.Options{ScanConcurrency: 1, HashFiles: true})
+		require.NoError(t, err)
+
+		// A fresh index for each archive stands in for a later run
+		up := New(ctx, mockS3, src, nil, worker.NewPool(1), nil, cfg,
+			WithDedupe(NewDedupeIndex()), WithHashJournal(shared), WithStats(stats))
+		require.NoError(t, up.Run())
+	}
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+	sum := sha256.Sum256([]byte("same photo"))
+	_, seen := shared.SeenHash(hex.EncodeToString(sum[:]))
+	assert.True(t, seen)
+
+	totals := stats.Totals()
+	assert.Equal(t, 1, totals.DuplicateFiles)
+	assert.Equal(t, int64(10), totals.DuplicateBytes)
+}
+
+func TestUploader_DedupeResumeWithKeyTemplate(t *testing.T) {
+	ctx := context.Background()
+	kt, err := ParseKeyTemplate("photos/{{.Filename}}")
+	require.NoError(t, err)
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "photos/a.jpg", mock.Anything, mock.Anything).Return(nil).Once()
+
+	cfg := &config.Config{}
+	cfg.Upload.Dedupe = true
+	scan := func(name string) source.Source {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "Trip"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Trip", name), []byte("same photo"), 0600))
+		src, err := generic.New(ctx, dir, generic.Options{ScanConcurrency: 1, HashFiles: true})
+		require.NoError(t, err)
+		return src
+	}
+
+	// The first run records the key of the upload, not the path of the file
+	path := filepath.Join(t.TempDir(), "journal.json")
+	jnl := journal.New(path)
+	up := New(ctx, mockS3, scan("a.jpg"), jnl, worker.NewPool(1), nil, cfg, WithKeyTemplate(kt), WithDedupe(NewDedupeIndex()))
+	require.NoError(t, up.Run())
+	require.NoError(t, jnl.Flush())
+
+	// A resumed run finds the original object under its key
+	loaded := journal.New(path)
+	require.NoError(t, loaded.Load())
+	up = New(ctx, mockS3, scan("b.jpg"), loaded, worker.NewPool(1), nil, cfg,
+		WithKeyTemplate(kt), WithDedupe(NewDedupeIndex()), WithHashJournal(loaded))
+	require.NoError(t, up.Run())
+
+	entry, ok := loaded.GetEntry("Trip/b.jpg")
+	require.True(t, ok)
+	assert.Equal(t, "photos/a.jpg", entry.DuplicateOf)
+
+	// So does one that only seeds the index from the uploads in its journal
+	loaded = journal.New(path)
+	require.NoError(t, loaded.Load())
+	up = New(ctx, mockS3, scan("c.jpg"), loaded, worker.NewPool(1), nil, cfg, WithKeyTemplate(kt), WithDedupe(NewDedupeIndex()))
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+	entry, ok = loaded.GetEntry("Trip/c.jpg")
+	require.True(t, ok)
+	assert.Equal(t, "photos/a.jpg", entry.DuplicateOf)
+}
@@ -0,0 +1,76 @@
+package uploader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
+)
+
+// ExistingKeys is the set of keys stored under the prefix, listed once
+// before a run so --skip-existing can check files without a HEAD request
+// each. Keys are relative to the prefix, like those of the uploader.
+type ExistingKeys struct {
+	mu   sync.RWMutex
+	keys map[string]struct{}
+}
+
+// ListExistingKeys lists the objects under the prefix of the client. It
+// returns nil if there are more than limit, so files are checked one at a
+// time instead of the run holding a large listing in memory. Clients that
+// list a page at a time stop listing as soon as the limit is passed. A limit
+// of 0 means no limit.
+func ListExistingKeys(ctx context.Context, client s3client.S3Interface, limit int) (*ExistingKeys, error) {
+	existing := &ExistingKeys{keys: make(map[string]struct{})}
+	add := func(object minio.ObjectInfo) bool {
+		if key, ok := s3client.RelativeKey(client.GetPrefix(), object.Key); ok {
+			existing.keys[key] = struct{}{}
+		}
+		return limit == 0 || len(existing.keys) <= limit
+	}
+
+	if walker, ok := client.(s3client.ObjectWalker); ok {
+		if err := walker.WalkObjects(ctx, "", add); err != nil {
+			return nil, err
+		}
+	} else {
+		objects, err := client.ListObjects(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if !add(object) {
+				break
+			}
+		}
+	}
+
+	if limit > 0 && len(existing.keys) > limit {
+		return nil, nil
+	}
+	return existing, nil
+}
+
+// Len returns the number of keys in the set
+func (e *ExistingKeys) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.keys)
+}
+
+// Has reports whether an object is stored under key
+func (e *ExistingKeys) Has(key string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.keys[key]
+	return ok
+}
+
+// Add records an object uploaded during the run, so a file of another
+// archive with the same key is skipped too
+func (e *ExistingKeys) Add(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys[key] = struct{}{}
+}
@@ -0,0 +1,107 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListExistingKeys(t *testing.T) {
+	mockS3 := new(MockS3Client)
+	mockS3.On("GetPrefix").Return("photos/")
+	mockS3.On("ListObjects", mock.Anything, "").Return([]minio.ObjectInfo{
+		{Key: "photos/Takeout/a.jpg"},
+		{Key: "photos/Takeout/b.jpg"},
+		{Key: "photos-old/Takeout/c.jpg"},
+	}, nil)
+
+	existing, err := ListExistingKeys(context.Background(), mockS3, 2)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, 2, existing.Len())
+	assert.True(t, existing.Has("Takeout/a.jpg"))
+	assert.False(t, existing.Has("Takeout/c.jpg"))
+
+	existing.Add("Takeout/c.jpg")
+	assert.True(t, existing.Has("Takeout/c.jpg"))
+
+	// Too many objects to hold in memory
+	existing, err = ListExistingKeys(context.Background(), mockS3, 1)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+}
+
+// walkingBucket lists objects one at a time and counts how many were read
+type walkingBucket struct {
+	s3client.S3Interface
+	keys []string
+	read int
+}
+
+func (b *walkingBucket) WalkObjects(ctx context.Context, prefix string, fn func(object minio.ObjectInfo) bool) error {
+	for _, key := range b.keys {
+		b.read++
+		if !fn(minio.ObjectInfo{Key: key}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (b *walkingBucket) GetPrefix() string { return "" }
+
+func TestListExistingKeys_StopsAtLimit(t *testing.T) {
+	bucket := &walkingBucket{keys: []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"}}
+	existing, err := ListExistingKeys(context.Background(), bucket, 2)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+	assert.Equal(t, 3, bucket.read)
+
+	bucket.read = 0
+	existing, err = ListExistingKeys(context.Background(), bucket, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 5, existing.Len())
+}
+
+func TestUploader_ExistingKeys(t *testing.T) {
+	files := []*source.MediaFile{
+		{Path: "a.jpg", Size: 3, Archive: "takeout.zip"},
+		{Path: "b.jpg", Size: 3, Archive: "takeout.zip"},
+	}
+	takeout := newMockTakeout(files)
+	takeout.On("OpenFile", "b.jpg").Return(MockReadCloser{strings.NewReader("abc")}, nil)
+
+	// No file is checked with a request of its own
+	mockS3 := newMockS3()
+	mockS3.On("GetPrefix").Return("")
+	mockS3.On("ListObjects", mock.Anything, "").Return([]minio.ObjectInfo{{Key: "a.jpg"}}, nil)
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "b.jpg", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		_, _ = io.ReadAll(args.Get(1).(io.Reader))
+	}).Return(nil)
+
+	existing, err := ListExistingKeys(context.Background(), mockS3, 0)
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	cfg.Upload.SkipExisting = true
+	jnl := newJournal(t)
+	up := New(context.Background(), mockS3, takeout, jnl, worker.NewPool(1), nil, cfg, WithExistingKeys(existing))
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNotCalled(t, "ObjectExists", mock.Anything, mock.Anything)
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+	totals := up.Totals()
+	assert.Equal(t, 1, totals.SkippedFiles)
+	assert.Equal(t, 1, totals.UploadedFiles)
+	assert.True(t, existing.Has("b.jpg"))
+}
@@ -0,0 +1,88 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// maxListedErrors is the number of file errors a FilesError lists in its message
+const maxListedErrors = 10
+
+// FilesError is the error of an archive some files of which failed to upload.
+// Its message lists the first few, while Errs holds all of them.
+type FilesError struct {
+	Failed   int
+	Total    int
+	Uploaded int
+
+	// Errs holds the error of each file that failed, in the order they failed
+	Errs []error
+}
+
+func (e *FilesError) Error() string {
+	var errMsgs []string
+	for i, err := range e.Errs {
+		if i == maxListedErrors {
+			errMsgs = append(errMsgs, fmt.Sprintf("... and %d more errors", len(e.Errs)-maxListedErrors))
+			break
+		}
+		errMsgs = append(errMsgs, err.Error())
+	}
+
+	return fmt.Sprintf("upload completed with %d/%d files failed and %d uploaded:\n%s",
+		e.Failed, e.Total, e.Uploaded, strings.Join(errMsgs, "\n"))
+}
+
+// ErrorCategory is the kind of failure an upload error is counted under in
+// the summary of a run
+type ErrorCategory string
+
+const (
+	// ErrorAuth is a rejected credential or a request that isn't allowed
+	ErrorAuth ErrorCategory = "auth"
+	// ErrorNetwork is a transient failure that ran out of retries, such as a
+	// timeout, a dropped connection or a throttled or unavailable endpoint
+	ErrorNetwork ErrorCategory = "network"
+	// ErrorNotFound is a missing bucket, object or upload
+	ErrorNotFound ErrorCategory = "not-found"
+	// ErrorCorrupt is a damaged archive entry
+	ErrorCorrupt ErrorCategory = "corrupt"
+	// ErrorOversize is an object larger than the provider accepts
+	ErrorOversize ErrorCategory = "oversize"
+	// ErrorUnknown is any other failure
+	ErrorUnknown ErrorCategory = "unknown"
+)
+
+// ErrorCategories lists the categories in the order they are reported
+var ErrorCategories = []ErrorCategory{ErrorAuth, ErrorNetwork, ErrorNotFound, ErrorCorrupt, ErrorOversize, ErrorUnknown}
+
+// CategorizeError returns the category of the error of a file. Damaged
+// entries and oversize objects are told apart first, since their errors can
+// also look transient.
+func CategorizeError(err error) ErrorCategory {
+	switch {
+	case isCorruption(err):
+		return ErrorCorrupt
+	case isOversize(err):
+		return ErrorOversize
+	case s3client.IsAuthError(err):
+		return ErrorAuth
+	case s3client.IsNotFoundError(err):
+		return ErrorNotFound
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) || DefaultRetryConfig().IsRetryable(err):
+		return ErrorNetwork
+	default:
+		return ErrorUnknown
+	}
+}
+
+// isOversize reports whether the server rejected an upload for its size
+func isOversize(err error) bool {
+	status, code, ok := s3client.ErrorStatus(err)
+	return ok && (status == http.StatusRequestEntityTooLarge || code == "EntityTooLarge")
+}
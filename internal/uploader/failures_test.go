@@ -0,0 +1,51 @@
+package uploader
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategorizeError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{"access denied", minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, ErrorAuth},
+		{"no such bucket", minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchBucket"}, ErrorNotFound},
+		{"slow down", minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}, ErrorNetwork},
+		{"timed out", fmt.Errorf("timed out after 1m0s: %w", context.DeadlineExceeded), ErrorNetwork},
+		{"breaker open", fmt.Errorf("upload skipped: %w", ErrCircuitOpen), ErrorNetwork},
+		{"bad CRC", fmt.Errorf("failed to upload file: %w", zip.ErrChecksum), ErrorCorrupt},
+		{"too large", minio.ErrorResponse{StatusCode: http.StatusBadRequest, Code: "EntityTooLarge"}, ErrorOversize},
+		{"other", errors.New("metadata too large for S3"), ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CategorizeError(fmt.Errorf("failed to upload a.jpg: %w", tt.err)))
+		})
+	}
+}
+
+func TestFilesError(t *testing.T) {
+	var errs []error
+	for i := 0; i < 12; i++ {
+		errs = append(errs, fmt.Errorf("failed to upload %d.jpg", i))
+	}
+	err := error(&FilesError{Failed: 12, Total: 20, Uploaded: 8, Errs: errs})
+
+	assert.Contains(t, err.Error(), "12/20 files failed and 8 uploaded")
+	assert.Contains(t, err.Error(), "failed to upload 9.jpg\n... and 2 more errors")
+	assert.NotContains(t, err.Error(), "10.jpg")
+
+	var filesErr *FilesError
+	assert.True(t, errors.As(fmt.Errorf("upload failed for takeout.zip: %w", err), &filesErr))
+	assert.Len(t, filesErr.Errs, 12)
+}
@@ -0,0 +1,198 @@
+package uploader
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fileinfo"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
+)
+
+// PathFilter selects files by glob patterns on their path in the archive.
+// Patterns use path.Match syntax, with "**" matching any number of
+// directories. Patterns without a slash are matched against the file name only.
+type PathFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewPathFilter creates a filter that keeps files matching any include
+// pattern, or all files if there are none, unless they match an exclude pattern
+func NewPathFilter(include, exclude []string) (*PathFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return &PathFilter{include: include, exclude: exclude}, nil
+}
+
+// Match reports whether a file should be uploaded. Excludes win over includes.
+func (f *PathFilter) Match(p string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, pattern := range f.exclude {
+		if fshelper.MatchGlob(pattern, p) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.include {
+		if fshelper.MatchGlob(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// TypeFilter selects files by their extension
+type TypeFilter struct {
+	extensions map[string]bool
+	images     bool
+	videos     bool
+	types      []string
+}
+
+// NewTypeFilter creates a filter that keeps files with one of the given
+// extensions, with or without the dot and in any case. config.OnlyTypesImages
+// and config.OnlyTypesVideos stand for every image or video format.
+func NewTypeFilter(types []string) (*TypeFilter, error) {
+	f := &TypeFilter{extensions: make(map[string]bool)}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case t == "":
+			continue
+		case t == config.OnlyTypesImages:
+			f.images = true
+		case t == config.OnlyTypesVideos:
+			f.videos = true
+		case strings.ContainsAny(t, "/*?["):
+			return nil, fmt.Errorf("invalid --only-types %q, expected an extension such as jpg, %s or %s (use --include for patterns)",
+				t, config.OnlyTypesImages, config.OnlyTypesVideos)
+		default:
+			f.extensions["."+strings.TrimPrefix(t, ".")] = true
+		}
+		f.types = append(f.types, t)
+	}
+	return f, nil
+}
+
+// Active reports whether the filter leaves any files out
+func (f *TypeFilter) Active() bool {
+	return f != nil && len(f.types) > 0
+}
+
+// Match reports whether a file should be uploaded
+func (f *TypeFilter) Match(p string) bool {
+	if !f.Active() {
+		return true
+	}
+	return f.extensions[strings.ToLower(path.Ext(p))] ||
+		(f.images && fileinfo.IsImageFile(p)) ||
+		(f.videos && fileinfo.IsVideoFile(p))
+}
+
+// String lists the types for logs
+func (f *TypeFilter) String() string {
+	return strings.Join(f.types, ",")
+}
+
+// SizeFilter selects files by their size
+type SizeFilter struct {
+	min int64
+	max int64
+}
+
+// NewSizeFilter creates a filter that keeps files of min to max bytes, both
+// included. Zero leaves that end of the range open.
+func NewSizeFilter(min, max int64) (*SizeFilter, error) {
+	if min < 0 || max < 0 {
+		return nil, fmt.Errorf("--min-size and --max-size must not be negative")
+	}
+	if max > 0 && min > max {
+		return nil, fmt.Errorf("--max-size %s is smaller than --min-size %s", config.FormatSize(max), config.FormatSize(min))
+	}
+	return &SizeFilter{min: min, max: max}, nil
+}
+
+// Active reports whether the filter leaves any files out
+func (f *SizeFilter) Active() bool {
+	return f != nil && (f.min > 0 || f.max > 0)
+}
+
+// TooSmall reports whether a file is below the minimum size
+func (f *SizeFilter) TooSmall(size int64) bool {
+	return f != nil && size < f.min
+}
+
+// TooLarge reports whether a file is above the maximum size
+func (f *SizeFilter) TooLarge(size int64) bool {
+	return f != nil && f.max > 0 && size > f.max
+}
+
+// DateFilter selects files by their capture date, the photo taken time or,
+// without one, the creation time from their metadata
+type DateFilter struct {
+	since          time.Time
+	until          time.Time
+	includeUndated bool
+}
+
+// NewDateFilter creates a filter that keeps files taken from since to until,
+// both included. A zero time leaves that end of the range open. Files without
+// a capture date are kept or left out by policy, config.NoDateInclude or
+// config.NoDateExclude.
+func NewDateFilter(since, until time.Time, policy string) (*DateFilter, error) {
+	switch policy {
+	case "", config.NoDateInclude, config.NoDateExclude:
+	default:
+		return nil, fmt.Errorf("invalid --no-date-policy %q (expected %s or %s)", policy, config.NoDateInclude, config.NoDateExclude)
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		return nil, fmt.Errorf("--until %s is before --since %s", config.FormatDate(until), config.FormatDate(since))
+	}
+
+	return &DateFilter{since: since, until: until, includeUndated: policy != config.NoDateExclude}, nil
+}
+
+// Active reports whether the filter leaves any files out
+func (f *DateFilter) Active() bool {
+	return f != nil && (!f.since.IsZero() || !f.until.IsZero())
+}
+
+// Match reports whether a file should be uploaded
+func (f *DateFilter) Match(file *source.MediaFile) bool {
+	if !f.Active() {
+		return true
+	}
+
+	takenAt, ok := originalDate(file.Metadata)
+	if !ok {
+		return f.includeUndated
+	}
+	return (f.since.IsZero() || !takenAt.Before(f.since)) && (f.until.IsZero() || !takenAt.After(f.until))
+}
+
+// String describes the date range for logs
+func (f *DateFilter) String() string {
+	switch {
+	case f.since.IsZero():
+		return "until " + config.FormatDate(f.until)
+	case f.until.IsZero():
+		return "since " + config.FormatDate(f.since)
+	default:
+		return config.FormatDate(f.since) + " to " + config.FormatDate(f.until)
+	}
+}
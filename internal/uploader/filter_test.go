@@ -0,0 +1,196 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/googletakeout"
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathFilter_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		path     string
+		expected bool
+	}{
+		{"no patterns", nil, nil, "Takeout/Drive/report.pdf", true},
+		{"file name pattern matches nested file", []string{"*.jpg"}, nil, "Takeout/Google Photos/Trip/IMG_1.jpg", true},
+		{"file name pattern rejects other types", []string{"*.jpg", "*.mp4"}, nil, "Takeout/Google Photos/Trip/IMG_1.png", false},
+		{"double star in the middle", []string{"**/Photos from 2020/*.jpg"}, nil, "Takeout/Google Photos/Photos from 2020/IMG_1.jpg", true},
+		{"double star matches no directories", []string{"**/Photos from 2020/*.jpg"}, nil, "Photos from 2020/IMG_1.jpg", true},
+		{"single star doesn't cross directories", []string{"Takeout/*/IMG_1.jpg"}, nil, "Takeout/Google Photos/Trip/IMG_1.jpg", false},
+		{"wrong year", []string{"**/Photos from 2020/*.jpg"}, nil, "Takeout/Google Photos/Photos from 2021/IMG_1.jpg", false},
+		{"trailing double star", []string{"Takeout/Google Photos/**"}, nil, "Takeout/Google Photos/Trip/IMG_1.jpg", true},
+		{"exclude wins over include", []string{"*.jpg"}, []string{"**/Trash/**"}, "Takeout/Google Photos/Trash/IMG_1.jpg", false},
+		{"exclude only", nil, []string{"*.mp4"}, "Takeout/Google Photos/Trip/VID_1.mp4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewPathFilter(tt.include, tt.exclude)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filter.Match(tt.path))
+		})
+	}
+}
+
+func TestNewPathFilter_InvalidPattern(t *testing.T) {
+	_, err := NewPathFilter([]string{"*.jpg"}, []string{"[a-"})
+	assert.Error(t, err)
+}
+
+func TestTypeFilter_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		types    []string
+		path     string
+		expected bool
+	}{
+		{"no types", nil, "Takeout/Drive/report.pdf", true},
+		{"listed extension", []string{"jpg", "mp4"}, "Takeout/Google Photos/Trip/VID_1.mp4", true},
+		{"other extension", []string{"jpg", "mp4"}, "Takeout/Google Photos/Trip/IMG_1.png", false},
+		{"dot and case are ignored", []string{".JPG"}, "Takeout/Google Photos/Trip/IMG_1.jpg", true},
+		{"extension case is ignored", []string{"heic"}, "Takeout/Google Photos/Trip/IMG_1.HEIC", true},
+		{"images", []string{config.OnlyTypesImages}, "Takeout/Google Photos/Trip/IMG_1.heic", true},
+		{"images leave out videos", []string{config.OnlyTypesImages}, "Takeout/Google Photos/Trip/VID_1.mov", false},
+		{"videos and an extension", []string{config.OnlyTypesVideos, "png"}, "Takeout/Google Photos/Trip/IMG_1.png", true},
+		{"no extension", []string{"jpg"}, "Takeout/Google Photos/Trip/IMG_1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewTypeFilter(tt.types)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filter.Match(tt.path))
+		})
+	}
+}
+
+func TestNewTypeFilter_Pattern(t *testing.T) {
+	_, err := NewTypeFilter([]string{"*.jpg"})
+	assert.ErrorContains(t, err, "--include")
+}
+
+func TestUploader_Run_Filtered(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.mp4", "c.png"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("media"), 0600))
+	}
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.Anything).Return(nil)
+
+	filter, err := NewPathFilter([]string{"*.jpg", "*.mp4"}, []string{"b.*"})
+	require.NoError(t, err)
+
+	up := New(ctx, mockS3, takeout, nil, worker.NewPool(1), nil, &config.Config{}, WithFilter(filter))
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+	assert.Equal(t, 1, up.totalFiles)
+	assert.Equal(t, int32(2), up.filteredFiles)
+	assert.Equal(t, int32(1), up.uploadedFiles)
+	assert.Equal(t, int32(0), up.skippedFiles)
+
+	// Files of other types count as filtered too
+	typeFilter, err := NewTypeFilter([]string{"jpg"})
+	require.NoError(t, err)
+	up = New(ctx, mockS3, takeout, nil, worker.NewPool(1), nil, &config.Config{}, WithTypeFilter(typeFilter))
+	require.NoError(t, up.Run())
+	assert.Equal(t, int32(2), up.filteredFiles)
+	assert.Equal(t, int32(1), up.uploadedFiles)
+
+	// Filtering out every file isn't reported as an empty archive
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	defer logger.SetOutput(os.Stdout)
+	typeFilter, err = NewTypeFilter([]string{"heic"})
+	require.NoError(t, err)
+	up = New(ctx, mockS3, takeout, nil, worker.NewPool(1), nil, &config.Config{}, WithTypeFilter(typeFilter))
+	require.NoError(t, up.Run())
+	assert.Equal(t, 0, up.totalFiles)
+	assert.Contains(t, logs.String(), "All 3 files in the archive were filtered out")
+	assert.NotContains(t, logs.String(), "No files found")
+}
+
+func TestSizeFilter(t *testing.T) {
+	filter, err := NewSizeFilter(100*1024, 2*1024*1024*1024)
+	require.NoError(t, err)
+	assert.True(t, filter.Active())
+	assert.True(t, filter.TooSmall(100*1024-1))
+	assert.False(t, filter.TooSmall(100*1024))
+	assert.False(t, filter.TooLarge(2*1024*1024*1024))
+	assert.True(t, filter.TooLarge(2*1024*1024*1024+1))
+
+	// Zero leaves that end open
+	filter, err = NewSizeFilter(0, 1024)
+	require.NoError(t, err)
+	assert.False(t, filter.TooSmall(0))
+	filter, err = NewSizeFilter(1024, 0)
+	require.NoError(t, err)
+	assert.False(t, filter.TooLarge(1<<40))
+
+	var none *SizeFilter
+	assert.False(t, none.Active())
+	assert.False(t, none.TooSmall(0))
+	assert.False(t, none.TooLarge(1<<40))
+
+	_, err = NewSizeFilter(2048, 1024)
+	assert.ErrorContains(t, err, "--max-size 1.00 KB is smaller than --min-size 2.00 KB")
+	_, err = NewSizeFilter(-1, 0)
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func TestDateFilter_Match(t *testing.T) {
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC)
+	taken := func(timestamp string) *source.MediaFile {
+		return &source.MediaFile{Metadata: &metadata.Metadata{PhotoTakenTime: &metadata.TimeInfo{Timestamp: timestamp}}}
+	}
+	created := &source.MediaFile{Metadata: &metadata.Metadata{CreationTime: &metadata.TimeInfo{Timestamp: "1590000000"}}} // 2020-05-20
+	undated := &source.MediaFile{}
+
+	filter, err := NewDateFilter(since, until, config.NoDateInclude)
+	require.NoError(t, err)
+	assert.True(t, filter.Match(taken("1577836800")))  // 2020-01-01T00:00:00Z
+	assert.True(t, filter.Match(taken("1609459199")))  // 2020-12-31T23:59:59Z
+	assert.False(t, filter.Match(taken("1577836799"))) // 2019-12-31T23:59:59Z
+	assert.False(t, filter.Match(taken("1609459200"))) // 2021-01-01T00:00:00Z
+	assert.True(t, filter.Match(created))
+	assert.True(t, filter.Match(undated))
+	assert.Equal(t, "2020-01-01 to 2020-12-31T23:59:59Z", filter.String())
+
+	filter, err = NewDateFilter(since, time.Time{}, config.NoDateExclude)
+	require.NoError(t, err)
+	assert.True(t, filter.Match(taken("1609459200")))
+	assert.False(t, filter.Match(undated))
+
+	// Without a range every file is kept
+	filter, err = NewDateFilter(time.Time{}, time.Time{}, config.NoDateExclude)
+	require.NoError(t, err)
+	assert.False(t, filter.Active())
+	assert.True(t, filter.Match(undated))
+
+	_, err = NewDateFilter(until, since, "")
+	assert.ErrorContains(t, err, "before --since")
+	_, err = NewDateFilter(since, until, "skip")
+	assert.ErrorContains(t, err, "--no-date-policy")
+}
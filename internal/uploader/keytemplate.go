@@ -0,0 +1,266 @@
+package uploader
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
+	"github.com/bstardust/google-takeout-s3-importer/internal/transcode"
+)
+
+// unknownDate is used for the date fields of files without a capture time
+const unknownDate = "unknown"
+
+// unknownDatePrefix is the folder --prefix-date puts files without a capture time in
+const unknownDatePrefix = "unknown-date"
+
+// takeoutRoot is the folder every file of a Takeout archive is in
+const takeoutRoot = "Takeout"
+
+// takeoutPhotosFolders are the names Takeout gives the Google Photos folder,
+// which depend on the language of the account
+var takeoutPhotosFolders = []string{"Google Photos", "Google Fotos"}
+
+// KeyFields are the values available to a key template
+type KeyFields struct {
+	// Path is the path of the file in the archive
+	Path string
+	// Dir is the directory of the file in the archive
+	Dir string
+	// Filename is the base name of the file, including its extension
+	Filename string
+	// Ext is the extension of the file, including the dot
+	Ext string
+	// Year, Month and Day are the zero padded capture date, or "unknown"
+	Year  string
+	Month string
+	Day   string
+	// Unknown is true if the file has no capture date
+	Unknown bool
+	// Album is the first album the file belongs to
+	Album string
+	// Archive is the name of the archive the file came from
+	Archive string
+}
+
+// KeyTemplate builds object keys from file metadata using a Go template
+type KeyTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseKeyTemplate parses a key template, rejecting templates that fail to
+// parse or refer to fields that don't exist
+func ParseKeyTemplate(text string) (*KeyTemplate, error) {
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key template: %w", err)
+	}
+
+	kt := &KeyTemplate{tmpl: tmpl}
+
+	// Unknown fields are only reported when the template is executed
+	sample := &source.MediaFile{Path: "Photos from 2019/IMG_1234.jpg", Archive: "takeout.zip"}
+	if _, err := kt.Key(sample); err != nil {
+		return nil, err
+	}
+
+	return kt, nil
+}
+
+// Key returns the object key for a file
+func (kt *KeyTemplate) Key(file *source.MediaFile) (string, error) {
+	var b strings.Builder
+	if err := kt.tmpl.Execute(&b, newKeyFields(file)); err != nil {
+		return "", fmt.Errorf("invalid key template: %w", err)
+	}
+
+	key := strings.TrimPrefix(path.Clean("/"+b.String()), "/")
+	if key == "" {
+		return "", fmt.Errorf("key template produced an empty key for %s", file.Path)
+	}
+	return key, nil
+}
+
+// newKeyFields collects the template fields of a file
+func newKeyFields(file *source.MediaFile) KeyFields {
+	fields := KeyFields{
+		Path:     file.Path,
+		Dir:      path.Dir(file.Path),
+		Filename: path.Base(file.Path),
+		Ext:      path.Ext(file.Path),
+		Year:     unknownDate,
+		Month:    unknownDate,
+		Day:      unknownDate,
+		Unknown:  true,
+		Archive:  file.Archive,
+	}
+
+	if takenAt, ok := originalDate(file.Metadata); ok {
+		fields.Year = fmt.Sprintf("%04d", takenAt.Year())
+		fields.Month = fmt.Sprintf("%02d", takenAt.Month())
+		fields.Day = fmt.Sprintf("%02d", takenAt.Day())
+		fields.Unknown = false
+	}
+
+	if file.Metadata != nil && len(file.Metadata.Albums) > 0 {
+		fields.Album = file.Metadata.Albums[0]
+	}
+
+	return fields
+}
+
+// ObjectKey returns the key a file is stored under, relative to the bucket
+// prefix. The key is built from the template if there is one, or is the path
+// in the archive shortened by Flatten, and is put under a YYYY/MM folder for
+// PrefixDate. Unless they are split, both halves of a Live Photo are grouped
+// under a prefix named after it, and HEIC photos replaced by a JPEG get its
+// extension. The finished key is then sanitized for SanitizeKeys.
+func ObjectKey(file *source.MediaFile, kt *KeyTemplate, cfg *config.UploadConfig) (string, error) {
+	key, err := objectKey(file, kt, cfg)
+	if err != nil {
+		return "", err
+	}
+	return SanitizeKey(key, cfg.SanitizeKeys), nil
+}
+
+// objectKey builds the key of a file before it is sanitized
+func objectKey(file *source.MediaFile, kt *KeyTemplate, cfg *config.UploadConfig) (string, error) {
+	key := file.Path
+	if kt != nil {
+		var err error
+		if key, err = kt.Key(file); err != nil {
+			return "", err
+		}
+	}
+
+	// Object keys use forward slashes, even for paths from archives made on
+	// Windows, and are valid UTF-8 without control characters
+	key = fshelper.CleanName(strings.ReplaceAll(key, "\\", "/"))
+	key = flattenKey(key, cfg.Flatten)
+
+	if cfg.PrefixDate {
+		key = path.Join(datePrefix(file), key)
+	}
+
+	if !cfg.SplitLivePhotos && file.LivePhotoGroup != "" {
+		key = path.Join(path.Dir(key), path.Base(file.LivePhotoGroup), path.Base(key))
+	}
+
+	if cfg.TranscodeHEIC == config.TranscodeHEICReplace && transcode.IsHEIC(file.Path) {
+		key = transcode.JPEGKey(key)
+	}
+	return key, nil
+}
+
+// flattenKey shortens the path of a file in the archive for --flatten.
+// FlattenTakeout drops a leading Takeout folder and the Google Photos folder
+// after it, so "Takeout/Google Photos/Trip/IMG_1.jpg" becomes
+// "Trip/IMG_1.jpg". FlattenAlbum then also drops every folder but the one the
+// file is in, which is its album or "Photos from YYYY" folder. Paths outside
+// those folders are only shortened by the folders they have.
+func flattenKey(key, mode string) string {
+	if mode == "" {
+		return key
+	}
+
+	key = strings.TrimPrefix(key, takeoutRoot+"/")
+	for _, folder := range takeoutPhotosFolders {
+		if rest, ok := strings.CutPrefix(key, folder+"/"); ok {
+			key = rest
+			break
+		}
+	}
+
+	if mode != config.FlattenAlbum {
+		return key
+	}
+	dir := path.Dir(key)
+	if dir == "." {
+		return key
+	}
+	return path.Join(path.Base(dir), path.Base(key))
+}
+
+// keySafePunct is the punctuation kept in sanitized keys. The rest, such as
+// "#", "?" and "%", breaks URLs or is rejected by some providers.
+const keySafePunct = "-_.!*'()&$@=;:+, "
+
+// keyReplacement takes the place of unsafe characters for SanitizeKeysReplace
+const keyReplacement = '_'
+
+// SanitizeKey rewrites the characters of a key that S3 providers or the
+// tools around them mishandle, one path segment at a time. Letters, digits
+// and combining marks of any script are kept, as is the punctuation of
+// keySafePunct, except for spaces at either end of a segment. For
+// SanitizeKeysPercentEncode everything else is percent-encoded byte by byte,
+// so "a#b.jpg" becomes "a%23b.jpg" and can be decoded back. For
+// SanitizeKeysReplace every run of unsafe characters, like an emoji and the
+// joiners and variation selectors that make it up, becomes one underscore.
+// Other modes return the key unchanged.
+func SanitizeKey(key, mode string) string {
+	if mode != config.SanitizeKeysPercentEncode && mode != config.SanitizeKeysReplace {
+		return key
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = sanitizeSegment(segment, mode)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sanitizeSegment sanitizes one path segment of a key for SanitizeKey
+func sanitizeSegment(segment, mode string) string {
+	first := len(segment) - len(strings.TrimLeft(segment, " "))
+	last := len(strings.TrimRight(segment, " "))
+
+	var b strings.Builder
+	replaced := false
+	for i, r := range segment {
+		if keySafeRune(r) && (r != ' ' || i >= first && i < last) {
+			b.WriteRune(r)
+			replaced = false
+			continue
+		}
+
+		if mode == config.SanitizeKeysReplace {
+			if !replaced {
+				b.WriteRune(keyReplacement)
+			}
+			replaced = true
+			continue
+		}
+		for _, c := range []byte(string(r)) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// keySafeRune reports whether a character is kept in sanitized keys
+func keySafeRune(r rune) bool {
+	switch {
+	case r < utf8.RuneSelf:
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' ||
+			strings.ContainsRune(keySafePunct, r)
+	case unicode.Is(unicode.Variation_Selector, r):
+		return false
+	default:
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+	}
+}
+
+// datePrefix returns the YYYY/MM folder of the capture date of a file
+func datePrefix(file *source.MediaFile) string {
+	takenAt, ok := originalDate(file.Metadata)
+	if !ok {
+		return unknownDatePrefix
+	}
+	return fmt.Sprintf("%04d/%02d", takenAt.Year(), takenAt.Month())
+}
@@ -0,0 +1,269 @@
+package uploader
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyTemplate_Invalid(t *testing.T) {
+	for _, text := range []string{
+		"{{.Year",
+		"{{.Camera}}/{{.Filename}}",
+		"{{if .Unknown}}",
+	} {
+		t.Run(text, func(t *testing.T) {
+			_, err := ParseKeyTemplate(text)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyTemplate_Key(t *testing.T) {
+	kt, err := ParseKeyTemplate("photos/{{.Year}}/{{.Month}}/{{.Filename}}")
+	require.NoError(t, err)
+
+	dated := &source.MediaFile{
+		Path: "Photos from 2019/IMG_1234.jpg",
+		Metadata: &metadata.Metadata{
+			PhotoTakenTime: &metadata.TimeInfo{Timestamp: "1557838800"}, // 2019-05-14
+		},
+	}
+	key, err := kt.Key(dated)
+	require.NoError(t, err)
+	assert.Equal(t, "photos/2019/05/IMG_1234.jpg", key)
+
+	undated := &source.MediaFile{Path: "Trip/IMG_5678.jpg"}
+	key, err = kt.Key(undated)
+	require.NoError(t, err)
+	assert.Equal(t, "photos/unknown/unknown/IMG_5678.jpg", key)
+
+	// Empty fields don't leave empty path segments behind
+	albums, err := ParseKeyTemplate("{{.Album}}/{{if .Unknown}}undated/{{end}}{{.Filename}}")
+	require.NoError(t, err)
+	key, err = albums.Key(undated)
+	require.NoError(t, err)
+	assert.Equal(t, "undated/IMG_5678.jpg", key)
+}
+
+func TestObjectKey_TemplateWithLivePhotoGroup(t *testing.T) {
+	kt, err := ParseKeyTemplate("{{.Year}}/{{.Filename}}")
+	require.NoError(t, err)
+
+	cfg := config.New()
+	cfg.Upload.SplitLivePhotos = false
+	up := New(context.Background(), nil, nil, nil, nil, nil, cfg, WithKeyTemplate(kt))
+
+	file := &source.MediaFile{Path: "Photos from 2022/IMG_1234.MOV", LivePhotoGroup: "Photos from 2022/IMG_1234"}
+	key, err := up.objectKey(file)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown/IMG_1234/IMG_1234.MOV", key)
+}
+
+// verify looks objects up with ObjectKey, so it must group Live Photos the
+// same way uploads do
+func TestObjectKey_LivePhotoGroup(t *testing.T) {
+	file := &source.MediaFile{Path: "Photos from 2022/PXL_0001.MP.mp4", LivePhotoGroup: "Photos from 2022/PXL_0001"}
+
+	cfg := config.New()
+	key, err := ObjectKey(file, nil, &cfg.Upload)
+	require.NoError(t, err)
+	assert.Equal(t, "Photos from 2022/PXL_0001.MP.mp4", key)
+
+	cfg.Upload.SplitLivePhotos = false
+	key, err = ObjectKey(file, nil, &cfg.Upload)
+	require.NoError(t, err)
+	assert.Equal(t, "Photos from 2022/PXL_0001/PXL_0001.MP.mp4", key)
+}
+
+func TestUploader_ObjectKey_Backslashes(t *testing.T) {
+	file := &source.MediaFile{Path: `Takeout\Google Photos\Trip\IMG_0001.jpg`}
+
+	u := &Uploader{config: &config.Config{}}
+	key, err := u.objectKey(file)
+	require.NoError(t, err)
+	assert.Equal(t, "Takeout/Google Photos/Trip/IMG_0001.jpg", key)
+
+	kt, err := ParseKeyTemplate(`{{.Dir}}\{{.Filename}}`)
+	require.NoError(t, err)
+	u.keyTemplate = kt
+	key, err = u.objectKey(file)
+	require.NoError(t, err)
+	assert.NotContains(t, key, `\`)
+}
+
+func TestObjectKey_PrefixDate(t *testing.T) {
+	cfg := &config.UploadConfig{PrefixDate: true, SplitLivePhotos: true}
+
+	dated := &source.MediaFile{
+		Path: "Takeout/Google Photos/Photos from 2019/IMG_1234.jpg",
+		Metadata: &metadata.Metadata{
+			PhotoTakenTime: &metadata.TimeInfo{Timestamp: "1557838800"}, // 2019-05-14
+		},
+	}
+	key, err := ObjectKey(dated, nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "2019/05/Takeout/Google Photos/Photos from 2019/IMG_1234.jpg", key)
+
+	undated := &source.MediaFile{Path: "Takeout/Google Photos/Photos from 2019/IMG_1235.jpg"}
+	key, err = ObjectKey(undated, nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown-date/Takeout/Google Photos/Photos from 2019/IMG_1235.jpg", key)
+}
+
+func TestObjectKey_Flatten(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		takeout string
+		album   string
+	}{
+		{
+			name:    "year folder",
+			path:    "Takeout/Google Photos/Photos from 2020/IMG_1234.jpg",
+			takeout: "Photos from 2020/IMG_1234.jpg",
+			album:   "Photos from 2020/IMG_1234.jpg",
+		},
+		{
+			name:    "album folder",
+			path:    "Takeout/Google Photos/Trip to Rome/IMG_1234.jpg",
+			takeout: "Trip to Rome/IMG_1234.jpg",
+			album:   "Trip to Rome/IMG_1234.jpg",
+		},
+		{
+			name:    "localized photos folder",
+			path:    "Takeout/Google Fotos/Urlaub/IMG_1234.jpg",
+			takeout: "Urlaub/IMG_1234.jpg",
+			album:   "Urlaub/IMG_1234.jpg",
+		},
+		{
+			name:    "extracted without the Takeout folder",
+			path:    "Google Photos/Photos from 2020/IMG_1234.jpg",
+			takeout: "Photos from 2020/IMG_1234.jpg",
+			album:   "Photos from 2020/IMG_1234.jpg",
+		},
+		{
+			name:    "nested folders",
+			path:    "Takeout/Google Photos/Trips/Rome/IMG_1234.jpg",
+			takeout: "Trips/Rome/IMG_1234.jpg",
+			album:   "Rome/IMG_1234.jpg",
+		},
+		{
+			name:    "file in the photos folder",
+			path:    "Takeout/Google Photos/IMG_1234.jpg",
+			takeout: "IMG_1234.jpg",
+			album:   "IMG_1234.jpg",
+		},
+		{
+			name:    "other product",
+			path:    "Takeout/Drive/Pictures/IMG_1234.jpg",
+			takeout: "Drive/Pictures/IMG_1234.jpg",
+			album:   "Pictures/IMG_1234.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &source.MediaFile{Path: tt.path}
+
+			key, err := ObjectKey(file, nil, &config.UploadConfig{SplitLivePhotos: true})
+			require.NoError(t, err)
+			assert.Equal(t, tt.path, key)
+
+			key, err = ObjectKey(file, nil, &config.UploadConfig{Flatten: config.FlattenTakeout, SplitLivePhotos: true})
+			require.NoError(t, err)
+			assert.Equal(t, tt.takeout, key)
+
+			key, err = ObjectKey(file, nil, &config.UploadConfig{Flatten: config.FlattenAlbum, SplitLivePhotos: true})
+			require.NoError(t, err)
+			assert.Equal(t, tt.album, key)
+		})
+	}
+}
+
+func TestSanitizeKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		percent string
+		replace string
+	}{
+		{
+			name:    "safe key",
+			key:     "Photos from 2020/IMG_1234 (1).jpg",
+			percent: "Photos from 2020/IMG_1234 (1).jpg",
+			replace: "Photos from 2020/IMG_1234 (1).jpg",
+		},
+		{
+			name:    "URL characters",
+			key:     "Party #1/What?/100%.jpg",
+			percent: "Party %231/What%3F/100%25.jpg",
+			replace: "Party _1/What_/100_.jpg",
+		},
+		{
+			name:    "spaces around segments",
+			key:     " Trip /IMG_1234.jpg ",
+			percent: "%20Trip%20/IMG_1234.jpg%20",
+			replace: "_Trip_/IMG_1234.jpg_",
+		},
+		{
+			name:    "emoji",
+			key:     "Beach 🏖️/IMG_1234.jpg",
+			percent: "Beach %F0%9F%8F%96%EF%B8%8F/IMG_1234.jpg",
+			replace: "Beach _/IMG_1234.jpg",
+		},
+		{
+			name:    "other scripts",
+			key:     "Urlaub in Köln/日本/IMG_1234.jpg",
+			percent: "Urlaub in Köln/日本/IMG_1234.jpg",
+			replace: "Urlaub in Köln/日本/IMG_1234.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.key, SanitizeKey(tt.key, config.SanitizeKeysPassthrough))
+			assert.Equal(t, tt.percent, SanitizeKey(tt.key, config.SanitizeKeysPercentEncode))
+			assert.Equal(t, tt.replace, SanitizeKey(tt.key, config.SanitizeKeysReplace))
+
+			// Percent-encoded keys decode back to the original
+			decoded, err := url.PathUnescape(tt.percent)
+			require.NoError(t, err)
+			assert.Equal(t, tt.key, decoded)
+		})
+	}
+}
+
+func TestObjectKey_SanitizeKeys(t *testing.T) {
+	file := &source.MediaFile{Path: "Takeout/Google Photos/Party #1/IMG_1234.jpg"}
+	cfg := &config.UploadConfig{Flatten: config.FlattenTakeout, SanitizeKeys: config.SanitizeKeysReplace, SplitLivePhotos: true}
+
+	key, err := ObjectKey(file, nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Party _1/IMG_1234.jpg", key)
+}
+
+func TestObjectKey_TranscodeHEIC(t *testing.T) {
+	cfg := &config.UploadConfig{TranscodeHEIC: config.TranscodeHEICReplace}
+
+	// verify looks replaced photos up under the same key the uploader used
+	key, err := ObjectKey(&source.MediaFile{Path: "Photos from 2023/IMG_0001.HEIC"}, nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Photos from 2023/IMG_0001.jpg", key)
+
+	// Other files and copies uploaded alongside the original keep their keys
+	key, err = ObjectKey(&source.MediaFile{Path: "Photos from 2023/IMG_0002.MOV"}, nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Photos from 2023/IMG_0002.MOV", key)
+
+	cfg.TranscodeHEIC = config.TranscodeHEICAlongside
+	key, err = ObjectKey(&source.MediaFile{Path: "Photos from 2023/IMG_0001.HEIC"}, nil, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Photos from 2023/IMG_0001.HEIC", key)
+}
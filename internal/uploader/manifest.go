@@ -0,0 +1,159 @@
+package uploader
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// Statuses of the files listed in a manifest
+const (
+	ManifestUploaded  = "uploaded"
+	ManifestSkipped   = "skipped"
+	ManifestDuplicate = "duplicate"
+	ManifestFailed    = "failed"
+	ManifestCorrupt   = "corrupt"
+)
+
+// manifestColumns is the header of a CSV manifest
+var manifestColumns = []string{"time", "status", "path", "archive", "key", "size", "content_type", "etag", "error", "warning"}
+
+// ManifestEntry is one file in a manifest
+type ManifestEntry struct {
+	Time        time.Time `json:"time"`
+	Status      string    `json:"status"`
+	Path        string    `json:"path"`
+	Archive     string    `json:"archive"`
+	Key         string    `json:"key,omitempty"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	ETag        string    `json:"etag,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Warning     string    `json:"warning,omitempty"`
+}
+
+// Manifest lists every file the uploaders handled, with the object it ended
+// up as. Unlike the journal, which only tracks what is left to do, it is a
+// record for people to audit. Entries are appended as files complete, as CSV
+// or, for a .json or .jsonl path, as one JSON object per line.
+type Manifest struct {
+	mu      sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	encoder *json.Encoder
+}
+
+// NewManifest opens a manifest for appending, so the entries of a resumed
+// run follow those of earlier runs. Close it to flush the entries to disk.
+func NewManifest(path string) (*Manifest, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create manifest directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	m := &Manifest{file: file, buf: bufio.NewWriter(file)}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl":
+		m.encoder = json.NewEncoder(m.buf)
+	default:
+		m.csv = csv.NewWriter(m.buf)
+		if info.Size() == 0 {
+			if err := m.csv.Write(manifestColumns); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("failed to write manifest header: %w", err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Add appends an entry, stamping it with the current time. It does nothing
+// on a nil manifest.
+func (m *Manifest) Add(entry ManifestEntry) {
+	if m == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	if m.encoder != nil {
+		err = m.encoder.Encode(entry)
+	} else {
+		err = m.csv.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			entry.Status,
+			entry.Path,
+			entry.Archive,
+			entry.Key,
+			strconv.FormatInt(entry.Size, 10),
+			entry.ContentType,
+			entry.ETag,
+			entry.Error,
+			entry.Warning,
+		})
+	}
+	if err != nil {
+		logger.Warn("Failed to add %s to the manifest: %v", entry.Path, err)
+	}
+}
+
+// Flush writes the buffered entries to disk
+func (m *Manifest) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.flush()
+}
+
+// flush writes the buffered entries to disk. The caller must hold the lock.
+func (m *Manifest) flush() error {
+	if m.csv != nil {
+		m.csv.Flush()
+		if err := m.csv.Error(); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	if err := m.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the manifest and closes its file
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.flush(); err != nil {
+		m.file.Close()
+		return err
+	}
+	return m.file.Close()
+}
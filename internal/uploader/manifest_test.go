@@ -0,0 +1,103 @@
+package uploader
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/googletakeout"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func readManifestCSV(t *testing.T, path string) [][]string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	require.NoError(t, err)
+	return rows
+}
+
+func TestManifest_CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "manifest.csv")
+
+	m, err := NewManifest(path)
+	require.NoError(t, err)
+	m.Add(ManifestEntry{Status: ManifestUploaded, Path: "a.jpg", Archive: "takeout.zip", Key: "photos/a.jpg", Size: 10, ContentType: "image/jpeg", ETag: `"abc"`})
+	require.NoError(t, m.Close())
+
+	// A resumed run appends without repeating the header
+	m, err = NewManifest(path)
+	require.NoError(t, err)
+	m.Add(ManifestEntry{Status: ManifestFailed, Path: "b.jpg", Archive: "takeout.zip", Error: "access denied", Warning: "capture times differ"})
+	require.NoError(t, m.Close())
+
+	rows := readManifestCSV(t, path)
+	require.Len(t, rows, 3)
+	assert.Equal(t, manifestColumns, rows[0])
+	assert.Equal(t, []string{"uploaded", "a.jpg", "takeout.zip", "photos/a.jpg", "10", "image/jpeg", `"abc"`, "", ""}, rows[1][1:])
+	assert.Equal(t, []string{"failed", "b.jpg", "takeout.zip", "", "0", "", "", "access denied", "capture times differ"}, rows[2][1:])
+}
+
+func TestManifest_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+
+	m, err := NewManifest(path)
+	require.NoError(t, err)
+	m.Add(ManifestEntry{Status: ManifestSkipped, Path: "a.jpg", Key: "a.jpg", Size: 10})
+	require.NoError(t, m.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entry ManifestEntry
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, ManifestSkipped, entry.Status)
+	assert.Equal(t, "a.jpg", entry.Key)
+	assert.False(t, entry.Time.IsZero())
+}
+
+func TestUploader_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not really a jpeg"), 0600))
+	}
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	mockS3 := newMockS3()
+	mockS3.On("GetPrefix").Return("photos")
+	mockS3.On("ObjectExists", mock.Anything, "a.jpg").Return(true, nil)
+	mockS3.On("ObjectExists", mock.Anything, mock.Anything).Return(false, nil)
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "b.jpg", mock.Anything, mock.Anything).Return(errors.New("access denied"))
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "c.jpg", mock.Anything, mock.Anything).Return(nil)
+
+	path := filepath.Join(t.TempDir(), "manifest.csv")
+	manifest, err := NewManifest(path)
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	cfg.Upload.SkipExisting = true
+	up := New(ctx, mockS3, takeout, nil, worker.NewPool(1), nil, cfg, WithManifest(manifest))
+	require.Error(t, up.Run())
+	require.NoError(t, manifest.Close())
+
+	statuses := make(map[string][]string)
+	for _, row := range readManifestCSV(t, path)[1:] {
+		statuses[row[2]] = []string{row[1], row[4], row[8]}
+	}
+	assert.Equal(t, map[string][]string{
+		"a.jpg": {ManifestSkipped, "photos/a.jpg", ""},
+		"b.jpg": {ManifestFailed, "photos/b.jpg", "failed to upload file: access denied"},
+		"c.jpg": {ManifestUploaded, "photos/c.jpg", ""},
+	}, statuses)
+}
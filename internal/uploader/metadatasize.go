@@ -0,0 +1,193 @@
+package uploader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// metadataSidecarSuffix is appended to the key of an object to name the
+// sidecar holding its metadata for config.MetadataOverflowSidecar
+const metadataSidecarSuffix = ".metadata.json"
+
+// metadataSidecarContentType is the content type of metadata sidecars
+const metadataSidecarContentType = "application/json"
+
+// metadataSidecarEncoding is the content encoding of metadata sidecars
+// gzipped for --compress-metadata-json
+const metadataSidecarEncoding = "gzip"
+
+// metadataDropOrder lists the metadata fields dropped to fit
+// s3client.MaxMetadataSize, least useful first. Lists of names grow with the
+// file's albums and people, so they go before the fields of fixed size.
+var metadataDropOrder = []string{
+	"tags",
+	"people",
+	"albums",
+	"description",
+	"url",
+	"image-views",
+	"title",
+	"creation-time-formatted",
+	"photo-taken-time-formatted",
+	"video-codec",
+	"camera-exposure-time",
+	"camera-f-number",
+	"camera-iso",
+	"camera-make",
+	"camera-model",
+}
+
+// essentialMetadata are the fields the tool reads back from objects, which
+// are never dropped
+var essentialMetadata = map[string]bool{
+	s3client.MetadataSHA256:         true,
+	s3client.MetadataOriginalDate:   true,
+	s3client.MetadataLivePhotoGroup: true,
+	s3client.MetadataSidecar:        true,
+}
+
+// limitMetadata makes the metadata of a file fit s3client.MaxMetadataSize
+// according to --metadata-overflow, and reports whether the full metadata has
+// to be stored in a sidecar next to the object, as for
+// config.MetadataOverflowSidecar. stored tells that the sidecar of
+// --sidecar-metadata is uploaded anyway, so metadata that doesn't fit is no
+// reason to fail the file.
+func (u *Uploader) limitMetadata(filePath, key string, metadata map[string]string, stored bool) (map[string]string, bool, error) {
+	size := s3client.MetadataSize(metadata)
+	if size <= s3client.MaxMetadataSize {
+		return metadata, false, nil
+	}
+
+	overflow := u.config.Upload.MetadataOverflow
+	if overflow == config.MetadataOverflowError && stored {
+		overflow = config.MetadataOverflowSidecar
+	}
+
+	switch overflow {
+	case config.MetadataOverflowError:
+		return nil, false, fmt.Errorf("metadata of %d bytes is over the %d byte limit of S3 (use --metadata-overflow=trim or sidecar to upload it anyway)",
+			size, s3client.MaxMetadataSize)
+
+	case config.MetadataOverflowSidecar:
+		kept := make(map[string]string, len(essentialMetadata))
+		for k, v := range metadata {
+			if essentialMetadata[k] {
+				kept[k] = v
+			}
+		}
+		kept[s3client.MetadataSidecar] = path.Base(key) + metadataSidecarSuffix
+		logger.Info("Metadata of %s is %d bytes, over the S3 limit, storing it in %s", filePath, size, key+metadataSidecarSuffix)
+		return kept, true, nil
+
+	default:
+		fitted, dropped := fitMetadata(metadata)
+		logger.Warn("Metadata of %s is %d bytes, over the %d byte S3 limit, dropped %s",
+			filePath, size, s3client.MaxMetadataSize, strings.Join(dropped, ", "))
+		return fitted, false, nil
+	}
+}
+
+// fitMetadata drops fields from a copy of metadata until it fits
+// s3client.MaxMetadataSize, in the order of metadataDropOrder and then the
+// largest other fields first, returning the copy and the dropped fields.
+// Essential fields are kept even if the rest doesn't fit.
+func fitMetadata(metadata map[string]string) (map[string]string, []string) {
+	fitted := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		fitted[k] = v
+	}
+
+	others := make([]string, 0, len(fitted))
+	for k := range fitted {
+		others = append(others, k)
+	}
+	sort.Slice(others, func(a, b int) bool {
+		sizeA, sizeB := len(others[a])+len(fitted[others[a]]), len(others[b])+len(fitted[others[b]])
+		if sizeA != sizeB {
+			return sizeA > sizeB
+		}
+		return others[a] < others[b]
+	})
+
+	order := append(append([]string{}, metadataDropOrder...), others...)
+
+	var dropped []string
+	for _, k := range order {
+		if s3client.MetadataSize(fitted) <= s3client.MaxMetadataSize {
+			break
+		}
+		if _, ok := fitted[k]; !ok || essentialMetadata[k] {
+			continue
+		}
+		delete(fitted, k)
+		dropped = append(dropped, k)
+	}
+	return fitted, dropped
+}
+
+// uploadMetadataSidecar stores the full metadata of a file as JSON next to
+// its object, for --sidecar-metadata or metadata that didn't fit on it
+func (u *Uploader) uploadMetadataSidecar(ctx context.Context, file *source.MediaFile, key string, data []byte) error {
+	sidecarKey := key + metadataSidecarSuffix
+
+	var contentEncoding string
+	if u.config.Upload.CompressMetadataJSON {
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return fmt.Errorf("failed to compress metadata sidecar: %w", err)
+		}
+		data = compressed
+		contentEncoding = metadataSidecarEncoding
+	}
+
+	operation := fmt.Sprintf("Upload metadata sidecar of %s to S3", file.Path)
+	var info s3client.UploadInfo
+	err := RetryWithBackoff(ctx, operation, func() error {
+		var err error
+		info, err = u.s3Client.UploadFile(ctx, bytes.NewReader(data), sidecarKey, int64(len(data)), s3client.UploadOptions{
+			ContentType:     metadataSidecarContentType,
+			ContentEncoding: contentEncoding,
+		})
+		return err
+	}, u.retryConfig)
+	if err != nil {
+		return fmt.Errorf("failed to upload metadata sidecar: %w", err)
+	}
+
+	logger.Debug("Uploaded metadata sidecar of %s as %s", file.Path, u.bucketKey(sidecarKey))
+	if u.manifest != nil {
+		u.manifest.Add(ManifestEntry{
+			Status:      ManifestUploaded,
+			Path:        file.Path,
+			Archive:     file.Archive,
+			Key:         u.bucketKey(sidecarKey),
+			Size:        int64(len(data)),
+			ContentType: metadataSidecarContentType,
+			ETag:        info.ETag,
+		})
+	}
+	return nil
+}
+
+// gzipBytes compresses data with gzip
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package uploader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oversizedMetadata returns metadata over the S3 limit because of its lists
+// of albums and people
+func oversizedMetadata() map[string]string {
+	return map[string]string{
+		"title":                  "IMG_1234.jpg",
+		"albums":                 strings.Repeat("Summer holidays,", 80),
+		"people":                 strings.Repeat("Someone Else,", 80),
+		"tags":                   "beach,sunset",
+		"geo-latitude":           "41.902800",
+		s3client.MetadataSHA256:  strings.Repeat("a", 64),
+		s3client.MetadataSidecar: "",
+	}
+}
+
+func TestFitMetadata(t *testing.T) {
+	metadata := oversizedMetadata()
+	delete(metadata, s3client.MetadataSidecar)
+	require.Greater(t, s3client.MetadataSize(metadata), s3client.MaxMetadataSize)
+
+	fitted, dropped := fitMetadata(metadata)
+	assert.LessOrEqual(t, s3client.MetadataSize(fitted), s3client.MaxMetadataSize)
+	assert.Equal(t, []string{"tags", "people"}, dropped)
+	assert.Contains(t, fitted, "albums")
+	assert.Contains(t, fitted, s3client.MetadataSHA256)
+
+	// The original is left alone
+	assert.Contains(t, metadata, "people")
+
+	// Essential fields stay even when nothing else is left
+	huge := map[string]string{
+		"camera-model":          strings.Repeat("x", 3000),
+		s3client.MetadataSHA256: strings.Repeat("a", 64),
+	}
+	fitted, dropped = fitMetadata(huge)
+	assert.Equal(t, map[string]string{s3client.MetadataSHA256: strings.Repeat("a", 64)}, fitted)
+	assert.Equal(t, []string{"camera-model"}, dropped)
+}
+
+func TestUploader_LimitMetadata(t *testing.T) {
+	cfg := config.New()
+	u := &Uploader{config: cfg}
+	metadata := oversizedMetadata()
+	delete(metadata, s3client.MetadataSidecar)
+
+	// Metadata that fits is kept as is
+	small := map[string]string{"title": "IMG_1234.jpg"}
+	kept, sidecar, err := u.limitMetadata("IMG_1234.jpg", "Trip/IMG_1234.jpg", small, false)
+	require.NoError(t, err)
+	assert.Equal(t, small, kept)
+	assert.False(t, sidecar)
+
+	kept, sidecar, err = u.limitMetadata("IMG_1234.jpg", "Trip/IMG_1234.jpg", metadata, false)
+	require.NoError(t, err)
+	assert.NotContains(t, kept, "people")
+	assert.False(t, sidecar)
+
+	essential := map[string]string{
+		s3client.MetadataSHA256:  strings.Repeat("a", 64),
+		s3client.MetadataSidecar: "IMG_1234.jpg.metadata.json",
+	}
+	cfg.Upload.MetadataOverflow = config.MetadataOverflowSidecar
+	kept, sidecar, err = u.limitMetadata("IMG_1234.jpg", "Trip/IMG_1234.jpg", metadata, false)
+	require.NoError(t, err)
+	assert.Equal(t, essential, kept)
+	assert.True(t, sidecar)
+
+	cfg.Upload.MetadataOverflow = config.MetadataOverflowError
+	_, _, err = u.limitMetadata("IMG_1234.jpg", "Trip/IMG_1234.jpg", metadata, false)
+	assert.ErrorContains(t, err, "over the 2048 byte limit")
+
+	// The sidecar of --sidecar-metadata already holds everything
+	kept, sidecar, err = u.limitMetadata("IMG_1234.jpg", "Trip/IMG_1234.jpg", metadata, true)
+	require.NoError(t, err)
+	assert.Equal(t, essential, kept)
+	assert.True(t, sidecar)
+}
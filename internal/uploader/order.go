@@ -0,0 +1,49 @@
+package uploader
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+)
+
+// ValidateSortBy checks an order accepted by --sort-by
+func ValidateSortBy(by string) error {
+	switch by {
+	case "", config.SortByPath, config.SortByDate, config.SortBySize:
+		return nil
+	}
+	return fmt.Errorf("invalid --sort-by %q (expected %s, %s or %s)", by, config.SortByPath, config.SortByDate, config.SortBySize)
+}
+
+// sortFiles orders files for upload by path, capture date or size. Files
+// that tie are kept in order of their path, so every run uploads them in the
+// same order.
+func sortFiles(files []*source.MediaFile, by string) {
+	switch by {
+	case config.SortByDate:
+		sort.SliceStable(files, func(i, j int) bool {
+			a, aOK := originalDate(files[i].Metadata)
+			b, bOK := originalDate(files[j].Metadata)
+			switch {
+			case aOK != bOK:
+				return aOK
+			case aOK && !a.Equal(b):
+				return a.Before(b)
+			}
+			return files[i].Path < files[j].Path
+		})
+	case config.SortBySize:
+		sort.SliceStable(files, func(i, j int) bool {
+			if files[i].Size != files[j].Size {
+				return files[i].Size < files[j].Size
+			}
+			return files[i].Path < files[j].Path
+		})
+	default:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package uploader
+
+import (
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortFiles(t *testing.T) {
+	taken := func(path, timestamp string, size int64) *source.MediaFile {
+		file := &source.MediaFile{Path: path, Size: size}
+		if timestamp != "" {
+			file.Metadata = &metadata.Metadata{PhotoTakenTime: &metadata.TimeInfo{Timestamp: timestamp}}
+		}
+		return file
+	}
+	files := func() []*source.MediaFile {
+		return []*source.MediaFile{
+			taken("b.jpg", "1609459200", 300), // 2021
+			taken("d.jpg", "", 100),
+			taken("a.jpg", "1577836800", 200), // 2020
+			taken("c.jpg", "1577836800", 100), // 2020
+		}
+	}
+	paths := func(files []*source.MediaFile) []string {
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, file.Path)
+		}
+		return paths
+	}
+
+	sorted := files()
+	sortFiles(sorted, config.SortByPath)
+	assert.Equal(t, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, paths(sorted))
+
+	// Undated files go last, and files taken at the same time by path
+	sorted = files()
+	sortFiles(sorted, config.SortByDate)
+	assert.Equal(t, []string{"a.jpg", "c.jpg", "b.jpg", "d.jpg"}, paths(sorted))
+
+	sorted = files()
+	sortFiles(sorted, config.SortBySize)
+	assert.Equal(t, []string{"c.jpg", "d.jpg", "a.jpg", "b.jpg"}, paths(sorted))
+
+	assert.NoError(t, ValidateSortBy(config.SortByDate))
+	assert.ErrorContains(t, ValidateSortBy("name"), "invalid --sort-by")
+}
@@ -0,0 +1,165 @@
+package uploader
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// Actions a dry run plans for a file
+const (
+	PlanUpload = "upload"
+	PlanSkip   = "skip"
+)
+
+// Reasons a dry run plans to skip a file
+const (
+	SkipReasonExists    = "exists"
+	SkipReasonJournal   = "journal"
+	SkipReasonDuplicate = "duplicate"
+)
+
+// PlannedObject describes what a dry run would do with one file
+type PlannedObject struct {
+	Action      string            `json:"action"`
+	Path        string            `json:"path"`
+	Archive     string            `json:"archive"`
+	Key         string            `json:"key"`
+	Size        int64             `json:"size"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+}
+
+// DryRunPlan collects the objects planned by the uploaders of a dry run
+type DryRunPlan struct {
+	mu      sync.Mutex
+	objects []PlannedObject
+}
+
+// NewDryRunPlan creates an empty plan
+func NewDryRunPlan() *DryRunPlan {
+	return &DryRunPlan{}
+}
+
+// Add records a planned object. It does nothing on a nil plan.
+func (p *DryRunPlan) Add(object PlannedObject) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.objects = append(p.objects, object)
+}
+
+// Objects returns the planned objects sorted by key, so plans of the same
+// archives can be diffed even though files are processed concurrently
+func (p *DryRunPlan) Objects() []PlannedObject {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	objects := append([]PlannedObject{}, p.objects...)
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Key != objects[j].Key {
+			return objects[i].Key < objects[j].Key
+		}
+		return objects[i].Archive < objects[j].Archive
+	})
+	return objects
+}
+
+// WriteJSON writes the planned objects as an indented JSON array
+func (p *DryRunPlan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p.Objects())
+}
+
+// TypeSummary counts the planned uploads of one content type
+type TypeSummary struct {
+	ContentType string `json:"content_type"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// PlanSummary totals the objects of a dry run plan
+type PlanSummary struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+
+	// Upload counts the files that would be uploaded, and Existing the ones
+	// skipped because an object with their key is already in the bucket.
+	// Skipped counts the files skipped for other reasons, such as the
+	// journal or duplicate content.
+	UploadFiles   int   `json:"upload_files"`
+	UploadBytes   int64 `json:"upload_bytes"`
+	ExistingFiles int   `json:"existing_files"`
+	ExistingBytes int64 `json:"existing_bytes"`
+	SkippedFiles  int   `json:"skipped_files"`
+	SkippedBytes  int64 `json:"skipped_bytes"`
+
+	// Types breaks the uploads down by content type, largest first
+	Types []TypeSummary `json:"types"`
+
+	// Oversized lists the uploads larger than the provider accepts
+	Oversized []PlannedObject `json:"oversized,omitempty"`
+}
+
+// Summary totals the planned objects. Uploads larger than the largest object
+// S3 accepts, or than MaxParts parts of partSize bytes, are listed as
+// oversized since they would fail. Zero uses the default part size.
+func (p *DryRunPlan) Summary(partSize int64) PlanSummary {
+	if partSize <= 0 {
+		partSize = s3client.DefaultPartSize
+	}
+
+	var summary PlanSummary
+	types := make(map[string]*TypeSummary)
+	maxSize := min(s3client.MaxObjectSize, partSize*s3client.MaxParts)
+
+	for _, object := range p.Objects() {
+		summary.Files++
+		summary.Bytes += object.Size
+
+		switch {
+		case object.Action == PlanUpload:
+			summary.UploadFiles++
+			summary.UploadBytes += object.Size
+
+			t, ok := types[object.ContentType]
+			if !ok {
+				t = &TypeSummary{ContentType: object.ContentType}
+				types[object.ContentType] = t
+			}
+			t.Files++
+			t.Bytes += object.Size
+
+			if object.Size > maxSize {
+				summary.Oversized = append(summary.Oversized, object)
+			}
+		case object.Reason == SkipReasonExists:
+			summary.ExistingFiles++
+			summary.ExistingBytes += object.Size
+		default:
+			summary.SkippedFiles++
+			summary.SkippedBytes += object.Size
+		}
+	}
+
+	summary.Types = make([]TypeSummary, 0, len(types))
+	for _, t := range types {
+		summary.Types = append(summary.Types, *t)
+	}
+	sort.Slice(summary.Types, func(i, j int) bool {
+		if summary.Types[i].Bytes != summary.Types[j].Bytes {
+			return summary.Types[i].Bytes > summary.Types[j].Bytes
+		}
+		return summary.Types[i].ContentType < summary.Types[j].ContentType
+	})
+	return summary
+}
@@ -0,0 +1,104 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadFile_DryRunPlan(t *testing.T) {
+	ctx := context.Background()
+
+	mockTakeout := new(MockTakeout)
+	mockTakeout.On("GetMetadata", "Photos/a.jpg").Return(nil)
+	mockTakeout.On("OpenFile", "Photos/a.jpg").Return(MockReadCloser{strings.NewReader("jpeg")}, nil)
+
+	mockS3 := new(MockS3Client)
+	mockS3.On("GetPrefix").Return("photos/")
+	mockS3.On("ObjectExists", ctx, "Photos/a.jpg").Return(false, nil)
+	mockS3.On("ObjectExists", ctx, "Photos/b.jpg").Return(true, nil)
+
+	cfg := &config.Config{}
+	cfg.Upload.DryRun = true
+	cfg.Upload.SkipExisting = true
+
+	plan := NewDryRunPlan()
+	up := New(ctx, mockS3, mockTakeout, nil, nil, nil, cfg, WithDryRunPlan(plan))
+
+	require.NoError(t, up.uploadFile(ctx, &source.MediaFile{Path: "Photos/b.jpg", Archive: "takeout.zip", Size: 20, SHA256: "abc"}))
+	require.NoError(t, up.uploadFile(ctx, &source.MediaFile{Path: "Photos/a.jpg", Archive: "takeout.zip", Size: 10, SHA256: "def"}))
+
+	mockS3.AssertNotCalled(t, "UploadFile")
+	assert.Equal(t, []PlannedObject{
+		{
+			Action:      PlanUpload,
+			Path:        "Photos/a.jpg",
+			Archive:     "takeout.zip",
+			Key:         "photos/Photos/a.jpg",
+			Size:        10,
+			ContentType: "image/jpeg",
+			Metadata:    map[string]string{"sha256": "def"},
+		},
+		{
+			Action:  PlanSkip,
+			Path:    "Photos/b.jpg",
+			Archive: "takeout.zip",
+			Key:     "photos/Photos/b.jpg",
+			Size:    20,
+			Reason:  "exists",
+		},
+	}, plan.Objects())
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.WriteJSON(&buf))
+
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(t, decoded, 2)
+	assert.Equal(t, "photos/Photos/a.jpg", decoded[0]["key"])
+	assert.Equal(t, "image/jpeg", decoded[0]["content_type"])
+	assert.NotContains(t, decoded[1], "content_type")
+}
+
+func TestDryRunPlan_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewDryRunPlan().WriteJSON(&buf))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestDryRunPlan_Summary(t *testing.T) {
+	plan := NewDryRunPlan()
+	plan.Add(PlannedObject{Action: PlanUpload, Path: "a.jpg", Size: 10, ContentType: "image/jpeg"})
+	plan.Add(PlannedObject{Action: PlanUpload, Path: "b.jpg", Size: 20, ContentType: "image/jpeg"})
+	plan.Add(PlannedObject{Action: PlanUpload, Path: "c.mp4", Size: 64 << 30, ContentType: "video/mp4"})
+	plan.Add(PlannedObject{Action: PlanSkip, Path: "d.jpg", Size: 5, Reason: SkipReasonExists})
+	plan.Add(PlannedObject{Action: PlanSkip, Path: "e.jpg", Size: 7, Reason: SkipReasonJournal})
+	plan.Add(PlannedObject{Action: PlanSkip, Path: "f.jpg", Size: 9, Reason: SkipReasonDuplicate})
+
+	// 10,000 parts of 5MB hold less than the 64GB video
+	summary := plan.Summary(5 << 20)
+	assert.Equal(t, 6, summary.Files)
+	assert.Equal(t, int64(64<<30+51), summary.Bytes)
+	assert.Equal(t, 3, summary.UploadFiles)
+	assert.Equal(t, int64(64<<30+30), summary.UploadBytes)
+	assert.Equal(t, 1, summary.ExistingFiles)
+	assert.Equal(t, int64(5), summary.ExistingBytes)
+	assert.Equal(t, 2, summary.SkippedFiles)
+	assert.Equal(t, int64(16), summary.SkippedBytes)
+	assert.Equal(t, []TypeSummary{
+		{ContentType: "video/mp4", Files: 1, Bytes: 64 << 30},
+		{ContentType: "image/jpeg", Files: 2, Bytes: 30},
+	}, summary.Types)
+	require.Len(t, summary.Oversized, 1)
+	assert.Equal(t, "c.mp4", summary.Oversized[0].Path)
+
+	// Larger parts fit it
+	assert.Empty(t, plan.Summary(16<<20).Oversized)
+}
@@ -0,0 +1,113 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// resumableClient returns the client to upload a file of size bytes with if
+// it is to be uploaded in parts recorded in the journal for
+// --resumable-multipart, or false to use UploadFile
+func (u *Uploader) resumableClient(size int64) (s3client.ResumableUploader, bool) {
+	if !u.config.Upload.ResumableMultipart || u.journal == nil {
+		return nil, false
+	}
+
+	threshold := u.config.S3.MultipartThreshold
+	if threshold == 0 {
+		threshold = s3client.DefaultMultipartThreshold
+	}
+	if size < threshold {
+		return nil, false
+	}
+
+	client, ok := u.s3Client.(s3client.ResumableUploader)
+	return client, ok
+}
+
+// uploadResumable uploads a file in parts recorded in the journal, continuing
+// the upload an earlier run left unfinished. The parts the server still has
+// are read past, so the checksums cover the whole file, but aren't sent
+// again. The bytes a failed attempt read can't be read again, so the upload
+// isn't retried here: the clients retry each part, and the next run
+// continues from the last part that was stored.
+func (u *Uploader) uploadResumable(ctx context.Context, client s3client.ResumableUploader, file *source.MediaFile,
+	key string, body io.Reader, size int64, opts s3client.UploadOptions) (s3client.UploadInfo, error) {
+	filePath := file.Path
+
+	var state s3client.MultipartState
+	if entry, ok := u.journal.MultipartUpload(filePath); ok && entry.Key == key && entry.Size == size {
+		operation := fmt.Sprintf("List uploaded parts of %s", filePath)
+		err := RetryWithBackoff(ctx, operation, func() error {
+			var err error
+			state, err = client.ResumeState(ctx, key, size, multipartState(entry))
+			return err
+		}, u.retryConfig)
+		if err != nil {
+			return s3client.UploadInfo{}, fmt.Errorf("failed to resume upload: %w", err)
+		}
+	}
+
+	sums := newChecksumReader(body)
+	if offset := state.Offset(); offset > 0 {
+		if _, err := io.CopyN(io.Discard, sums, offset); err != nil {
+			return s3client.UploadInfo{}, fmt.Errorf("failed to skip the uploaded parts: %w", err)
+		}
+		logger.Info("Resuming upload of %s after %d parts (%.2f of %.2f MB already uploaded)",
+			filePath, len(state.Parts), float64(offset)/(1024*1024), float64(size)/(1024*1024))
+		if u.progress != nil {
+			u.progress.AddBytes(offset)
+		}
+	}
+
+	// Only the bytes that are sent are throttled and reported
+	reader := u.progress.Reader(u.limiter.Reader(ctx, sums))
+
+	info, err := client.UploadResumable(ctx, reader, key, size, opts, state, func(state s3client.MultipartState) {
+		u.journal.SetMultipartUpload(filePath, multipartEntry(key, size, state))
+	})
+	if err != nil {
+		return info, err
+	}
+
+	// The parts of a completed upload can't be used again
+	if err := u.verifyUpload(ctx, key, info, sums); err != nil {
+		u.journal.ClearMultipartUpload(filePath)
+		return info, err
+	}
+	return info, nil
+}
+
+// multipartEntry converts the state of an upload to its journal entry
+func multipartEntry(key string, size int64, state s3client.MultipartState) journal.MultipartEntry {
+	entry := journal.MultipartEntry{
+		Key:      key,
+		UploadID: state.UploadID,
+		Size:     size,
+		PartSize: state.PartSize,
+		Parts:    make([]journal.PartEntry, len(state.Parts)),
+	}
+	for i, part := range state.Parts {
+		entry.Parts[i] = journal.PartEntry{Number: part.Number, ETag: part.ETag, Size: part.Size}
+	}
+	return entry
+}
+
+// multipartState converts a journal entry back to the state of an upload
+func multipartState(entry journal.MultipartEntry) s3client.MultipartState {
+	state := s3client.MultipartState{
+		UploadID: entry.UploadID,
+		PartSize: entry.PartSize,
+		Parts:    make([]s3client.CompletedPart, len(entry.Parts)),
+	}
+	for i, part := range entry.Parts {
+		state.Parts[i] = s3client.CompletedPart{Number: part.Number, ETag: part.ETag, Size: part.Size}
+	}
+	return state
+}
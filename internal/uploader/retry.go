@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand/v2"
+	"net"
+	"net/http"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
 )
 
 // RetryConfig defines retry behavior for operations that might fail transiently
@@ -28,6 +33,14 @@ type RetryConfig struct {
 
 	// RetryableErrors is a map of error types that should be retried
 	RetryableErrors map[string]bool
+
+	// Retryable, if set, decides which failures other than cancellations are
+	// retried in place of the checks for S3 and network errors
+	Retryable func(error) bool
+
+	// Breaker, if set, is shared by all operations and fails them right away
+	// while the endpoint is considered down. Only S3 operations should use it.
+	Breaker *CircuitBreaker
 }
 
 // DefaultRetryConfig returns a default retry configuration
@@ -41,6 +54,20 @@ func DefaultRetryConfig() RetryConfig {
 	}
 }
 
+// Validate checks that the retry settings are usable
+func (rc RetryConfig) Validate() error {
+	if rc.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative, got %d", rc.MaxRetries)
+	}
+	if rc.InitialBackoff <= 0 {
+		return fmt.Errorf("initial backoff must be positive, got %v", rc.InitialBackoff)
+	}
+	if rc.MaxBackoff < rc.InitialBackoff {
+		return fmt.Errorf("max backoff (%v) must not be less than initial backoff (%v)", rc.MaxBackoff, rc.InitialBackoff)
+	}
+	return nil
+}
+
 // defaultRetryableErrors returns a map of common S3 error codes that should be retried
 func defaultRetryableErrors() map[string]bool {
 	return map[string]bool{
@@ -75,14 +102,51 @@ func (rc RetryConfig) IsRetryable(err error) bool {
 		return false
 	}
 
-	// Check common S3 error types
+	if rc.Retryable != nil {
+		return rc.Retryable(err)
+	}
+
+	// Damaged archive entries read the same way every time
+	if isCorruption(err) {
+		return false
+	}
+
+	// The object didn't match what was sent, so upload it again
+	if errors.Is(err, ErrChecksumMismatch) {
+		return true
+	}
+
+	// Responses from the server say whether the failure is temporary
+	if status, code, ok := s3client.ErrorStatus(err); ok {
+		return status >= http.StatusInternalServerError ||
+			status == http.StatusTooManyRequests ||
+			status == http.StatusRequestTimeout ||
+			rc.RetryableErrors[code]
+	}
+
+	// A host that doesn't exist won't appear on a retry, unlike one whose
+	// lookup timed out
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+
+	// Connection failures and timeouts before any response was received
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// As a last resort, look for error codes and transient error patterns in
+	// the message of errors that lost their type along the way
 	for errCode := range rc.RetryableErrors {
 		if strings.Contains(err.Error(), errCode) {
 			return true
 		}
 	}
-
-	// Check for common transient error patterns
 	lowerErr := strings.ToLower(err.Error())
 	if strings.Contains(lowerErr, "timeout") ||
 		strings.Contains(lowerErr, "connection") ||
@@ -112,9 +176,30 @@ func RetryWithBackoff(ctx context.Context, operation string, fn func() error, co
 			logger.Debug("Retry attempt %d/%d for %s", attempt, config.MaxRetries, operation)
 		}
 
+		// Don't wait out the backoff of every file while the endpoint is down
+		if breakerErr := config.Breaker.Allow(); breakerErr != nil {
+			if err == nil {
+				return fmt.Errorf("%s skipped: %w", operation, breakerErr)
+			}
+			return fmt.Errorf("%s failed after %d attempts: %w (%w)", operation, attempt, err, breakerErr)
+		}
+
 		// Attempt the operation
 		err = fn()
 
+		// Transient failures and timeouts say the endpoint may be down, while
+		// other errors came from an endpoint that answered. The operation
+		// running out of its own time, such as a --file-timeout for a large
+		// file, says nothing about the endpoint.
+		switch {
+		case ctx.Err() != nil:
+			config.Breaker.Release()
+		case err == nil || !(config.IsRetryable(err) || errors.Is(err, context.DeadlineExceeded)):
+			config.Breaker.Success()
+		default:
+			config.Breaker.Failure()
+		}
+
 		// Success! Return nil
 		if err == nil {
 			if attempt > 0 {
@@ -134,8 +219,12 @@ func RetryWithBackoff(ctx context.Context, operation string, fn func() error, co
 			break
 		}
 
-		// Calculate backoff duration
+		// Calculate backoff duration, waiting as long as a throttling server
+		// asked instead if it said
 		backoff := getBackoffDuration(attempt, config)
+		if after, ok := s3client.RetryAfter(err); ok {
+			backoff = min(after, config.MaxBackoff)
+		}
 
 		// Log the backoff
 		logger.Debug("Backing off for %v before retrying %s: %v", backoff, operation, err)
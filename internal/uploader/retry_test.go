@@ -0,0 +1,218 @@
+package uploader
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*RetryConfig)
+		wantErr bool
+	}{
+		{"defaults", func(rc *RetryConfig) {}, false},
+		{"no retries", func(rc *RetryConfig) { rc.MaxRetries = 0 }, false},
+		{"equal backoffs", func(rc *RetryConfig) { rc.MaxBackoff = rc.InitialBackoff }, false},
+		{"negative retries", func(rc *RetryConfig) { rc.MaxRetries = -1 }, true},
+		{"zero initial backoff", func(rc *RetryConfig) { rc.InitialBackoff = 0 }, true},
+		{"max below initial", func(rc *RetryConfig) { rc.InitialBackoff, rc.MaxBackoff = 10*time.Second, 5*time.Second }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := DefaultRetryConfig()
+			tt.modify(&rc)
+			err := rc.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_IsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"too many requests", minio.ErrorResponse{StatusCode: http.StatusTooManyRequests, Code: "TooManyRequests", Message: "Please reduce your request rate."}, true},
+		{"internal error with unknown code", minio.ErrorResponse{StatusCode: http.StatusInternalServerError, Code: "ProviderHiccup", Message: "Something went wrong."}, true},
+		{"service unavailable", fmt.Errorf("failed to upload file: %w", minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable"}), true},
+		{"slow down code", minio.ErrorResponse{StatusCode: http.StatusBadRequest, Code: "SlowDown"}, true},
+		{"access denied mentioning timeout", minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied", Key: "photos/timeout.jpg", Message: "Access denied to photos/timeout.jpg"}, false},
+		{"no such bucket", minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchBucket"}, false},
+		{"aws throttling", awserr.NewRequestFailure(awserr.New("Throttling", "rate exceeded", nil), http.StatusServiceUnavailable, ""), true},
+		{"aws multipart failure", awserr.New("MultipartUpload", "upload multipart failed",
+			awserr.NewRequestFailure(awserr.New("InternalError", "try again", nil), http.StatusInternalServerError, "")), true},
+		{"aws bad request", awserr.NewRequestFailure(awserr.New("InvalidArgument", "bad", nil), http.StatusBadRequest, ""), false},
+		{"network error", fmt.Errorf("put failed: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true},
+		{"unknown host", fmt.Errorf("put failed: %w", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "s3.example.invalid", IsNotFound: true}}), false},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "s3.example.com", IsTimeout: true}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"untyped message", errors.New("read tcp: connection reset by peer"), true},
+		{"cancelled", fmt.Errorf("upload: %w", context.Canceled), false},
+		{"invalid file", errors.New("file is not a valid zip"), false},
+		{"zip checksum", fmt.Errorf("failed to read file: %w", zip.ErrChecksum), false},
+		{"corrupt deflate stream", flate.CorruptInputError(1024), false},
+		{"corrupt entry", fmt.Errorf("%w: %w", ErrCorruptEntry, io.ErrUnexpectedEOF), false},
+	}
+
+	rc := DefaultRetryConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rc.IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := NewCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	assert.NoError(t, cb.Allow())
+	cb.Failure()
+	assert.NoError(t, cb.Allow())
+	cb.Failure()
+
+	// Open for the cool-down
+	assert.ErrorIs(t, cb.Allow(), ErrCircuitOpen)
+
+	// Half-open: one test request at a time
+	now = now.Add(time.Minute)
+	assert.NoError(t, cb.Allow())
+	assert.ErrorIs(t, cb.Allow(), ErrCircuitOpen)
+
+	// A failed test opens it again
+	cb.Failure()
+	assert.ErrorIs(t, cb.Allow(), ErrCircuitOpen)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, cb.Allow())
+	cb.Success()
+	assert.NoError(t, cb.Allow())
+	assert.NoError(t, cb.Allow())
+
+	// Disabled
+	assert.Nil(t, NewCircuitBreaker(0, time.Minute))
+	var disabled *CircuitBreaker
+	assert.NoError(t, disabled.Allow())
+}
+
+func TestRetryWithBackoff_CircuitBreaker(t *testing.T) {
+	config := DefaultRetryConfig()
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = time.Millisecond
+	config.Breaker = NewCircuitBreaker(3, time.Minute)
+
+	unavailable := minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable"}
+	attempts := 0
+	err := RetryWithBackoff(context.Background(), "upload", func() error {
+		attempts++
+		return unavailable
+	}, config)
+
+	// The breaker opens before the retries run out
+	assert.Equal(t, 3, attempts)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, unavailable)
+
+	// Later operations aren't attempted at all
+	err = RetryWithBackoff(context.Background(), "upload", func() error {
+		attempts++
+		return nil
+	}, config)
+	assert.Equal(t, 3, attempts)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestRetryWithBackoff_CircuitBreakerFileTimeout(t *testing.T) {
+	config := DefaultRetryConfig()
+	config.Breaker = NewCircuitBreaker(1, time.Minute)
+
+	// A file running out of time isn't a failure of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := RetryWithBackoff(ctx, "upload", func() error {
+		<-ctx.Done()
+		return fmt.Errorf("failed to upload file: %w", ctx.Err())
+	}, config)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, config.Breaker.Allow())
+}
+
+func TestRetryWithBackoff_CircuitBreakerCancelledProbe(t *testing.T) {
+	now := time.Now()
+	config := DefaultRetryConfig()
+	config.Breaker = NewCircuitBreaker(1, time.Minute)
+	config.Breaker.now = func() time.Time { return now }
+	config.Breaker.Failure()
+	now = now.Add(time.Minute)
+
+	// The test request runs out of time before the endpoint answers
+	ctx, cancel := context.WithCancel(context.Background())
+	err := RetryWithBackoff(ctx, "upload", func() error {
+		cancel()
+		return fmt.Errorf("failed to upload file: %w", ctx.Err())
+	}, config)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The next operation tests the endpoint instead
+	attempts := 0
+	err = RetryWithBackoff(context.Background(), "upload", func() error {
+		attempts++
+		return nil
+	}, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryWithBackoff_RetryAfter(t *testing.T) {
+	unavailable := minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}
+	retry := func(config RetryConfig, after time.Duration) (time.Duration, error) {
+		attempts := 0
+		start := time.Now()
+		err := RetryWithBackoff(context.Background(), "upload", func() error {
+			attempts++
+			if attempts == 1 {
+				return fmt.Errorf("failed to upload file: %w", &s3client.RetryAfterError{Err: unavailable, After: after})
+			}
+			return nil
+		}, config)
+		return time.Since(start), err
+	}
+
+	// The server's wait replaces a much longer exponential backoff
+	config := DefaultRetryConfig()
+	config.InitialBackoff = time.Minute
+	config.MaxBackoff = time.Hour
+	elapsed, err := retry(config, 20*time.Millisecond)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, elapsed, 20*time.Millisecond)
+	assert.Less(t, elapsed, 10*time.Second)
+
+	// But not beyond the longest backoff
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 20 * time.Millisecond
+	elapsed, err = retry(config, time.Hour)
+	assert.NoError(t, err)
+	assert.Less(t, elapsed, 10*time.Second)
+}
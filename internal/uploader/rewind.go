@@ -0,0 +1,64 @@
+package uploader
+
+import (
+	"io"
+)
+
+// attemptBody gives each attempt to upload a file the file from its first
+// byte. A failed attempt may have read part of it, and sending the rest
+// would store a truncated object that still looks like a success.
+type attemptBody struct {
+	// first is read by the first attempt. If it can seek, such as a copy in
+	// --tmp-dir or a transcoded photo, later attempts seek it back.
+	first io.Reader
+
+	// source is the reader the file was opened with, which later attempts
+	// seek back if they can't seek first
+	source io.Reader
+
+	// reopen opens the file again for sources that can't seek at all
+	reopen func() (io.ReadCloser, error)
+
+	// entry watches the reader of the last attempt for corruption
+	entry *corruptionReader
+
+	reopened io.Closer
+	attempts int
+}
+
+// next returns the reader of the next attempt, positioned at the start of
+// the file
+func (b *attemptBody) next() (io.Reader, error) {
+	b.attempts++
+	if b.attempts == 1 {
+		return b.first, nil
+	}
+
+	if seeker, ok := b.first.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		return b.first, err
+	}
+	if seeker, ok := b.source.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return b.entry, nil
+	}
+
+	b.close()
+	reader, err := b.reopen()
+	if err != nil {
+		return nil, err
+	}
+	b.reopened = reader
+	b.entry = newCorruptionReader(reader)
+	return b.entry, nil
+}
+
+// close closes the file if an attempt opened it again
+func (b *attemptBody) close() {
+	if b.reopened != nil {
+		b.reopened.Close()
+		b.reopened = nil
+	}
+}
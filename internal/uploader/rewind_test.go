@@ -0,0 +1,77 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// seekReadCloser is an archive entry that can seek, like those of tar archives
+type seekReadCloser struct {
+	*strings.Reader
+}
+
+func (seekReadCloser) Close() error {
+	return nil
+}
+
+func TestUploader_RetryAfterPartialRead(t *testing.T) {
+	content := strings.Repeat("takeout", 100)
+	tests := []struct {
+		name  string
+		open  func() io.ReadCloser
+		opens int
+	}{
+		{
+			name:  "stream is opened again",
+			open:  func() io.ReadCloser { return MockReadCloser{strings.NewReader(content)} },
+			opens: 2,
+		},
+		{
+			name:  "seekable entry is rewound",
+			open:  func() io.ReadCloser { return seekReadCloser{strings.NewReader(content)} },
+			opens: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			takeout := newMockTakeout([]*source.MediaFile{{Path: "a.jpg", Size: int64(len(content)), Archive: "takeout.zip"}})
+			takeout.On("OpenFile", "a.jpg").Return(tt.open(), nil).Once()
+			takeout.On("OpenFile", "a.jpg").Return(tt.open(), nil).Once()
+
+			// The first attempt fails after reading half of the file
+			var uploaded []string
+			mockS3 := newMockS3()
+			mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				_, _ = io.ReadFull(args.Get(1).(io.Reader), make([]byte, len(content)/2))
+			}).Return(minio.ErrorResponse{StatusCode: http.StatusInternalServerError, Code: "InternalError"}).Once()
+			mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				data, _ := io.ReadAll(args.Get(1).(io.Reader))
+				uploaded = append(uploaded, string(data))
+			}).Return(nil).Once()
+
+			retry := DefaultRetryConfig()
+			retry.InitialBackoff = time.Millisecond
+			jnl := newJournal(t)
+			up := New(context.Background(), mockS3, takeout, jnl, worker.NewPool(1), nil, &config.Config{}, WithRetryConfig(retry))
+			require.NoError(t, up.Run())
+
+			// The retry sent the whole file
+			mockS3.AssertNumberOfCalls(t, "UploadFile", 2)
+			takeout.AssertNumberOfCalls(t, "OpenFile", tt.opens)
+			assert.Equal(t, []string{content}, uploaded)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package uploader
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+)
+
+// fileMetadata returns the metadata of a file for its object metadata and
+// metadata sidecar, with the GPS coordinates stripped or blurred if asked to.
+// It returns nil if neither is uploaded or the file has no metadata.
+func (u *Uploader) fileMetadata(filePath string) *metadata.Metadata {
+	if !u.config.Upload.PreserveMetadata && !u.config.Upload.SidecarMetadata {
+		return nil
+	}
+
+	fileMetadata := u.source.GetMetadata(filePath)
+	if fileMetadata == nil {
+		return nil
+	}
+
+	switch {
+	case u.config.Upload.StripGPS:
+		return fileMetadata.WithoutLocation()
+	case u.config.Upload.BlurGPS > 0:
+		return fileMetadata.WithBlurredLocation(u.config.Upload.BlurGPS)
+	}
+	return fileMetadata
+}
+
+// metadataSidecar returns the full metadata of a file as the JSON stored
+// next to its object for --sidecar-metadata or when it doesn't fit on the
+// object. Unlike the object metadata it keeps every person, album and
+// location span.
+func metadataSidecar(fileMetadata *metadata.Metadata) ([]byte, error) {
+	data, err := json.MarshalIndent(fileMetadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata sidecar: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,49 @@
+package uploader
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// spillPattern is the name pattern of the temporary copies of large entries
+const spillPattern = "takeout-upload-*"
+
+// spills reports whether a file of size bytes is copied to --tmp-dir before
+// it is uploaded. Only large files are, and only when the source can't seek
+// back to their start itself.
+func (u *Uploader) spills(reader io.Reader, size int64) bool {
+	if u.config.Upload.TmpDir == "" || size < u.config.Upload.SpillThreshold {
+		return false
+	}
+	_, seekable := reader.(io.Seeker)
+	return !seekable
+}
+
+// spillFile copies size bytes of r to a temporary file in dir, so a retried
+// upload can read them again from the start. The file is positioned at its
+// start. Call cleanup to close and remove it.
+func spillFile(dir string, r io.Reader, size int64) (f *os.File, cleanup func(), err error) {
+	f, err = os.CreateTemp(dir, spillPattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	cleanup = func() {
+		f.Close()
+		if err := os.Remove(f.Name()); err != nil {
+			logger.Warn("Failed to remove temporary file %s: %v", f.Name(), err)
+		}
+	}
+
+	if _, err := io.CopyN(f, r, size); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return f, cleanup, nil
+}
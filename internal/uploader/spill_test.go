@@ -0,0 +1,67 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploader_SpillToTmpDir(t *testing.T) {
+	content := strings.Repeat("takeout", 100)
+	files := []*source.MediaFile{{Path: "video.mp4", Size: int64(len(content)), Archive: "takeout.zip"}}
+	takeout := newMockTakeout(files)
+	takeout.On("OpenFile", "video.mp4").Return(MockReadCloser{io.NopCloser(strings.NewReader(content))}, nil).Once()
+
+	// The first attempt fails half way through the file
+	var uploaded []string
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "video.mp4", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		_, _ = io.ReadFull(args.Get(1).(io.Reader), make([]byte, len(content)/2))
+	}).Return(minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}).Once()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "video.mp4", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := io.ReadAll(args.Get(1).(io.Reader))
+		uploaded = append(uploaded, string(data))
+	}).Return(nil).Once()
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Upload.TmpDir = tmpDir
+	cfg.Upload.SpillThreshold = 100
+	retry := DefaultRetryConfig()
+	retry.InitialBackoff = time.Millisecond
+	jnl := newJournal(t)
+	up := New(context.Background(), mockS3, takeout, jnl, worker.NewPool(1), nil, cfg, WithRetryConfig(retry))
+	require.NoError(t, up.Run())
+
+	// The retry sent the whole file and the copy is gone
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 2)
+	assert.Equal(t, []string{content}, uploaded)
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestUploader_Spills(t *testing.T) {
+	u := &Uploader{config: &config.Config{}}
+	u.config.Upload.SpillThreshold = 100
+
+	// Nothing is copied without --tmp-dir
+	assert.False(t, u.spills(io.NopCloser(strings.NewReader("")), 200))
+
+	u.config.Upload.TmpDir = t.TempDir()
+	assert.True(t, u.spills(io.NopCloser(strings.NewReader("")), 200))
+	assert.False(t, u.spills(io.NopCloser(strings.NewReader("")), 50))
+	assert.False(t, u.spills(strings.NewReader(""), 200), "a seekable source rewinds on its own")
+}
@@ -0,0 +1,100 @@
+package uploader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// Totals holds the combined statistics of the archives in a run
+type Totals struct {
+	Archives      int   `json:"archives"`
+	TotalFiles    int   `json:"total_files"`
+	UploadedFiles int   `json:"uploaded_files"`
+	SkippedFiles  int   `json:"skipped_files"`
+	FailedFiles   int   `json:"failed_files"`
+	FilteredFiles int   `json:"filtered_files"`
+	TotalBytes    int64 `json:"total_bytes"`
+	UploadedBytes int64 `json:"uploaded_bytes"`
+
+	// CorruptFiles could not be read from their archive. They aren't
+	// counted as failed.
+	CorruptFiles int `json:"corrupt_files"`
+
+	// DuplicateFiles were skipped because their content was already
+	// uploaded, saving DuplicateBytes. They are counted as skipped too.
+	DuplicateFiles int   `json:"duplicate_files"`
+	DuplicateBytes int64 `json:"duplicate_bytes"`
+}
+
+// Stats aggregates the statistics of uploaders running concurrently for
+// different archives
+type Stats struct {
+	start time.Time
+
+	mu     sync.Mutex
+	totals Totals
+}
+
+// NewStats creates an aggregator, measuring the duration of the run from now
+func NewStats() *Stats {
+	return &Stats{start: time.Now()}
+}
+
+// add adds the statistics of an uploader that has finished. It does nothing
+// on a nil aggregator.
+func (s *Stats) add(u *Uploader) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := u.Totals()
+	s.totals.Archives += totals.Archives
+	s.totals.TotalFiles += totals.TotalFiles
+	s.totals.UploadedFiles += totals.UploadedFiles
+	s.totals.SkippedFiles += totals.SkippedFiles
+	s.totals.FailedFiles += totals.FailedFiles
+	s.totals.CorruptFiles += totals.CorruptFiles
+	s.totals.FilteredFiles += totals.FilteredFiles
+	s.totals.TotalBytes += totals.TotalBytes
+	s.totals.UploadedBytes += totals.UploadedBytes
+	s.totals.DuplicateFiles += totals.DuplicateFiles
+	s.totals.DuplicateBytes += totals.DuplicateBytes
+}
+
+// Totals returns the statistics added so far
+func (s *Stats) Totals() Totals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.totals
+}
+
+// Elapsed returns the time since the aggregator was created
+func (s *Stats) Elapsed() time.Duration {
+	return time.Since(s.start)
+}
+
+// LogSummary logs the combined statistics of all archives
+func (s *Stats) LogSummary(dryRun bool) {
+	totals := s.Totals()
+
+	logger.InfoKV("Run complete", map[string]any{
+		"archives":        totals.Archives,
+		"total_files":     totals.TotalFiles,
+		"uploaded_files":  totals.UploadedFiles,
+		"uploaded_bytes":  totals.UploadedBytes,
+		"skipped_files":   totals.SkippedFiles,
+		"failed_files":    totals.FailedFiles,
+		"corrupt_files":   totals.CorruptFiles,
+		"filtered_files":  totals.FilteredFiles,
+		"duplicate_files": totals.DuplicateFiles,
+		"duplicate_bytes": totals.DuplicateBytes,
+		"duration":        s.Elapsed().Round(time.Second).String(),
+		"dry_run":         dryRun,
+	})
+}
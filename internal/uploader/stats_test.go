@@ -0,0 +1,50 @@
+package uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/generic"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats_AcrossArchives(t *testing.T) {
+	ctx := context.Background()
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	stats := NewStats()
+	var wg sync.WaitGroup
+	for _, names := range [][]string{{"a.jpg", "b.jpg"}, {"c.jpg", "d.png", "e.mp4"}} {
+		dir := t.TempDir()
+		for _, name := range names {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("media"), 0600))
+		}
+		src, err := generic.New(ctx, dir, generic.Options{ScanConcurrency: 1})
+		require.NoError(t, err)
+
+		up := New(ctx, mockS3, src, nil, worker.NewPool(2), nil, &config.Config{}, WithStats(stats))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, up.Run())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, Totals{
+		Archives:      2,
+		TotalFiles:    5,
+		UploadedFiles: 5,
+		TotalBytes:    25,
+		UploadedBytes: 25,
+	}, stats.Totals())
+}
@@ -0,0 +1,23 @@
+package uploader
+
+import (
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+)
+
+// originalDate returns the capture time of a file, preferring the time the
+// photo was taken over the time it was created
+func originalDate(meta *metadata.Metadata) (time.Time, bool) {
+	if meta == nil {
+		return time.Time{}, false
+	}
+
+	for _, info := range []*metadata.TimeInfo{meta.PhotoTakenTime, meta.CreationTime} {
+		if t, err := info.Time(); err == nil {
+			return t.UTC(), true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -1,29 +1,36 @@
 package uploader
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"path/filepath"
+	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/googletakeout"
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
 	"github.com/bstardust/google-takeout-s3-importer/internal/config"
 	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
 	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metrics"
 	"github.com/bstardust/google-takeout-s3-importer/internal/progress"
+	"github.com/bstardust/google-takeout-s3-importer/internal/ratelimit"
+	"github.com/bstardust/google-takeout-s3-importer/internal/transcode"
 	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
 	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
 )
 
-// Uploader handles the process of uploading files from Google Takeout to S3
+// Uploader handles the process of uploading files from a source to S3
 type Uploader struct {
 	ctx      context.Context
 	s3Client s3client.S3Interface
-	takeout  *googletakeout.Takeout
+	source   source.Source
 	journal  *journal.Journal
 	pool     *worker.Pool
 	progress *progress.Reporter
@@ -34,38 +41,271 @@ type Uploader struct {
 	uploadedFiles int32
 	skippedFiles  int32
 	failedFiles   int32
+	corruptFiles  int32
+	filteredFiles int32
 	totalBytes    int64
 	uploadedBytes int64
 
+	// Files skipped because their content was already uploaded, and the bytes saved
+	duplicateFiles int32
+	duplicateBytes int64
+
 	// Error handling
 	retryConfig RetryConfig
+
+	// Bandwidth limiting shared with other uploaders
+	limiter *ratelimit.Limiter
+
+	// Content hashes shared with other uploaders for deduplication
+	dedupe *DedupeIndex
+
+	// Journal shared by all archives that keeps the hashes of uploaded
+	// content across runs, or nil
+	hashJournal *journal.Journal
+
+	// Layout of object keys, or nil to use the path in the archive
+	keyTemplate *KeyTemplate
+
+	// Selects the files to upload, or nil to upload all of them
+	filter *PathFilter
+
+	// Selects the files to upload by size, or nil to upload all of them
+	sizeFilter *SizeFilter
+	typeFilter *TypeFilter
+
+	// existing, if set, is the listing --skip-existing checks keys against
+	existing *ExistingKeys
+
+	// Selects the files to upload by capture date, or nil to upload all of them
+	dateFilter *DateFilter
+
+	// Metrics shared with other uploaders, or nil if they aren't exported
+	metrics *metrics.Upload
+
+	// Collects the objects a dry run would write, or nil to only log them
+	plan *DryRunPlan
+
+	// Lists the handled files for auditing, or nil
+	manifest *Manifest
+
+	// Totals of all archives in the run, or nil if there's only this one
+	stats *Stats
+}
+
+// Option configures optional Uploader behavior
+type Option func(*Uploader)
+
+// WithRateLimiter throttles uploads using a limiter that may be shared
+// between uploaders. A nil limiter disables throttling.
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(u *Uploader) {
+		u.limiter = limiter
+	}
+}
+
+// WithRetryConfig overrides the default retry behavior for S3 operations
+func WithRetryConfig(rc RetryConfig) Option {
+	return func(u *Uploader) {
+		u.retryConfig = rc
+	}
+}
+
+// WithDedupe skips files whose content was already uploaded under another key,
+// using an index that may be shared between uploaders. Files are only checked
+// if the takeout was scanned with hashing enabled.
+func WithDedupe(index *DedupeIndex) Option {
+	return func(u *Uploader) {
+		u.dedupe = index
+	}
+}
+
+// WithHashJournal skips files whose content was uploaded from any archive
+// sharing the journal, in this or an earlier run, and records the content of
+// every upload in it. It only applies along with WithDedupe.
+func WithHashJournal(jnl *journal.Journal) Option {
+	return func(u *Uploader) {
+		u.hashJournal = jnl
+	}
+}
+
+// WithKeyTemplate stores objects under keys built from a template instead of
+// their path in the archive
+func WithKeyTemplate(kt *KeyTemplate) Option {
+	return func(u *Uploader) {
+		u.keyTemplate = kt
+	}
+}
+
+// WithFilter only uploads the files selected by a path filter
+func WithFilter(filter *PathFilter) Option {
+	return func(u *Uploader) {
+		u.filter = filter
+	}
+}
+
+// WithTypeFilter only uploads the files with the extensions of a type filter
+func WithTypeFilter(filter *TypeFilter) Option {
+	return func(u *Uploader) {
+		u.typeFilter = filter
+	}
+}
+
+// WithExistingKeys checks for existing objects in a listing made before the
+// run instead of with a request per file
+func WithExistingKeys(existing *ExistingKeys) Option {
+	return func(u *Uploader) {
+		u.existing = existing
+	}
+}
+
+// WithSizeFilter only uploads the files in the size range of a size filter
+func WithSizeFilter(filter *SizeFilter) Option {
+	return func(u *Uploader) {
+		u.sizeFilter = filter
+	}
+}
+
+// WithDateFilter only uploads the files taken in the range of a date filter
+func WithDateFilter(filter *DateFilter) Option {
+	return func(u *Uploader) {
+		u.dateFilter = filter
+	}
+}
+
+// WithMetrics records uploads, failures and skips in metrics that may be
+// shared between uploaders
+func WithMetrics(m *metrics.Upload) Option {
+	return func(u *Uploader) {
+		u.metrics = m
+	}
+}
+
+// WithDryRunPlan records the objects a dry run would write or skip in a plan
+// that may be shared between uploaders
+func WithDryRunPlan(plan *DryRunPlan) Option {
+	return func(u *Uploader) {
+		u.plan = plan
+	}
+}
+
+// WithManifest lists every uploaded, skipped and failed file in a manifest
+// that may be shared between uploaders
+func WithManifest(manifest *Manifest) Option {
+	return func(u *Uploader) {
+		u.manifest = manifest
+	}
+}
+
+// WithStats adds the statistics of this uploader to an aggregator shared with
+// the uploaders of other archives once Run returns
+func WithStats(stats *Stats) Option {
+	return func(u *Uploader) {
+		u.stats = stats
+	}
 }
 
 // New creates a new Uploader
-func New(ctx context.Context, s3Client s3client.S3Interface, takeout *googletakeout.Takeout,
+func New(ctx context.Context, s3Client s3client.S3Interface, src source.Source,
 	jnl *journal.Journal, pool *worker.Pool, progress *progress.Reporter,
-	cfg *config.Config) *Uploader {
+	cfg *config.Config, opts ...Option) *Uploader {
 
-	return &Uploader{
+	u := &Uploader{
 		ctx:         ctx,
 		s3Client:    s3Client,
-		takeout:     takeout,
+		source:      src,
 		journal:     jnl,
 		pool:        pool,
 		progress:    progress,
 		config:      cfg,
 		retryConfig: DefaultRetryConfig(),
 	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	return u
 }
 
-// Run executes the upload process
+// Run executes the upload process. The files uploaded before a failure or
+// an interruption are counted in the totals and saved to the journal, so a
+// resumed run skips them.
 func (u *Uploader) Run() error {
-	// Get files to process
-	files := u.takeout.ListFiles()
+	defer u.stats.add(u)
+	defer u.flushJournal()
+
+	// Get files to process, leaving out those the filters exclude
+	var files []*source.MediaFile
+	var pathFiltered, typeFiltered, smallFiltered, largeFiltered, dateFiltered int32
+	for _, file := range u.source.ListFiles() {
+		if !u.filter.Match(file.Path) {
+			logger.Debug("Filtered out %s", file.Path)
+			pathFiltered++
+			continue
+		}
+		if !u.typeFilter.Match(file.Path) {
+			logger.Debug("Filtered out %s, which isn't of type %s", file.Path, u.typeFilter)
+			typeFiltered++
+			continue
+		}
+		if u.sizeFilter.TooSmall(file.Size) {
+			logger.Debug("Filtered out %s, which is too small (%d bytes)", file.Path, file.Size)
+			smallFiltered++
+			continue
+		}
+		if u.sizeFilter.TooLarge(file.Size) {
+			logger.Debug("Filtered out %s, which is too large (%d bytes)", file.Path, file.Size)
+			largeFiltered++
+			continue
+		}
+		if !u.dateFilter.Match(file) {
+			logger.Debug("Filtered out %s, which wasn't taken %s", file.Path, u.dateFilter)
+			dateFiltered++
+			continue
+		}
+		files = append(files, file)
+	}
+	u.filteredFiles = pathFiltered + typeFiltered + smallFiltered + largeFiltered + dateFiltered
+
+	if pathFiltered > 0 {
+		logger.Info("Filtered out %d files that do not match the include and exclude patterns", pathFiltered)
+	}
+	if typeFiltered > 0 {
+		logger.Info("Filtered out %d files that are not of type %s", typeFiltered, u.typeFilter)
+	}
+	if smallFiltered > 0 {
+		logger.Info("Filtered out %d files smaller than %s", smallFiltered, config.FormatSize(u.config.Upload.MinSize))
+	}
+	if largeFiltered > 0 {
+		logger.Info("Filtered out %d files larger than %s", largeFiltered, config.FormatSize(u.config.Upload.MaxSize))
+	}
+	if dateFiltered > 0 {
+		logger.Info("Filtered out %d files that were not taken %s", dateFiltered, u.dateFilter)
+	}
+
+	// Only retry the files that failed in earlier runs
+	if u.config.Upload.RetryFailedOnly && u.journal != nil {
+		var failed []*source.MediaFile
+		for _, file := range files {
+			if u.journal.IsFailed(file.Path) {
+				failed = append(failed, file)
+			}
+		}
+		logger.Info("Retrying %d files that failed in earlier runs, leaving out %d others", len(failed), len(files)-len(failed))
+		files = failed
+	}
 	u.totalFiles = len(files)
+	sortFiles(files, u.config.Upload.SortBy)
 
 	if u.totalFiles == 0 {
-		logger.Warn("No files found in the provided Google Takeout archive")
+		switch {
+		case u.config.Upload.RetryFailedOnly && u.journal != nil:
+			// Already reported with the files left out
+		case u.filteredFiles > 0:
+			logger.Warn("All %d files in the archive were filtered out, nothing to upload", u.filteredFiles)
+		default:
+			logger.Warn("No files found in the provided Google Takeout archive")
+		}
 		return nil
 	}
 
@@ -80,12 +320,19 @@ func (u *Uploader) Run() error {
 		u.progress.SetArchive(files[0].Archive)
 	}
 
+	// Content uploaded in earlier runs doesn't need to be uploaded again
+	if u.dedupe != nil && u.journal != nil && !u.config.Upload.Overwrite {
+		for sum, key := range u.journal.UploadedHashes() {
+			u.dedupe.Add(sum, key)
+		}
+	}
+
 	logger.Info("Starting upload to %s bucket %s", u.s3Client.GetEndpoint(), u.s3Client.GetBucketName())
 	logger.Info("Found %d files to process (%.2f MB total) in archive: %s", u.totalFiles, float64(u.totalBytes)/(1024*1024), files[0].Archive)
 
 	// Start progress reporting
 	if u.progress != nil {
-		u.progress.Start(u.totalFiles)
+		u.progress.Start(u.totalFiles, u.totalBytes)
 		defer u.progress.Finish()
 	}
 
@@ -97,34 +344,89 @@ func (u *Uploader) Run() error {
 	var uploadErrors []error
 
 	// Submit upload tasks to the worker pool
-	for _, file := range files {
-		// Skip if already uploaded in journal
-		if u.journal != nil && u.journal.IsUploaded(file.Path) {
+	for i, file := range files {
+		// Stop handing out work once the upload has been cancelled
+		if u.ctx.Err() != nil {
+			logger.Warn("Upload cancelled, skipping the remaining %d files in archive %s", len(files)-i, file.Archive)
+			break
+		}
+
+		// Skip if already uploaded in journal, unless the entry has to be verified
+		// first or everything is uploaded again
+		if u.journal != nil && u.journal.IsUploaded(file.Path) && !u.config.Upload.VerifyOnResume && !u.config.Upload.Overwrite {
 			logger.Debug("Skipping already uploaded file: %s", file.Path)
+			u.planSkip(file, "", SkipReasonJournal)
 			atomic.AddInt32(&u.skippedFiles, 1)
+			u.metrics.Skipped()
 			if u.progress != nil {
-				u.progress.Skip(file.Path)
+				u.progress.Skip(file.Path, file.Size)
+			}
+			if u.manifest != nil {
+				entry := u.manifestEntry(file, ManifestSkipped)
+				if recorded, ok := u.journal.GetEntry(file.Path); ok {
+					entry.ETag = recorded.ETag
+				}
+				u.manifest.Add(entry)
 			}
 			continue
 		}
 
-		// Create a context for this specific file with timeout
-		fileCtx, cancel := context.WithTimeout(u.ctx, 30*time.Minute)
-
 		// Capture the file for closure
 		mediaFile := file
 
 		// Submit the task to the worker pool
 		u.pool.Submit(func() {
+			// Start the timeout once a worker picks the file up, so time spent
+			// waiting in the queue doesn't count against it
+			fileCtx, cancel := u.fileContext(mediaFile.Size)
 			defer cancel()
 
+			// The upload may have been cancelled while this task waited for a worker
+			if fileCtx.Err() != nil {
+				return
+			}
+
 			// Upload the file
 			if err := u.uploadFile(fileCtx, mediaFile); err != nil {
-				logger.Error("Failed to upload %s from archive %s: %v", mediaFile.Path, mediaFile.Archive, err)
-				atomic.AddInt32(&u.failedFiles, 1)
+				// The whole run stopping, on an interrupt or at --max-duration,
+				// isn't a failure of the file
+				interrupted := u.ctx.Err() != nil
+				if errors.Is(fileCtx.Err(), context.DeadlineExceeded) && !interrupted {
+					err = fmt.Errorf("timed out after %v: %w", u.fileTimeout(mediaFile.Size), err)
+				}
+				corrupt := isCorruption(err)
+				if corrupt {
+					logger.Error("Corrupt file %s in archive %s: %v", mediaFile.Path, mediaFile.Archive, err)
+					atomic.AddInt32(&u.corruptFiles, 1)
+					u.metrics.Corrupt()
+				} else {
+					logger.Error("Failed to upload %s from archive %s: %v", mediaFile.Path, mediaFile.Archive, err)
+					atomic.AddInt32(&u.failedFiles, 1)
+					u.metrics.Failed()
+				}
+
+				// Remember the failure so a later run can retry just this file,
+				// unless the upload was only interrupted
+				if u.journal != nil && !interrupted {
+					u.journal.MarkFailed(mediaFile.Path, mediaFile.Archive, err)
+				}
 				if u.progress != nil {
 					u.progress.Error(mediaFile.Path, err)
 				}
+				if u.manifest != nil && !interrupted {
+					status := ManifestFailed
+					if corrupt {
+						status = ManifestCorrupt
+					}
+					entry := u.manifestEntry(mediaFile, status)
+					entry.Error = err.Error()
+					u.manifest.Add(entry)
+				}
+
+				// The rest of the archive can still be uploaded
+				if corrupt && u.config.Upload.ContinueOnCorrupt {
+					return
+				}
 
 				// Use mutex to safely collect errors instead of a channel
 				errMutex.Lock()
@@ -142,175 +444,716 @@ func (u *Uploader) Run() error {
 	// Handle errors without using a channel
 	var err error
 	if errCount > 0 {
-		// Format error messages from the slice
-		var errMsgs []string
-		for i, e := range uploadErrors {
-			if i < 10 {
-				errMsgs = append(errMsgs, e.Error())
-			} else {
-				errMsgs = append(errMsgs, fmt.Sprintf("... and %d more errors", len(uploadErrors)-10))
-				break
-			}
+		err = &FilesError{
+			Failed:   int(errCount),
+			Total:    u.totalFiles,
+			Uploaded: int(atomic.LoadInt32(&u.uploadedFiles)),
+			Errs:     uploadErrors,
 		}
-
-		err = fmt.Errorf("upload completed with %d/%d files failed:\n%s",
-			errCount, u.totalFiles, strings.Join(errMsgs, "\n"))
 	}
 
 	// Log summary
 	u.logSummary()
 
+	if u.ctx.Err() != nil {
+		return fmt.Errorf("upload cancelled after uploading %d/%d files: %w",
+			atomic.LoadInt32(&u.uploadedFiles), u.totalFiles, u.ctx.Err())
+	}
+
 	return err
 }
 
+// flushJournal saves the progress of the archive, whether it finished or not
+func (u *Uploader) flushJournal() {
+	if u.journal == nil || u.config.Upload.DryRun {
+		return
+	}
+	// The run may have been cancelled, so the save gets its own deadline
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(u.ctx), journal.FlushTimeout)
+	defer cancel()
+	if err := u.journal.FlushContext(ctx); errors.Is(err, context.DeadlineExceeded) {
+		logger.Error("Timed out saving journal, resume state may be stale: %v", err)
+	} else if err != nil {
+		logger.Error("Failed to save journal: %v", err)
+	}
+}
+
+// Totals returns the statistics of the archive so far
+func (u *Uploader) Totals() Totals {
+	return Totals{
+		Archives:       1,
+		TotalFiles:     u.totalFiles,
+		UploadedFiles:  int(atomic.LoadInt32(&u.uploadedFiles)),
+		SkippedFiles:   int(atomic.LoadInt32(&u.skippedFiles)),
+		FailedFiles:    int(atomic.LoadInt32(&u.failedFiles)),
+		CorruptFiles:   int(atomic.LoadInt32(&u.corruptFiles)),
+		FilteredFiles:  int(u.filteredFiles),
+		TotalBytes:     u.totalBytes,
+		UploadedBytes:  atomic.LoadInt64(&u.uploadedBytes),
+		DuplicateFiles: int(atomic.LoadInt32(&u.duplicateFiles)),
+		DuplicateBytes: atomic.LoadInt64(&u.duplicateBytes),
+	}
+}
+
+// fileTimeout returns how long a file may take to upload, including retries:
+// the configured timeout, raised for files too large to upload at the minimum
+// rate in that time. Zero means no limit.
+func (u *Uploader) fileTimeout(size int64) time.Duration {
+	timeout := u.config.Upload.Timeout
+	if timeout <= 0 {
+		return 0
+	}
+
+	if rate := u.config.Upload.MinUploadRate; rate > 0 {
+		if scaled := time.Duration(float64(size) / float64(rate) * float64(time.Second)); scaled > timeout {
+			timeout = scaled
+		}
+	}
+	return timeout
+}
+
+// fileContext returns the context a file is uploaded with, limited to its
+// timeout
+func (u *Uploader) fileContext(size int64) (context.Context, context.CancelFunc) {
+	timeout := u.fileTimeout(size)
+	if timeout == 0 {
+		return context.WithCancel(u.ctx)
+	}
+	return context.WithTimeout(u.ctx, timeout)
+}
+
 // uploadFile handles uploading a single file to S3
-func (u *Uploader) uploadFile(ctx context.Context, file *googletakeout.MediaFile) error {
+func (u *Uploader) uploadFile(ctx context.Context, file *source.MediaFile) (err error) {
 	filePath := file.Path
 	archiveName := file.Archive
+	key, err := u.objectKey(file)
+	if err != nil {
+		return err
+	}
 
 	// Add archive name to log messages
 	logger.Debug("Processing %s from archive %s", filePath, archiveName)
 
+	// Verify objects recorded in the journal before trusting them
+	verifiedMismatch := false
+	if u.journal != nil && u.config.Upload.VerifyOnResume && !u.config.Upload.Overwrite {
+		if entry, ok := u.journal.GetEntry(filePath); ok && entry.Uploaded {
+			intact, err := u.verifyJournalEntry(ctx, file, entry)
+			if err != nil {
+				return fmt.Errorf("failed to verify journal entry: %w", err)
+			}
+
+			if intact {
+				logger.Debug("Skipping already uploaded file: %s", filePath)
+				u.planSkip(file, key, SkipReasonJournal)
+				atomic.AddInt32(&u.skippedFiles, 1)
+				u.metrics.Skipped()
+				if u.progress != nil {
+					u.progress.Skip(filePath, file.Size)
+				}
+				if u.manifest != nil {
+					skipped := u.manifestEntry(file, ManifestSkipped)
+					skipped.ETag = entry.ETag
+					u.manifest.Add(skipped)
+				}
+				return nil
+			}
+
+			logger.Warn("Object for %s does not match the journal, re-uploading", filePath)
+			verifiedMismatch = true
+		}
+	}
+
+	// Skip files whose content is already stored under another key
+	if u.dedupe != nil && file.SHA256 != "" {
+		if u.hashJournal != nil {
+			if original, seen := u.hashJournal.SeenHash(file.SHA256); seen {
+				u.skipDuplicate(file, original)
+				return nil
+			}
+		}
+
+		original, claimed, err := u.dedupe.claim(ctx, file.SHA256, key)
+		if err != nil {
+			return err
+		}
+
+		if !claimed {
+			u.skipDuplicate(file, original)
+			return nil
+		}
+
+		// Let files waiting on this content know whether it made it to the bucket
+		defer func() {
+			u.dedupe.release(file.SHA256, err == nil)
+		}()
+	}
+
 	// Check if the file already exists in S3
-	if u.config.Upload.SkipExisting {
+	if u.config.Upload.SkipExisting && !u.config.Upload.Overwrite && !verifiedMismatch {
 		operation := fmt.Sprintf("Check existence of %s", filePath)
 
-		var exists bool
-		checkErr := RetryWithBackoff(ctx, operation, func() error {
-			var err error
-			exists, err = u.s3Client.ObjectExists(ctx, filePath)
-			return err
-		}, u.retryConfig)
+		exists := false
+		if u.existing != nil {
+			exists = u.existing.Has(key)
+		} else {
+			checkErr := RetryWithBackoff(ctx, operation, func() error {
+				var err error
+				exists, err = u.s3Client.ObjectExists(ctx, key)
+				return err
+			}, u.retryConfig)
 
-		if checkErr != nil {
-			return fmt.Errorf("failed to check if file exists: %w", checkErr)
+			if checkErr != nil {
+				return fmt.Errorf("failed to check if file exists: %w", checkErr)
+			}
 		}
 
 		if exists {
 			logger.Debug("File already exists in S3, skipping: %s", filePath)
+			if u.config.Upload.DryRun {
+				logger.Info("[DRY RUN] Would skip %s (already exists as %s)", filePath, u.bucketKey(key))
+				u.planSkip(file, key, SkipReasonExists)
+			}
 			atomic.AddInt32(&u.skippedFiles, 1)
+			u.metrics.Skipped()
 			if u.progress != nil {
-				u.progress.Skip(filePath)
+				u.progress.Skip(filePath, file.Size)
+			}
+			if u.manifest != nil {
+				u.manifest.Add(u.manifestEntry(file, ManifestSkipped))
 			}
 			return nil
 		}
 	}
 
-	// Dry run mode
-	if u.config.Upload.DryRun {
-		logger.Info("[DRY RUN] Would upload %s (%.2f MB)", filePath, float64(file.Size)/(1024*1024))
-		atomic.AddInt32(&u.uploadedFiles, 1)
-		atomic.AddInt64(&u.uploadedBytes, file.Size)
-		if u.progress != nil {
-			u.progress.Complete(filePath)
+	// Get file metadata
+	fileMetadata := u.fileMetadata(filePath)
+	metadata := make(map[string]string)
+	if u.config.Upload.PreserveMetadata && fileMetadata != nil {
+		// Instead of manually constructing metadata, use the ToMap method
+		metadata = fileMetadata.ToMap()
+
+		// Add source info if not already present
+		if _, ok := metadata["Source"]; !ok {
+			metadata["Source"] = "Google Takeout"
 		}
-		if u.journal != nil {
-			u.journal.MarkUploaded(filePath, file.Archive)
+	}
+
+	// Record the original capture time so objects can be sorted by it
+	if u.config.Upload.PreserveTimestamps {
+		if takenAt, ok := originalDate(file.Metadata); ok {
+			metadata[s3client.MetadataOriginalDate] = takenAt.Format(time.RFC3339)
 		}
-		return nil
 	}
 
-	// Get file metadata
-	metadata := make(map[string]string)
-	if u.config.Upload.PreserveMetadata {
-		if fileMetadata := u.takeout.GetMetadata(filePath); fileMetadata != nil {
-			// Instead of manually constructing metadata, use the ToMap method
-			metadata = fileMetadata.ToMap()
-
-			// Add source info if not already present
-			if _, ok := metadata["Source"]; !ok {
-				metadata["Source"] = "Google Takeout"
-			}
+	// Link the still and video halves of Motion Photos and Live Photos
+	if file.LivePhotoGroup != "" {
+		metadata[s3client.MetadataLivePhotoGroup] = file.LivePhotoGroup
+	}
+
+	// Record which archive the file came from for --tag-source-archive
+	if u.config.Upload.TagSourceArchive && file.Archive != "" {
+		metadata[s3client.MetadataSourceArchive] = file.Archive
+	}
+
+	// Store the checksum from the scan so multipart objects, whose ETag isn't
+	// a hash of the content, can still be checked later
+	if file.SHA256 != "" {
+		metadata[s3client.MetadataSHA256] = file.SHA256
+	}
+
+	// Tag objects with the albums and people they belong to
+	var tags map[string]string
+	if u.config.Upload.ObjectTags && file.Metadata != nil {
+		var truncated bool
+		tags, truncated = file.Metadata.ToTags()
+		if truncated {
+			logger.Warn("Truncated object tags for %s to fit the S3 tag limits", filePath)
 		}
 	}
+	if u.config.Upload.ObjectTags && u.config.Upload.TagSourceArchive && file.Archive != "" {
+		tags = sourceArchiveTags(file, tags)
+	}
 
-	// Determine content type
-	contentType := "application/octet-stream"
+	// Store the full metadata as JSON next to the object if asked to
+	var sidecar []byte
+	if u.config.Upload.SidecarMetadata && fileMetadata != nil {
+		if sidecar, err = metadataSidecar(fileMetadata); err != nil {
+			return err
+		}
+		metadata[s3client.MetadataSidecar] = path.Base(key) + metadataSidecarSuffix
+	}
 
-	// Try to determine content type from extension first
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
-	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
-	case ".png":
-		contentType = "image/png"
-	case ".gif":
-		contentType = "image/gif"
-	case ".mp4":
-		contentType = "video/mp4"
-	case ".mov":
-		contentType = "video/quicktime"
-	case ".heic":
-		contentType = "image/heic"
-	case ".3gp":
-		contentType = "video/3gpp"
-	case ".webp":
-		contentType = "image/webp"
+	// S3 rejects objects with more than 2KB of user metadata
+	metadata, overflow, err := u.limitMetadata(filePath, key, metadata, sidecar != nil)
+	if err != nil {
+		return err
 	}
 
-	// If available, get content type from metadata (it might be stored in a different place)
-	if file.Metadata != nil {
-		// Check if we can find content type info in the metadata map
-		metadataMap := file.Metadata.ToMap()
-		if contentTypeFromMeta, ok := metadataMap["Content-Type"]; ok && contentTypeFromMeta != "" {
-			contentType = contentTypeFromMeta
+	// The full metadata sidecar already holds what didn't fit
+	if overflow && sidecar == nil {
+		if sidecar, err = metadataSidecar(fileMetadata); err != nil {
+			return err
 		}
 	}
 
-	// Open the file
+	// Open the file. Reading the archive says nothing about the endpoint, so
+	// the circuit breaker is left out.
 	operation := fmt.Sprintf("Open file %s", filePath)
+	openRetry := u.retryConfig
+	openRetry.Breaker = nil
 	var reader io.ReadCloser
 	openErr := RetryWithBackoff(ctx, operation, func() error {
 		var err error
-		reader, err = u.takeout.OpenFile(filePath)
+		reader, err = u.source.OpenFile(filePath)
 		return err
-	}, u.retryConfig)
+	}, openRetry)
 
 	if openErr != nil {
 		return fmt.Errorf("failed to open file: %w", openErr)
 	}
 	defer reader.Close()
 
-	// Upload the file with retry
-	uploadOperation := fmt.Sprintf("Upload %s to S3", filePath)
-	uploadErr := RetryWithBackoff(ctx, uploadOperation, func() error {
-		return u.s3Client.UploadFile(ctx, reader, filePath, file.Size, metadata, contentType)
-	}, u.retryConfig)
+	// Tell damaged archive entries apart from failed uploads
+	entry := newCorruptionReader(reader)
+	defer func() {
+		if cerr := entry.Err(); err != nil && cerr != nil {
+			err = cerr
+		}
+	}()
+
+	// Determine content type, sniffing the content if the extension is unknown
+	contentType, body, err := detectContentType(file, entry)
+	if err != nil {
+		return fmt.Errorf("failed to detect content type: %w", err)
+	}
+
+	// Convert HEIC photos to JPEG for viewers that can't display them. The
+	// JPEG either takes the place of the original or is uploaded next to it.
+	size := file.Size
+	var jpegCopy []byte
+	if u.transcodes(file) && !u.config.Upload.DryRun {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+
+		jpg, err := transcode.HEICToJPEG(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to transcode %s: %w", filePath, err)
+		}
+
+		if u.config.Upload.TranscodeHEIC == config.TranscodeHEICReplace {
+			body, size, contentType = bytes.NewReader(jpg), int64(len(jpg)), transcode.JPEGContentType
+			// The checksum from the scan is of the original
+			delete(metadata, s3client.MetadataSHA256)
+		} else {
+			body, jpegCopy = bytes.NewReader(data), jpg
+		}
+	}
+
+	// Dry run mode: report the object that would be written instead of uploading it
+	if u.config.Upload.DryRun {
+		logger.InfoKV(fmt.Sprintf("[DRY RUN] Would upload %s", filePath), map[string]any{
+			"key":          u.bucketKey(key),
+			"content_type": contentType,
+			"bytes":        file.Size,
+			"metadata":     metadata,
+		})
+		u.plan.Add(PlannedObject{
+			Action:      PlanUpload,
+			Path:        filePath,
+			Archive:     file.Archive,
+			Key:         u.bucketKey(key),
+			Size:        file.Size,
+			ContentType: contentType,
+			Metadata:    metadata,
+		})
+
+		atomic.AddInt32(&u.uploadedFiles, 1)
+		atomic.AddInt64(&u.uploadedBytes, file.Size)
+		if u.progress != nil {
+			u.progress.AddBytes(file.Size)
+			u.progress.Complete(filePath)
+		}
+		return nil
+	}
+
+	// Keep a record of objects that may have replaced a good copy
+	if u.config.Upload.Overwrite {
+		logger.Info("Overwriting %s with %s from archive %s", u.bucketKey(key), filePath, archiveName)
+	}
+
+	// The JPEG that replaces a HEIC photo is named like its object
+	filename := fileName(file)
+	if u.transcodes(file) && u.config.Upload.TranscodeHEIC == config.TranscodeHEICReplace {
+		filename = transcode.JPEGKey(filename)
+	}
+
+	uploadOpts := s3client.UploadOptions{
+		ContentType:        contentType,
+		Metadata:           metadata,
+		Tags:               tags,
+		ContentDisposition: u.contentDisposition(filename),
+	}
+	uploadStart := time.Now()
+	var info s3client.UploadInfo
+	var uploadErr error
+
+	if resumable, ok := u.resumableClient(size); ok {
+		info, uploadErr = u.uploadResumable(ctx, resumable, file, key, body, size, uploadOpts)
+	} else {
+		// Copy large entries that can't seek to disk first, so a retry
+		// doesn't have to open and decompress them again
+		if u.spills(reader, size) {
+			logger.Debug("Copying %s to %s before uploading it", filePath, u.config.Upload.TmpDir)
+			f, cleanup, err := spillFile(u.config.Upload.TmpDir, body, size)
+			if err != nil {
+				if cerr := entry.Err(); cerr != nil {
+					return cerr
+				}
+				return fmt.Errorf("failed to copy %s to --tmp-dir: %w", filePath, err)
+			}
+			defer cleanup()
+			body = f
+		}
+
+		attempts := &attemptBody{
+			first:  body,
+			source: reader,
+			reopen: func() (io.ReadCloser, error) { return u.source.OpenFile(filePath) },
+			entry:  entry,
+		}
+		defer attempts.close()
+
+		// Upload the file with retry, checking the stored object against the bytes sent
+		uploadOperation := fmt.Sprintf("Upload %s to S3", filePath)
+		uploadErr = RetryWithBackoff(ctx, uploadOperation, func() error {
+			attempt, err := attempts.next()
+			if err != nil {
+				return fmt.Errorf("failed to read %s again: %w", filePath, err)
+			}
+			entry = attempts.entry
+
+			// Throttle the upload if a bandwidth limit is set
+			attempt = u.limiter.Reader(ctx, attempt)
+
+			// Report bytes as they are sent so throughput and ETA reflect file sizes
+			attempt = u.progress.Reader(attempt)
+
+			sums := newChecksumReader(attempt)
+			info, err = u.s3Client.UploadFile(ctx, sums, key, size, uploadOpts)
+			if err != nil {
+				// Don't retry a damaged entry, whatever the client made of the error
+				if cerr := entry.Err(); cerr != nil {
+					return cerr
+				}
+				return err
+			}
+			return u.verifyUpload(ctx, key, info, sums)
+		}, u.retryConfig)
+	}
 
 	if uploadErr != nil {
 		return fmt.Errorf("failed to upload file: %w", uploadErr)
 	}
 
+	if jpegCopy != nil {
+		if err := u.uploadJPEGCopy(ctx, file, key, jpegCopy, metadata, tags); err != nil {
+			return err
+		}
+	}
+	if sidecar != nil {
+		if err := u.uploadMetadataSidecar(ctx, file, key, sidecar); err != nil {
+			return err
+		}
+	}
+
 	// Update statistics
+	sent := size + int64(len(jpegCopy))
 	atomic.AddInt32(&u.uploadedFiles, 1)
-	atomic.AddInt64(&u.uploadedBytes, file.Size)
+	atomic.AddInt64(&u.uploadedBytes, sent)
+	u.metrics.Uploaded(sent, time.Since(uploadStart))
 
 	// Update progress
 	if u.progress != nil {
 		u.progress.Complete(filePath)
 	}
 
-	// Mark as uploaded in journal
+	// Mark as uploaded in journal, with the size of the object stored under
+	// the key so it can be verified on resume
 	if u.journal != nil {
-		u.journal.MarkUploaded(filePath, file.Archive)
+		u.journal.MarkUploaded(filePath, key, file.Archive, size, info.ETag, file.SHA256)
+	}
+	if u.hashJournal != nil && u.dedupe != nil && file.SHA256 != "" {
+		u.hashJournal.MarkHash(file.SHA256, key)
+	}
+	if u.existing != nil {
+		u.existing.Add(key)
+	}
+	if u.manifest != nil {
+		u.manifest.Add(ManifestEntry{
+			Status:      ManifestUploaded,
+			Path:        filePath,
+			Archive:     archiveName,
+			Key:         u.bucketKey(key),
+			Size:        size,
+			ContentType: contentType,
+			ETag:        info.ETag,
+		})
+	}
+
+	logger.DebugKV("Successfully uploaded file", map[string]any{
+		"path":    filePath,
+		"archive": archiveName,
+		"bytes":   size,
+		"etag":    info.ETag,
+	})
+	return nil
+}
+
+// objectKey returns the key a file is stored under
+func (u *Uploader) objectKey(file *source.MediaFile) (string, error) {
+	return ObjectKey(file, u.keyTemplate, &u.config.Upload)
+}
+
+// fileName returns the base name of a file in its archive. Paths from
+// archives made on Windows may use backslashes.
+func fileName(file *source.MediaFile) string {
+	return path.Base(strings.ReplaceAll(file.Path, "\\", "/"))
+}
+
+// contentDisposition returns the Content-Disposition header naming an object
+// filename for --content-disposition, or "" to send none
+func (u *Uploader) contentDisposition(filename string) string {
+	if u.config.Upload.ContentDisposition == "" {
+		return ""
+	}
+	return s3client.ContentDisposition(u.config.Upload.ContentDisposition, filename)
+}
+
+// sourceArchiveTags adds the archive of a file to its object tags for
+// --tag-source-archive
+func sourceArchiveTags(file *source.MediaFile, tags map[string]string) map[string]string {
+	tags, added := metadata.AddSourceArchiveTag(tags, file.Archive)
+	if !added {
+		logger.Warn("No room for the source archive tag of %s, which has %d tags already", file.Path, len(tags))
+	}
+	return tags
+}
+
+// transcodes reports whether a file is a HEIC photo to convert to JPEG
+func (u *Uploader) transcodes(file *source.MediaFile) bool {
+	return u.config.Upload.TranscodeHEIC != "" && transcode.IsHEIC(file.Path)
+}
+
+// uploadJPEGCopy uploads the JPEG transcoded from a HEIC photo next to the
+// original, with the same metadata and tags
+func (u *Uploader) uploadJPEGCopy(ctx context.Context, file *source.MediaFile, key string, jpg []byte,
+	metadata, tags map[string]string) error {
+	filePath := file.Path
+	jpegKey := transcode.JPEGKey(key)
+
+	// The checksum from the scan is of the original
+	jpegMetadata := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		jpegMetadata[k] = v
+	}
+	delete(jpegMetadata, s3client.MetadataSHA256)
+
+	operation := fmt.Sprintf("Upload JPEG copy of %s to S3", filePath)
+	var info s3client.UploadInfo
+	err := RetryWithBackoff(ctx, operation, func() error {
+		var err error
+		info, err = u.s3Client.UploadFile(ctx, bytes.NewReader(jpg), jpegKey, int64(len(jpg)), s3client.UploadOptions{
+			ContentType:        transcode.JPEGContentType,
+			Metadata:           jpegMetadata,
+			Tags:               tags,
+			ContentDisposition: u.contentDisposition(transcode.JPEGKey(fileName(file))),
+		})
+		return err
+	}, u.retryConfig)
+	if err != nil {
+		return fmt.Errorf("failed to upload JPEG copy: %w", err)
 	}
 
-	logger.Debug("Successfully uploaded %s from archive %s (%.2f MB)",
-		filePath, archiveName, float64(file.Size)/(1024*1024))
+	logger.Debug("Uploaded JPEG copy of %s as %s", filePath, u.bucketKey(jpegKey))
+	if u.manifest != nil {
+		u.manifest.Add(ManifestEntry{
+			Status:      ManifestUploaded,
+			Path:        filePath,
+			Archive:     file.Archive,
+			Key:         u.bucketKey(jpegKey),
+			Size:        int64(len(jpg)),
+			ContentType: transcode.JPEGContentType,
+			ETag:        info.ETag,
+		})
+	}
 	return nil
 }
 
+// manifestEntry describes a file for the manifest, with the key it is or
+// would have been stored under
+func (u *Uploader) manifestEntry(file *source.MediaFile, status string) ManifestEntry {
+	entry := ManifestEntry{Status: status, Path: file.Path, Archive: file.Archive, Size: file.Size}
+	if file.Metadata != nil {
+		entry.Warning = strings.Join(file.Metadata.Warnings, "; ")
+	}
+	if key, err := u.objectKey(file); err == nil {
+		entry.Key = u.bucketKey(key)
+	}
+	return entry
+}
+
+// verifyJournalEntry checks that the object recorded in the journal for a file
+// is still present in the bucket with the recorded size and ETag
+func (u *Uploader) verifyJournalEntry(ctx context.Context, file *source.MediaFile, entry journal.UploadEntry) (bool, error) {
+	// Duplicates are stored under the key of the file they were deduplicated against
+	key, err := u.objectKey(file)
+	if err != nil {
+		return false, err
+	}
+	if entry.DuplicateOf != "" {
+		key = entry.DuplicateOf
+	}
+
+	operation := fmt.Sprintf("Verify %s", key)
+
+	var objects []minio.ObjectInfo
+	listErr := RetryWithBackoff(ctx, operation, func() error {
+		var err error
+		objects, err = u.s3Client.ListObjects(ctx, key)
+		return err
+	}, u.retryConfig)
+
+	if listErr != nil {
+		return false, listErr
+	}
+
+	// Entries written before sizes were recorded fall back to the local size
+	expectedSize := entry.Size
+	if expectedSize == 0 {
+		expectedSize = file.Size
+	}
+
+	for _, object := range objects {
+		if rel, ok := s3client.RelativeKey(u.s3Client.GetPrefix(), object.Key); !ok || rel != key {
+			continue
+		}
+
+		if object.Size != expectedSize {
+			logger.Debug("Size mismatch for %s: journal %d bytes, bucket %d bytes", key, expectedSize, object.Size)
+			return false, nil
+		}
+
+		if entry.ETag != "" && object.ETag != "" && strings.Trim(entry.ETag, `"`) != strings.Trim(object.ETag, `"`) {
+			logger.Debug("ETag mismatch for %s: journal %s, bucket %s", key, entry.ETag, object.ETag)
+			return false, nil
+		}
+
+		return true, nil
+	}
+
+	logger.Debug("Object for %s is missing from the bucket", key)
+	return false, nil
+}
+
+// bucketKey returns the key an object is stored under, including the prefix
+func (u *Uploader) bucketKey(key string) string {
+	prefix := strings.TrimSuffix(u.s3Client.GetPrefix(), "/")
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// detectContentType determines the content type of a media file from its
+// extension or content, letting a content type recorded in its metadata take
+// precedence. The returned reader must be used in place of the given one.
+func detectContentType(file *source.MediaFile, reader io.Reader) (string, io.Reader, error) {
+	contentType, reader, err := s3client.DetectContentTypeFromReader(file.Path, reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// If available, get content type from metadata (it might be stored in a different place)
+	if file.Metadata != nil {
+		contentType = metadataContentType(file.Metadata.ToMap(), contentType)
+	}
+
+	return contentType, reader, nil
+}
+
+// metadataContentType returns the content type recorded in the metadata map
+// of a file, or the detected one if it has none
+func metadataContentType(metadataMap map[string]string, detected string) string {
+	if contentTypeFromMeta, ok := metadataMap["Content-Type"]; ok && contentTypeFromMeta != "" {
+		return contentTypeFromMeta
+	}
+	return detected
+}
+
+// skipDuplicate skips a file whose content is already stored under original
+func (u *Uploader) skipDuplicate(file *source.MediaFile, original string) {
+	logger.Info("Skipping duplicate %s (same content as %s)", file.Path, original)
+	u.planSkip(file, original, SkipReasonDuplicate)
+	atomic.AddInt32(&u.skippedFiles, 1)
+	atomic.AddInt32(&u.duplicateFiles, 1)
+	atomic.AddInt64(&u.duplicateBytes, file.Size)
+	u.metrics.Skipped()
+	if u.progress != nil {
+		u.progress.Skip(file.Path, file.Size)
+	}
+	if u.manifest != nil {
+		entry := u.manifestEntry(file, ManifestDuplicate)
+		entry.Key = u.bucketKey(original)
+		u.manifest.Add(entry)
+	}
+	if u.journal != nil {
+		u.journal.MarkDuplicate(file.Path, file.Archive, file.Size, file.SHA256, original)
+	}
+}
+
+// planSkip records in the plan of a dry run that a file is skipped. Key is
+// the object that already holds the file, if it is known.
+func (u *Uploader) planSkip(file *source.MediaFile, key string, reason string) {
+	if u.plan == nil {
+		return
+	}
+
+	object := PlannedObject{
+		Action:  PlanSkip,
+		Path:    file.Path,
+		Archive: file.Archive,
+		Size:    file.Size,
+		Reason:  reason,
+	}
+	if key != "" {
+		object.Key = u.bucketKey(key)
+	}
+	u.plan.Add(object)
+}
+
 // logSummary logs a summary of the upload process
 func (u *Uploader) logSummary() {
 	uploadedFiles := atomic.LoadInt32(&u.uploadedFiles)
 	skippedFiles := atomic.LoadInt32(&u.skippedFiles)
 	failedFiles := atomic.LoadInt32(&u.failedFiles)
 
-	logger.Info("Upload complete:")
-	logger.Info("  Total files: %d", u.totalFiles)
-	logger.Info("  Uploaded: %d (%.2f MB)", uploadedFiles, float64(u.uploadedBytes)/(1024*1024))
-	logger.Info("  Skipped: %d", skippedFiles)
-	logger.Info("  Failed: %d", failedFiles)
+	logger.InfoKV("Upload complete", map[string]any{
+		"total_files":    u.totalFiles,
+		"uploaded_files": uploadedFiles,
+		"uploaded_bytes": atomic.LoadInt64(&u.uploadedBytes),
+		"skipped_files":  skippedFiles,
+		"failed_files":   failedFiles,
+		"corrupt_files":  atomic.LoadInt32(&u.corruptFiles),
+		"filtered_files": u.filteredFiles,
+		"dry_run":        u.config.Upload.DryRun,
+	})
+
+	if duplicates := atomic.LoadInt32(&u.duplicateFiles); duplicates > 0 {
+		logger.Info("Skipped %d duplicate files, saving %s of uploads", duplicates, config.FormatSize(atomic.LoadInt64(&u.duplicateBytes)))
+	}
 
 	if u.config.Upload.DryRun {
 		logger.Info("Note: This was a dry run, no files were actually uploaded")
@@ -1,15 +1,23 @@
 package uploader
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
-	"unsafe"
 
 	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/googletakeout"
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
 	"github.com/bstardust/google-takeout-s3-importer/internal/config"
 	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
 	"github.com/bstardust/google-takeout-s3-importer/internal/metadata"
@@ -19,6 +27,7 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Make sure the MockS3Client properly implements S3Interface
@@ -29,9 +38,9 @@ type MockS3Client struct {
 	mock.Mock
 }
 
-func (m *MockS3Client) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, metadata map[string]string, contentType string) error {
-	args := m.Called(ctx, reader, objectKey, size, metadata, contentType)
-	return args.Error(0)
+func (m *MockS3Client) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, opts s3client.UploadOptions) (s3client.UploadInfo, error) {
+	args := m.Called(ctx, reader, objectKey, size, opts)
+	return s3client.UploadInfo{Key: objectKey, Size: size}, args.Error(0)
 }
 
 func (m *MockS3Client) ObjectExists(ctx context.Context, objectKey string) (bool, error) {
@@ -39,17 +48,22 @@ func (m *MockS3Client) ObjectExists(ctx context.Context, objectKey string) (bool
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockS3Client) StatObject(ctx context.Context, objectKey string) (s3client.ObjectInfo, error) {
+	args := m.Called(ctx, objectKey)
+	return args.Get(0).(s3client.ObjectInfo), args.Error(1)
+}
+
 func (m *MockS3Client) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
 	args := m.Called(ctx, prefix)
 	return args.Get(0).([]minio.ObjectInfo), args.Error(1)
 }
 
-func (m *MockS3Client) GetObject(ctx context.Context, objectKey string) (*minio.Object, error) {
+func (m *MockS3Client) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, s3client.ObjectInfo, error) {
 	args := m.Called(ctx, objectKey)
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, s3client.ObjectInfo{}, args.Error(2)
 	}
-	return args.Get(0).(*minio.Object), args.Error(1)
+	return args.Get(0).(io.ReadCloser), args.Get(1).(s3client.ObjectInfo), args.Error(2)
 }
 
 func (m *MockS3Client) DeleteObject(ctx context.Context, objectKey string) error {
@@ -57,6 +71,16 @@ func (m *MockS3Client) DeleteObject(ctx context.Context, objectKey string) error
 	return args.Error(0)
 }
 
+func (m *MockS3Client) ListIncompleteUploads(ctx context.Context, prefix string) ([]s3client.IncompleteUpload, error) {
+	args := m.Called(ctx, prefix)
+	return args.Get(0).([]s3client.IncompleteUpload), args.Error(1)
+}
+
+func (m *MockS3Client) AbortIncompleteUpload(ctx context.Context, upload s3client.IncompleteUpload) error {
+	args := m.Called(ctx, upload)
+	return args.Error(0)
+}
+
 func (m *MockS3Client) GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
 	args := m.Called(ctx, objectKey, expiry)
 	return args.String(0), args.Error(1)
@@ -82,9 +106,9 @@ type MockTakeout struct {
 	mock.Mock
 }
 
-func (m *MockTakeout) ListFiles() []*googletakeout.MediaFile {
+func (m *MockTakeout) ListFiles() []*source.MediaFile {
 	args := m.Called()
-	return args.Get(0).([]*googletakeout.MediaFile)
+	return args.Get(0).([]*source.MediaFile)
 }
 
 func (m *MockTakeout) OpenFile(path string) (io.ReadCloser, error) {
@@ -114,15 +138,25 @@ func (m MockReadCloser) Close() error {
 	return nil
 }
 
-// Create an adapter that wraps MockTakeout to make it look like *googletakeout.Takeout
-type TakeoutAdapter struct {
-	mock *MockTakeout
+// newMockS3 returns a client mock that answers the calls every run makes
+func newMockS3() *MockS3Client {
+	m := new(MockS3Client)
+	m.On("GetEndpoint").Return("test-endpoint")
+	m.On("GetBucketName").Return("test-bucket")
+	return m
 }
 
-func NewTakeoutAdapter(mock *MockTakeout) *googletakeout.Takeout {
-	// This uses type assertion to bypass the type system
-	// It's not ideal, but works for testing purposes
-	return (*googletakeout.Takeout)(unsafe.Pointer(mock))
+// newMockTakeout returns a source mock listing the files
+func newMockTakeout(files []*source.MediaFile) *MockTakeout {
+	m := new(MockTakeout)
+	m.On("ListFiles").Return(files)
+	return m
+}
+
+// newJournal returns an empty journal saved in a temporary directory
+func newJournal(t *testing.T) *journal.Journal {
+	t.Helper()
+	return journal.New(filepath.Join(t.TempDir(), "journal.json"))
 }
 
 // Tests
@@ -145,12 +179,12 @@ func TestUploader_Run(t *testing.T) {
 	}
 
 	// Create components
-	jnl := journal.New("")
+	jnl := newJournal(t)
 	pool := worker.NewPool(2)
 	prog := progress.New()
 
 	// Setup test media files
-	mediaFiles := []*googletakeout.MediaFile{
+	mediaFiles := []*source.MediaFile{
 		{
 			Path: "test/photo1.jpg",
 			Metadata: &metadata.Metadata{
@@ -181,25 +215,26 @@ func TestUploader_Run(t *testing.T) {
 	mockTakeout.On("ListFiles").Return(mediaFiles)
 
 	// First file doesn't exist in S3
-	mockS3.On("ObjectExists", ctx, "test/photo1.jpg").Return(false, nil)
-	mockTakeout.On("GetSize", "test/photo1.jpg").Return(int64(1024))
+	mockS3.On("ObjectExists", mock.Anything, "test/photo1.jpg").Return(false, nil)
 	mockTakeout.On("GetMetadata", "test/photo1.jpg").Return(mediaFiles[0].Metadata)
 	mockTakeout.On("OpenFile", "test/photo1.jpg").Return(
 		MockReadCloser{Reader: strings.NewReader("test file content")},
 		nil,
 	)
-	mockS3.On("UploadFile", ctx, mock.Anything, "test/photo1.jpg", int64(1024), mock.Anything, "image/jpeg").Return(nil)
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "test/photo1.jpg", int64(1024), mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+		return opts.ContentType == "image/jpeg"
+	})).Return(nil)
 
 	// Second file already exists in S3
-	mockS3.On("ObjectExists", ctx, "test/photo2.jpg").Return(true, nil)
+	mockS3.On("ObjectExists", mock.Anything, "test/photo2.jpg").Return(true, nil)
 
 	// Mock bucket info
 	mockS3.On("GetBucketName").Return("test-bucket")
 	mockS3.On("GetEndpoint").Return("test-endpoint")
-	mockS3.On("GetPrefix").Return("")
+	mockS3.On("GetPrefix").Return("").Maybe()
 
 	// Create uploader with mocks
-	uploader := New(ctx, mockS3, NewTakeoutAdapter(mockTakeout), jnl, pool, prog, cfg)
+	uploader := New(ctx, mockS3, mockTakeout, jnl, pool, prog, cfg)
 
 	// Run the uploader
 	err := uploader.Run()
@@ -233,12 +268,12 @@ func TestUploader_Run_WithError(t *testing.T) {
 	}
 
 	// Create components
-	jnl := journal.New("")
+	jnl := newJournal(t)
 	pool := worker.NewPool(2)
 	prog := progress.New()
 
 	// Setup test media file
-	mediaFiles := []*googletakeout.MediaFile{
+	mediaFiles := []*source.MediaFile{
 		{
 			Path: "test/photo_error.jpg",
 			Metadata: &metadata.Metadata{
@@ -255,8 +290,7 @@ func TestUploader_Run_WithError(t *testing.T) {
 
 	// Configure mock expectations
 	mockTakeout.On("ListFiles").Return(mediaFiles)
-	mockS3.On("ObjectExists", ctx, "test/photo_error.jpg").Return(false, nil)
-	mockTakeout.On("GetSize", "test/photo_error.jpg").Return(int64(1024))
+	mockS3.On("ObjectExists", mock.Anything, "test/photo_error.jpg").Return(false, nil)
 	mockTakeout.On("GetMetadata", "test/photo_error.jpg").Return(mediaFiles[0].Metadata)
 	mockTakeout.On("OpenFile", "test/photo_error.jpg").Return(
 		MockReadCloser{Reader: strings.NewReader("test file content")},
@@ -265,15 +299,19 @@ func TestUploader_Run_WithError(t *testing.T) {
 
 	// Simulate upload error
 	uploadErr := errors.New("upload failed: network error")
-	mockS3.On("UploadFile", ctx, mock.Anything, "test/photo_error.jpg", int64(1024), mock.Anything, "image/jpeg").Return(uploadErr)
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "test/photo_error.jpg", int64(1024), mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+		return opts.ContentType == "image/jpeg"
+	})).Return(uploadErr)
 
 	// Mock bucket info
 	mockS3.On("GetBucketName").Return("test-bucket")
 	mockS3.On("GetEndpoint").Return("test-endpoint")
 	mockS3.On("GetPrefix").Return("")
 
-	// Create uploader with mocks
-	uploader := New(ctx, mockS3, NewTakeoutAdapter(mockTakeout), jnl, pool, prog, cfg)
+	// Create uploader with mocks, retrying without waiting
+	retry := DefaultRetryConfig()
+	retry.InitialBackoff = time.Millisecond
+	uploader := New(ctx, mockS3, mockTakeout, jnl, pool, prog, cfg, WithRetryConfig(retry))
 
 	// Run the uploader
 	err := uploader.Run()
@@ -286,3 +324,472 @@ func TestUploader_Run_WithError(t *testing.T) {
 	completed := jnl.ListCompleted()
 	assert.NotContains(t, completed, "test/photo_error.jpg")
 }
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"Google Photos/photo.jpg", "image/jpeg"},
+		{"Google Photos/photo.heif", "image/heif"},
+		{"Google Photos/video.mkv", "video/x-matroska"},
+		{"Google Photos/video.webm", "video/webm"},
+		{"Google Photos/VIDEO.MP4", "video/mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			file := &source.MediaFile{Path: tt.path, Metadata: &metadata.Metadata{Title: "test"}}
+			contentType, _, err := detectContentType(file, strings.NewReader("content"))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, contentType)
+		})
+	}
+
+	// A content type recorded in the metadata takes precedence
+	assert.Equal(t, "image/x-adobe-dng", metadataContentType(map[string]string{"Content-Type": "image/x-adobe-dng", "title": "test"}, "image/jpeg"))
+	assert.Equal(t, "image/jpeg", metadataContentType(map[string]string{"Content-Type": "", "title": "test"}, "image/jpeg"))
+}
+
+func TestUploader_VerifyJournalEntry(t *testing.T) {
+	ctx := context.Background()
+	file := &source.MediaFile{Path: "test/photo.jpg", Size: 1024}
+
+	tests := []struct {
+		name     string
+		entry    journal.UploadEntry
+		objects  []minio.ObjectInfo
+		expected bool
+	}{
+		{
+			name:     "matching size and etag",
+			entry:    journal.UploadEntry{Uploaded: true, Size: 1024, ETag: `"abc"`},
+			objects:  []minio.ObjectInfo{{Key: "photos/test/photo.jpg", Size: 1024, ETag: "abc"}},
+			expected: true,
+		},
+		{
+			name:     "partial upload",
+			entry:    journal.UploadEntry{Uploaded: true, Size: 1024},
+			objects:  []minio.ObjectInfo{{Key: "photos/test/photo.jpg", Size: 512}},
+			expected: false,
+		},
+		{
+			name:     "etag mismatch",
+			entry:    journal.UploadEntry{Uploaded: true, Size: 1024, ETag: "abc"},
+			objects:  []minio.ObjectInfo{{Key: "photos/test/photo.jpg", Size: 1024, ETag: "def"}},
+			expected: false,
+		},
+		{
+			name:     "legacy entry without size",
+			entry:    journal.UploadEntry{Uploaded: true},
+			objects:  []minio.ObjectInfo{{Key: "photos/test/photo.jpg", Size: 1024}},
+			expected: true,
+		},
+		{
+			name:     "missing object",
+			entry:    journal.UploadEntry{Uploaded: true, Size: 1024},
+			objects:  []minio.ObjectInfo{{Key: "photos/test/photo.jpg.json", Size: 1024}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := new(MockS3Client)
+			mockS3.On("ListObjects", ctx, "test/photo.jpg").Return(tt.objects, nil)
+			mockS3.On("GetPrefix").Return("photos/")
+
+			up := New(ctx, mockS3, nil, nil, nil, nil, &config.Config{})
+			intact, err := up.verifyJournalEntry(ctx, file, tt.entry)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, intact)
+		})
+	}
+}
+
+func TestUploader_Run_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not really a jpeg"), 0600))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	// The first upload blocks until the parent context is cancelled
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			close(started)
+			<-args.Get(0).(context.Context).Done()
+			close(stopped)
+		}).
+		Return(context.Canceled).Once()
+
+	up := New(ctx, mockS3, takeout, nil, worker.NewPool(1), nil, &config.Config{})
+
+	done := make(chan error, 1)
+	go func() { done <- up.Run() }()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight upload was not cancelled")
+	}
+
+	// Files that hadn't started must not be uploaded
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+}
+
+func TestUploader_Run_Deadline(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("not really a jpeg"), 0600))
+
+	takeout, err := googletakeout.New(context.Background(), dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	// The upload is still running when the run's deadline passes
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).
+		Return(context.DeadlineExceeded).Once()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	jnl := newJournal(t)
+	up := New(ctx, mockS3, takeout, jnl, worker.NewPool(1), nil, &config.Config{})
+
+	err = up.Run()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Running out of time leaves the file to be uploaded by the next run
+	// rather than recording it as failed
+	assert.False(t, jnl.IsFailed("a.jpg"))
+	assert.False(t, jnl.IsUploaded("a.jpg"))
+}
+
+func TestUploader_Run_PartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not really a jpeg"), 0600))
+	}
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "b.jpg", mock.Anything, mock.Anything).Return(errors.New("access denied"))
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	path := filepath.Join(t.TempDir(), "journal.json")
+	up := New(ctx, mockS3, takeout, journal.New(path), worker.NewPool(1), nil, &config.Config{})
+
+	// The error and the totals count the file uploaded before the failure
+	err = up.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1/2 files failed and 1 uploaded")
+	totals := up.Totals()
+	assert.Equal(t, 1, totals.UploadedFiles)
+	assert.Equal(t, 1, totals.FailedFiles)
+
+	// The progress is on disk for the next run to resume from
+	loaded := journal.New(path)
+	require.NoError(t, loaded.Load())
+	assert.True(t, loaded.IsUploaded("a.jpg"))
+	assert.True(t, loaded.IsFailed("b.jpg"))
+}
+
+func TestUploader_RetryFailedOnly(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not really a jpeg"), 0600))
+	}
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "b.jpg", mock.Anything, mock.Anything).Return(errors.New("access denied")).Once()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	jnl := newJournal(t)
+	cfg := &config.Config{}
+
+	// The failure is recorded in the journal
+	up := New(ctx, mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	assert.Error(t, up.Run())
+	require.True(t, jnl.IsFailed("b.jpg"))
+	assert.Equal(t, 1, jnl.FailedEntries()[0].Attempts)
+
+	// The next run only uploads the failed file and clears the failure
+	cfg.Upload.RetryFailedOnly = true
+	up = New(ctx, mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+	assert.Equal(t, 1, up.totalFiles)
+	assert.False(t, jnl.IsFailed("b.jpg"))
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 4)
+}
+
+func TestUploader_Overwrite(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("not really a jpeg"), 0600))
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	mockS3 := newMockS3()
+	mockS3.On("GetPrefix").Return("")
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.Anything).Return(nil)
+
+	jnl := newJournal(t)
+	jnl.MarkUploaded("a.jpg", "a.jpg", filepath.Base(dir), 17, "", "")
+
+	// Neither the journal nor the existing object stop the upload
+	cfg := &config.Config{}
+	cfg.Upload.Overwrite = true
+	cfg.Upload.SkipExisting = true
+	up := New(ctx, mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+	mockS3.AssertNotCalled(t, "ObjectExists", mock.Anything, mock.Anything)
+}
+
+func TestUploader_FileTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Upload.Timeout = 30 * time.Minute
+	u := &Uploader{config: cfg}
+
+	// Small files get the configured timeout
+	assert.Equal(t, 30*time.Minute, u.fileTimeout(5*1024*1024))
+
+	// Large files get enough time for the minimum rate
+	cfg.Upload.MinUploadRate = 1024 * 1024
+	assert.Equal(t, 30*time.Minute, u.fileTimeout(5*1024*1024))
+	assert.Equal(t, 20480*time.Second, u.fileTimeout(20*1024*1024*1024))
+
+	// No timeout at all
+	cfg.Upload.Timeout = 0
+	assert.Equal(t, time.Duration(0), u.fileTimeout(20*1024*1024*1024))
+	u.ctx = context.Background()
+	ctx, cancel := u.fileContext(1024)
+	defer cancel()
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+}
+
+func TestUploader_SidecarMetadata(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("not really a jpeg"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg.json"),
+		[]byte(`{"title": "a.jpg", "people": [{"name": "Alice"}, {"name": "Bob"}]}`), 0600))
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	var sidecar []byte
+	mockS3 := newMockS3()
+	mockS3.On("GetPrefix").Return("")
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+		return opts.Metadata[s3client.MetadataSidecar] == "a.jpg.metadata.json"
+	})).Return(nil)
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg.metadata.json", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		sidecar, _ = io.ReadAll(args.Get(1).(io.Reader))
+	}).Return(nil)
+
+	jnl := newJournal(t)
+	cfg := config.New()
+	cfg.Upload.SkipExisting = false
+	cfg.Upload.SidecarMetadata = true
+	up := New(ctx, mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 2)
+	var stored metadata.Metadata
+	require.NoError(t, json.Unmarshal(sidecar, &stored))
+	assert.Equal(t, "a.jpg", stored.Title)
+	assert.Len(t, stored.People, 2)
+	assert.True(t, jnl.IsUploaded("a.jpg"))
+}
+
+func TestUploader_MetadataOverflowSidecar(t *testing.T) {
+	people := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		people = append(people, fmt.Sprintf(`{"name": "Someone Else %d"}`, i))
+	}
+
+	for name, modify := range map[string]func(cfg *config.Config){
+		"overflow sidecar": func(cfg *config.Config) { cfg.Upload.MetadataOverflow = config.MetadataOverflowSidecar },
+		"sidecar metadata": func(cfg *config.Config) {
+			cfg.Upload.MetadataOverflow = config.MetadataOverflowError
+			cfg.Upload.SidecarMetadata = true
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("not really a jpeg"), 0600))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg.json"),
+				[]byte(`{"title": "a.jpg", "people": [`+strings.Join(people, ",")+`]}`), 0600))
+
+			ctx := context.Background()
+			takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+			require.NoError(t, err)
+
+			var sidecar []byte
+			mockS3 := newMockS3()
+			mockS3.On("GetPrefix").Return("")
+			mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+				_, hasPeople := opts.Metadata["people"]
+				return opts.Metadata[s3client.MetadataSidecar] == "a.jpg.metadata.json" && !hasPeople
+			})).Return(nil)
+			mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg.metadata.json", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				sidecar, _ = io.ReadAll(args.Get(1).(io.Reader))
+			}).Return(nil)
+
+			cfg := config.New()
+			cfg.Upload.SkipExisting = false
+			modify(cfg)
+			up := New(ctx, mockS3, takeout, newJournal(t), worker.NewPool(1), nil, cfg)
+			require.NoError(t, up.Run())
+
+			// Both sidecars have the format of --sidecar-metadata
+			mockS3.AssertNumberOfCalls(t, "UploadFile", 2)
+			var stored metadata.Metadata
+			require.NoError(t, json.Unmarshal(sidecar, &stored))
+			assert.Equal(t, "a.jpg", stored.Title)
+			assert.Len(t, stored.People, 200)
+		})
+	}
+}
+
+func TestUploader_CompressMetadataJSON(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("not really a jpeg"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg.json"), []byte(`{"title": "a.jpg"}`), 0600))
+
+	ctx := context.Background()
+	takeout, err := googletakeout.New(ctx, dir, googletakeout.Options{ScanConcurrency: 1})
+	require.NoError(t, err)
+
+	var sidecar []byte
+	mockS3 := newMockS3()
+	mockS3.On("GetPrefix").Return("")
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.Anything).Return(nil)
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg.metadata.json", mock.Anything, mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+		return opts.ContentType == "application/json" && opts.ContentEncoding == "gzip"
+	})).Run(func(args mock.Arguments) {
+		sidecar, _ = io.ReadAll(args.Get(1).(io.Reader))
+	}).Return(nil)
+
+	jnl := newJournal(t)
+	cfg := config.New()
+	cfg.Upload.SkipExisting = false
+	cfg.Upload.SidecarMetadata = true
+	cfg.Upload.CompressMetadataJSON = true
+	up := New(ctx, mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 2)
+	zr, err := gzip.NewReader(bytes.NewReader(sidecar))
+	require.NoError(t, err)
+	var stored metadata.Metadata
+	require.NoError(t, json.NewDecoder(zr).Decode(&stored))
+	assert.Equal(t, "a.jpg", stored.Title)
+}
+
+func TestUploader_ContentDisposition(t *testing.T) {
+	files := []*source.MediaFile{{Path: "Takeout/Google Photos/Trip/Café.jpg", Size: 3, Archive: "takeout.zip"}}
+	takeout := newMockTakeout(files)
+	takeout.On("OpenFile", files[0].Path).Return(MockReadCloser{strings.NewReader("abc")}, nil)
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, files[0].Path, mock.Anything, mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+		return opts.ContentDisposition == `attachment; filename="Caf_.jpg"; filename*=UTF-8''Caf%C3%A9.jpg`
+	})).Return(nil)
+
+	jnl := newJournal(t)
+	cfg := &config.Config{}
+	cfg.Upload.ContentDisposition = s3client.DispositionAttachment
+	up := New(context.Background(), mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+}
+
+func TestUploader_TagSourceArchive(t *testing.T) {
+	files := []*source.MediaFile{{Path: "a.jpg", Size: 3, Archive: "takeout-001.zip"}}
+	takeout := newMockTakeout(files)
+	takeout.On("OpenFile", "a.jpg").Return(MockReadCloser{strings.NewReader("abc")}, nil)
+
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.MatchedBy(func(opts s3client.UploadOptions) bool {
+		return opts.Metadata[s3client.MetadataSourceArchive] == "takeout-001.zip" &&
+			opts.Tags[metadata.SourceArchiveTag] == "takeout-001.zip"
+	})).Return(nil)
+
+	jnl := newJournal(t)
+	cfg := &config.Config{}
+	cfg.Upload.TagSourceArchive = true
+	cfg.Upload.ObjectTags = true
+	up := New(context.Background(), mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 1)
+}
+
+func TestUploader_CorruptEntry(t *testing.T) {
+	files := []*source.MediaFile{
+		{Path: "a.jpg", Size: 3, Archive: "takeout.zip"},
+		{Path: "b.jpg", Size: 3, Archive: "takeout.zip"},
+	}
+	takeout := newMockTakeout(files)
+	takeout.On("OpenFile", "a.jpg").Return(MockReadCloser{io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(zip.ErrChecksum))}, nil)
+	takeout.On("OpenFile", "b.jpg").Return(MockReadCloser{strings.NewReader("abc")}, nil)
+
+	// The client reports the failed read as an error of its own
+	mockS3 := newMockS3()
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "a.jpg", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		_, _ = io.ReadAll(args.Get(1).(io.Reader))
+	}).Return(errors.New("SerializationError: failed to read request body"))
+	mockS3.On("UploadFile", mock.Anything, mock.Anything, "b.jpg", mock.Anything, mock.Anything).Return(nil)
+
+	// The corrupt file isn't retried and doesn't fail the run
+	jnl := newJournal(t)
+	cfg := &config.Config{}
+	cfg.Upload.ContinueOnCorrupt = true
+	up := New(context.Background(), mockS3, takeout, jnl, worker.NewPool(1), nil, cfg)
+	require.NoError(t, up.Run())
+
+	mockS3.AssertNumberOfCalls(t, "UploadFile", 2)
+	totals := up.Totals()
+	assert.Equal(t, 1, totals.CorruptFiles)
+	assert.Equal(t, 0, totals.FailedFiles)
+	assert.Equal(t, 1, totals.UploadedFiles)
+	assert.True(t, jnl.IsFailed("a.jpg"))
+
+	// Otherwise it fails the run like any other error
+	cfg.Upload.ContinueOnCorrupt = false
+	up = New(context.Background(), mockS3, takeout, newJournal(t), worker.NewPool(1), nil, cfg)
+	err := up.Run()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, ErrCorruptEntry.Error())
+}
@@ -9,22 +9,64 @@ import (
 type Pool struct {
 	wg      sync.WaitGroup
 	workers chan struct{}
+
+	// limiter caps the tasks running in this and other pools, or is nil
+	limiter *Limiter
+}
+
+// Limiter caps the number of tasks running at once across the pools that
+// share it. A nil *Limiter doesn't limit anything.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter creates a limiter that lets size tasks run at once, or returns
+// nil if size isn't positive
+func NewLimiter(size int) *Limiter {
+	if size <= 0 {
+		return nil
+	}
+	return &Limiter{slots: make(chan struct{}, size)}
+}
+
+func (l *Limiter) acquire() {
+	if l != nil {
+		l.slots <- struct{}{}
+	}
+}
+
+func (l *Limiter) release() {
+	if l != nil {
+		<-l.slots
+	}
 }
 
 // NewPool creates a new worker pool with the specified number of workers
 func NewPool(size int) *Pool {
+	return NewLimitedPool(size, nil)
+}
+
+// NewLimitedPool creates a worker pool whose tasks also take a slot of a
+// limiter shared with other pools before they run
+func NewLimitedPool(size int, limiter *Limiter) *Pool {
 	return &Pool{
 		workers: make(chan struct{}, size),
+		limiter: limiter,
 	}
 }
 
-// Submit submits a task to the worker pool
+// Submit submits a task to the worker pool, waiting for a free worker and
+// a slot of the shared limiter
 func (p *Pool) Submit(task func()) {
 	p.workers <- struct{}{} // Acquire a worker
+	p.limiter.acquire()
+	p.wg.Add(1)
 
 	go func() {
 		defer func() {
+			p.limiter.release()
 			<-p.workers // Release the worker
+			p.wg.Done()
 		}()
 
 		task()
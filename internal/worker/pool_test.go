@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool_WaitBlocksUntilTasksFinish(t *testing.T) {
+	p := NewPool(2)
+
+	var finished int32
+	for i := 0; i < 5; i++ {
+		p.Submit(func() {
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&finished, 1)
+		})
+	}
+
+	p.Wait()
+	assert.Equal(t, int32(5), atomic.LoadInt32(&finished))
+}
+
+func TestPool_LimitsConcurrency(t *testing.T) {
+	p := NewPool(2)
+
+	var running, peak int32
+	for i := 0; i < 6; i++ {
+		p.Submit(func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+
+	p.Wait()
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+}
+
+func TestLimitedPool_SharesLimit(t *testing.T) {
+	limiter := NewLimiter(3)
+	pools := []*Pool{NewLimitedPool(4, limiter), NewLimitedPool(4, limiter), NewLimitedPool(4, limiter)}
+
+	var running, peak int32
+	var submitted sync.WaitGroup
+	for _, p := range pools {
+		submitted.Add(1)
+		go func(p *Pool) {
+			defer submitted.Done()
+			for i := 0; i < 6; i++ {
+				p.Submit(func() {
+					n := atomic.AddInt32(&running, 1)
+					for {
+						old := atomic.LoadInt32(&peak)
+						if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+							break
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt32(&running, -1)
+				})
+			}
+			p.Wait()
+		}(p)
+	}
+
+	submitted.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&peak))
+	assert.Nil(t, NewLimiter(0))
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
+	"github.com/spf13/cobra"
+)
+
+func newCleanupCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	var olderThan time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "cleanup [flags]",
+		Short: "Abort incomplete multipart uploads left under the prefix",
+		Long:  `Abort multipart uploads that were started under the prefix but never completed, for example because a previous run crashed. Their parts are billed as storage until they are aborted.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCleanup(cmd.Context(), cfg, olderThan)
+		},
+	}
+
+	// S3 connection flags
+	addS3Flags(cmd, cfg)
+
+	// Cleanup options
+	cmd.Flags().DurationVar(&olderThan, "older-than", importer.DefaultCleanupAge, "Only abort uploads started at least this long ago, to leave uploads in progress alone")
+
+	return cmd
+}
+
+func runCleanup(ctx context.Context, cfg *config.Config, olderThan time.Duration) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if err := importer.ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	s3Client, err := importer.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = importer.AbortIncompleteUploads(ctx, s3Client, olderThan)
+	return err
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor [flags]",
+		Short: "Check the connection, credentials and bucket before a long upload",
+		Long: `Check that uploads with these settings will work: connect and find the bucket, write a small
+test object under the prefix and delete it again, and upload a 5MB test object in parts. Each check is
+reported with a hint if it fails, and the command exits non-zero if any did.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context(), cfg, os.Stdout)
+		},
+	}
+
+	// S3 connection flags
+	addS3Flags(cmd, cfg)
+
+	// Doctor options
+	cmd.Flags().StringVar(&cfg.S3.ACL, "acl", s3client.ACLPrivate, "Canned ACL to write the test objects with, as for upload ("+strings.Join(s3client.CannedACLs, ", ")+")")
+
+	return cmd
+}
+
+func runDoctor(ctx context.Context, cfg *config.Config, out io.Writer) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if err := importer.ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	failed := 0
+	checks := importer.Doctor(ctx, cfg)
+	for _, check := range checks {
+		switch {
+		case check.Skipped:
+			fmt.Fprintf(out, "SKIP  %s\n", check.Name)
+		case check.Err != nil:
+			failed++
+			fmt.Fprintf(out, "FAIL  %s: %v\n", check.Name, check.Err)
+			if check.Hint != "" {
+				fmt.Fprintf(out, "      %s\n", check.Hint)
+			}
+		default:
+			fmt.Fprintf(out, "PASS  %s\n", check.Name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
+	"github.com/spf13/cobra"
+)
+
+func newDownloadCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	opts := importer.DownloadOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "download [flags] <directory>",
+		Short: "Download objects under the prefix to a local directory",
+		Long:  `Download the objects under the prefix to a local directory, mirroring their keys relative to the prefix. Use --include and --exclude to restore only some of them.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Dir = args[0]
+			return runDownload(cmd.Context(), cfg, opts)
+		},
+	}
+
+	// S3 connection flags
+	addS3Flags(cmd, cfg)
+
+	// Download options
+	retryDefaults := uploader.DefaultRetryConfig()
+	cmd.Flags().StringArrayVar(&opts.Include, "include", nil, "Only download objects whose key matches this glob, e.g. '2020/**' (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.Exclude, "exclude", nil, "Skip objects whose key matches this glob, taking precedence over --include (repeatable)")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 4, "Number of concurrent downloads")
+	cmd.Flags().BoolVar(&opts.SkipExisting, "skip-existing", true, "Skip objects whose local file already exists with the same size")
+	cmd.Flags().IntVar(&cfg.Upload.MaxRetries, "max-retries", retryDefaults.MaxRetries, "Maximum number of retries for failed downloads")
+
+	return cmd
+}
+
+func runDownload(ctx context.Context, cfg *config.Config, opts importer.DownloadOptions) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if err := importer.ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	opts.Retry = uploader.DefaultRetryConfig()
+	opts.Retry.MaxRetries = cfg.Upload.MaxRetries
+	if err := opts.Retry.Validate(); err != nil {
+		return fmt.Errorf("invalid retry settings: %w", err)
+	}
+
+	s3Client, err := importer.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := importer.Download(ctx, s3Client, opts)
+	if err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("failed to download %d objects", result.Failed)
+	}
+	return nil
+}
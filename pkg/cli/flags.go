@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// addS3Flags registers the S3 connection flags shared by all commands
+func addS3Flags(cmd *cobra.Command, cfg *config.Config) {
+	cmd.Flags().StringVar(&cfg.S3.Endpoint, "endpoint", "", "S3 endpoint URL (required), also accepted as --endpoint-url")
+	cmd.Flags().StringVar(&cfg.S3.Region, "region", "us-east-1", "S3 region, taken from the endpoint host when not set if it names one, such as s3.us-west-002.backblazeb2.com")
+	cmd.Flags().StringVar(&cfg.S3.Bucket, "bucket", "", "S3 bucket name (required)")
+	cmd.Flags().StringVar(&cfg.S3.AccessKey, "access-key", "", "S3 access key (required)")
+	cmd.Flags().StringVar(&cfg.S3.SecretKey, "secret-key", "", "S3 secret key (required)")
+	cmd.Flags().StringVar(&cfg.S3.AccessKeyFile, "access-key-file", "", "Read the access key from this file, such as a Docker secret, instead of --access-key")
+	cmd.Flags().StringVar(&cfg.S3.SecretKeyFile, "secret-key-file", "", "Read the secret key from this file, such as a Docker secret, instead of --secret-key")
+	cmd.Flags().BoolVar(&cfg.S3.SecretKeyStdin, "secret-key-stdin", false, "Read the secret key from stdin instead of --secret-key")
+	cmd.Flags().StringVar(&cfg.S3.SessionToken, "session-token", "", "Session token for temporary credentials")
+	cmd.Flags().StringVar(&cfg.S3.Profile, "profile", "", "Named profile from ~/.aws/credentials to use instead of access keys")
+	cmd.Flags().BoolVar(&cfg.S3.UseInstanceRole, "use-instance-role", false, "Use the EC2 instance IAM role instead of access keys")
+	cmd.Flags().BoolVar(&cfg.S3.UseSSL, "use-ssl", true, "Use SSL for S3 connection")
+	cmd.Flags().StringVar(&cfg.S3.CACert, "ca-cert", "", "PEM file of CA certificates to trust besides the system ones, for endpoints with a private CA")
+	cmd.Flags().BoolVar(&cfg.S3.TLSSkipVerify, "tls-skip-verify", false, "Accept any TLS certificate from the endpoint (insecure, for testing only)")
+	cmd.Flags().IntVar(&cfg.S3.MaxIdleConns, "max-idle-conns", 0, "Connections to the endpoint kept open for reuse by the client of each archive (default that of the backend, raised to --concurrency if lower)")
+	cmd.Flags().IntVar(&cfg.S3.MaxConnsPerHost, "max-conns-per-host", 0, "Maximum connections open to the endpoint at once, 0 for no limit")
+	cmd.Flags().StringVar(&cfg.S3.Prefix, "prefix", "", "Prefix for S3 object keys")
+	cmd.Flags().BoolVar(&cfg.S3.PathStyle, "path-style", true, "Use path-style requests (endpoint/bucket/key); set to false for providers that only accept virtual-hosted-style requests (bucket.endpoint/key)")
+	cmd.Flags().BoolVar(&cfg.S3.DisableChecksums, "disable-checksums", false, "Disable checksum headers for better compatibility with Backblaze B2 (uses AWS SDK)")
+	cmd.Flags().StringVar(&cfg.S3.Backend, "backend", "", "Client to use: minio, aws or b2 for the native Backblaze B2 API (default minio, or aws with --disable-checksums)")
+
+	// --endpoint-url is what the AWS CLI calls it
+	cmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "endpoint-url" {
+			name = "endpoint"
+		}
+		return pflag.NormalizedName(name)
+	})
+}
+
+// addSourceFlags registers the flags that control how input paths are read
+func addSourceFlags(cmd *cobra.Command, cfg *config.Config) {
+	cmd.Flags().StringVar(&cfg.Upload.SourceType, "source-type", config.SourceTypeTakeout, "Layout of the input: takeout (Google Takeout with JSON sidecars) or generic (any folder or zip of media files)")
+	cmd.Flags().StringVar(&cfg.Upload.KeyEncoding, "key-encoding", "", "Encoding of zip entry names not marked as UTF-8, e.g. shift_jis or latin1 (default guesses per name)")
+}
+
+// addKeyFlags registers the flags that control how object keys are built
+func addKeyFlags(cmd *cobra.Command, cfg *config.Config) {
+	cmd.Flags().StringVar(&cfg.Upload.KeyTemplate, "key-template", "", "Go template for object keys, e.g. '{{.Year}}/{{.Month}}/{{.Filename}}' (default is the path in the archive)")
+	cmd.Flags().BoolVar(&cfg.Upload.PrefixDate, "prefix-date", false, "Store objects under YYYY/MM/ folders of their capture date, or unknown-date/ if it isn't known")
+	cmd.Flags().StringVar(&cfg.Upload.Flatten, "flatten", "", "Shorten object keys: takeout (drop the Takeout/Google Photos/ folders) or album (keep only the album or year folder of each file)")
+	cmd.Flags().Lookup("flatten").NoOptDefVal = config.FlattenTakeout
+	cmd.Flags().StringVar(&cfg.Upload.SanitizeKeys, "sanitize-keys", config.SanitizeKeysPassthrough, "Rewrite characters in object keys that some providers and URLs mishandle, such as #, ? and emoji: passthrough, percent-encode or replace")
+}
+
+// applyConfigSources sets every flag that wasn't given on the command line
+// from the environment or the config file, so flags take precedence over
+// environment variables, which take precedence over the file
+func applyConfigSources(cmd *cobra.Command, cfg *config.Config) error {
+	path := cfg.ConfigFile
+	if !cmd.Flags().Changed("config") {
+		path = os.Getenv(config.EnvName("config"))
+	}
+
+	var names []string
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		names = append(names, f.Name)
+	})
+
+	values, err := config.LoadConfig(path, names)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			logger.Warn("Ignoring unknown setting %q for command %s", name, cmd.Name())
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyVerbosity sets --log-level for --verbose or --quiet, unless it was set
+// by a flag, the environment or the config file
+func applyVerbosity(cmd *cobra.Command) error {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	if verbose && quiet {
+		return fmt.Errorf("--verbose and --quiet can't be combined")
+	}
+	if cmd.Flags().Changed("log-level") {
+		return nil
+	}
+
+	switch {
+	case verbose:
+		return cmd.Flags().Set("log-level", "debug")
+	case quiet:
+		return cmd.Flags().Set("log-level", "error")
+	}
+	return nil
+}
+
+// deriveRegion sets the region from the endpoint host if --region wasn't set
+// by a flag, the environment or the config file
+func deriveRegion(cmd *cobra.Command, cfg *config.Config) {
+	flag := cmd.Flags().Lookup("region")
+	if flag == nil || flag.Changed {
+		return
+	}
+	if region, ok := s3client.RegionFromEndpoint(cfg.S3.Endpoint); ok {
+		logger.Info("Using region %s from endpoint %s", region, cfg.S3.Endpoint)
+		cfg.S3.Region = region
+	}
+}
+
+// readCredentials sets the keys given with --access-key-file,
+// --secret-key-file or --secret-key-stdin
+func readCredentials(cfg *config.Config) error {
+	return config.ResolveCredentials(&cfg.S3, os.Stdin)
+}
+
+// sizeValue is a flag value holding a byte count parsed from a human readable size
+type sizeValue int64
+
+func newSizeValue(p *int64, value int64) *sizeValue {
+	*p = value
+	return (*sizeValue)(p)
+}
+
+func (s *sizeValue) Set(value string) error {
+	n, err := config.ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = sizeValue(n)
+	return nil
+}
+
+func (s *sizeValue) String() string {
+	if *s == 0 {
+		return "0"
+	}
+	return config.FormatSize(int64(*s))
+}
+
+func (s *sizeValue) Type() string {
+	return "size"
+}
+
+// dateValue is a flag value holding a date or RFC3339 time. A date that ends
+// a range stands for the last instant of that day.
+type dateValue struct {
+	t   *time.Time
+	end bool
+}
+
+func newDateValue(p *time.Time, end bool) *dateValue {
+	return &dateValue{t: p, end: end}
+}
+
+func (d *dateValue) Set(value string) error {
+	t, err := config.ParseDate(value, d.end)
+	if err != nil {
+		return err
+	}
+	*d.t = t
+	return nil
+}
+
+func (d *dateValue) String() string {
+	if d.t == nil || d.t.IsZero() {
+		return ""
+	}
+	return config.FormatDate(*d.t)
+}
+
+func (d *dateValue) Type() string {
+	return "date"
+}
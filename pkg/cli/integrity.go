@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
+	"github.com/spf13/cobra"
+)
+
+func newCheckIntegrityCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	opts := importer.IntegrityOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "check-integrity [flags]",
+		Short: "Re-hash objects in the bucket to find corrupted or truncated ones",
+		Long:  `Download the objects under the prefix that carry the SHA-256 recorded at upload and hash them again, without needing the original archives. Objects without a recorded checksum are reported as unverifiable. Use --include and --exclude to check only some of them.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheckIntegrity(cmd.Context(), cfg, opts)
+		},
+	}
+
+	// S3 connection flags
+	addS3Flags(cmd, cfg)
+
+	// Check options
+	retryDefaults := uploader.DefaultRetryConfig()
+	cmd.Flags().StringArrayVar(&opts.Include, "include", nil, "Only check objects whose key matches this glob, e.g. '2020/**' (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.Exclude, "exclude", nil, "Skip objects whose key matches this glob, taking precedence over --include (repeatable)")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 4, "Number of objects checked at a time")
+	cmd.Flags().IntVar(&cfg.Upload.MaxRetries, "max-retries", retryDefaults.MaxRetries, "Maximum number of retries for failed downloads")
+
+	return cmd
+}
+
+func runCheckIntegrity(ctx context.Context, cfg *config.Config, opts importer.IntegrityOptions) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if err := importer.ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	opts.Retry = uploader.DefaultRetryConfig()
+	opts.Retry.MaxRetries = cfg.Upload.MaxRetries
+	if err := opts.Retry.Validate(); err != nil {
+		return fmt.Errorf("invalid retry settings: %w", err)
+	}
+
+	s3Client, err := importer.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := importer.CheckIntegrity(ctx, s3Client, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range result.Unverifiable {
+		logger.Warn("Unverifiable: %s has no recorded checksum", key)
+	}
+	for _, key := range result.Mismatched {
+		logger.Error("Mismatch: %s", key)
+	}
+
+	if len(result.Mismatched) > 0 || result.Failed > 0 {
+		return fmt.Errorf("integrity check found %d mismatched objects and failed to check %d",
+			len(result.Mismatched), result.Failed)
+	}
+	return nil
+}
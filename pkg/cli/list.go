@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
+	"github.com/minio/minio-go/v7"
+	"github.com/spf13/cobra"
+)
+
+// listedObject is the machine readable form of an object in the bucket
+type listedObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// listTotals summarizes the objects in the bucket
+type listTotals struct {
+	Count      int   `json:"count"`
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+func newListCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	var asJSON, countOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List objects already uploaded under the prefix",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(cmd.Context(), cfg, os.Stdout, asJSON, countOnly)
+		},
+	}
+
+	// S3 connection flags
+	addS3Flags(cmd, cfg)
+
+	// List options
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print output as JSON")
+	cmd.Flags().BoolVar(&countOnly, "count-only", false, "Only print the object count and total size")
+
+	return cmd
+}
+
+func runList(ctx context.Context, cfg *config.Config, out io.Writer, asJSON bool, countOnly bool) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if err := importer.ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	s3Client, err := importer.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	objects, err := s3Client.ListObjects(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return printObjects(out, objects, asJSON, countOnly)
+}
+
+// printObjects writes the listing as a table or JSON
+func printObjects(out io.Writer, objects []minio.ObjectInfo, asJSON bool, countOnly bool) error {
+	totals := listTotals{Count: len(objects)}
+	for _, object := range objects {
+		totals.TotalBytes += object.Size
+	}
+
+	if countOnly {
+		if asJSON {
+			return json.NewEncoder(out).Encode(totals)
+		}
+		fmt.Fprintf(out, "Objects: %d\n", totals.Count)
+		fmt.Fprintf(out, "Total size: %d bytes (%.2f MB)\n", totals.TotalBytes, float64(totals.TotalBytes)/(1024*1024))
+		return nil
+	}
+
+	if asJSON {
+		listed := make([]listedObject, 0, len(objects))
+		for _, object := range objects {
+			listed = append(listed, listedObject{
+				Key:          object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified,
+			})
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listed)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSIZE\tLAST MODIFIED")
+	for _, object := range objects {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", object.Key, object.Size, object.LastModified.Format(time.RFC3339))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d objects, %.2f MB total\n", totals.Count, float64(totals.TotalBytes)/(1024*1024))
+	return nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// profiler writes the pprof profiles asked for with the hidden --cpuprofile
+// and --memprofile flags, to see where a large import spends its time
+type profiler struct {
+	cpuPath string
+	memPath string
+
+	cpuFile *os.File
+}
+
+// addFlags registers the profiling flags on the root command, hidden
+// since they are only useful for debugging performance
+func (p *profiler) addFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&p.cpuPath, "cpuprofile", "", "Write a CPU profile of the command to this file")
+	cmd.PersistentFlags().StringVar(&p.memPath, "memprofile", "", "Write a heap profile to this file when the command finishes")
+	cmd.PersistentFlags().MarkHidden("cpuprofile")
+	cmd.PersistentFlags().MarkHidden("memprofile")
+}
+
+// start starts the CPU profile, if one was asked for
+func (p *profiler) start() error {
+	if p.cpuPath == "" {
+		return nil
+	}
+
+	f, err := os.Create(p.cpuPath)
+	if err != nil {
+		return fmt.Errorf("failed to create CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to start CPU profile: %w", err)
+	}
+	p.cpuFile = f
+	return nil
+}
+
+// stop stops the CPU profile and writes the heap profile. It runs whether
+// the command failed or not, so failures are only logged.
+func (p *profiler) stop() {
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpuFile.Close(); err != nil {
+			logger.Error("Failed to write CPU profile: %v", err)
+		}
+		p.cpuFile = nil
+	}
+
+	if p.memPath == "" {
+		return
+	}
+	f, err := os.Create(p.memPath)
+	if err != nil {
+		logger.Error("Failed to create heap profile: %v", err)
+		return
+	}
+	defer f.Close()
+
+	// Only count memory that is still in use
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		logger.Error("Failed to write heap profile: %v", err)
+	}
+}
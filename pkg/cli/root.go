@@ -34,11 +34,51 @@ func Execute() {
 	// Global flags
 	config := config.New()
 	rootCmd.PersistentFlags().StringVar(&config.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log debug messages, as --log-level=debug")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log errors, as --log-level=error")
+	rootCmd.PersistentFlags().StringVar(&config.LogFormat, "log-format", "text", "Log format (text, json)")
+	rootCmd.PersistentFlags().StringVar(&config.ConfigFile, "config", "", "Path to a YAML or JSON config file")
+	profiler := &profiler{}
+	profiler.addFlags(rootCmd)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := profiler.start(); err != nil {
+			return err
+		}
+		// Fill in flags that weren't set on the command line from the environment and config file
+		if err := applyConfigSources(cmd, config); err != nil {
+			return err
+		}
+		// Keys read from files or stdin count as given for the required settings
+		if err := readCredentials(config); err != nil {
+			return err
+		}
+		if err := applyVerbosity(cmd); err != nil {
+			return err
+		}
+		if err := logger.SetFormat(config.LogFormat); err != nil {
+			return err
+		}
+		// Commands set the level again, but messages logged before then
+		// should already follow it
+		logger.SetLevel(config.LogLevel)
+		deriveRegion(cmd, config)
+		return nil
+	}
 
 	// Add commands
 	rootCmd.AddCommand(newUploadCommand(ctx, config))
+	rootCmd.AddCommand(newVerifyCommand(ctx, config))
+	rootCmd.AddCommand(newDownloadCommand(ctx, config))
+	rootCmd.AddCommand(newCheckIntegrityCommand(ctx, config))
+	rootCmd.AddCommand(newListCommand(ctx, config))
+	rootCmd.AddCommand(newCleanupCommand(ctx, config))
+	rootCmd.AddCommand(newStatsCommand(ctx, config))
+	rootCmd.AddCommand(newDoctorCommand(ctx, config))
+	rootCmd.AddCommand(newPutCommand(ctx, config))
 
-	if err := rootCmd.ExecuteContext(ctx); err != nil {
+	err := rootCmd.ExecuteContext(ctx)
+	profiler.stop()
+	if err != nil {
 		logger.Error("Error executing command: %v", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// journalReport is the summary of one journal file
+type journalReport struct {
+	Path       string                 `json:"path"`
+	Entries    int                    `json:"entries"`
+	Uploaded   int                    `json:"uploaded"`
+	Duplicates int                    `json:"duplicates"`
+	Failed     int                    `json:"failed"`
+	Bytes      int64                  `json:"bytes"`
+	First      time.Time              `json:"first"`
+	Last       time.Time              `json:"last"`
+	Archives   []journal.ArchiveStats `json:"archives"`
+}
+
+func newStatsCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	var asJSON, failedOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "stats [flags] [journal files...]",
+		Short: "Summarize the upload journal",
+		Long:  `Show how far previous runs got from the journal alone, without scanning the archives or contacting the bucket. Reads the default journal unless journal files are given, such as the per-archive journals written when --journal is a directory.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Keep stdout for the report
+			logger.SetOutput(os.Stderr)
+			return runStats(cfg, os.Stdout, args, asJSON, failedOnly)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print output as JSON")
+	cmd.Flags().BoolVar(&failedOnly, "failed", false, "List the files that failed to upload instead of the summary")
+
+	return cmd
+}
+
+func runStats(cfg *config.Config, out io.Writer, paths []string, asJSON bool, failedOnly bool) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if len(paths) == 0 {
+		paths = []string{journal.DefaultPath()}
+	}
+
+	reports := make([]journalReport, 0, len(paths))
+	var failed []journal.FailedEntry
+	for _, path := range paths {
+		// journal.New creates missing files, which would hide a mistyped path
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("failed to read journal: %w", err)
+		}
+
+		jnl := journal.New(path)
+		if err := jnl.Load(); err != nil {
+			return fmt.Errorf("failed to load journal %s: %w", path, err)
+		}
+		reports = append(reports, newJournalReport(path, jnl.ArchiveStats()))
+		failed = append(failed, jnl.FailedEntries()...)
+	}
+
+	if failedOnly {
+		return printFailed(out, failed, asJSON)
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if err := printJournalReport(out, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newJournalReport totals the statistics of the archives in a journal
+func newJournalReport(path string, archives []journal.ArchiveStats) journalReport {
+	report := journalReport{Path: path, Archives: archives}
+	for _, archive := range archives {
+		report.Entries += archive.Entries
+		report.Uploaded += archive.Uploaded
+		report.Duplicates += archive.Duplicates
+		report.Failed += archive.Failed
+		report.Bytes += archive.Bytes
+		if archive.Entries == 0 {
+			continue
+		}
+		if report.First.IsZero() || archive.First.Before(report.First) {
+			report.First = archive.First
+		}
+		if archive.Last.After(report.Last) {
+			report.Last = archive.Last
+		}
+	}
+	return report
+}
+
+// printJournalReport writes a journal summary followed by a table of its archives
+func printJournalReport(out io.Writer, report journalReport) error {
+	fmt.Fprintf(out, "Journal: %s\n", report.Path)
+	fmt.Fprintf(out, "Entries: %d (%d uploaded, %d duplicates)\n", report.Entries, report.Uploaded, report.Duplicates)
+	fmt.Fprintf(out, "Failed: %d\n", report.Failed)
+	fmt.Fprintf(out, "Uploaded size: %s\n", config.FormatSize(report.Bytes))
+	if len(report.Archives) == 0 {
+		return nil
+	}
+	if report.Entries > 0 {
+		fmt.Fprintf(out, "First entry: %s\n", report.First.Format(time.RFC3339))
+		fmt.Fprintf(out, "Last entry: %s\n", report.Last.Format(time.RFC3339))
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCHIVE\tENTRIES\tUPLOADED\tDUPLICATES\tFAILED\tSIZE\tLAST ENTRY")
+	for _, archive := range report.Archives {
+		last := "-"
+		if !archive.Last.IsZero() {
+			last = archive.Last.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\n", archiveLabel(archive.Archive), archive.Entries, archive.Uploaded,
+			archive.Duplicates, archive.Failed, config.FormatSize(archive.Bytes), last)
+	}
+	return w.Flush()
+}
+
+// printFailed writes the files that failed to upload as a table or JSON
+func printFailed(out io.Writer, failed []journal.FailedEntry, asJSON bool) error {
+	if asJSON {
+		if failed == nil {
+			failed = []journal.FailedEntry{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(failed)
+	}
+
+	if len(failed) == 0 {
+		fmt.Fprintln(out, "No failed files")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCHIVE\tPATH\tATTEMPTS\tLAST ATTEMPT\tERROR")
+	for _, entry := range failed {
+		// Retry errors span several lines, which would break the table
+		errorLine, _, _ := strings.Cut(entry.Error, "\n")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", archiveLabel(entry.Archive), entry.Path, entry.Attempts,
+			entry.Timestamp.Format(time.RFC3339), errorLine)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d failed files, retry them with upload --retry-failed-only\n", len(failed))
+	return nil
+}
+
+// archiveLabel names an archive in tables, including entries written before
+// archives were recorded
+func archiveLabel(archive string) string {
+	if archive == "" {
+		return "(unknown)"
+	}
+	return archive
+}
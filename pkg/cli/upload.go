@@ -3,18 +3,17 @@ package cli
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
-	"sync"
+	"text/tabwriter"
+	"time"
 
-	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/googletakeout"
 	"github.com/bstardust/google-takeout-s3-importer/internal/config"
-	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
 	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
 	"github.com/bstardust/google-takeout-s3-importer/internal/progress"
 	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
-	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
 	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
 	"github.com/spf13/cobra"
 )
@@ -26,300 +25,238 @@ func newUploadCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			isGlob, _ := cmd.Flags().GetBool("glob")
+
+			// Timestamps follow --preserve-metadata unless set explicitly
+			if !cmd.Flags().Changed("preserve-timestamps") {
+				cfg.Upload.PreserveTimestamps = cfg.Upload.PreserveMetadata
+			}
+			deriveScanConcurrency(cmd, cfg)
+
+			// A plan is a dry run that only prints the summary
+			if cfg.Upload.Plan {
+				cfg.Upload.DryRun = true
+				if !cmd.Flags().Changed("log-level") {
+					cfg.LogLevel = "warn"
+				}
+			}
+
+			// Overwriting replaces the existence check that --skip-existing turns on by default
+			if cfg.Upload.Overwrite {
+				if cmd.Flags().Changed("skip-existing") {
+					return fmt.Errorf("--overwrite and --skip-existing can't be combined")
+				}
+				cfg.Upload.SkipExisting = false
+			}
+
 			return runUpload(cmd.Context(), cfg, args, isGlob)
 		},
 	}
 
 	// S3 connection flags
-	cmd.Flags().StringVar(&cfg.S3.Endpoint, "endpoint", "", "S3 endpoint URL (required)")
-	cmd.Flags().StringVar(&cfg.S3.Region, "region", "us-east-1", "S3 region")
-	cmd.Flags().StringVar(&cfg.S3.Bucket, "bucket", "", "S3 bucket name (required)")
-	cmd.Flags().StringVar(&cfg.S3.AccessKey, "access-key", "", "S3 access key (required)")
-	cmd.Flags().StringVar(&cfg.S3.SecretKey, "secret-key", "", "S3 secret key (required)")
-	cmd.Flags().BoolVar(&cfg.S3.UseSSL, "use-ssl", true, "Use SSL for S3 connection")
-	cmd.Flags().StringVar(&cfg.S3.Prefix, "prefix", "", "Prefix for S3 object keys")
-	cmd.Flags().BoolVar(&cfg.S3.DisableChecksums, "disable-checksums", false, "Disable checksum headers for better compatibility with Backblaze B2 (uses AWS SDK)")
+	addS3Flags(cmd, cfg)
 
 	// Upload options
 	cmd.Flags().IntVar(&cfg.Upload.Concurrency, "concurrency", 4, "Number of concurrent file uploads within each archive")
 	cmd.Flags().IntVar(&cfg.Upload.MaxConcurrentArchives, "max-archives", 3, "Maximum number of archives to process simultaneously")
+	cmd.Flags().IntVar(&cfg.Upload.MaxTotalUploads, "max-total-uploads", 0, "Maximum number of concurrent file uploads across all archives, whatever --concurrency and --max-archives allow (0 for no limit)")
+	cmd.Flags().IntVar(&cfg.Upload.ScanConcurrency, "scan-concurrency", 4, "Number of files to extract metadata from in parallel while scanning an archive (defaults to --concurrency)")
+	cmd.Flags().Var(newSizeValue(&cfg.Upload.MaxBandwidth, 0), "max-bandwidth", "Maximum total upload throughput per second across all archives, e.g. 10MB (0 for unlimited)")
+	cmd.Flags().Var(newSizeValue(&cfg.S3.MultipartThreshold, s3client.DefaultMultipartThreshold), "multipart-threshold", "Upload files of at least this size in parts instead of a single PUT, e.g. 64MB (at most 5GB; files no larger than --part-size always use a single PUT)")
+	cmd.Flags().Var(newSizeValue(&cfg.S3.PartSize, s3client.DefaultPartSize), "part-size", "Size of each part of a multipart upload, e.g. 16MB (at least 5MB, as required by S3 and Backblaze B2)")
+	cmd.Flags().IntVar(&cfg.S3.PartConcurrency, "multipart-concurrency", s3client.DefaultPartConcurrency, "Number of parts of each multipart upload sent at a time with the AWS backend, independently of --concurrency; each holds a part in memory")
+	cmd.Flags().BoolVar(&cfg.S3.CreateBucket, "create-bucket", false, "Create the bucket in --region if it doesn't exist")
+	cmd.Flags().StringVar(&cfg.Upload.ContentDisposition, "content-disposition", "", "Set the Content-Disposition header of media objects to inline or attachment, naming them after the original file for browsers to save them under")
+	cmd.Flags().StringVar(&cfg.S3.ACL, "acl", s3client.ACLPrivate, "Canned ACL of uploaded objects, e.g. public-read for a public gallery ("+strings.Join(s3client.CannedACLs, ", ")+")")
 	cmd.Flags().BoolVar(&cfg.Upload.DryRun, "dry-run", false, "Simulate upload without actually uploading")
+	cmd.Flags().BoolVar(&cfg.Upload.Plan, "plan", false, "Scan the archives and print a summary of what would be uploaded (files, size, types, objects already in the bucket and files over the size limits) without uploading")
+	cmd.Flags().StringVar(&cfg.Upload.DryRunFormat, "dry-run-format", "text", "Dry run output: text to log each planned object or json to print them as a JSON array on stdout")
 	cmd.Flags().BoolVar(&cfg.Upload.Resume, "resume", true, "Resume previous upload if interrupted")
+	cmd.Flags().BoolVar(&cfg.Upload.RetryFailedOnly, "retry-failed-only", false, "Only upload the files recorded as failed in the journal by earlier runs")
+	cmd.Flags().BoolVar(&cfg.Upload.VerifyOnResume, "verify-on-resume", false, "Check the size of objects recorded in the journal before skipping them")
 	cmd.Flags().StringVar(&cfg.Upload.JournalPath, "journal", "", "Path to journal file for resumable uploads")
+	cmd.Flags().StringVar(&cfg.Upload.Manifest, "manifest", "", "Append every uploaded, skipped and failed file with its object key to this CSV file, or JSON lines for a .json or .jsonl path")
+	cmd.Flags().StringVar(&cfg.Upload.ErrorLog, "error-log", "", "Write every error of the run to this file, one per line after its category")
 	cmd.Flags().BoolVar(&cfg.Upload.PreserveMetadata, "preserve-metadata", true, "Preserve file metadata as S3 object metadata")
+	cmd.Flags().BoolVar(&cfg.Upload.PreserveTimestamps, "preserve-timestamps", true, "Set the original capture date on uploaded objects (defaults to --preserve-metadata)")
+	cmd.Flags().BoolVar(&cfg.Upload.StripGPS, "strip-gps", false, "Leave GPS coordinates out of the object metadata (the file content is not changed)")
+	cmd.Flags().Float64Var(&cfg.Upload.BlurGPS, "blur-gps", 0, "Round GPS coordinates in the object metadata to a grid of this many kilometers (0 to keep them exact)")
+	cmd.Flags().DurationVar(&cfg.Upload.TimeDivergence, "time-divergence", 24*time.Hour, "Warn and note in the manifest when the capture times in a JSON sidecar and in the file itself differ by more than this, which often means a wrong camera clock or time zone (0 to turn off)")
+	cmd.Flags().BoolVar(&cfg.Upload.AbortIncomplete, "abort-incomplete", false, "Abort incomplete multipart uploads under the prefix started more than 24 hours ago before starting")
+	cmd.Flags().BoolVar(&cfg.Upload.ResumableMultipart, "resumable-multipart", false, "Record the parts of large files in the journal so an interrupted upload continues where it stopped (MinIO and AWS backends)")
 	cmd.Flags().BoolVar(&cfg.Upload.SkipExisting, "skip-existing", true, "Skip files that already exist in the bucket")
+	cmd.Flags().BoolVar(&cfg.Upload.ListExisting, "list-existing", false, "List the objects under the prefix once before uploading and check --skip-existing against the listing instead of a request per file")
+	cmd.Flags().IntVar(&cfg.Upload.ListExistingMax, "list-existing-max", 100000, "Check files one request at a time if more objects than this are under the prefix (0 for no limit)")
+	cmd.Flags().BoolVar(&cfg.Upload.Overwrite, "overwrite", false, "Upload every file again, replacing existing objects and ignoring the journal")
+	cmd.Flags().BoolVar(&cfg.Upload.SplitLivePhotos, "split-live-photos", true, "Upload the halves of Motion Photos and Live Photos under their own keys instead of a shared prefix")
+	cmd.Flags().BoolVar(&cfg.Upload.UploadMetadataJSON, "upload-metadata-json", false, "Also upload the JSON sidecars of Takeout media files, next to the files they describe")
+	cmd.Flags().StringVar(&cfg.Upload.MetadataOverflow, "metadata-overflow", config.MetadataOverflowTrim, "What to do with object metadata over the 2KB S3 limit: trim (drop tags, people and albums first), sidecar (store it in a .metadata.json object next to the file) or error")
+	cmd.Flags().BoolVar(&cfg.Upload.SidecarMetadata, "sidecar-metadata", false, "Also store the full metadata of each file as JSON in a .metadata.json object next to it")
+	cmd.Flags().BoolVar(&cfg.Upload.CompressMetadataJSON, "compress-metadata-json", false, "Gzip metadata sidecars and store them with Content-Encoding: gzip")
+	cmd.Flags().StringVar(&cfg.Upload.TranscodeHEIC, "transcode-heic", "", "Convert HEIC photos to JPEG: alongside (upload both) or replace (upload only the JPEG); needs a build with -tags heic")
+	cmd.Flags().Lookup("transcode-heic").NoOptDefVal = config.TranscodeHEICAlongside
+	cmd.Flags().BoolVar(&cfg.Upload.TagSourceArchive, "tag-source-archive", false, "Store the name of the archive each file came from on its object as X-Amz-Meta-Source-Archive, and as a tag with --object-tags")
+	cmd.Flags().BoolVar(&cfg.Upload.ObjectTags, "object-tags", false, "Tag objects with the albums and people from the Takeout metadata (not supported by all providers)")
+	cmd.Flags().BoolVar(&cfg.Upload.Dedupe, "dedupe", false, "Hash files while scanning and upload identical content only once")
+	cmd.Flags().BoolVar(&cfg.Upload.VerifyChecksums, "verify-checksums", false, "Hash files while scanning and download objects whose ETag isn't an MD5 (multipart uploads) to check their SHA-256")
 	cmd.Flags().BoolP("glob", "g", false, "Treat input paths as glob patterns")
-
-	// Mark required flags
-	cmd.MarkFlagRequired("endpoint")
-	cmd.MarkFlagRequired("bucket")
-	cmd.MarkFlagRequired("access-key")
-	cmd.MarkFlagRequired("secret-key")
+	addSourceFlags(cmd, cfg)
+	addKeyFlags(cmd, cfg)
+	cmd.Flags().StringArrayVar(&cfg.Upload.Include, "include", nil, "Only upload files whose path matches this glob, e.g. '*.jpg' or '**/Photos from 2020/*' (repeatable)")
+	cmd.Flags().StringArrayVar(&cfg.Upload.Exclude, "exclude", nil, "Skip files whose path matches this glob, taking precedence over --include (repeatable)")
+	cmd.Flags().StringSliceVar(&cfg.Upload.OnlyTypes, "only-types", nil, "Only upload files with these extensions, e.g. jpg,png,mp4, or images or videos for every image or video format")
+	cmd.Flags().Var(newSizeValue(&cfg.Upload.MinSize, 0), "min-size", "Skip files smaller than this, e.g. 100KB to leave out thumbnails (0 for no minimum)")
+	cmd.Flags().Var(newSizeValue(&cfg.Upload.MaxSize, 0), "max-size", "Skip files larger than this, e.g. 2GB (0 for no maximum)")
+	cmd.Flags().Var(newDateValue(&cfg.Upload.Since, false), "since", "Only upload files taken on or after this date, e.g. 2020-01-01 or an RFC3339 time")
+	cmd.Flags().Var(newDateValue(&cfg.Upload.Until, true), "until", "Only upload files taken on or before this date, e.g. 2020-12-31 (the whole day) or an RFC3339 time")
+	cmd.Flags().StringVar(&cfg.Upload.NoDatePolicy, "no-date-policy", config.NoDateInclude, "Whether files without a capture date are uploaded with --since or --until: include or exclude")
+	cmd.Flags().StringVar(&cfg.Upload.SortBy, "sort-by", config.SortByPath, "Order the files of each archive are uploaded in: path, date (oldest first) or size (smallest first)")
+	cmd.Flags().StringVar(&cfg.Upload.Progress, "progress", "log", "Progress display: log or bar (bar requires a terminal)")
+	cmd.Flags().StringVar(&cfg.Upload.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address while uploading, e.g. :9090")
+	cmd.Flags().StringVar(&cfg.Upload.WebhookURL, "webhook-url", "", "POST a JSON summary of the run (counts, bytes, duration and errors) to this URL when it finishes")
+	cmd.Flags().BoolVar(&cfg.Upload.WebhookOnError, "webhook-on-error", false, "Only call --webhook-url when the run failed or was interrupted")
+
+	// Retry options
+	retryDefaults := uploader.DefaultRetryConfig()
+	cmd.Flags().IntVar(&cfg.Upload.MaxRetries, "max-retries", retryDefaults.MaxRetries, "Maximum number of retries for failed S3 operations")
+	cmd.Flags().DurationVar(&cfg.Upload.InitialBackoff, "initial-backoff", retryDefaults.InitialBackoff, "Time to wait before the first retry, doubled on each attempt")
+	cmd.Flags().DurationVar(&cfg.Upload.MaxBackoff, "max-backoff", retryDefaults.MaxBackoff, "Maximum time to wait between retries")
+	cmd.Flags().IntVar(&cfg.Upload.BreakerThreshold, "breaker-threshold", 20, "Fail uploads right away after this many S3 requests fail in a row, until --breaker-cooldown has passed (0 to disable)")
+	cmd.Flags().DurationVar(&cfg.Upload.BreakerCooldown, "breaker-cooldown", time.Minute, "Time to fail uploads right away once the breaker opens, before testing the endpoint with a single request")
+	cmd.Flags().DurationVar(&cfg.Upload.Timeout, "file-timeout", 30*time.Minute, "Maximum time to upload a single file, including retries (0 for no limit)")
+	cmd.Flags().DurationVar(&cfg.Upload.MaxDuration, "max-duration", 0, "Stop the whole run gracefully after this long, e.g. 6h, saving the journal so the next run resumes where it stopped (0 for no limit)")
+	cmd.Flags().Var(newSizeValue(&cfg.Upload.MinUploadRate, 0), "min-upload-rate", "Raise --file-timeout for large files to give them enough time at this rate per second, e.g. 500KB (0 to use --file-timeout for all files)")
+	cmd.Flags().BoolVar(&cfg.Upload.ContinueOnCorrupt, "continue-on-corrupt", true, "Report files whose archive entry is corrupt and upload the rest, instead of failing the run")
+	cmd.Flags().StringVar(&cfg.Upload.TmpDir, "tmp-dir", "", "Copy archive entries of at least --spill-threshold to a temporary file in this directory before uploading them, so retries can read them again from the start")
+	cmd.Flags().Var(newSizeValue(&cfg.Upload.SpillThreshold, 100*1024*1024), "spill-threshold", "Smallest file copied to --tmp-dir before it is uploaded")
 
 	return cmd
 }
 
+// deriveScanConcurrency sets --scan-concurrency to --concurrency unless it was
+// set by a flag, the environment or the config file
+func deriveScanConcurrency(cmd *cobra.Command, cfg *config.Config) {
+	if !cmd.Flags().Changed("scan-concurrency") {
+		cfg.Upload.ScanConcurrency = cfg.Upload.Concurrency
+	}
+}
+
 func runUpload(ctx context.Context, cfg *config.Config, args []string, isGlob bool) error {
 	// Initialize logger
 	logger.SetLevel(cfg.LogLevel)
 
-	// Initialize S3 client using the new package
-	s3Config := s3client.Config{
-		Endpoint:         cfg.S3.Endpoint,
-		Region:           cfg.S3.Region,
-		Bucket:           cfg.S3.Bucket,
-		AccessKey:        cfg.S3.AccessKey,
-		SecretKey:        cfg.S3.SecretKey,
-		UseSSL:           cfg.S3.UseSSL,
-		Prefix:           cfg.S3.Prefix,
-		DisableChecksums: cfg.S3.DisableChecksums,
+	if cfg.Upload.DryRunFormat != "text" && cfg.Upload.DryRunFormat != "json" {
+		return fmt.Errorf("invalid --dry-run-format %q (expected text or json)", cfg.Upload.DryRunFormat)
 	}
 
-	// Initialize journal for resumable uploads
-	jnl := journal.New(cfg.Upload.JournalPath)
-	if cfg.Upload.Resume {
-		if err := jnl.Load(); err != nil {
-			logger.Warn("Could not load journal: %v", err)
-		}
-
-		// Test if we can write to the journal file
-		logger.Info("Testing journal write access...")
-		if err := jnl.Save(); err != nil {
-			logger.Error("Failed to write journal file: %v", err)
-			logger.Warn("Continuing without journal - uploads will not be resumable")
-		} else {
-			logger.Info("Journal write test successful")
-		}
+	if cfg.Upload.Progress != "log" && cfg.Upload.Progress != "bar" {
+		return fmt.Errorf("invalid --progress %q (expected log or bar)", cfg.Upload.Progress)
 	}
 
-	// Start periodic save with context
-	logger.Info("Starting periodic journal save")
-	jnl.StartPeriodicSave(ctx)
-	defer func() {
-		logger.Info("Stopping periodic journal save")
-		jnl.StopPeriodicSave()
-		// Final save before exiting
-		if err := jnl.Save(); err != nil {
-			logger.Error("Failed to save journal before exit: %v", err)
-		}
-	}()
-
-	// Create a wait group to wait for all uploads to complete
-	var wg sync.WaitGroup
-	var uploadErrors []error
-	var errorsMutex sync.Mutex
-
-	// Limit the number of concurrent archives being processed
-	archiveSemaphore := make(chan struct{}, cfg.Upload.MaxConcurrentArchives)
-	logger.Info("Processing up to %d archives simultaneously", cfg.Upload.MaxConcurrentArchives)
-
-	// At the start of runUpload
-	logger.Info("Starting upload process with PID: %d", os.Getpid())
-
-	// Process each input path
-	for _, path := range args {
-		var filesToProcess []string
-
-		if isGlob {
-			// Handle as glob pattern
-			logger.Debug("Processing pattern: %s", path)
-			matches, err := filepath.Glob(path)
-			if err != nil {
-				logger.Error("Failed to expand glob pattern: %v", err)
-				return fmt.Errorf("failed to expand glob pattern %s: %w", path, err)
-			}
-
-			logger.Debug("Glob pattern expanded to %d matches", len(matches))
-			for i, match := range matches {
-				logger.Debug("Match %d: %s", i+1, match)
-			}
+	// Keep stdout for the JSON plan
+	printPlan := cfg.Upload.DryRun && cfg.Upload.DryRunFormat == "json" && !cfg.Upload.Plan
+	if printPlan {
+		logger.SetOutput(os.Stderr)
+	}
 
-			if len(matches) == 0 {
-				logger.Warn("No files matched pattern: %s", path)
-				continue
-			}
+	opts := importer.Options{
+		Config: cfg,
+		Paths:  args,
+		Glob:   isGlob,
+	}
 
-			logger.Info("Found %d files matching pattern: %s", len(matches), path)
-			filesToProcess = matches
+	// Show the combined progress of all archives on one line when attached to a terminal
+	if cfg.Upload.Progress == "bar" {
+		if progress.IsTerminal(os.Stdout) {
+			opts.ProgressBar = os.Stdout
 		} else {
-			// If the path is a directory, find all zip files in it
-			fileInfo, err := os.Stat(path)
-			if err == nil && fileInfo.IsDir() {
-				zipFiles, err := findZipFiles(path)
-				if err != nil {
-					return fmt.Errorf("failed to scan directory %s: %w", path, err)
-				}
-
-				if len(zipFiles) == 0 {
-					logger.Warn("No zip files found in directory: %s", path)
-					continue
-				}
-
-				logger.Info("Found %d zip files in directory: %s", len(zipFiles), path)
-				filesToProcess = zipFiles
-			} else {
-				// Handle as literal path
-				filesToProcess = []string{path}
-			}
+			logger.Info("Standard output is not a terminal, logging progress instead of showing a bar")
 		}
+	}
 
-		for _, filePath := range filesToProcess {
-			// Capture filePath for the goroutine
-			currentPath := filePath
-
-			// Add to wait group
-			wg.Add(1)
-
-			// Acquire semaphore to limit concurrent archives
-			archiveSemaphore <- struct{}{}
-
-			// Process each file in a separate goroutine
-			go func() {
-				// Add panic recovery at the beginning
-				defer func() {
-					if r := recover(); r != nil {
-						logger.Error("Panic recovered in archive processing: %v", r)
-						// Still release resources
-						<-archiveSemaphore
-						wg.Done()
-					}
-				}()
-
-				defer func() {
-					// Release semaphore when done
-					<-archiveSemaphore
-					wg.Done()
-					logger.Info("Released semaphore for archive: %s", filepath.Base(currentPath))
-				}()
-
-				// Log at the beginning of the goroutine
-				archiveName := filepath.Base(currentPath)
-				logger.Info("Started goroutine for archive: %s", archiveName)
-
-				// Create a completely independent context for this archive
-				archiveCtx, archiveCancel := context.WithCancel(context.Background())
-				defer archiveCancel() // Ensure this context is cancelled when the goroutine exits
-
-				logger.Info("Starting processing for archive: %s", archiveName)
-
-				// Create a separate S3 client for each archive
-				archiveS3Client, err := s3client.New(archiveCtx, s3Config)
-				if err != nil {
-					errorMsg := fmt.Errorf("failed to initialize S3 client for archive %s: %w", currentPath, err)
-					logger.Error("%v", errorMsg)
-
-					errorsMutex.Lock()
-					uploadErrors = append(uploadErrors, errorMsg)
-					errorsMutex.Unlock()
-					return
-				}
-
-				// Determine if it's a zip file or directory
-				isZip := filepath.Ext(currentPath) == ".zip"
-
-				// Create Google Takeout adapter with archive-specific context
-				takeout, err := googletakeout.New(archiveCtx, currentPath, isZip)
-				if err != nil {
-					errorMsg := fmt.Errorf("failed to process takeout at %s: %w", currentPath, err)
-					logger.Error("%v", errorMsg)
-
-					errorsMutex.Lock()
-					uploadErrors = append(uploadErrors, errorMsg)
-					errorsMutex.Unlock()
-					return
-				}
-
-				// Create a separate worker pool for each file
-				filePool := worker.NewPool(cfg.Upload.Concurrency)
-
-				// Create a separate progress reporter for each archive
-				archiveProgress := progress.New()
-
-				// Create a separate journal for each archive if needed
-				var archiveJournal *journal.Journal
-				if cfg.Upload.JournalPath != "" {
-					// Create a journal with a unique name for this archive
-					journalPath := cfg.Upload.JournalPath
-					if !strings.HasSuffix(journalPath, ".json") {
-						journalPath = filepath.Join(journalPath, archiveName+".json")
-					} else {
-						// Insert archive name before .json extension
-						ext := filepath.Ext(journalPath)
-						base := strings.TrimSuffix(journalPath, ext)
-						journalPath = base + "-" + archiveName + ext
-					}
-
-					logger.Info("Using journal at %s for archive: %s", journalPath, archiveName)
-					archiveJournal = journal.New(journalPath)
-					if cfg.Upload.Resume {
-						if err := archiveJournal.Load(); err != nil {
-							logger.Warn("Could not load journal for %s: %v", archiveName, err)
-						}
-					}
-
-					// Start periodic save for this archive's journal
-					archiveJournal.StartPeriodicSave(archiveCtx)
-					defer archiveJournal.StopPeriodicSave()
-				} else {
-					// Use the main journal if no specific journal path was provided
-					archiveJournal = jnl
-				}
-
-				// Start upload process with archive-specific resources
-				logger.Info("Starting upload for archive: %s", archiveName)
-				up := uploader.New(archiveCtx, archiveS3Client, takeout, archiveJournal, filePool, archiveProgress, cfg)
-
-				if err := up.Run(); err != nil {
-					errorMsg := fmt.Errorf("upload failed for %s: %w", currentPath, err)
-					logger.Error("%v", errorMsg)
-
-					errorsMutex.Lock()
-					uploadErrors = append(uploadErrors, errorMsg)
-					errorsMutex.Unlock()
-				} else {
-					logger.Info("Successfully completed upload for archive: %s", archiveName)
-				}
+	result, err := importer.Run(ctx, opts)
+	if err != nil {
+		return err
+	}
 
-				// Final log message
-				logger.Info("Finished processing archive: %s", archiveName)
-			}()
+	if printPlan {
+		if err := result.Plan.WriteJSON(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write dry run plan: %w", err)
 		}
+	}
 
-		// Just before wg.Wait()
-		logger.Info("About to wait for %d archives to complete", len(filesToProcess))
+	if cfg.Upload.Plan {
+		printPlanSummary(os.Stdout, result.Plan.Summary(cfg.S3.PartSize))
 	}
 
-	// Wait for all uploads to complete
-	logger.Info("Waiting for all archives to complete...")
-	wg.Wait()
-	logger.Info("All archives have been processed")
+	if cfg.Upload.ErrorLog != "" {
+		if err := writeErrorLog(cfg.Upload.ErrorLog, result); err != nil {
+			return err
+		}
+	}
 
 	// Check if there were any errors
-	if len(uploadErrors) > 0 {
-		logger.Error("Encountered %d errors during upload", len(uploadErrors))
-		for _, err := range uploadErrors {
-			logger.Error("  %v", err)
+	if groups := result.ErrorGroups(); len(groups) > 0 {
+		logger.Error("Encountered %d errors during upload", len(result.FileErrors()))
+		for _, group := range groups {
+			logger.Error("  %s: %d", group.Category, len(group.Errors))
+			for i, err := range group.Errors {
+				if i == errorExamples {
+					logger.Error("    ... and %d more", len(group.Errors)-errorExamples)
+					break
+				}
+				logger.Error("    %v", err)
+			}
+		}
+		for _, archive := range result.Archives {
+			if archive.Err == nil {
+				continue
+			}
+			logger.Error("  %s: %d/%d files uploaded before the failure, run again with --resume to continue",
+				archive.Name, archive.Totals.UploadedFiles, archive.Totals.TotalFiles)
+		}
+		if cfg.Upload.ErrorLog != "" {
+			logger.Error("All errors are listed in %s", cfg.Upload.ErrorLog)
 		}
-		return nil
 	}
 
 	return nil
 }
 
-func findZipFiles(dir string) ([]string, error) {
-	var zipFiles []string
+// errorExamples is the number of errors of each category shown in the summary
+const errorExamples = 3
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// writeErrorLog writes every error of the run to path, replacing the log of
+// an earlier run
+func writeErrorLog(path string, result *importer.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create error log: %w", err)
+	}
+	if err := result.WriteErrorLog(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write error log: %w", err)
+	}
+	return f.Close()
+}
 
-		if !info.IsDir() && filepath.Ext(path) == ".zip" {
-			zipFiles = append(zipFiles, path)
+// printPlanSummary prints what a run would upload and warns about the files
+// that would fail for their size
+func printPlanSummary(w io.Writer, summary importer.PlanSummary) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Files:\t%d\t%s\n", summary.Files, config.FormatSize(summary.Bytes))
+	fmt.Fprintf(tw, "To upload:\t%d\t%s\n", summary.UploadFiles, config.FormatSize(summary.UploadBytes))
+	fmt.Fprintf(tw, "Already in bucket:\t%d\t%s\n", summary.ExistingFiles, config.FormatSize(summary.ExistingBytes))
+	fmt.Fprintf(tw, "Skipped:\t%d\t%s\n", summary.SkippedFiles, config.FormatSize(summary.SkippedBytes))
+
+	if len(summary.Types) > 0 {
+		fmt.Fprintln(tw, "\nTo upload by type:")
+		for _, t := range summary.Types {
+			fmt.Fprintf(tw, "  %s\t%d\t%s\n", t.ContentType, t.Files, config.FormatSize(t.Bytes))
 		}
+	}
+	tw.Flush()
 
-		return nil
-	})
-
-	return zipFiles, err
+	for _, object := range summary.Oversized {
+		logger.Warn("%s is %s, larger than the provider accepts or than the parts of --part-size allow", object.Path, config.FormatSize(object.Size))
+	}
 }
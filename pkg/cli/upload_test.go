@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveScanConcurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"default", nil, 4},
+		{"follows concurrency", []string{"--concurrency=8"}, 8},
+		{"explicit", []string{"--concurrency=8", "--scan-concurrency=2"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cmd := newUploadCommand(context.Background(), cfg)
+			require.NoError(t, cmd.ParseFlags(tt.args))
+
+			deriveScanConcurrency(cmd, cfg)
+			assert.Equal(t, tt.want, cfg.Upload.ScanConcurrency)
+		})
+	}
+}
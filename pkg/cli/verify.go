@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/importer"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
+	"github.com/spf13/cobra"
+)
+
+// verifyResult holds the outcome of verifying one archive against the bucket
+type verifyResult struct {
+	checked        int
+	missing        int
+	sizeMismatches int
+	etagMismatches int
+}
+
+func (r verifyResult) failed() int {
+	return r.missing + r.sizeMismatches + r.etagMismatches
+}
+
+func newVerifyCommand(ctx context.Context, cfg *config.Config) *cobra.Command {
+	var checkETag bool
+
+	cmd := &cobra.Command{
+		Use:   "verify [flags] <takeout-*.zip> | <takeout-folder>",
+		Short: "Verify that the files of Google Takeout archives exist in S3",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			isGlob, _ := cmd.Flags().GetBool("glob")
+			return runVerify(cmd.Context(), cfg, args, isGlob, checkETag)
+		},
+	}
+
+	// S3 connection flags
+	addS3Flags(cmd, cfg)
+
+	// Verify options
+	addSourceFlags(cmd, cfg)
+	addKeyFlags(cmd, cfg)
+	cmd.Flags().BoolVar(&checkETag, "check-etag", false, "Compare the MD5 of each local file against the object ETag (single-part uploads only)")
+	cmd.Flags().BoolP("glob", "g", false, "Treat input paths as glob patterns")
+
+	return cmd
+}
+
+func runVerify(ctx context.Context, cfg *config.Config, args []string, isGlob bool, checkETag bool) error {
+	logger.SetLevel(cfg.LogLevel)
+
+	if err := importer.ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	if err := importer.ValidateSourceType(cfg); err != nil {
+		return err
+	}
+
+	keyTemplate, err := importer.ParseKeyTemplate(cfg)
+	if err != nil {
+		return err
+	}
+
+	s3Client, err := importer.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	// List the bucket once and index the objects by their key relative to the prefix
+	logger.Info("Listing objects in bucket %s", s3Client.GetBucketName())
+	objects, err := s3Client.ListObjects(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	index := make(map[string]minio.ObjectInfo, len(objects))
+	for _, object := range objects {
+		if key, ok := s3client.RelativeKey(s3Client.GetPrefix(), object.Key); ok {
+			index[key] = object
+		}
+	}
+	logger.Info("Found %d objects in bucket", len(index))
+
+	var total verifyResult
+	archives, err := importer.ResolveArchives(args, isGlob, cfg.Upload.SourceType)
+	if err != nil {
+		return err
+	}
+
+	for _, archive := range archives {
+		src, err := importer.OpenSource(ctx, archive, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to process %s source at %s: %w", cfg.Upload.SourceType, archive.Path, err)
+		}
+
+		result, err := verifyArchive(ctx, s3Client, src, keyTemplate, &cfg.Upload, index, checkETag)
+		importer.CloseSource(src)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", archive.Path, err)
+		}
+
+		logger.Info("Verified archive %s: %d files, %d missing, %d size mismatches, %d ETag mismatches",
+			archive.Name, result.checked, result.missing, result.sizeMismatches, result.etagMismatches)
+
+		total.checked += result.checked
+		total.missing += result.missing
+		total.sizeMismatches += result.sizeMismatches
+		total.etagMismatches += result.etagMismatches
+	}
+
+	logger.Info("Verification complete:")
+	logger.Info("  Checked: %d", total.checked)
+	logger.Info("  OK: %d", total.checked-total.failed())
+	logger.Info("  Missing: %d", total.missing)
+	logger.Info("  Size mismatches: %d", total.sizeMismatches)
+	if checkETag {
+		logger.Info("  ETag mismatches: %d", total.etagMismatches)
+	}
+
+	if total.failed() > 0 {
+		return fmt.Errorf("verification failed for %d/%d files", total.failed(), total.checked)
+	}
+
+	return nil
+}
+
+// verifyArchive compares every file of a source against the bucket index
+func verifyArchive(ctx context.Context, s3Client s3client.S3Interface, src source.Source,
+	keyTemplate *uploader.KeyTemplate, cfg *config.UploadConfig, index map[string]minio.ObjectInfo, checkETag bool) (verifyResult, error) {
+
+	var result verifyResult
+
+	for _, file := range src.ListFiles() {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		result.checked++
+
+		key, err := uploader.ObjectKey(file, keyTemplate, cfg)
+		if err != nil {
+			return result, err
+		}
+
+		object, listed := index[key]
+		if !listed {
+			// Fall back to a direct check in case the listing missed it
+			exists, err := s3Client.ObjectExists(ctx, key)
+			if err != nil {
+				return result, err
+			}
+			if !exists {
+				logger.Warn("Missing object: %s", file.Path)
+				result.missing++
+				continue
+			}
+			logger.Debug("Object %s exists but was not listed, skipping size check", file.Path)
+			continue
+		}
+
+		if object.Size != file.Size {
+			logger.Warn("Size mismatch for %s: local %d bytes, remote %d bytes", file.Path, file.Size, object.Size)
+			result.sizeMismatches++
+			continue
+		}
+
+		if checkETag {
+			etag := strings.Trim(object.ETag, `"`)
+			if strings.Contains(etag, "-") {
+				// Multipart ETags are not a plain MD5 of the content
+				logger.Debug("Skipping ETag check for multipart object %s", file.Path)
+				continue
+			}
+
+			sum, err := fileMD5(src, file.Path)
+			if err != nil {
+				return result, fmt.Errorf("failed to hash %s: %w", file.Path, err)
+			}
+			if !strings.EqualFold(sum, etag) {
+				logger.Warn("ETag mismatch for %s: local %s, remote %s", file.Path, sum, etag)
+				result.etagMismatches++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// fileMD5 returns the hex encoded MD5 of a file in the source
+func fileMD5(src source.Source, path string) (string, error) {
+	reader, err := src.OpenFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
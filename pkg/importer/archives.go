@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/generic"
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/googletakeout"
+	"github.com/bstardust/google-takeout-s3-importer/internal/adapter/source"
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// Archive is an archive or folder to process. The numbered parts of a split
+// Takeout export are processed together as one archive.
+type Archive struct {
+	Path  string // the archive, or the path its parts share for a split export
+	Name  string
+	Parts []string
+}
+
+// ResolveArchives expands the input paths into the archives to process,
+// grouping the parts of split Takeout exports so their JSON sidecars can be
+// matched with media files in other parts
+func ResolveArchives(paths []string, isGlob bool, sourceType string) ([]Archive, error) {
+	var resolved []string
+	for _, path := range paths {
+		matches, err := resolveInputPaths(path, isGlob, sourceType)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, matches...)
+	}
+
+	var archives []Archive
+	if sourceType == config.SourceTypeGeneric {
+		for _, path := range resolved {
+			archives = append(archives, Archive{Path: path, Name: filepath.Base(path), Parts: []string{path}})
+		}
+		return archives, nil
+	}
+
+	for _, parts := range fshelper.GroupParts(resolved) {
+		archive := Archive{Path: parts[0], Name: fshelper.PartsName(parts), Parts: parts}
+		if len(parts) > 1 {
+			archive.Path = filepath.Join(filepath.Dir(parts[0]), archive.Name)
+			logger.Info("Processing %d parts of %s as one archive", len(parts), archive.Name)
+		}
+		archives = append(archives, archive)
+	}
+	return archives, nil
+}
+
+// resolveInputPaths expands an input argument into the archives to process.
+// Glob patterns are expanded, directories are searched for zip and tar
+// archives unless they are a generic source, and anything else is returned
+// as is.
+func resolveInputPaths(path string, isGlob bool, sourceType string) ([]string, error) {
+	if isGlob {
+		// Handle as glob pattern
+		logger.Debug("Processing pattern: %s", path)
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			logger.Error("Failed to expand glob pattern: %v", err)
+			return nil, fmt.Errorf("failed to expand glob pattern %s: %w", path, err)
+		}
+
+		logger.Debug("Glob pattern expanded to %d matches", len(matches))
+		for i, match := range matches {
+			logger.Debug("Match %d: %s", i+1, match)
+		}
+
+		if len(matches) == 0 {
+			logger.Warn("No files matched pattern: %s", path)
+			return nil, nil
+		}
+
+		logger.Info("Found %d files matching pattern: %s", len(matches), path)
+		return matches, nil
+	}
+
+	// If the path is a directory, find all zip and tar archives in it. A
+	// generic source is the directory itself.
+	fileInfo, err := os.Stat(path)
+	if err == nil && fileInfo.IsDir() && sourceType != config.SourceTypeGeneric {
+		archives, err := findArchives(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan directory %s: %w", path, err)
+		}
+
+		if len(archives) == 0 {
+			logger.Warn("No zip or tar archives found in directory: %s", path)
+			return nil, nil
+		}
+
+		logger.Info("Found %d archives in directory: %s", len(archives), path)
+		return archives, nil
+	}
+
+	// Handle as literal path
+	return []string{path}, nil
+}
+
+// findArchives returns the .zip, .tgz and .tar.gz files under a directory
+func findArchives(dir string) ([]string, error) {
+	var archives []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && fshelper.IsArchive(path) {
+			archives = append(archives, path)
+		}
+
+		return nil
+	})
+
+	return archives, err
+}
+
+// OpenSource scans an archive or folder with the adapter for the configured
+// source type. Close the source with CloseSource when done to release the
+// archive.
+func OpenSource(ctx context.Context, archive Archive, cfg *Config) (source.Source, error) {
+	// Checksums from the scan are used to skip duplicates and stored with each object
+	hashFiles := cfg.Upload.Dedupe || cfg.Upload.VerifyChecksums
+
+	// Return a nil interface on error rather than a typed nil pointer
+	if cfg.Upload.SourceType == config.SourceTypeGeneric {
+		// Generic sources are never grouped into parts
+		dir, err := generic.New(ctx, archive.Path, generic.Options{
+			ScanConcurrency: cfg.Upload.ScanConcurrency,
+			HashFiles:       hashFiles,
+			NameEncoding:    cfg.Upload.KeyEncoding,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return dir, nil
+	}
+
+	takeout, err := googletakeout.NewFromParts(ctx, archive.Parts, googletakeout.Options{
+		ScanConcurrency:    cfg.Upload.ScanConcurrency,
+		HashFiles:          hashFiles,
+		UploadMetadataJSON: cfg.Upload.UploadMetadataJSON,
+		NameEncoding:       cfg.Upload.KeyEncoding,
+		TimeDivergence:     cfg.Upload.TimeDivergence,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return takeout, nil
+}
+
+// CloseSource releases the archive behind a source opened by OpenSource
+func CloseSource(src source.Source) {
+	closer, ok := src.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		logger.Warn("Failed to close source: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// DefaultCleanupAge is how old an incomplete upload must be before it is
+// aborted, so uploads another run still has in progress are left alone
+const DefaultCleanupAge = 24 * time.Hour
+
+// CleanupResult counts the incomplete uploads that were aborted
+type CleanupResult struct {
+	Aborted int
+	Bytes   int64
+}
+
+// AbortIncompleteUploads aborts the incomplete multipart uploads under the
+// prefix that were started at least olderThan ago and logs what was reclaimed
+func AbortIncompleteUploads(ctx context.Context, s3Client s3client.S3Interface, olderThan time.Duration) (CleanupResult, error) {
+	var result CleanupResult
+
+	uploads, err := s3Client.ListIncompleteUploads(ctx, "")
+	if err != nil {
+		return result, fmt.Errorf("failed to list incomplete uploads: %w", err)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	for _, upload := range uploads {
+		if upload.Initiated.After(cutoff) {
+			logger.Debug("Keeping recent incomplete upload of %s started at %s", upload.Key, upload.Initiated.Format(time.RFC3339))
+			continue
+		}
+
+		if err := s3Client.AbortIncompleteUpload(ctx, upload); err != nil {
+			return result, err
+		}
+
+		logger.Info("Aborted incomplete upload of %s (%.2f MB)", upload.Key, float64(upload.Size)/(1024*1024))
+		result.Aborted++
+		result.Bytes += upload.Size
+	}
+
+	logger.Info("Aborted %d incomplete uploads, reclaiming about %.2f MB", result.Aborted, float64(result.Bytes)/(1024*1024))
+	return result, nil
+}
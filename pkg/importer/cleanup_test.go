@@ -0,0 +1,40 @@
+package importer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadsBucket lists a fixed set of incomplete uploads and records aborts
+type uploadsBucket struct {
+	s3client.S3Interface
+	uploads []s3client.IncompleteUpload
+	aborted []string
+}
+
+func (b *uploadsBucket) ListIncompleteUploads(ctx context.Context, prefix string) ([]s3client.IncompleteUpload, error) {
+	return b.uploads, nil
+}
+
+func (b *uploadsBucket) AbortIncompleteUpload(ctx context.Context, upload s3client.IncompleteUpload) error {
+	b.aborted = append(b.aborted, upload.Key)
+	return nil
+}
+
+func TestAbortIncompleteUploads_KeepsRecent(t *testing.T) {
+	bucket := &uploadsBucket{uploads: []s3client.IncompleteUpload{
+		{Key: "photos/old.mp4", UploadID: "1", Initiated: time.Now().Add(-48 * time.Hour), Size: 1024},
+		{Key: "photos/running.mp4", UploadID: "2", Initiated: time.Now().Add(-time.Minute), Size: 2048},
+	}}
+
+	result, err := AbortIncompleteUploads(context.Background(), bucket, DefaultCleanupAge)
+	require.NoError(t, err)
+
+	assert.Equal(t, CleanupResult{Aborted: 1, Bytes: 1024}, result)
+	assert.Equal(t, []string{"photos/old.mp4"}, bucket.aborted)
+}
@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// Names of the checks of Doctor, in the order they run
+const (
+	CheckConnect   = "connect"
+	CheckWrite     = "write"
+	CheckDelete    = "delete"
+	CheckMultipart = "multipart"
+)
+
+// doctorObject is the name of the test objects Doctor writes under the prefix
+const doctorObject = ".s3-takeout-upload-doctor"
+
+// DoctorCheck is the outcome of one check of Doctor. Err is nil if it
+// passed, and Hint suggests what to change if it didn't.
+type DoctorCheck struct {
+	Name    string
+	Err     error
+	Hint    string
+	Skipped bool
+}
+
+// Passed reports whether the check ran and succeeded
+func (c DoctorCheck) Passed() bool {
+	return !c.Skipped && c.Err == nil
+}
+
+// Doctor checks that uploads with the settings will work before a long run:
+// that the client connects and finds the bucket, that a small object can be
+// written under the prefix and deleted again, and that a multipart upload
+// completes. Checks that need a connection are skipped if it fails.
+func Doctor(ctx context.Context, cfg *Config) []DoctorCheck {
+	// Connect errors already say what to check
+	client, err := Connect(ctx, cfg)
+	checks := []DoctorCheck{{Name: CheckConnect, Err: err}}
+	if err != nil {
+		for _, name := range []string{CheckWrite, CheckDelete, CheckMultipart} {
+			checks = append(checks, DoctorCheck{Name: name, Skipped: true})
+		}
+		return checks
+	}
+
+	key := fmt.Sprintf("%s-%d", doctorObject, time.Now().UnixNano())
+	checks = append(checks, writeChecks(ctx, client, key)...)
+
+	// Multipart uploads are only used for large files, so the check uses a
+	// client that splits the smallest object it can
+	multipartConfig := NewS3Config(cfg)
+	multipartConfig.MultipartThreshold = s3client.MinPartSize
+	multipartConfig.PartSize = s3client.MinPartSize
+	multipartClient, err := s3client.New(ctx, multipartConfig)
+	if err != nil {
+		return append(checks, DoctorCheck{Name: CheckMultipart, Err: s3client.ExplainConnectError(err, multipartConfig)})
+	}
+	return append(checks, multipartCheck(ctx, multipartClient, key+"-multipart"))
+}
+
+// writeChecks writes a small test object under key and deletes it again
+func writeChecks(ctx context.Context, client s3client.S3Interface, key string) []DoctorCheck {
+	content := []byte("s3-takeout-upload doctor check\n")
+	_, err := client.UploadFile(ctx, bytes.NewReader(content), key, int64(len(content)), s3client.UploadOptions{ContentType: "text/plain"})
+	write := doctorCheck(CheckWrite, err, "check that the key may write objects to the bucket under --prefix")
+	if err != nil {
+		return []DoctorCheck{write, {Name: CheckDelete, Skipped: true}}
+	}
+
+	err = client.DeleteObject(ctx, key)
+	return []DoctorCheck{write, doctorCheck(CheckDelete, err,
+		fmt.Sprintf("uploads don't delete objects, but remove the test object %s by hand", key))}
+}
+
+// multipartCheck uploads a test object in two parts with a client that
+// splits files from s3client.MinPartSize bytes, and deletes it again
+func multipartCheck(ctx context.Context, client s3client.S3Interface, key string) DoctorCheck {
+	data := make([]byte, s3client.MinPartSize+1)
+	_, err := client.UploadFile(ctx, bytes.NewReader(data), key, int64(len(data)), s3client.UploadOptions{})
+	if err != nil {
+		return doctorCheck(CheckMultipart, err, "raise --multipart-threshold to upload files of up to 5GB in a single request")
+	}
+
+	// A key that can't delete was already reported by the delete check
+	_ = client.DeleteObject(ctx, key)
+	return DoctorCheck{Name: CheckMultipart}
+}
+
+// doctorCheck builds the result of a check, preferring a hint for the kind of
+// error over the hint of the check
+func doctorCheck(name string, err error, hint string) DoctorCheck {
+	if err == nil {
+		return DoctorCheck{Name: name}
+	}
+
+	switch {
+	case s3client.IsAuthError(err):
+		hint = "check --access-key and --secret-key, and that the key is allowed to use the bucket"
+	case s3client.IsNotFoundError(err):
+		hint = "check --bucket and --region, or pass --create-bucket to create the bucket"
+	}
+	return DoctorCheck{Name: name, Err: err, Hint: hint}
+}
@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doctorBucket records the test objects written and deleted by the checks
+type doctorBucket struct {
+	s3client.S3Interface
+	uploadErr error
+	deleteErr error
+	uploaded  map[string]int64
+	deleted   []string
+}
+
+func (b *doctorBucket) UploadFile(ctx context.Context, reader io.Reader, key string, size int64, opts s3client.UploadOptions) (s3client.UploadInfo, error) {
+	if b.uploadErr != nil {
+		return s3client.UploadInfo{}, b.uploadErr
+	}
+	n, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return s3client.UploadInfo{}, err
+	}
+	b.uploaded[key] = n
+	return s3client.UploadInfo{Key: key, Size: n}, nil
+}
+
+func (b *doctorBucket) DeleteObject(ctx context.Context, key string) error {
+	if b.deleteErr != nil {
+		return b.deleteErr
+	}
+	b.deleted = append(b.deleted, key)
+	return nil
+}
+
+func TestDoctorChecks(t *testing.T) {
+	ctx := context.Background()
+	bucket := &doctorBucket{uploaded: map[string]int64{}}
+
+	checks := writeChecks(ctx, bucket, "test")
+	checks = append(checks, multipartCheck(ctx, bucket, "test-multipart"))
+	for _, check := range checks {
+		assert.True(t, check.Passed(), check.Name)
+	}
+	assert.Equal(t, int64(s3client.MinPartSize+1), bucket.uploaded["test-multipart"])
+	assert.Equal(t, []string{"test", "test-multipart"}, bucket.deleted)
+
+	// A key that can't delete fails that check only
+	bucket.deleteErr = errors.New("not allowed to delete")
+	checks = writeChecks(ctx, bucket, "test")
+	require.Len(t, checks, 2)
+	assert.True(t, checks[0].Passed())
+	assert.Error(t, checks[1].Err)
+	assert.Contains(t, checks[1].Hint, "by hand")
+
+	// Denied writes say which settings to check, and the delete is skipped
+	bucket.uploadErr = minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"}
+	checks = writeChecks(ctx, bucket, "test")
+	require.Len(t, checks, 2)
+	assert.Contains(t, checks[0].Hint, "--access-key")
+	assert.True(t, checks[1].Skipped)
+	assert.False(t, checks[1].Passed())
+}
@@ -0,0 +1,181 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// DownloadOptions configures Download
+type DownloadOptions struct {
+	// Dir is the local directory the objects are written to, mirroring their
+	// keys relative to the prefix
+	Dir string
+
+	// Include and Exclude select the objects by their key relative to the
+	// prefix, like --include and --exclude of upload
+	Include []string
+	Exclude []string
+
+	// Concurrency is the number of objects downloaded at a time
+	Concurrency int
+
+	// SkipExisting leaves local files that already have the size of the object alone
+	SkipExisting bool
+
+	// Retry is used for every request. The zero value uses the defaults.
+	Retry uploader.RetryConfig
+}
+
+// DownloadResult counts the objects handled by Download
+type DownloadResult struct {
+	Downloaded int
+	Skipped    int
+	Filtered   int
+	Failed     int
+	Bytes      int64
+}
+
+// Download writes the objects under the prefix to a local directory, for
+// example to restore photos uploaded earlier. Objects that fail are logged
+// and counted in the result, while failing to list the bucket or an
+// interrupted run is returned as an error.
+func Download(ctx context.Context, s3Client s3client.S3Interface, opts DownloadOptions) (DownloadResult, error) {
+	var result DownloadResult
+
+	filter, err := uploader.NewPathFilter(opts.Include, opts.Exclude)
+	if err != nil {
+		return result, fmt.Errorf("invalid --include or --exclude: %w", err)
+	}
+	if opts.Retry.InitialBackoff == 0 {
+		opts.Retry = uploader.DefaultRetryConfig()
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	objects, err := s3Client.ListObjects(ctx, "")
+	if err != nil {
+		return result, fmt.Errorf("failed to list objects: %w", err)
+	}
+	logger.Info("Found %d objects in bucket %s", len(objects), s3Client.GetBucketName())
+
+	var mu sync.Mutex
+	pool := worker.NewPool(opts.Concurrency)
+
+	for _, object := range objects {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Folder markers have no content to restore
+		key, ok := s3client.RelativeKey(s3Client.GetPrefix(), object.Key)
+		if !ok || key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		if !filter.Match(key) {
+			result.Filtered++
+			continue
+		}
+
+		// Keys are untrusted paths, so keep them inside the directory
+		local := filepath.FromSlash(key)
+		if !filepath.IsLocal(local) {
+			logger.Warn("Skipping %s, which would be written outside %s", key, opts.Dir)
+			// Workers count their failures too
+			mu.Lock()
+			result.Failed++
+			mu.Unlock()
+			continue
+		}
+		target := filepath.Join(opts.Dir, local)
+
+		if opts.SkipExisting {
+			if info, err := os.Stat(target); err == nil && info.Size() == object.Size {
+				logger.Debug("Skipping %s, which already exists", target)
+				result.Skipped++
+				continue
+			}
+		}
+
+		size := object.Size
+		pool.Submit(func() {
+			err := uploader.RetryWithBackoff(ctx, fmt.Sprintf("Download %s", key), func() error {
+				return downloadObject(ctx, s3Client, key, target)
+			}, opts.Retry)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logger.Error("Failed to download %s: %v", key, err)
+				result.Failed++
+				return
+			}
+			logger.Debug("Downloaded %s to %s", key, target)
+			result.Downloaded++
+			result.Bytes += size
+		})
+	}
+	pool.Wait()
+
+	logger.Info("Downloaded %d objects (%.2f MB), skipped %d existing and %d filtered, %d failed",
+		result.Downloaded, float64(result.Bytes)/(1024*1024), result.Skipped, result.Filtered, result.Failed)
+
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("download interrupted: %w", ctx.Err())
+	}
+	return result, nil
+}
+
+// downloadObject streams an object to a temporary file next to target and
+// renames it into place once complete, so an interrupted download never
+// leaves a partial file behind. The file gets the original capture time of
+// the photo as its modification time, or the time the object was written.
+func downloadObject(ctx context.Context, s3Client s3client.S3Interface, key string, target string) error {
+	body, info, err := s3Client.GetObject(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+
+	mtime := info.LastModified
+	if originalDate, err := time.Parse(time.RFC3339, info.Metadata[s3client.MetadataOriginalDate]); err == nil {
+		mtime = originalDate
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+			logger.Debug("Failed to set the modification time of %s: %v", target, err)
+		}
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
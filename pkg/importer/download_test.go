@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBucket serves objects from memory. Keys include the prefix.
+type fakeBucket struct {
+	s3client.S3Interface
+	prefix  string
+	objects map[string]string
+}
+
+func (b *fakeBucket) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for key, content := range b.objects {
+		objects = append(objects, minio.ObjectInfo{Key: key, Size: int64(len(content))})
+	}
+	return objects, nil
+}
+
+func (b *fakeBucket) GetObject(ctx context.Context, key string) (io.ReadCloser, s3client.ObjectInfo, error) {
+	key = b.prefix + "/" + key
+	content, ok := b.objects[key]
+	if !ok {
+		return nil, s3client.ObjectInfo{}, fmt.Errorf("no such key %s", key)
+	}
+	return io.NopCloser(strings.NewReader(content)), s3client.ObjectInfo{
+		Key:      key,
+		Size:     int64(len(content)),
+		Metadata: map[string]string{s3client.MetadataOriginalDate: "2020-04-07T20:00:00Z"},
+	}, nil
+}
+
+func (b *fakeBucket) GetPrefix() string     { return b.prefix }
+func (b *fakeBucket) GetBucketName() string { return "photos" }
+
+func TestDownload(t *testing.T) {
+	bucket := &fakeBucket{prefix: "backup", objects: map[string]string{
+		"backup/2020/a.jpg":          "photo a",
+		"backup/2020/trip/b.jpg":     "photo b",
+		"backup/2020/c.mp4":          "video c",
+		"backup/2021/d.jpg":          "photo d",
+		"backup/2020/":               "",
+		"backup/2020/../../../x.jpg": "escape",
+		"backup-old/2020/e.jpg":      "not under the prefix",
+	}}
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "2020"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2020", "a.jpg"), []byte("photo a"), 0644))
+
+	result, err := Download(context.Background(), bucket, DownloadOptions{
+		Dir:          dir,
+		Include:      []string{"2020/**"},
+		Exclude:      []string{"*.mp4"},
+		Concurrency:  2,
+		SkipExisting: true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, DownloadResult{Downloaded: 1, Skipped: 1, Filtered: 2, Failed: 1, Bytes: 7}, result)
+
+	content, err := os.ReadFile(filepath.Join(dir, "2020", "trip", "b.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "photo b", string(content))
+
+	info, err := os.Stat(filepath.Join(dir, "2020", "trip", "b.jpg"))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(time.Date(2020, 4, 7, 20, 0, 0, 0, time.UTC)))
+
+	// Nothing is left outside the directory or under temporary names
+	entries, err := os.ReadDir(filepath.Join(dir, "2020", "trip"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.NoFileExists(t, filepath.Join(dir, "2021", "d.jpg"))
+}
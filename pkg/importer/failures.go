@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+)
+
+// ErrorGroup is the errors of a run that fall in one category
+type ErrorGroup struct {
+	Category uploader.ErrorCategory
+	Errors   []error
+}
+
+// FileErrors returns the error of each file that failed to upload, and the
+// error of each archive that failed as a whole
+func (r *Result) FileErrors() []error {
+	var errs []error
+	for _, archive := range r.Archives {
+		var filesErr *uploader.FilesError
+		switch {
+		case archive.Err == nil:
+		case errors.As(archive.Err, &filesErr):
+			errs = append(errs, filesErr.Errs...)
+		default:
+			errs = append(errs, archive.Err)
+		}
+	}
+	return errs
+}
+
+// ErrorGroups groups FileErrors by category, in the order of
+// uploader.ErrorCategories and leaving out the categories with no errors
+func (r *Result) ErrorGroups() []ErrorGroup {
+	byCategory := make(map[uploader.ErrorCategory][]error)
+	for _, err := range r.FileErrors() {
+		category := uploader.CategorizeError(err)
+		byCategory[category] = append(byCategory[category], err)
+	}
+
+	var groups []ErrorGroup
+	for _, category := range uploader.ErrorCategories {
+		if errs := byCategory[category]; len(errs) > 0 {
+			groups = append(groups, ErrorGroup{Category: category, Errors: errs})
+		}
+	}
+	return groups
+}
+
+// WriteErrorLog writes every error of FileErrors to w, one per line after
+// its category and a tab
+func (r *Result) WriteErrorLog(w io.Writer) error {
+	for _, group := range r.ErrorGroups() {
+		for _, err := range group.Errors {
+			line := strings.ReplaceAll(err.Error(), "\n", " ")
+			if _, err := fmt.Fprintf(w, "%s\t%s\n", group.Category, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
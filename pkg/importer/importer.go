@@ -0,0 +1,674 @@
+// Package importer runs the upload pipeline of the command line tool as a
+// library: it scans Google Takeout archives or folders of media files and
+// uploads them to an S3-compatible bucket.
+//
+// A minimal upload looks like this:
+//
+//	cfg := importer.DefaultConfig()
+//	cfg.S3.Endpoint = "s3.amazonaws.com"
+//	cfg.S3.Bucket = "my-photos-bucket"
+//	cfg.S3.AccessKey = accessKey
+//	cfg.S3.SecretKey = secretKey
+//
+//	result, err := importer.Run(ctx, importer.Options{
+//		Config: cfg,
+//		Paths:  []string{"takeout-20230101T000000Z-001.zip"},
+//	})
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/metrics"
+	"github.com/bstardust/google-takeout-s3-importer/internal/progress"
+	"github.com/bstardust/google-takeout-s3-importer/internal/ratelimit"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// Config holds the settings of an upload, the same ones the command line
+// flags set
+type Config = config.Config
+
+// S3Config holds the settings for the bucket connection
+type S3Config = config.S3Config
+
+// UploadConfig holds the settings for scanning and uploading
+type UploadConfig = config.UploadConfig
+
+// Totals holds the combined statistics of the archives in a run
+type Totals = uploader.Totals
+
+// DryRunPlan holds the objects a dry run would have written
+type DryRunPlan = uploader.DryRunPlan
+
+// PlannedObject is an object a dry run would have written or skipped
+type PlannedObject = uploader.PlannedObject
+
+// PlanSummary totals the objects of a dry run plan
+type PlanSummary = uploader.PlanSummary
+
+// KeyTemplate builds object keys from the metadata of a file
+type KeyTemplate = uploader.KeyTemplate
+
+// DefaultConfig returns the settings the command line tool uses when no
+// flags are given. The S3 endpoint, bucket and credentials still have to be
+// filled in.
+func DefaultConfig() *Config {
+	return config.New()
+}
+
+// Options configures a run
+type Options struct {
+	// Config holds the upload settings, as returned by DefaultConfig
+	Config *Config
+
+	// Paths are the archives and folders to upload. Folders are searched
+	// for archives unless the source type is generic.
+	Paths []string
+
+	// Glob treats Paths as glob patterns
+	Glob bool
+
+	// ProgressBar draws the combined progress of all archives on this
+	// terminal. Progress is logged instead when it is nil.
+	ProgressBar io.Writer
+}
+
+// ArchiveResult is the outcome of uploading one archive
+type ArchiveResult struct {
+	Name  string
+	Path  string
+	Parts []string
+
+	// Totals counts the files and bytes of the archive. They are filled in
+	// for an archive that failed part way too, so it is clear how far it got.
+	Totals Totals
+
+	// Err is set if the archive could not be scanned or some of its files
+	// failed to upload
+	Err error
+}
+
+// Result is the outcome of a run
+type Result struct {
+	// Totals counts the files and bytes of all archives
+	Totals Totals
+
+	// Archives holds the result of each archive, in the order of Paths
+	Archives []ArchiveResult
+
+	// Plan lists the objects a dry run would have written. It is nil unless
+	// DryRun is set.
+	Plan *DryRunPlan
+
+	// Duration is the time the run took
+	Duration time.Duration
+}
+
+// Errors returns the errors of the archives that failed
+func (r *Result) Errors() []error {
+	var errs []error
+	for _, archive := range r.Archives {
+		if archive.Err != nil {
+			errs = append(errs, archive.Err)
+		}
+	}
+	return errs
+}
+
+// Validate checks the upload settings that Run needs before it connects to
+// the bucket
+func Validate(cfg *Config) error {
+	if err := ValidateS3Config(cfg); err != nil {
+		return err
+	}
+
+	if err := retryConfig(cfg).Validate(); err != nil {
+		return fmt.Errorf("invalid retry settings: %w", err)
+	}
+
+	if cfg.Upload.BreakerThreshold < 0 {
+		return fmt.Errorf("--breaker-threshold must not be negative, got %d", cfg.Upload.BreakerThreshold)
+	}
+	if cfg.Upload.BreakerThreshold > 0 && cfg.Upload.BreakerCooldown <= 0 {
+		return fmt.Errorf("--breaker-cooldown must be positive, got %v", cfg.Upload.BreakerCooldown)
+	}
+
+	if cfg.Upload.Timeout < 0 {
+		return fmt.Errorf("--file-timeout must not be negative, got %v", cfg.Upload.Timeout)
+	}
+	if cfg.Upload.MaxDuration < 0 {
+		return fmt.Errorf("--max-duration must not be negative, got %v", cfg.Upload.MaxDuration)
+	}
+
+	if err := ValidateSourceType(cfg); err != nil {
+		return err
+	}
+
+	// An empty semaphore would never let an archive start
+	if cfg.Upload.MaxConcurrentArchives < 1 {
+		return fmt.Errorf("--max-archives must be at least 1, got %d", cfg.Upload.MaxConcurrentArchives)
+	}
+	if cfg.S3.PartConcurrency < 1 {
+		return fmt.Errorf("--multipart-concurrency must be at least 1, got %d", cfg.S3.PartConcurrency)
+	}
+	if cfg.Upload.ListExistingMax < 0 {
+		return fmt.Errorf("--list-existing-max must not be negative, got %d", cfg.Upload.ListExistingMax)
+	}
+	if cfg.Upload.MaxTotalUploads < 0 {
+		return fmt.Errorf("--max-total-uploads must not be negative, got %d", cfg.Upload.MaxTotalUploads)
+	}
+
+	if _, err := ParseKeyTemplate(cfg); err != nil {
+		return err
+	}
+
+	if _, err := uploader.NewPathFilter(cfg.Upload.Include, cfg.Upload.Exclude); err != nil {
+		return fmt.Errorf("invalid --include or --exclude: %w", err)
+	}
+	if _, err := uploader.NewTypeFilter(cfg.Upload.OnlyTypes); err != nil {
+		return err
+	}
+	if _, err := uploader.NewSizeFilter(cfg.Upload.MinSize, cfg.Upload.MaxSize); err != nil {
+		return err
+	}
+	if _, err := uploader.NewDateFilter(cfg.Upload.Since, cfg.Upload.Until, cfg.Upload.NoDatePolicy); err != nil {
+		return err
+	}
+
+	if err := uploader.ValidateSortBy(cfg.Upload.SortBy); err != nil {
+		return err
+	}
+
+	if cfg.Upload.TmpDir != "" {
+		info, err := os.Stat(cfg.Upload.TmpDir)
+		if err != nil {
+			return fmt.Errorf("invalid --tmp-dir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid --tmp-dir: %s is not a directory", cfg.Upload.TmpDir)
+		}
+	}
+	if cfg.Upload.SpillThreshold < 0 {
+		return fmt.Errorf("--spill-threshold must not be negative, got %d", cfg.Upload.SpillThreshold)
+	}
+
+	if cfg.Upload.BlurGPS < 0 {
+		return fmt.Errorf("--blur-gps must not be negative, got %v", cfg.Upload.BlurGPS)
+	}
+	if cfg.Upload.TimeDivergence < 0 {
+		return fmt.Errorf("--time-divergence must not be negative, got %v", cfg.Upload.TimeDivergence)
+	}
+	if cfg.Upload.StripGPS && cfg.Upload.BlurGPS > 0 {
+		return fmt.Errorf("--strip-gps and --blur-gps can't be combined")
+	}
+
+	if err := ValidateTranscodeHEIC(cfg); err != nil {
+		return err
+	}
+
+	switch cfg.Upload.MetadataOverflow {
+	case "", config.MetadataOverflowTrim, config.MetadataOverflowSidecar, config.MetadataOverflowError:
+	default:
+		return fmt.Errorf("invalid --metadata-overflow %q (expected %s, %s or %s)", cfg.Upload.MetadataOverflow,
+			config.MetadataOverflowTrim, config.MetadataOverflowSidecar, config.MetadataOverflowError)
+	}
+	switch cfg.Upload.ContentDisposition {
+	case "", s3client.DispositionInline, s3client.DispositionAttachment:
+	default:
+		return fmt.Errorf("invalid --content-disposition %q (expected %s or %s)", cfg.Upload.ContentDisposition,
+			s3client.DispositionInline, s3client.DispositionAttachment)
+	}
+	if cfg.Upload.CompressMetadataJSON && !cfg.Upload.SidecarMetadata && cfg.Upload.MetadataOverflow != config.MetadataOverflowSidecar {
+		return fmt.Errorf("--compress-metadata-json needs --sidecar-metadata or --metadata-overflow=%s", config.MetadataOverflowSidecar)
+	}
+
+	if cfg.Upload.RetryFailedOnly && !cfg.Upload.Resume {
+		return fmt.Errorf("--retry-failed-only reads failures from the journal and can't be combined with --resume=false")
+	}
+
+	if cfg.Upload.ResumableMultipart && !cfg.Upload.Resume {
+		return fmt.Errorf("--resumable-multipart keeps the uploaded parts in the journal and can't be combined with --resume=false")
+	}
+	if cfg.Upload.ResumableMultipart && cfg.Upload.AbortIncomplete {
+		return fmt.Errorf("--abort-incomplete would abort the uploads --resumable-multipart continues")
+	}
+
+	if err := validateWebhook(cfg); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// retryConfig builds the retry settings from the config
+func retryConfig(cfg *Config) uploader.RetryConfig {
+	retry := uploader.DefaultRetryConfig()
+	retry.MaxRetries = cfg.Upload.MaxRetries
+	retry.InitialBackoff = cfg.Upload.InitialBackoff
+	retry.MaxBackoff = cfg.Upload.MaxBackoff
+	return retry
+}
+
+// listExisting lists the objects under the prefix for --list-existing. It
+// returns nil if there are more than --list-existing-max, leaving the
+// uploaders to check each file with a request of its own.
+func listExisting(ctx context.Context, s3Client s3client.S3Interface, cfg *Config, retry uploader.RetryConfig) (*uploader.ExistingKeys, error) {
+	logger.Info("Listing the objects under the prefix to skip existing files")
+	var existing *uploader.ExistingKeys
+	err := uploader.RetryWithBackoff(ctx, "List existing objects", func() error {
+		var err error
+		existing, err = uploader.ListExistingKeys(ctx, s3Client, cfg.Upload.ListExistingMax)
+		return err
+	}, retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list existing objects: %w", err)
+	}
+
+	if existing == nil {
+		logger.Info("More than %d objects under the prefix, checking each file for an existing object instead", cfg.Upload.ListExistingMax)
+		return nil, nil
+	}
+	logger.Info("Found %d existing objects under the prefix", existing.Len())
+	return existing, nil
+}
+
+// Run scans and uploads the archives in opts.Paths, up to
+// MaxConcurrentArchives at a time. Errors in the settings, the bucket
+// connection or the journal are returned before anything is uploaded, while
+// archives that fail are reported in the result and don't stop the others.
+// An interrupted run returns the result so far with the context error. Once
+// the settings are valid, the outcome is posted to the webhook if one is set.
+func Run(ctx context.Context, opts Options) (result *Result, err error) {
+	cfg := opts.Config
+	if cfg == nil {
+		return nil, fmt.Errorf("no config given")
+	}
+
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	defer func() {
+		notifyWebhook(ctx, cfg, NewWebhookPayload(cfg, result, err, time.Since(start)))
+	}()
+
+	ctx, cancel := withMaxDuration(ctx, cfg.Upload.MaxDuration)
+	defer cancel()
+
+	// Validate has checked these already
+	keyTemplate, _ := ParseKeyTemplate(cfg)
+	filter, _ := uploader.NewPathFilter(cfg.Upload.Include, cfg.Upload.Exclude)
+	typeFilter, _ := uploader.NewTypeFilter(cfg.Upload.OnlyTypes)
+	sizeFilter, _ := uploader.NewSizeFilter(cfg.Upload.MinSize, cfg.Upload.MaxSize)
+	dateFilter, _ := uploader.NewDateFilter(cfg.Upload.Since, cfg.Upload.Until, cfg.Upload.NoDatePolicy)
+
+	result = &Result{}
+	if cfg.Upload.DryRun {
+		result.Plan = uploader.NewDryRunPlan()
+	}
+
+	s3Config := NewS3Config(cfg)
+
+	// Check the endpoint and bucket once before any archive is scanned, so a
+	// wrong setting fails with one clear error instead of one per archive
+	s3Client, err := Connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s3Client.(s3client.ResumableUploader); cfg.Upload.ResumableMultipart && !ok {
+		logger.Warn("The %s backend can't resume multipart uploads, large files start over if the run is interrupted", cfg.S3.Backend)
+	}
+
+	// Clear out multipart uploads left behind by runs that crashed
+	if cfg.Upload.AbortIncomplete {
+		if _, err := AbortIncompleteUploads(ctx, s3Client, DefaultCleanupAge); err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize journal for resumable uploads
+	jnl := journal.New(cfg.Upload.JournalPath)
+	if cfg.Upload.Resume {
+		if err := jnl.LoadOrBackup(); err != nil {
+			logger.Warn("Could not load journal: %v", err)
+		}
+	}
+
+	// A dry run reads the journal to skip what was uploaded, but never writes it
+	if cfg.Upload.Resume && !cfg.Upload.DryRun {
+		// Test if we can write to the journal file
+		logger.Info("Testing journal write access...")
+		if err := jnl.Save(); err != nil {
+			logger.Error("Failed to write journal file: %v", err)
+			logger.Warn("Continuing without journal - uploads will not be resumable")
+		} else {
+			logger.Info("Journal write test successful")
+		}
+	}
+
+	// Start periodic save with context. A dry run leaves the journal as it was.
+	if !cfg.Upload.DryRun {
+		logger.Info("Starting periodic journal save")
+		jnl.StartPeriodicSave(ctx)
+		defer func() {
+			logger.Info("Stopping periodic journal save")
+			jnl.StopPeriodicSave()
+			// Final save before exiting, however recently the journal was saved.
+			// The run may have been cancelled, so it gets its own deadline.
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), journal.FlushTimeout)
+			defer cancel()
+			if err := jnl.FlushContext(flushCtx); errors.Is(err, context.DeadlineExceeded) {
+				logger.Error("Timed out saving journal before exit, resume state may be stale: %v", err)
+			} else if err != nil {
+				logger.Error("Failed to save journal before exit: %v", err)
+			}
+		}()
+	}
+
+	// Share one bandwidth limiter between all archives and workers
+	limiter := ratelimit.New(cfg.Upload.MaxBandwidth)
+	if limiter != nil {
+		logger.Info("Limiting upload bandwidth to %s/s", config.FormatSize(cfg.Upload.MaxBandwidth))
+	}
+
+	// Cap the uploads of all archives together, on top of the workers of each
+	uploadLimiter := worker.NewLimiter(cfg.Upload.MaxTotalUploads)
+	if uploadLimiter != nil {
+		logger.Info("Limiting uploads to %d at a time across all archives", cfg.Upload.MaxTotalUploads)
+	}
+
+	// Share the content index between archives so duplicates across archives are
+	// skipped too, and total the statistics of all archives
+	stats := uploader.NewStats()
+	// Share one circuit breaker too, so an endpoint that is down stops all
+	// archives instead of each file retrying on its own
+	retry := retryConfig(cfg)
+	retry.Breaker = uploader.NewCircuitBreaker(cfg.Upload.BreakerThreshold, cfg.Upload.BreakerCooldown)
+
+	uploaderOpts := []uploader.Option{
+		uploader.WithRateLimiter(limiter),
+		uploader.WithRetryConfig(retry),
+		uploader.WithStats(stats),
+	}
+	if len(cfg.Upload.Include) > 0 || len(cfg.Upload.Exclude) > 0 {
+		uploaderOpts = append(uploaderOpts, uploader.WithFilter(filter))
+	}
+	if typeFilter.Active() {
+		uploaderOpts = append(uploaderOpts, uploader.WithTypeFilter(typeFilter))
+	}
+	if sizeFilter.Active() {
+		uploaderOpts = append(uploaderOpts, uploader.WithSizeFilter(sizeFilter))
+	}
+	if dateFilter.Active() {
+		uploaderOpts = append(uploaderOpts, uploader.WithDateFilter(dateFilter))
+	}
+	if keyTemplate != nil {
+		uploaderOpts = append(uploaderOpts, uploader.WithKeyTemplate(keyTemplate))
+	}
+	if cfg.Upload.ListExisting && cfg.Upload.SkipExisting && !cfg.Upload.Overwrite {
+		existing, err := listExisting(ctx, s3Client, cfg, retry)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			uploaderOpts = append(uploaderOpts, uploader.WithExistingKeys(existing))
+		}
+	}
+	if cfg.Upload.Dedupe {
+		uploaderOpts = append(uploaderOpts, uploader.WithDedupe(uploader.NewDedupeIndex()))
+		// Keep the hashes in the main journal even when each archive has its own,
+		// so content from other archives and earlier runs is skipped too
+		if !cfg.Upload.Overwrite {
+			uploaderOpts = append(uploaderOpts, uploader.WithHashJournal(jnl))
+		}
+	}
+	if result.Plan != nil {
+		uploaderOpts = append(uploaderOpts, uploader.WithDryRunPlan(result.Plan))
+	}
+
+	// List the files of all archives in one manifest. Closing it writes the
+	// last entries, also when the run is interrupted.
+	if cfg.Upload.Manifest != "" {
+		if cfg.Upload.DryRun {
+			logger.Warn("Not writing a manifest in a dry run, use --dry-run-format=json to list the planned objects")
+		} else {
+			manifest, err := uploader.NewManifest(cfg.Upload.Manifest)
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if err := manifest.Close(); err != nil {
+					logger.Error("Failed to write manifest: %v", err)
+				}
+			}()
+
+			logger.Info("Writing manifest to %s", cfg.Upload.Manifest)
+			uploaderOpts = append(uploaderOpts, uploader.WithManifest(manifest))
+		}
+	}
+
+	// Export metrics for all archives while the upload runs
+	if cfg.Upload.MetricsAddr != "" {
+		registry := metrics.NewRegistry()
+		server, err := metrics.Serve(ctx, cfg.Upload.MetricsAddr, registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start metrics server: %w", err)
+		}
+		defer server.Close()
+
+		uploaderOpts = append(uploaderOpts, uploader.WithMetrics(metrics.NewUpload(registry)))
+	}
+
+	// Show the combined progress of all archives on one line
+	var bar *progress.Bar
+	if opts.ProgressBar != nil {
+		bar = progress.NewBar(opts.ProgressBar)
+		bar.Start()
+		defer bar.Stop()
+	}
+
+	// Resolve the input paths, grouping the parts of split exports
+	archives, err := ResolveArchives(opts.Paths, opts.Glob, cfg.Upload.SourceType)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Found %d archives to process", len(archives))
+
+	result.Archives = make([]ArchiveResult, len(archives))
+	for i, archive := range archives {
+		result.Archives[i] = ArchiveResult{Name: archive.Name, Path: archive.Path, Parts: archive.Parts}
+	}
+
+	// Create a wait group to wait for all uploads to complete
+	var wg sync.WaitGroup
+
+	// Limit the number of concurrent archives being processed
+	archiveSemaphore := make(chan struct{}, cfg.Upload.MaxConcurrentArchives)
+	logger.Info("Processing up to %d archives simultaneously", cfg.Upload.MaxConcurrentArchives)
+
+	logger.Info("Starting upload process with PID: %d", os.Getpid())
+
+	// Process each archive
+archives:
+	for i, archive := range archives {
+		// Acquire semaphore to limit concurrent archives, unless we're shutting down
+		select {
+		case archiveSemaphore <- struct{}{}:
+		case <-ctx.Done():
+			logger.Warn("Upload cancelled, not starting archive: %s", archive.Name)
+			for j := i; j < len(archives); j++ {
+				result.Archives[j].Err = fmt.Errorf("not started: %w", ctx.Err())
+			}
+			break archives
+		}
+
+		// Add to wait group
+		wg.Add(1)
+
+		// Process each archive in a separate goroutine. Each goroutine only
+		// writes the result of its own archive.
+		go func(archive Archive, archiveResult *ArchiveResult) {
+			defer func() {
+				// Release semaphore when done
+				<-archiveSemaphore
+				wg.Done()
+				logger.Info("Released semaphore for archive: %s", archive.Name)
+			}()
+
+			// Recover from panics before the deferred release above runs, so
+			// the error is recorded before Run stops waiting for the archive
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("Panic recovered in archive processing: %v", r)
+					archiveResult.Err = fmt.Errorf("panic while processing %s: %v", archive.Path, r)
+				}
+			}()
+
+			archiveResult.Totals, archiveResult.Err = uploadArchive(ctx, cfg, archive, s3Config, jnl, bar, uploadLimiter, uploaderOpts)
+		}(archive, &result.Archives[i])
+	}
+
+	// Wait for all uploads to complete
+	logger.Info("Waiting for all archives to complete...")
+	wg.Wait()
+	logger.Info("All archives have been processed")
+	stats.LogSummary(cfg.Upload.DryRun)
+
+	result.Totals = stats.Totals()
+	result.Duration = stats.Elapsed()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return result, fmt.Errorf("upload stopped after --max-duration of %v, run again to resume: %w", cfg.Upload.MaxDuration, ctx.Err())
+	}
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("upload interrupted: %w", ctx.Err())
+	}
+
+	return result, nil
+}
+
+// withMaxDuration limits the run to maxDuration, if positive. Running out of
+// time cancels the run like an interrupt does: no more files are started,
+// uploads in flight stop and the journal is saved for the next run to resume.
+func withMaxDuration(ctx context.Context, maxDuration time.Duration) (context.Context, context.CancelFunc) {
+	if maxDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, maxDuration)
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logger.Warn("Reached --max-duration of %v, stopping the upload gracefully...", maxDuration)
+		}
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// uploadArchive scans an archive and uploads its files with its own S3
+// client, worker pool and progress reporter. It returns the totals of the
+// archive, including the files uploaded before a failure.
+func uploadArchive(ctx context.Context, cfg *Config, archive Archive, s3Config s3client.Config,
+	jnl *journal.Journal, bar *progress.Bar, uploadLimiter *worker.Limiter, uploaderOpts []uploader.Option) (Totals, error) {
+	archiveName := archive.Name
+	logger.Info("Started goroutine for archive: %s", archiveName)
+
+	// Derive the archive context from the parent so an interrupt stops the upload,
+	// while still letting each archive be cancelled on its own
+	archiveCtx, archiveCancel := context.WithCancel(ctx)
+	defer archiveCancel() // Ensure this context is cancelled when the goroutine exits
+
+	logger.Info("Starting processing for archive: %s", archiveName)
+
+	// Create a separate S3 client for each archive
+	archiveS3Client, err := s3client.New(archiveCtx, s3Config)
+	if err != nil {
+		return Totals{}, logArchiveError(fmt.Errorf("failed to initialize S3 client for archive %s: %w", archive.Path, err))
+	}
+
+	// Scan the archive with the adapter for the source type and archive-specific context
+	src, err := OpenSource(archiveCtx, archive, cfg)
+	if err != nil {
+		return Totals{}, logArchiveError(fmt.Errorf("failed to process %s source at %s: %w", cfg.Upload.SourceType, archive.Path, err))
+	}
+	defer CloseSource(src)
+
+	// Create a separate worker pool for each archive, sharing the cap on all uploads
+	filePool := worker.NewLimitedPool(cfg.Upload.Concurrency, uploadLimiter)
+
+	// Create a separate progress reporter for each archive
+	archiveProgress := progress.New()
+	if bar != nil {
+		archiveProgress = bar.NewReporter()
+	}
+
+	// Create a separate journal for each archive if needed
+	var archiveJournal *journal.Journal
+	if cfg.Upload.JournalPath != "" {
+		// Create a journal with a unique name for this archive
+		journalPath := cfg.Upload.JournalPath
+		if !strings.HasSuffix(journalPath, ".json") {
+			journalPath = filepath.Join(journalPath, archiveName+".json")
+		} else {
+			// Insert archive name before .json extension
+			ext := filepath.Ext(journalPath)
+			base := strings.TrimSuffix(journalPath, ext)
+			journalPath = base + "-" + archiveName + ext
+		}
+
+		logger.Info("Using journal at %s for archive: %s", journalPath, archiveName)
+		archiveJournal = journal.New(journalPath)
+		if cfg.Upload.Resume {
+			if err := archiveJournal.LoadOrBackup(); err != nil {
+				logger.Warn("Could not load journal for %s: %v", archiveName, err)
+			}
+		}
+
+		// Start periodic save for this archive's journal
+		if !cfg.Upload.DryRun {
+			archiveJournal.StartPeriodicSave(archiveCtx)
+			defer archiveJournal.StopPeriodicSave()
+		}
+	} else {
+		// Use the main journal if no specific journal path was provided
+		archiveJournal = jnl
+	}
+
+	// Start upload process with archive-specific resources
+	logger.Info("Starting upload for archive: %s", archiveName)
+	up := uploader.New(archiveCtx, archiveS3Client, src, archiveJournal, filePool, archiveProgress, cfg, uploaderOpts...)
+
+	if err := up.Run(); err != nil {
+		return up.Totals(), logArchiveError(fmt.Errorf("upload failed for %s: %w", archive.Path, err))
+	}
+
+	logger.InfoKV("Successfully completed upload for archive", map[string]any{
+		"archive": archiveName,
+	})
+	logger.Info("Finished processing archive: %s", archiveName)
+	return up.Totals(), nil
+}
+
+// logArchiveError logs the error of an archive as it happens and returns it
+// for the result
+func logArchiveError(err error) error {
+	logger.Error("%v", err)
+	return err
+}
@@ -0,0 +1,367 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/journal"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *Config {
+	cfg := DefaultConfig()
+	cfg.S3.Endpoint = "localhost:9000"
+	cfg.S3.Bucket = "photos"
+	cfg.S3.AccessKey = "access"
+	cfg.S3.SecretKey = "secret"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:    "missing bucket",
+			modify:  func(cfg *Config) { cfg.S3.Bucket = "" },
+			wantErr: "missing required settings: --bucket",
+		},
+		{
+			name:    "breaker without cool-down",
+			modify:  func(cfg *Config) { cfg.Upload.BreakerCooldown = 0 },
+			wantErr: "--breaker-cooldown",
+		},
+		{
+			name:   "B2 without an endpoint",
+			modify: func(cfg *Config) { cfg.S3.Backend = "b2"; cfg.S3.Endpoint = "" },
+		},
+		{
+			name:    "B2 with a profile",
+			modify:  func(cfg *Config) { cfg.S3.Backend = "b2"; cfg.S3.Profile = "photos"; cfg.S3.AccessKey = "" },
+			wantErr: "--access-key",
+		},
+		{
+			name:    "unknown backend",
+			modify:  func(cfg *Config) { cfg.S3.Backend = "gcs" },
+			wantErr: "--backend",
+		},
+		{
+			name:    "unknown ACL",
+			modify:  func(cfg *Config) { cfg.S3.ACL = "everyone" },
+			wantErr: "--acl",
+		},
+		{
+			name:    "unknown source type",
+			modify:  func(cfg *Config) { cfg.Upload.SourceType = "icloud" },
+			wantErr: "invalid --source-type",
+		},
+		{
+			name:    "unknown key encoding",
+			modify:  func(cfg *Config) { cfg.Upload.KeyEncoding = "klingon" },
+			wantErr: "invalid --key-encoding",
+		},
+		{
+			name:    "no archives at a time",
+			modify:  func(cfg *Config) { cfg.Upload.MaxConcurrentArchives = 0 },
+			wantErr: "--max-archives",
+		},
+		{
+			name:    "no parts at a time",
+			modify:  func(cfg *Config) { cfg.S3.PartConcurrency = 0 },
+			wantErr: "--multipart-concurrency",
+		},
+		{
+			name:    "negative total uploads",
+			modify:  func(cfg *Config) { cfg.Upload.MaxTotalUploads = -1 },
+			wantErr: "--max-total-uploads",
+		},
+		{
+			name:    "negative list existing limit",
+			modify:  func(cfg *Config) { cfg.Upload.ListExistingMax = -1 },
+			wantErr: "--list-existing-max",
+		},
+		{
+			name:    "bad key template",
+			modify:  func(cfg *Config) { cfg.Upload.KeyTemplate = "{{.Year" },
+			wantErr: "template",
+		},
+		{
+			name:    "date prefix and key template",
+			modify:  func(cfg *Config) { cfg.Upload.PrefixDate = true; cfg.Upload.KeyTemplate = "{{.Filename}}" },
+			wantErr: "--prefix-date",
+		},
+		{
+			name:    "unknown flatten mode",
+			modify:  func(cfg *Config) { cfg.Upload.Flatten = "year" },
+			wantErr: "invalid --flatten",
+		},
+		{
+			name:    "flatten and key template",
+			modify:  func(cfg *Config) { cfg.Upload.Flatten = "album"; cfg.Upload.KeyTemplate = "{{.Filename}}" },
+			wantErr: "--flatten",
+		},
+		{
+			name:    "unknown sanitize mode",
+			modify:  func(cfg *Config) { cfg.Upload.SanitizeKeys = "escape" },
+			wantErr: "invalid --sanitize-keys",
+		},
+		{
+			name:    "pattern in only types",
+			modify:  func(cfg *Config) { cfg.Upload.OnlyTypes = []string{"**/*.jpg"} },
+			wantErr: "invalid --only-types",
+		},
+		{
+			name:    "max size below min size",
+			modify:  func(cfg *Config) { cfg.Upload.MinSize = 2048; cfg.Upload.MaxSize = 1024 },
+			wantErr: "--max-size",
+		},
+		{
+			name: "until before since",
+			modify: func(cfg *Config) {
+				cfg.Upload.Since = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+				cfg.Upload.Until = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			},
+			wantErr: "--until",
+		},
+		{
+			name:    "unknown no-date policy",
+			modify:  func(cfg *Config) { cfg.Upload.NoDatePolicy = "skip" },
+			wantErr: "--no-date-policy",
+		},
+		{
+			name:    "unknown sort order",
+			modify:  func(cfg *Config) { cfg.Upload.SortBy = "name" },
+			wantErr: "invalid --sort-by",
+		},
+		{
+			name:    "missing tmp dir",
+			modify:  func(cfg *Config) { cfg.Upload.TmpDir = filepath.Join(os.TempDir(), "no-such-dir", "spill") },
+			wantErr: "invalid --tmp-dir",
+		},
+		{
+			name:    "strip and blur",
+			modify:  func(cfg *Config) { cfg.Upload.StripGPS = true; cfg.Upload.BlurGPS = 10 },
+			wantErr: "can't be combined",
+		},
+		{
+			name:    "negative time divergence",
+			modify:  func(cfg *Config) { cfg.Upload.TimeDivergence = -time.Hour },
+			wantErr: "--time-divergence",
+		},
+		{
+			name:    "unknown HEIC transcode mode",
+			modify:  func(cfg *Config) { cfg.Upload.TranscodeHEIC = "webp" },
+			wantErr: "invalid --transcode-heic",
+		},
+		{
+			name:    "unknown metadata overflow policy",
+			modify:  func(cfg *Config) { cfg.Upload.MetadataOverflow = "truncate" },
+			wantErr: "invalid --metadata-overflow",
+		},
+		{
+			name:    "unknown content disposition",
+			modify:  func(cfg *Config) { cfg.Upload.ContentDisposition = "download" },
+			wantErr: "invalid --content-disposition",
+		},
+		{
+			name:    "compressed sidecars without sidecars",
+			modify:  func(cfg *Config) { cfg.Upload.CompressMetadataJSON = true },
+			wantErr: "--compress-metadata-json needs --sidecar-metadata",
+		},
+		{
+			name:    "negative max duration",
+			modify:  func(cfg *Config) { cfg.Upload.MaxDuration = -time.Hour },
+			wantErr: "--max-duration must not be negative",
+		},
+		{
+			name:    "webhook without a scheme",
+			modify:  func(cfg *Config) { cfg.Upload.WebhookURL = "hooks.example.com/done" },
+			wantErr: "invalid --webhook-url",
+		},
+		{
+			name:    "webhook on error without a URL",
+			modify:  func(cfg *Config) { cfg.Upload.WebhookOnError = true },
+			wantErr: "--webhook-url",
+		},
+		{
+			name:    "retry failed without resume",
+			modify:  func(cfg *Config) { cfg.Upload.RetryFailedOnly = true; cfg.Upload.Resume = false },
+			wantErr: "--retry-failed-only",
+		},
+		{
+			name:    "resumable multipart without resume",
+			modify:  func(cfg *Config) { cfg.Upload.ResumableMultipart = true; cfg.Upload.Resume = false },
+			wantErr: "--resumable-multipart",
+		},
+		{
+			name:    "resumable multipart and abort incomplete",
+			modify:  func(cfg *Config) { cfg.Upload.ResumableMultipart = true; cfg.Upload.AbortIncomplete = true },
+			wantErr: "--abort-incomplete",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(cfg)
+
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestRun_InvalidSettings(t *testing.T) {
+	_, err := Run(context.Background(), Options{})
+	assert.Error(t, err)
+
+	cfg := testConfig()
+	cfg.S3.Endpoint = ""
+	result, err := Run(context.Background(), Options{Config: cfg, Paths: []string{"takeout.zip"}})
+	assert.Nil(t, result)
+	assert.ErrorContains(t, err, "--endpoint")
+}
+
+func TestRun_DryRunLeavesJournal(t *testing.T) {
+	// The bucket exists and holds no objects
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/photos" && r.URL.Path != "/photos/" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not really a jpeg"), 0600))
+	}
+
+	// The default journal is shared by all archives
+	t.Setenv("HOME", t.TempDir())
+	journalPath := journal.DefaultPath()
+	jnl := journal.New(journalPath)
+	jnl.MarkUploaded("a.jpg", "a.jpg", filepath.Base(dir), 17, "", "")
+	require.NoError(t, jnl.Save())
+	before, err := os.ReadFile(journalPath)
+	require.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.S3.Endpoint = server.URL
+	cfg.S3.UseSSL = false
+	cfg.Upload.SourceType = config.SourceTypeGeneric
+	cfg.Upload.DryRun = true
+	_, err = Run(context.Background(), Options{Config: cfg, Paths: []string{dir}})
+	require.NoError(t, err)
+
+	// The file the dry run planned isn't recorded as uploaded
+	after, err := os.ReadFile(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+}
+
+func TestWithMaxDuration(t *testing.T) {
+	ctx, cancel := withMaxDuration(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	// No limit leaves the run to finish or be interrupted
+	ctx, cancel = withMaxDuration(context.Background(), 0)
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestResolveArchives(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"takeout-20230101T000000Z-001.zip",
+		"takeout-20230101T000000Z-002.zip",
+		"takeout-20240101T000000Z-001.tgz",
+		"notes.txt",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	archives, err := ResolveArchives([]string{dir}, false, "takeout")
+	require.NoError(t, err)
+	assert.Equal(t, []Archive{
+		{
+			Path: filepath.Join(dir, "takeout-20230101T000000Z.zip"),
+			Name: "takeout-20230101T000000Z.zip",
+			Parts: []string{
+				filepath.Join(dir, "takeout-20230101T000000Z-001.zip"),
+				filepath.Join(dir, "takeout-20230101T000000Z-002.zip"),
+			},
+		},
+		{
+			Path:  filepath.Join(dir, "takeout-20240101T000000Z-001.tgz"),
+			Name:  "takeout-20240101T000000Z-001.tgz",
+			Parts: []string{filepath.Join(dir, "takeout-20240101T000000Z-001.tgz")},
+		},
+	}, archives)
+
+	// A generic source is the folder itself
+	archives, err = ResolveArchives([]string{dir}, false, "generic")
+	require.NoError(t, err)
+	assert.Equal(t, []Archive{{Path: dir, Name: filepath.Base(dir), Parts: []string{dir}}}, archives)
+}
+
+func TestResult_Errors(t *testing.T) {
+	failed := errors.New("upload failed")
+	result := Result{Archives: []ArchiveResult{
+		{Name: "takeout-001.zip"},
+		{Name: "takeout-002.zip", Err: failed},
+	}}
+
+	assert.Equal(t, []error{failed}, result.Errors())
+}
+
+func TestResult_ErrorGroups(t *testing.T) {
+	denied := fmt.Errorf("failed to upload a.jpg: %w", minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"})
+	slow := fmt.Errorf("failed to upload b.jpg: %w", minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"})
+	scan := errors.New("failed to process takeout source at takeout-002.zip:\nnot a valid zip file")
+	result := Result{Archives: []ArchiveResult{
+		{Name: "takeout-001.zip", Err: fmt.Errorf("upload failed for takeout-001.zip: %w",
+			&uploader.FilesError{Failed: 2, Total: 3, Uploaded: 1, Errs: []error{slow, denied}})},
+		{Name: "takeout-002.zip", Err: scan},
+		{Name: "takeout-003.zip"},
+	}}
+
+	assert.Equal(t, []error{slow, denied, scan}, result.FileErrors())
+	assert.Equal(t, []ErrorGroup{
+		{Category: uploader.ErrorAuth, Errors: []error{denied}},
+		{Category: uploader.ErrorNetwork, Errors: []error{slow}},
+		{Category: uploader.ErrorUnknown, Errors: []error{scan}},
+	}, result.ErrorGroups())
+
+	var log bytes.Buffer
+	require.NoError(t, result.WriteErrorLog(&log))
+	assert.Equal(t, "auth\t"+denied.Error()+"\n"+
+		"network\t"+slow.Error()+"\n"+
+		"unknown\tfailed to process takeout source at takeout-002.zip: not a valid zip file\n", log.String())
+}
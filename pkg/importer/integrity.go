@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/internal/worker"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// IntegrityOptions configures CheckIntegrity
+type IntegrityOptions struct {
+	// Include and Exclude select the objects by their key relative to the
+	// prefix, like --include and --exclude of upload
+	Include []string
+	Exclude []string
+
+	// Concurrency is the number of objects checked at a time
+	Concurrency int
+
+	// Retry is used for every request. The zero value uses the defaults.
+	Retry uploader.RetryConfig
+}
+
+// IntegrityResult counts the objects handled by CheckIntegrity. Mismatched
+// and Unverifiable list the keys, relative to the prefix, in sorted order.
+type IntegrityResult struct {
+	Verified     int
+	Filtered     int
+	Failed       int
+	Bytes        int64
+	Mismatched   []string
+	Unverifiable []string
+}
+
+// CheckIntegrity downloads the objects under the prefix that carry the
+// SHA-256 recorded when they were uploaded and hashes them again, to find
+// objects that were corrupted or truncated in the bucket. Objects without a
+// recorded checksum can't be checked and are listed as unverifiable. Objects
+// that fail to download are logged and counted, while failing to list the
+// bucket or an interrupted run is returned as an error.
+func CheckIntegrity(ctx context.Context, s3Client s3client.S3Interface, opts IntegrityOptions) (IntegrityResult, error) {
+	var result IntegrityResult
+
+	filter, err := uploader.NewPathFilter(opts.Include, opts.Exclude)
+	if err != nil {
+		return result, fmt.Errorf("invalid --include or --exclude: %w", err)
+	}
+	if opts.Retry.InitialBackoff == 0 {
+		opts.Retry = uploader.DefaultRetryConfig()
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	objects, err := s3Client.ListObjects(ctx, "")
+	if err != nil {
+		return result, fmt.Errorf("failed to list objects: %w", err)
+	}
+	logger.Info("Found %d objects in bucket %s", len(objects), s3Client.GetBucketName())
+
+	var mu sync.Mutex
+	pool := worker.NewPool(opts.Concurrency)
+
+	for _, object := range objects {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Folder markers have no content to check
+		key, ok := s3client.RelativeKey(s3Client.GetPrefix(), object.Key)
+		if !ok || key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		if !filter.Match(key) {
+			result.Filtered++
+			continue
+		}
+
+		pool.Submit(func() {
+			var check objectCheck
+			err := uploader.RetryWithBackoff(ctx, fmt.Sprintf("Check %s", key), func() error {
+				var err error
+				check, err = checkObject(ctx, s3Client, key)
+				return err
+			}, opts.Retry)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				logger.Error("Failed to check %s: %v", key, err)
+				result.Failed++
+			case check.want == "":
+				logger.Debug("Can't verify %s, which has no %s metadata", key, s3client.MetadataSHA256)
+				result.Unverifiable = append(result.Unverifiable, key)
+			case check.got != check.want:
+				logger.Error("Checksum mismatch for %s: expected %s, got %s (%d of %d bytes read)",
+					key, check.want, check.got, check.read, check.size)
+				result.Mismatched = append(result.Mismatched, key)
+			default:
+				logger.Debug("Verified %s", key)
+				result.Verified++
+				result.Bytes += check.read
+			}
+		})
+	}
+	pool.Wait()
+
+	sort.Strings(result.Mismatched)
+	sort.Strings(result.Unverifiable)
+
+	logger.Info("Verified %d objects (%.2f MB), %d mismatched, %d unverifiable, %d filtered, %d failed",
+		result.Verified, float64(result.Bytes)/(1024*1024), len(result.Mismatched),
+		len(result.Unverifiable), result.Filtered, result.Failed)
+
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("integrity check interrupted: %w", ctx.Err())
+	}
+	return result, nil
+}
+
+// objectCheck holds the checksum recorded for an object and the one of the
+// bytes read from the bucket
+type objectCheck struct {
+	want string
+	got  string
+	size int64
+	read int64
+}
+
+// checkObject hashes an object that has a recorded SHA-256. Objects without
+// one are closed without reading them.
+func checkObject(ctx context.Context, s3Client s3client.S3Interface, key string) (objectCheck, error) {
+	body, info, err := s3Client.GetObject(ctx, key)
+	if err != nil {
+		return objectCheck{}, err
+	}
+	defer body.Close()
+
+	check := objectCheck{
+		want: strings.ToLower(info.Metadata[s3client.MetadataSHA256]),
+		size: info.Size,
+	}
+	if check.want == "" {
+		return check, nil
+	}
+
+	hash := sha256.New()
+	if check.read, err = io.Copy(hash, body); err != nil {
+		return check, fmt.Errorf("failed to read object: %w", err)
+	}
+	check.got = hex.EncodeToString(hash.Sum(nil))
+	return check, nil
+}
@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksumBucket serves objects with the SHA-256 metadata recorded for them
+type checksumBucket struct {
+	fakeBucket
+	sums map[string]string
+}
+
+func (b *checksumBucket) GetObject(ctx context.Context, key string) (io.ReadCloser, s3client.ObjectInfo, error) {
+	body, info, err := b.fakeBucket.GetObject(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+	info.Metadata = map[string]string{}
+	if sum, ok := b.sums[info.Key]; ok {
+		info.Metadata[s3client.MetadataSHA256] = sum
+	}
+	return body, info, nil
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	bucket := &checksumBucket{
+		fakeBucket: fakeBucket{prefix: "backup", objects: map[string]string{
+			"backup/2020/a.jpg": "photo a",
+			"backup/2020/b.jpg": "photo b, trunc",
+			"backup/2020/c.jpg": "photo c",
+			"backup/2020/d.mp4": "video d",
+			"backup/2021/e.jpg": "photo e",
+			"backup/2020/":      "",
+
+			// Not under the prefix, though a listing of it includes the object
+			"backup-old/2020/f.jpg": "photo f",
+		}},
+		sums: map[string]string{
+			"backup/2020/a.jpg": strings.ToUpper(sha256Hex("photo a")),
+			"backup/2020/b.jpg": sha256Hex("photo b, truncated"),
+			"backup/2020/d.mp4": sha256Hex("video d"),
+			"backup/2021/e.jpg": sha256Hex("photo e"),
+		},
+	}
+
+	result, err := CheckIntegrity(context.Background(), bucket, IntegrityOptions{
+		Include:     []string{"2020/**"},
+		Exclude:     []string{"*.mp4"},
+		Concurrency: 2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, IntegrityResult{
+		Verified:     1,
+		Filtered:     2,
+		Bytes:        7,
+		Mismatched:   []string{"2020/b.jpg"},
+		Unverifiable: []string{"2020/c.jpg"},
+	}, result)
+}
@@ -0,0 +1,19 @@
+package importer
+
+import (
+	"context"
+
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// Connect creates an S3 client and checks the bucket, returning an error
+// that says whether the endpoint doesn't resolve, TLS fails, the credentials
+// are rejected or the bucket is missing
+func Connect(ctx context.Context, cfg *Config) (s3client.S3Interface, error) {
+	s3Config := NewS3Config(cfg)
+	client, err := s3client.New(ctx, s3Config)
+	if err != nil {
+		return nil, s3client.ExplainConnectError(err, s3Config)
+	}
+	return client, nil
+}
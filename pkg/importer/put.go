@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// PutOptions configures Put
+type PutOptions struct {
+	// Path is the local file to upload, and Key the object key it is stored
+	// under, relative to the prefix
+	Path string
+	Key  string
+
+	// ContentType overrides the type detected from the name and content of
+	// the file
+	ContentType string
+
+	// Metadata is stored with the object as user metadata
+	Metadata map[string]string
+
+	// Retry is used for the upload. The zero value uses the defaults.
+	Retry uploader.RetryConfig
+}
+
+// Put uploads a single local file to an exact key, without scanning it as
+// part of a Takeout archive, for example to test an endpoint with a known
+// file. Failed attempts are retried from the start of the file.
+func Put(ctx context.Context, s3Client s3client.S3Interface, opts PutOptions) (s3client.UploadInfo, error) {
+	if opts.Key == "" {
+		return s3client.UploadInfo{}, fmt.Errorf("object key is required")
+	}
+	if opts.Retry.InitialBackoff == 0 {
+		opts.Retry = uploader.DefaultRetryConfig()
+	}
+
+	f, err := os.Open(opts.Path)
+	if err != nil {
+		return s3client.UploadInfo{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return s3client.UploadInfo{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !stat.Mode().IsRegular() {
+		return s3client.UploadInfo{}, fmt.Errorf("%s is not a regular file", opts.Path)
+	}
+
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType, _, err = s3client.DetectContentTypeFromReader(opts.Path, f)
+		if err != nil {
+			return s3client.UploadInfo{}, err
+		}
+	}
+
+	var info s3client.UploadInfo
+	err = uploader.RetryWithBackoff(ctx, fmt.Sprintf("Upload %s to S3", opts.Path), func() error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind file: %w", err)
+		}
+		var err error
+		info, err = s3Client.UploadFile(ctx, f, opts.Key, stat.Size(), s3client.UploadOptions{
+			ContentType: contentType,
+			Metadata:    opts.Metadata,
+		})
+		return err
+	}, opts.Retry)
+	if err != nil {
+		return s3client.UploadInfo{}, fmt.Errorf("failed to upload %s: %w", opts.Path, err)
+	}
+	return info, nil
+}
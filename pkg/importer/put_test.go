@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putBucket fails the first upload after reading part of the body
+type putBucket struct {
+	s3client.S3Interface
+	attempts int
+	body     []byte
+	opts     s3client.UploadOptions
+}
+
+func (b *putBucket) UploadFile(ctx context.Context, reader io.Reader, key string, size int64, opts s3client.UploadOptions) (s3client.UploadInfo, error) {
+	b.attempts++
+	if b.attempts == 1 {
+		_, _ = io.ReadFull(reader, make([]byte, 2))
+		return s3client.UploadInfo{}, errors.New("connection reset by peer")
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return s3client.UploadInfo{}, err
+	}
+	b.body, b.opts = body, opts
+	return s3client.UploadInfo{Key: "photos/" + key, Size: int64(len(body))}, nil
+}
+
+func TestPut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test-photo")
+	require.NoError(t, os.WriteFile(path, []byte("\xff\xd8\xff\xe0 not really a jpeg"), 0600))
+
+	retry := uploader.DefaultRetryConfig()
+	retry.InitialBackoff = time.Millisecond
+	bucket := &putBucket{}
+	info, err := Put(context.Background(), bucket, PutOptions{
+		Path:     path,
+		Key:      "test/photo.jpg",
+		Metadata: map[string]string{"Source": "put"},
+		Retry:    retry,
+	})
+	require.NoError(t, err)
+
+	// The retry sends the whole file again, with the type sniffed from its content
+	assert.Equal(t, 2, bucket.attempts)
+	assert.Equal(t, "photos/test/photo.jpg", info.Key)
+	assert.Equal(t, "\xff\xd8\xff\xe0 not really a jpeg", string(bucket.body))
+	assert.Equal(t, "image/jpeg", bucket.opts.ContentType)
+	assert.Equal(t, "put", bucket.opts.Metadata["Source"])
+
+	// An explicit content type is used as is
+	bucket = &putBucket{attempts: 1}
+	_, err = Put(context.Background(), bucket, PutOptions{Path: path, Key: "a", ContentType: "text/plain", Retry: retry})
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", bucket.opts.ContentType)
+
+	_, err = Put(context.Background(), bucket, PutOptions{Path: filepath.Dir(path), Key: "a"})
+	assert.ErrorContains(t, err, "not a regular file")
+}
@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/config"
+	"github.com/bstardust/google-takeout-s3-importer/internal/fshelper"
+	"github.com/bstardust/google-takeout-s3-importer/internal/transcode"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+	"github.com/bstardust/google-takeout-s3-importer/pkg/s3client"
+)
+
+// requiredSetting pairs a flag name with the value it resolved to
+type requiredSetting struct {
+	flag  string
+	value string
+}
+
+// ValidateS3Config checks that the required S3 settings were supplied by a
+// flag, the environment or the config file
+func ValidateS3Config(cfg *Config) error {
+	if err := s3client.ValidateBackend(cfg.S3.Backend); err != nil {
+		return fmt.Errorf("invalid --backend: %w", err)
+	}
+	isB2 := cfg.S3.Backend == s3client.BackendB2
+
+	required := []requiredSetting{{"bucket", cfg.S3.Bucket}}
+
+	// B2 accounts are authorized with a well-known host
+	if !isB2 {
+		required = append(required, requiredSetting{"endpoint", cfg.S3.Endpoint})
+	}
+
+	// Keys aren't needed when credentials come from a profile or the instance
+	// role, which B2 doesn't have
+	if isB2 || (cfg.S3.Profile == "" && !cfg.S3.UseInstanceRole) {
+		required = append(required,
+			requiredSetting{"access-key", cfg.S3.AccessKey},
+			requiredSetting{"secret-key", cfg.S3.SecretKey},
+		)
+	}
+
+	var missing []string
+	for _, r := range required {
+		if r.value == "" {
+			missing = append(missing, fmt.Sprintf("--%s (or %s)", r.flag, config.EnvName(r.flag)))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+	}
+
+	if err := s3client.ValidateACL(cfg.S3.ACL); err != nil {
+		return fmt.Errorf("invalid --acl: %w", err)
+	}
+	return nil
+}
+
+// NewS3Config builds the S3 client configuration from the application config
+func NewS3Config(cfg *Config) s3client.Config {
+	return s3client.Config{
+		Endpoint:         cfg.S3.Endpoint,
+		Region:           cfg.S3.Region,
+		Bucket:           cfg.S3.Bucket,
+		AccessKey:        cfg.S3.AccessKey,
+		SecretKey:        cfg.S3.SecretKey,
+		SessionToken:     cfg.S3.SessionToken,
+		Profile:          cfg.S3.Profile,
+		UseInstanceRole:  cfg.S3.UseInstanceRole,
+		UseSSL:           cfg.S3.UseSSL,
+		Prefix:           cfg.S3.Prefix,
+		DisableChecksums: cfg.S3.DisableChecksums,
+		PathStyle:        cfg.S3.PathStyle,
+
+		MultipartThreshold: cfg.S3.MultipartThreshold,
+		PartSize:           cfg.S3.PartSize,
+		PartConcurrency:    cfg.S3.PartConcurrency,
+		ACL:                cfg.S3.ACL,
+		CreateBucket:       cfg.S3.CreateBucket,
+		Backend:            cfg.S3.Backend,
+		CACert:             cfg.S3.CACert,
+		TLSSkipVerify:      cfg.S3.TLSSkipVerify,
+		MaxIdleConns:       cfg.S3.MaxIdleConns,
+		MaxConnsPerHost:    cfg.S3.MaxConnsPerHost,
+		Concurrency:        cfg.Upload.Concurrency,
+	}
+}
+
+// ValidateSourceType checks that --source-type names a known source and
+// --key-encoding a known encoding
+func ValidateSourceType(cfg *Config) error {
+	switch cfg.Upload.SourceType {
+	case config.SourceTypeTakeout, config.SourceTypeGeneric:
+	default:
+		return fmt.Errorf("invalid --source-type %q (expected %s or %s)",
+			cfg.Upload.SourceType, config.SourceTypeTakeout, config.SourceTypeGeneric)
+	}
+
+	if cfg.Upload.KeyEncoding != "" {
+		if _, err := fshelper.LookupEncoding(cfg.Upload.KeyEncoding); err != nil {
+			return fmt.Errorf("invalid --key-encoding: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidateTranscodeHEIC checks that --transcode-heic names a known mode and
+// that this build can decode HEIC photos
+func ValidateTranscodeHEIC(cfg *Config) error {
+	switch cfg.Upload.TranscodeHEIC {
+	case "":
+		return nil
+	case config.TranscodeHEICAlongside, config.TranscodeHEICReplace:
+	default:
+		return fmt.Errorf("invalid --transcode-heic %q (expected %s or %s)",
+			cfg.Upload.TranscodeHEIC, config.TranscodeHEICAlongside, config.TranscodeHEICReplace)
+	}
+
+	if !transcode.Available() {
+		return fmt.Errorf("--transcode-heic: %w", transcode.ErrUnavailable)
+	}
+	return nil
+}
+
+// ParseKeyTemplate parses --key-template, returning nil if it isn't set. It
+// also checks --flatten, which builds keys instead of a template, and
+// --sanitize-keys.
+func ParseKeyTemplate(cfg *Config) (*KeyTemplate, error) {
+	switch cfg.Upload.Flatten {
+	case "", config.FlattenTakeout, config.FlattenAlbum:
+	default:
+		return nil, fmt.Errorf("invalid --flatten %q (expected %s or %s)",
+			cfg.Upload.Flatten, config.FlattenTakeout, config.FlattenAlbum)
+	}
+
+	switch cfg.Upload.SanitizeKeys {
+	case "", config.SanitizeKeysPassthrough, config.SanitizeKeysPercentEncode, config.SanitizeKeysReplace:
+	default:
+		return nil, fmt.Errorf("invalid --sanitize-keys %q (expected %s, %s or %s)", cfg.Upload.SanitizeKeys,
+			config.SanitizeKeysPassthrough, config.SanitizeKeysPercentEncode, config.SanitizeKeysReplace)
+	}
+
+	if cfg.Upload.KeyTemplate == "" {
+		return nil, nil
+	}
+	if cfg.Upload.Flatten != "" {
+		return nil, fmt.Errorf("--flatten and --key-template can't be combined, use {{.Album}}/{{.Filename}} in the template instead")
+	}
+	if cfg.Upload.PrefixDate {
+		return nil, fmt.Errorf("--prefix-date and --key-template can't be combined, use {{.Year}}/{{.Month}} in the template instead")
+	}
+	return uploader.ParseKeyTemplate(cfg.Upload.KeyTemplate)
+}
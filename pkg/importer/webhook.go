@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/bstardust/google-takeout-s3-importer/internal/uploader"
+)
+
+// Statuses of a run reported to the webhook
+const (
+	WebhookSucceeded   = "succeeded"
+	WebhookFailed      = "failed"
+	WebhookInterrupted = "interrupted"
+)
+
+// webhookTimeout limits each attempt to deliver the summary
+const webhookTimeout = 30 * time.Second
+
+// webhookInterruptedTimeout limits the time spent delivering the summary of
+// an interrupted run, so Ctrl-C doesn't wait out every retry
+var webhookInterruptedTimeout = 10 * time.Second
+
+// WebhookPayload is the JSON summary posted to --webhook-url when a run
+// finishes
+type WebhookPayload struct {
+	Status   string  `json:"status"`
+	DryRun   bool    `json:"dry_run"`
+	Totals   Totals  `json:"totals"`
+	Duration float64 `json:"duration_seconds"`
+
+	// Errors holds the error of the run and of each archive that failed
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NewWebhookPayload summarizes a run from its result and error, either of
+// which may be nil
+func NewWebhookPayload(cfg *Config, result *Result, err error, duration time.Duration) WebhookPayload {
+	payload := WebhookPayload{
+		Status:   WebhookSucceeded,
+		DryRun:   cfg.Upload.DryRun,
+		Duration: duration.Seconds(),
+	}
+
+	if err != nil {
+		payload.Errors = append(payload.Errors, err.Error())
+	}
+	if result != nil {
+		payload.Totals = result.Totals
+		for _, archiveErr := range result.Errors() {
+			payload.Errors = append(payload.Errors, archiveErr.Error())
+		}
+	}
+
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)):
+		payload.Status = WebhookInterrupted
+	case len(payload.Errors) > 0:
+		payload.Status = WebhookFailed
+	}
+	return payload
+}
+
+// validateWebhook checks the --webhook-url and --webhook-on-error settings
+func validateWebhook(cfg *Config) error {
+	if cfg.Upload.WebhookURL == "" {
+		if cfg.Upload.WebhookOnError {
+			return fmt.Errorf("--webhook-on-error needs --webhook-url")
+		}
+		return nil
+	}
+
+	u, err := url.Parse(cfg.Upload.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --webhook-url %q (expected an http or https URL)", cfg.Upload.WebhookURL)
+	}
+	return nil
+}
+
+// notifyWebhook posts the summary of a run to the webhook, unless only
+// failures are reported and the run succeeded. Failing to deliver it is
+// logged without failing the run.
+func notifyWebhook(ctx context.Context, cfg *Config, payload WebhookPayload) {
+	if cfg.Upload.WebhookURL == "" || (cfg.Upload.WebhookOnError && payload.Status == WebhookSucceeded) {
+		return
+	}
+
+	// The run may have been interrupted, which is worth reporting too, but
+	// only briefly
+	ctx = context.WithoutCancel(ctx)
+	if payload.Status == WebhookInterrupted {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, webhookInterruptedTimeout)
+		defer cancel()
+	}
+	if err := postWebhook(ctx, cfg, payload); err != nil {
+		logger.Error("Failed to notify webhook: %v", err)
+		return
+	}
+	logger.Info("Notified webhook of the %s run", payload.Status)
+}
+
+// postWebhook posts the payload, retrying with backoff on connection
+// failures, server errors and rate limiting
+func postWebhook(ctx context.Context, cfg *Config, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	// Whether a failure is worth retrying depends on the response
+	var retryable bool
+	retry := retryConfig(cfg)
+	retry.Retryable = func(error) bool { return retryable }
+
+	client := &http.Client{Timeout: webhookTimeout}
+	return uploader.RetryWithBackoff(ctx, "webhook notification", func() error {
+		var err error
+		retryable, err = sendWebhook(ctx, client, cfg.Upload.WebhookURL, body)
+		return err
+	}, retry)
+}
+
+// sendWebhook makes one attempt to post the payload, reporting whether a
+// failure is worth retrying
+func sendWebhook(ctx context.Context, client *http.Client, webhookURL string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "s3-takeout-upload")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("webhook returned %s", resp.Status)
+}
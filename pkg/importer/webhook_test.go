@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebhookPayload(t *testing.T) {
+	cfg := testConfig()
+	result := &Result{
+		Totals: Totals{Archives: 2, TotalFiles: 10, UploadedFiles: 9, FailedFiles: 1},
+		Archives: []ArchiveResult{
+			{Name: "takeout-001.zip"},
+			{Name: "takeout-002.zip", Err: errors.New("upload failed for takeout-002.zip")},
+		},
+	}
+
+	payload := NewWebhookPayload(cfg, result, nil, 90*time.Second)
+	assert.Equal(t, WebhookFailed, payload.Status)
+	assert.Equal(t, result.Totals, payload.Totals)
+	assert.Equal(t, 90.0, payload.Duration)
+	assert.Equal(t, []string{"upload failed for takeout-002.zip"}, payload.Errors)
+
+	result.Archives = result.Archives[:1]
+	assert.Equal(t, WebhookSucceeded, NewWebhookPayload(cfg, result, nil, time.Second).Status)
+
+	payload = NewWebhookPayload(cfg, result, context.Canceled, time.Second)
+	assert.Equal(t, WebhookInterrupted, payload.Status)
+	assert.Equal(t, []string{"context canceled"}, payload.Errors)
+
+	// Runs that fail before any archive has no totals
+	payload = NewWebhookPayload(cfg, nil, errors.New("bucket not found"), time.Second)
+	assert.Equal(t, WebhookFailed, payload.Status)
+	assert.Equal(t, Totals{}, payload.Totals)
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]any
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// The first attempt fails and is retried
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received = append(received, body)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Upload.WebhookURL = server.URL
+	cfg.Upload.InitialBackoff = time.Millisecond
+	cfg.Upload.MaxBackoff = time.Millisecond
+
+	succeeded := NewWebhookPayload(cfg, &Result{Totals: Totals{Archives: 1, UploadedFiles: 3, UploadedBytes: 2048}}, nil, time.Minute)
+	notifyWebhook(context.Background(), cfg, succeeded)
+	require.Len(t, received, 1)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, "succeeded", received[0]["status"])
+	assert.Equal(t, 60.0, received[0]["duration_seconds"])
+	assert.Equal(t, map[string]any{
+		"archives": 1.0, "total_files": 0.0, "uploaded_files": 3.0, "skipped_files": 0.0, "failed_files": 0.0,
+		"filtered_files": 0.0, "total_bytes": 0.0, "uploaded_bytes": 2048.0, "corrupt_files": 0.0,
+		"duplicate_files": 0.0, "duplicate_bytes": 0.0,
+	}, received[0]["totals"])
+
+	// Only failures are reported with --webhook-on-error
+	cfg.Upload.WebhookOnError = true
+	notifyWebhook(context.Background(), cfg, succeeded)
+	assert.Len(t, received, 1)
+	notifyWebhook(context.Background(), cfg, NewWebhookPayload(cfg, nil, errors.New("bucket not found"), time.Second))
+	require.Len(t, received, 2)
+	assert.Equal(t, []any{"bucket not found"}, received[1]["errors"])
+}
+
+func TestPostWebhook_ClientError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// Requests the server rejects aren't retried
+	cfg := testConfig()
+	cfg.Upload.WebhookURL = server.URL
+	err := postWebhook(context.Background(), cfg, WebhookPayload{Status: WebhookSucceeded})
+	assert.ErrorContains(t, err, "404")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestNotifyWebhook_InterruptedGivesUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	defer func(timeout time.Duration) { webhookInterruptedTimeout = timeout }(webhookInterruptedTimeout)
+	webhookInterruptedTimeout = 100 * time.Millisecond
+
+	// The summary of an interrupted run isn't retried for the full budget
+	cfg := testConfig()
+	cfg.Upload.WebhookURL = server.URL
+	cfg.Upload.InitialBackoff = time.Minute
+	cfg.Upload.MaxBackoff = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	notifyWebhook(ctx, cfg, NewWebhookPayload(cfg, nil, context.Canceled, time.Second))
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
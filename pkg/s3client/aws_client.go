@@ -5,12 +5,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"path/filepath"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -28,14 +29,8 @@ type AWSClient struct {
 // NewAWS creates a new AWS S3 client
 func NewAWS(ctx context.Context, cfg Config) (S3Interface, error) {
 	// Validate configuration
-	if cfg.Endpoint == "" {
-		return nil, fmt.Errorf("S3 endpoint is required")
-	}
-	if cfg.Bucket == "" {
-		return nil, fmt.Errorf("S3 bucket name is required")
-	}
-	if cfg.AccessKey == "" || cfg.SecretKey == "" {
-		return nil, fmt.Errorf("S3 access key and secret key are required")
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
 	// Ensure endpoint has proper format
@@ -50,14 +45,19 @@ func NewAWS(ctx context.Context, cfg Config) (S3Interface, error) {
 
 	// Initialize AWS session
 	s3Config := &aws.Config{
-		Credentials:      credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, ""),
 		Endpoint:         aws.String(endpoint),
 		Region:           aws.String(cfg.Region),
-		S3ForcePathStyle: aws.Bool(true),
+		S3ForcePathStyle: aws.Bool(cfg.PathStyle),
 		DisableSSL:       aws.Bool(!cfg.UseSSL),
 	}
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = recordRetryAfter(httpClient.Transport)
+	s3Config.HTTPClient = httpClient
 
-	newSession, err := session.NewSession(s3Config)
+	newSession, err := newAWSSession(s3Config, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS session: %w", err)
 	}
@@ -66,98 +66,306 @@ func NewAWS(ctx context.Context, cfg Config) (S3Interface, error) {
 	client := s3.New(newSession)
 
 	// Validate bucket exists
-	_, err = client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(cfg.Bucket),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to check if bucket exists: %w", err)
+	c := &AWSClient{client: client, config: cfg}
+	if err := c.ensureBucket(ctx); err != nil {
+		return nil, err
 	}
 
 	logger.Info("Successfully connected to S3 endpoint %s, bucket %s using AWS SDK", endpoint, cfg.Bucket)
 
 	// Create S3 client with custom part size configuration
 	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
-		// Set minimum part size to 5MB (B2 requirement)
-		u.PartSize = 5 * 1024 * 1024
-		// Set concurrency to match our app's concurrency
-		u.Concurrency = 4
+		// Validated to be at least 5MB (B2 requirement)
+		u.PartSize = cfg.partSize()
+		u.Concurrency = cfg.partConcurrency()
 		// Disable automatic content-type detection which can cause issues
 		u.LeavePartsOnError = false
 	})
 
-	return &AWSClient{
-		client:   client,
-		uploader: uploader,
-		config:   cfg,
-	}, nil
+	c.uploader = uploader
+	return c, nil
+}
+
+// ensureBucket checks that the bucket exists, creating it in the configured
+// region if it doesn't and CreateBucket is set
+func (c *AWSClient) ensureBucket(ctx context.Context) error {
+	_, err := c.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(c.config.Bucket),
+	})
+	if err == nil {
+		return nil
+	}
+	if !c.config.CreateBucket || !isAWSNotFound(err) {
+		return fmt.Errorf("failed to check if bucket exists: %w", addressingStyleError(err, c.config))
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(c.config.Bucket)}
+	// us-east-1 is the default and is rejected as a location constraint
+	if c.config.Region != "" && c.config.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(c.config.Region),
+		}
+	}
+
+	_, err = c.client.CreateBucketWithContext(ctx, input)
+	if err != nil && !isBucketOwned(err) {
+		return fmt.Errorf("failed to create bucket %s: %w", c.config.Bucket, err)
+	}
+
+	logBucketCreated(c.config, err)
+	return nil
+}
+
+// newAWSSession creates a session using the instance role, a named profile
+// from the shared credentials file, or the static keys, in that order
+func newAWSSession(s3Config *aws.Config, cfg Config) (*session.Session, error) {
+	switch {
+	case cfg.UseInstanceRole:
+		// The role provider needs a session of its own to reach the metadata service
+		metadataSession, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		s3Config.Credentials = ec2rolecreds.NewCredentials(metadataSession)
+		logger.Debug("Using EC2 instance role credentials")
+	case cfg.Profile != "":
+		logger.Debug("Using credentials from profile %s", cfg.Profile)
+		return session.NewSessionWithOptions(session.Options{
+			Config:            *s3Config,
+			Profile:           cfg.Profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	default:
+		s3Config.Credentials = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken)
+	}
+
+	return session.NewSession(s3Config)
 }
 
 // UploadFile uploads a file to S3
-func (c *AWSClient) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, metadata map[string]string, contentType string) error {
+func (c *AWSClient) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions) (UploadInfo, error) {
 	// Ensure the object key has the prefix
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	// Set default content type if not provided
+	contentType := opts.ContentType
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
-	// Convert metadata map to AWS format
-	awsMetadata := make(map[string]*string)
-	for k, v := range metadata {
-		value := v
-		awsMetadata[k] = &value
-	}
+	awsMetadata := awsMetadata(opts.Metadata)
+	tagging := awsTagging(opts.Tags)
+	acl := c.acl()
+	contentEncoding := awsHeader(opts.ContentEncoding)
+	contentDisposition := awsHeader(opts.ContentDisposition)
 
-	// For small files (less than 10MB), use PutObject instead of multipart upload
+	var etag, sse string
+
+	// For small files, use PutObject instead of multipart upload
 	// to avoid the "request body too small" error with B2
-	if size < 10*1024*1024 {
-		// Buffer the file in memory - safe for small files
-		buf := &bytes.Buffer{}
-		if _, err := io.Copy(buf, reader); err != nil {
-			return fmt.Errorf("failed to buffer file: %w", err)
+	if size < c.config.multipartThreshold() {
+		// Use the reader directly if it can seek, otherwise buffer it in a pooled buffer
+		body, release, err := seekableBody(ctx, uploadBuffers, reader, size)
+		if err != nil {
+			return UploadInfo{}, fmt.Errorf("failed to buffer file: %w", err)
 		}
-
-		_, err := c.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
-			Bucket:      aws.String(c.config.Bucket),
-			Key:         aws.String(objectKey),
-			Body:        bytes.NewReader(buf.Bytes()),
-			ContentType: aws.String(contentType),
-			Metadata:    awsMetadata,
+		defer release()
+
+		output, err := c.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:             aws.String(c.config.Bucket),
+			Key:                aws.String(objectKey),
+			Body:               body,
+			ContentType:        aws.String(contentType),
+			ContentEncoding:    contentEncoding,
+			ContentDisposition: contentDisposition,
+			Metadata:           awsMetadata,
+			Tagging:            tagging,
+			ACL:                acl,
 		})
 
 		if err != nil {
-			return fmt.Errorf("failed to upload file: %w", err)
+			return UploadInfo{}, fmt.Errorf("failed to upload file: %w", hint.wrap(err))
 		}
+		etag = aws.StringValue(output.ETag)
+		sse = serverSideEncryption(aws.StringValue(output.ServerSideEncryption), aws.StringValue(output.SSECustomerAlgorithm))
 	} else {
-		// For larger files, use multipart upload with adjusted settings
-		uploader := s3manager.NewUploaderWithClient(c.client, func(u *s3manager.Uploader) {
-			// Backblaze B2 requires at least 5MB parts
-			u.PartSize = 10 * 1024 * 1024 // Use 10MB to be safe
-			u.Concurrency = 4
-			u.LeavePartsOnError = false
-		})
-
-		_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-			Bucket:      aws.String(c.config.Bucket),
-			Key:         aws.String(objectKey),
-			Body:        reader,
-			ContentType: aws.String(contentType),
-			Metadata:    awsMetadata,
+		// For larger files, use multipart upload with the configured part size.
+		// Files of fewer parts than the concurrency don't start idle workers.
+		concurrency := c.fileConcurrency(size)
+		output, err := c.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket:             aws.String(c.config.Bucket),
+			Key:                aws.String(objectKey),
+			Body:               reader,
+			ContentType:        aws.String(contentType),
+			ContentEncoding:    contentEncoding,
+			ContentDisposition: contentDisposition,
+			Metadata:           awsMetadata,
+			Tagging:            tagging,
+			ACL:                acl,
+		}, func(u *s3manager.Uploader) {
+			u.Concurrency = concurrency
 		})
 
 		if err != nil {
-			return fmt.Errorf("failed to upload file: %w", err)
+			return UploadInfo{}, fmt.Errorf("failed to upload file: %w", hint.wrap(err))
 		}
+		etag = aws.StringValue(output.ETag)
+	}
+
+	logger.Debug("Uploaded file to %s (%d bytes, etag: %s)", objectKey, size, etag)
+	return UploadInfo{Key: objectKey, ETag: etag, Size: size, ServerSideEncryption: sse}, nil
+}
+
+// fileConcurrency returns the number of parts of a file of size bytes to
+// upload at a time: the configured concurrency, or the number of parts if
+// there are fewer
+func (c *AWSClient) fileConcurrency(size int64) int {
+	parts := (size + c.config.partSize() - 1) / c.config.partSize()
+	return int(max(min(int64(c.config.partConcurrency()), parts), 1))
+}
+
+// awsMetadata converts user metadata to the map of pointers the SDK expects
+func awsMetadata(metadata map[string]string) map[string]*string {
+	converted := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		converted[k] = aws.String(v)
+	}
+	return converted
+}
+
+// awsTagging encodes tags for the x-amz-tagging header, returning nil if there are none
+func awsTagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
 	}
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return aws.String(values.Encode())
+}
+
+// awsHeader returns an optional header to send, or nil to send none
+func awsHeader(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
 
-	logger.Debug("Uploaded file to %s (%d bytes)", objectKey, size)
+// acl returns the canned ACL to send with uploads, or nil to send none
+func (c *AWSClient) acl() *string {
+	if objectACL := c.config.objectACL(); objectACL != "" {
+		return aws.String(objectACL)
+	}
 	return nil
 }
 
+// ResumeState checks a saved multipart upload against the parts the server has
+func (c *AWSClient) ResumeState(ctx context.Context, objectKey string, size int64, state MultipartState) (MultipartState, error) {
+	return resumeState(ctx, c, c.config, c.getObjectKey(objectKey), size, state)
+}
+
+// UploadResumable uploads a file in parts that a later run can continue
+func (c *AWSClient) UploadResumable(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions,
+	state MultipartState, save func(MultipartState)) (UploadInfo, error) {
+	if size < c.config.multipartThreshold() {
+		return c.UploadFile(ctx, reader, objectKey, size, opts)
+	}
+	return uploadResumable(ctx, c, c.config, reader, c.getObjectKey(objectKey), size, opts, state, save)
+}
+
+// createMultipart starts a multipart upload with the attributes of the object
+func (c *AWSClient) createMultipart(ctx context.Context, key string, opts UploadOptions) (string, error) {
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	output, err := c.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(c.config.Bucket),
+		Key:                aws.String(key),
+		ContentType:        aws.String(contentType),
+		ContentEncoding:    awsHeader(opts.ContentEncoding),
+		ContentDisposition: awsHeader(opts.ContentDisposition),
+		Metadata:           awsMetadata(opts.Metadata),
+		Tagging:            awsTagging(opts.Tags),
+		ACL:                c.acl(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.UploadId), nil
+}
+
+// uploadPart uploads one part of a multipart upload, returning its ETag
+func (c *AWSClient) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	output, err := c.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(c.config.Bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(int64(number)),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.ETag), nil
+}
+
+// listParts lists the parts the server has of a multipart upload
+func (c *AWSClient) listParts(ctx context.Context, key, uploadID string) ([]CompletedPart, error) {
+	var parts []CompletedPart
+	err := c.client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(c.config.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, CompletedPart{
+				Number: int(aws.Int64Value(part.PartNumber)),
+				ETag:   aws.StringValue(part.ETag),
+				Size:   aws.Int64Value(part.Size),
+			})
+		}
+		return true
+	})
+	return parts, err
+}
+
+// completeMultipart assembles the parts of a multipart upload into the object
+func (c *AWSClient) completeMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) (string, error) {
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.Number)),
+		}
+	}
+
+	output, err := c.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(c.config.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.ETag), nil
+}
+
+// abortMultipart aborts a multipart upload, deleting its parts
+func (c *AWSClient) abortMultipart(ctx context.Context, key, uploadID string) error {
+	return c.AbortIncompleteUpload(ctx, IncompleteUpload{Key: key, UploadID: uploadID})
+}
+
 // ObjectExists checks if an object exists in the bucket
 func (c *AWSClient) ObjectExists(ctx context.Context, objectKey string) (bool, error) {
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	_, err := c.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(c.config.Bucket),
@@ -165,20 +373,54 @@ func (c *AWSClient) ObjectExists(ctx context.Context, objectKey string) (bool, e
 	})
 
 	if err != nil {
-		if strings.Contains(err.Error(), "NotFound") {
+		if isAWSNotFound(err) {
 			return false, nil
 		}
-		return false, fmt.Errorf("failed to check if object exists: %w", err)
+		return false, fmt.Errorf("failed to check if object exists: %w", hint.wrap(err))
 	}
 
 	return true, nil
 }
 
+// StatObject returns the attributes of an object without downloading it
+func (c *AWSClient) StatObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
+
+	output, err := c.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		if isAWSNotFound(err) {
+			return ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to stat object: %w", hint.wrap(err))
+	}
+
+	sse := serverSideEncryption(aws.StringValue(output.ServerSideEncryption), aws.StringValue(output.SSECustomerAlgorithm))
+	return ObjectInfo{
+		Key:                  objectKey,
+		Size:                 aws.Int64Value(output.ContentLength),
+		ETag:                 aws.StringValue(output.ETag),
+		ContentType:          aws.StringValue(output.ContentType),
+		LastModified:         aws.TimeValue(output.LastModified),
+		Metadata:             userMetadata(awsUserMetadata(output.Metadata)),
+		ServerSideEncryption: sse,
+	}, nil
+}
+
 // ListObjects lists objects in the bucket with the given prefix
 func (c *AWSClient) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	return collectObjects(ctx, c, prefix)
+}
+
+// WalkObjects calls fn for each object in the bucket with the given prefix,
+// until it returns false
+func (c *AWSClient) WalkObjects(ctx context.Context, prefix string, fn func(object minio.ObjectInfo) bool) error {
 	prefix = c.getObjectKey(prefix)
+	ctx, hint := withRetryAfter(ctx)
 
-	var objects []minio.ObjectInfo
 	var continuationToken *string
 
 	for {
@@ -190,42 +432,66 @@ func (c *AWSClient) ListObjects(ctx context.Context, prefix string) ([]minio.Obj
 
 		result, err := c.client.ListObjectsV2WithContext(ctx, input)
 		if err != nil {
-			return nil, fmt.Errorf("error listing objects: %w", err)
+			return fmt.Errorf("error listing objects: %w", hint.wrap(err))
 		}
 
 		// Convert AWS objects to MinIO objects for compatibility
 		for _, item := range result.Contents {
-			objects = append(objects, minio.ObjectInfo{
+			if !fn(minio.ObjectInfo{
 				Key:          *item.Key,
 				Size:         *item.Size,
 				LastModified: *item.LastModified,
 				ETag:         *item.ETag,
-			})
+			}) {
+				return nil
+			}
 		}
 
 		if !*result.IsTruncated {
-			break
+			return nil
 		}
 
 		continuationToken = result.NextContinuationToken
 	}
+}
+
+// GetObject retrieves an object from the bucket. The caller must close the
+// returned reader.
+func (c *AWSClient) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error) {
+	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
+
+	output, err := c.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get object: %w", hint.wrap(err))
+	}
 
-	return objects, nil
+	return output.Body, ObjectInfo{
+		Key:          objectKey,
+		Size:         aws.Int64Value(output.ContentLength),
+		ETag:         aws.StringValue(output.ETag),
+		ContentType:  aws.StringValue(output.ContentType),
+		LastModified: aws.TimeValue(output.LastModified),
+		Metadata:     userMetadata(awsUserMetadata(output.Metadata)),
+	}, nil
 }
 
-// GetObject retrieves an object from the bucket
-// Note: This returns a MinIO Object for interface compatibility
-// but internally uses AWS SDK to get the data
-func (c *AWSClient) GetObject(ctx context.Context, objectKey string) (*minio.Object, error) {
-	// This method requires returning a MinIO object
-	// For compatibility, we'll convert AWS SDK response into a MinIO object
-	// This is not ideal but necessary for interface compatibility
-	return nil, fmt.Errorf("GetObject not implemented for AWS SDK client - use direct AWS SDK operations instead")
+// awsUserMetadata converts the user metadata of an AWS response to plain strings
+func awsUserMetadata(metadata map[string]*string) map[string]string {
+	converted := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		converted[k] = aws.StringValue(v)
+	}
+	return converted
 }
 
 // DeleteObject deletes an object from the bucket
 func (c *AWSClient) DeleteObject(ctx context.Context, objectKey string) error {
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	_, err := c.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(c.config.Bucket),
@@ -233,13 +499,77 @@ func (c *AWSClient) DeleteObject(ctx context.Context, objectKey string) error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to delete object: %w", err)
+		return fmt.Errorf("failed to delete object: %w", hint.wrap(err))
 	}
 
 	logger.Debug("Deleted object %s", objectKey)
 	return nil
 }
 
+// ListIncompleteUploads lists the multipart uploads under the prefix that were
+// never completed, with the size of the parts uploaded so far
+func (c *AWSClient) ListIncompleteUploads(ctx context.Context, prefix string) ([]IncompleteUpload, error) {
+	prefix = c.getObjectKey(prefix)
+
+	// Stay inside the configured prefix instead of matching keys that merely start with it
+	if prefix != "" && prefix == strings.TrimSuffix(c.config.Prefix, "/") {
+		prefix += "/"
+	}
+
+	var uploads []IncompleteUpload
+	err := c.client.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(c.config.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, item := range page.Uploads {
+			uploads = append(uploads, IncompleteUpload{
+				Key:       aws.StringValue(item.Key),
+				UploadID:  aws.StringValue(item.UploadId),
+				Initiated: aws.TimeValue(item.Initiated),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing incomplete uploads: %w", err)
+	}
+
+	// The listing doesn't include sizes, so add up the parts
+	for i := range uploads {
+		upload := &uploads[i]
+		err := c.client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+			Bucket:   aws.String(c.config.Bucket),
+			Key:      aws.String(upload.Key),
+			UploadId: aws.String(upload.UploadID),
+		}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+			for _, part := range page.Parts {
+				upload.Size += aws.Int64Value(part.Size)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing parts of %s: %w", upload.Key, err)
+		}
+	}
+
+	return uploads, nil
+}
+
+// AbortIncompleteUpload aborts a multipart upload, deleting its parts
+func (c *AWSClient) AbortIncompleteUpload(ctx context.Context, upload IncompleteUpload) error {
+	_, err := c.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(c.config.Bucket),
+		Key:      aws.String(upload.Key),
+		UploadId: aws.String(upload.UploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort upload of %s: %w", upload.Key, err)
+	}
+
+	logger.Debug("Aborted incomplete upload %s of %s", upload.UploadID, upload.Key)
+	return nil
+}
+
 // GetPresignedURL generates a presigned URL for an object
 func (c *AWSClient) GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
 	objectKey = c.getObjectKey(objectKey)
@@ -259,17 +589,7 @@ func (c *AWSClient) GetPresignedURL(ctx context.Context, objectKey string, expir
 
 // getObjectKey returns the full object key with prefix
 func (c *AWSClient) getObjectKey(key string) string {
-	if c.config.Prefix == "" {
-		return key
-	}
-
-	// Ensure prefix doesn't have trailing slash
-	prefix := strings.TrimSuffix(c.config.Prefix, "/")
-
-	// Ensure key doesn't have leading slash
-	key = strings.TrimPrefix(key, "/")
-
-	return filepath.Join(prefix, key)
+	return joinKey(c.config.Prefix, key)
 }
 
 // GetBucketName returns the bucket name
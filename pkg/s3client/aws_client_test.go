@@ -0,0 +1,307 @@
+package s3client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAWSClient returns a client whose requests are answered by respond
+// instead of going over the network
+func newTestAWSClient(t *testing.T, respond func(r *request.Request) (int, string)) *AWSClient {
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String("http://localhost"),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		MaxRetries:       aws.Int(0),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	require.NoError(t, err)
+
+	client := s3.New(sess)
+	client.Handlers.Send.Clear()
+	client.Handlers.Send.PushBack(func(r *request.Request) {
+		status, body := respond(r)
+		r.HTTPResponse = &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}
+	})
+
+	return &AWSClient{client: client, config: Config{Bucket: "test-bucket", Prefix: "photos"}}
+}
+
+func TestAWSClient_IncompleteUploads(t *testing.T) {
+	var aborted []string
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		switch r.Operation.Name {
+		case "ListMultipartUploads":
+			assert.Equal(t, "photos/", aws.StringValue(r.Params.(*s3.ListMultipartUploadsInput).Prefix))
+			return http.StatusOK, `<ListMultipartUploadsResult>
+  <Bucket>test-bucket</Bucket>
+  <IsTruncated>false</IsTruncated>
+  <Upload>
+    <Key>photos/video.mp4</Key>
+    <UploadId>upload-1</UploadId>
+    <Initiated>2024-01-02T03:04:05.000Z</Initiated>
+  </Upload>
+</ListMultipartUploadsResult>`
+		case "ListParts":
+			return http.StatusOK, `<ListPartsResult>
+  <IsTruncated>false</IsTruncated>
+  <Part><PartNumber>1</PartNumber><Size>10485760</Size></Part>
+  <Part><PartNumber>2</PartNumber><Size>5242880</Size></Part>
+</ListPartsResult>`
+		case "AbortMultipartUpload":
+			input := r.Params.(*s3.AbortMultipartUploadInput)
+			aborted = append(aborted, aws.StringValue(input.Key)+"#"+aws.StringValue(input.UploadId))
+			return http.StatusNoContent, ""
+		}
+		t.Fatalf("unexpected operation %s", r.Operation.Name)
+		return 0, ""
+	})
+
+	ctx := context.Background()
+	uploads, err := c.ListIncompleteUploads(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+
+	assert.Equal(t, "photos/video.mp4", uploads[0].Key)
+	assert.Equal(t, "upload-1", uploads[0].UploadID)
+	assert.Equal(t, int64(15*1024*1024), uploads[0].Size)
+	assert.True(t, uploads[0].Initiated.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	require.NoError(t, c.AbortIncompleteUpload(ctx, uploads[0]))
+	assert.Equal(t, []string{"photos/video.mp4#upload-1"}, aborted)
+}
+
+func TestAWSClient_UploadFile_MultipartThreshold(t *testing.T) {
+	var operations []string
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		operations = append(operations, r.Operation.Name)
+		switch r.Operation.Name {
+		case "CreateMultipartUpload":
+			return http.StatusOK, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`
+		case "CompleteMultipartUpload":
+			return http.StatusOK, `<CompleteMultipartUploadResult><ETag>"abc-1"</ETag></CompleteMultipartUploadResult>`
+		default:
+			return http.StatusOK, ""
+		}
+	})
+	c.config.MultipartThreshold = 1024
+	c.config.PartSize = MinPartSize
+	c.config.PartConcurrency = 1
+	c.uploader = s3manager.NewUploaderWithClient(c.client, func(u *s3manager.Uploader) {
+		u.PartSize = MinPartSize
+		u.Concurrency = 1
+	})
+
+	ctx := context.Background()
+	_, err := c.UploadFile(ctx, strings.NewReader("small"), "small.jpg", 5, UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PutObject"}, operations)
+
+	operations = nil
+	data := strings.Repeat("x", MinPartSize+1)
+	_, err = c.UploadFile(ctx, strings.NewReader(data), "large.mp4", int64(len(data)), UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CreateMultipartUpload", "UploadPart", "UploadPart", "CompleteMultipartUpload"}, operations)
+}
+
+func TestAWSClient_PartConcurrency(t *testing.T) {
+	c := &AWSClient{config: Config{PartSize: MinPartSize, PartConcurrency: 16}}
+
+	// Files of fewer parts than the concurrency upload them all at once
+	assert.Equal(t, 2, c.fileConcurrency(MinPartSize+1))
+	assert.Equal(t, 16, c.fileConcurrency(100*MinPartSize))
+	assert.Equal(t, 1, c.fileConcurrency(0))
+
+	c.config.PartConcurrency = 0
+	assert.Equal(t, DefaultPartConcurrency, c.fileConcurrency(100*MinPartSize))
+}
+
+func TestAWSClient_GetObject(t *testing.T) {
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		assert.Equal(t, "GetObject", r.Operation.Name)
+		assert.Equal(t, "/test-bucket/photos/a.jpg", r.HTTPRequest.URL.Path)
+		return http.StatusOK, "jpeg data"
+	})
+	c.client.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse.Header.Set("ETag", `"abc"`)
+		r.HTTPResponse.Header.Set("Content-Type", "image/jpeg")
+		r.HTTPResponse.Header.Set("Content-Length", "9")
+		r.HTTPResponse.Header.Set("X-Amz-Meta-Sha256", "123")
+	})
+
+	body, info, err := c.GetObject(context.Background(), "a.jpg")
+	require.NoError(t, err)
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg data", string(data))
+	assert.Equal(t, ObjectInfo{
+		Key:         "photos/a.jpg",
+		Size:        9,
+		ETag:        `"abc"`,
+		ContentType: "image/jpeg",
+		Metadata:    map[string]string{"sha256": "123"},
+	}, info)
+}
+
+func TestAWSClient_StatObject(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		assert.Equal(t, "HeadObject", r.Operation.Name)
+		if r.HTTPRequest.URL.Path == "/test-bucket/photos/missing.jpg" {
+			return http.StatusNotFound, ""
+		}
+		return http.StatusOK, ""
+	})
+	c.client.Handlers.Send.PushBack(func(r *request.Request) {
+		if r.HTTPResponse.StatusCode != http.StatusOK {
+			return
+		}
+		r.HTTPResponse.Header.Set("ETag", `"abc"`)
+		r.HTTPResponse.Header.Set("Content-Type", "image/jpeg")
+		r.HTTPResponse.Header.Set("Content-Length", "9")
+		r.HTTPResponse.Header.Set("Last-Modified", modified.Format(http.TimeFormat))
+		r.HTTPResponse.Header.Set("X-Amz-Meta-Sha256", "123")
+		r.HTTPResponse.Header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+	})
+
+	info, err := c.StatObject(context.Background(), "a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, ObjectInfo{
+		Key:                  "photos/a.jpg",
+		Size:                 9,
+		ETag:                 `"abc"`,
+		ContentType:          "image/jpeg",
+		LastModified:         modified,
+		Metadata:             map[string]string{"sha256": "123"},
+		ServerSideEncryption: "aws:kms",
+	}, info)
+
+	_, err = c.StatObject(context.Background(), "missing.jpg")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestAWSClient_UploadFile_ACL(t *testing.T) {
+	var acls []string
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		acls = append(acls, r.HTTPRequest.Header.Get("X-Amz-Acl"))
+		return http.StatusOK, ""
+	})
+
+	ctx := context.Background()
+	c.config.ACL = ACLPrivate
+	_, err := c.UploadFile(ctx, strings.NewReader("jpeg"), "private.jpg", 4, UploadOptions{ContentType: "image/jpeg"})
+	require.NoError(t, err)
+
+	c.config.ACL = "public-read"
+	_, err = c.UploadFile(ctx, strings.NewReader("jpeg"), "public.jpg", 4, UploadOptions{ContentType: "image/jpeg"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", "public-read"}, acls)
+}
+
+func TestAWSClient_UploadFile_ServerSideEncryption(t *testing.T) {
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		return http.StatusOK, ""
+	})
+	c.client.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse.Header.Set("ETag", `"6b3ac4a05f4e2ac4d3b9d0e5f1a7c2e8"`)
+		r.HTTPResponse.Header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+	})
+
+	info, err := c.UploadFile(context.Background(), strings.NewReader("jpeg"), "a.jpg", 4, UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "aws:kms", info.ServerSideEncryption)
+	assert.True(t, EncryptedWithKey(info.ServerSideEncryption))
+}
+
+func TestAWSClient_EnsureBucket(t *testing.T) {
+	tests := []struct {
+		name       string
+		create     bool
+		headStatus int
+		createErr  string
+		wantCreate bool
+		wantErr    string
+	}{
+		{name: "exists", create: true, headStatus: http.StatusOK},
+		{name: "missing", headStatus: http.StatusNotFound, wantErr: "failed to check if bucket exists"},
+		{name: "created", create: true, headStatus: http.StatusNotFound, wantCreate: true},
+		{name: "created by another run", create: true, headStatus: http.StatusNotFound, createErr: "BucketAlreadyOwnedByYou", wantCreate: true},
+		{name: "taken by someone else", create: true, headStatus: http.StatusNotFound, createErr: "BucketAlreadyExists", wantCreate: true, wantErr: "failed to create bucket"},
+		{name: "access denied", create: true, headStatus: http.StatusForbidden, wantErr: "failed to check if bucket exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created bool
+			c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+				switch r.Operation.Name {
+				case "HeadBucket":
+					return tt.headStatus, ""
+				case "CreateBucket":
+					created = true
+					input := r.Params.(*s3.CreateBucketInput)
+					assert.Equal(t, "eu-west-1", aws.StringValue(input.CreateBucketConfiguration.LocationConstraint))
+					if tt.createErr != "" {
+						return http.StatusConflict, "<Error><Code>" + tt.createErr + "</Code></Error>"
+					}
+					return http.StatusOK, ""
+				}
+				t.Fatalf("unexpected operation %s", r.Operation.Name)
+				return 0, ""
+			})
+			c.config.CreateBucket = tt.create
+			c.config.Region = "eu-west-1"
+
+			err := c.ensureBucket(context.Background())
+			assert.Equal(t, tt.wantCreate, created)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAWSClient_WalkObjects_StopsEarly(t *testing.T) {
+	pages := 0
+	c := newTestAWSClient(t, func(r *request.Request) (int, string) {
+		pages++
+		return http.StatusOK, `<ListBucketResult><IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken>` +
+			`<Contents><Key>photos/a.jpg</Key><Size>1</Size><ETag>"a"</ETag><LastModified>2024-01-02T03:04:05Z</LastModified></Contents>` +
+			`<Contents><Key>photos/b.jpg</Key><Size>1</Size><ETag>"b"</ETag><LastModified>2024-01-02T03:04:05Z</LastModified></Contents>` +
+			`</ListBucketResult>`
+	})
+
+	var keys []string
+	err := c.WalkObjects(context.Background(), "", func(object minio.ObjectInfo) bool {
+		keys = append(keys, object.Key)
+		return len(keys) < 3
+	})
+	require.NoError(t, err)
+
+	// The third object is on the second page, after which no more are asked for
+	assert.Equal(t, []string{"photos/a.jpg", "photos/b.jpg", "photos/a.jpg"}, keys)
+	assert.Equal(t, 2, pages)
+}
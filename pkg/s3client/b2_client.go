@@ -0,0 +1,936 @@
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+	"github.com/minio/minio-go/v7"
+)
+
+// DefaultB2Endpoint is the host B2 accounts are authorized with when no
+// endpoint is given
+const DefaultB2Endpoint = "api.backblazeb2.com"
+
+// B2 native API limits
+const (
+	// b2MaxFileInfo is the number of metadata entries B2 stores with a file
+	b2MaxFileInfo = 10
+
+	// b2MaxListCount is the number of files a listing call returns at most
+	b2MaxListCount = 1000
+
+	// b2MaxDownloadAuthorization is the longest a download authorization is valid
+	b2MaxDownloadAuthorization = 7 * 24 * time.Hour
+
+	// b2UploadURLLifetime is how long an upload URL is reused. B2 tokens
+	// last a day, so URLs are renewed well before they expire.
+	b2UploadURLLifetime = time.Hour
+)
+
+// b2FileInfoMTime is the file info B2 uses as the modification time of a file
+const b2FileInfoMTime = "src_last_modified_millis"
+
+// b2FileInfoContentEncoding is the file info B2 serves as the Content-Encoding
+// header of a file
+const b2FileInfoContentEncoding = "b2-content-encoding"
+
+// b2FileInfoContentDisposition is the file info B2 serves as the
+// Content-Disposition header of a file
+const b2FileInfoContentDisposition = "b2-content-disposition"
+
+// B2Error is an error response of the B2 native API
+type B2Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// RetryAfter is how long a throttled request should wait before it is
+	// sent again, from the Retry-After header of the response
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *B2Error) Error() string {
+	return fmt.Sprintf("B2 error: %s (code: %s, status: %d)", e.Message, e.Code, e.Status)
+}
+
+// b2Auth is the result of authorizing an account
+type b2Auth struct {
+	AccountID          string `json:"accountId"`
+	AuthorizationToken string `json:"authorizationToken"`
+	APIURL             string `json:"apiUrl"`
+	DownloadURL        string `json:"downloadUrl"`
+	Allowed            struct {
+		BucketID   string `json:"bucketId"`
+		BucketName string `json:"bucketName"`
+	} `json:"allowed"`
+}
+
+// b2UploadURL is a URL files or parts are uploaded to, with its own token
+type b2UploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+	issued             time.Time
+}
+
+// b2File describes a file, or an unfinished large file, in a bucket
+type b2File struct {
+	FileID          string            `json:"fileId"`
+	FileName        string            `json:"fileName"`
+	Action          string            `json:"action"`
+	ContentLength   int64             `json:"contentLength"`
+	ContentSHA1     string            `json:"contentSha1"`
+	ContentType     string            `json:"contentType"`
+	FileInfo        map[string]string `json:"fileInfo"`
+	UploadTimestamp int64             `json:"uploadTimestamp"`
+}
+
+// B2Client is a client using the native Backblaze B2 API. B2 checks the SHA1
+// of every file and part it receives, so the checksum workarounds needed
+// with its S3 API don't apply.
+type B2Client struct {
+	config     Config
+	httpClient *http.Client
+	authURL    string
+
+	mu         sync.Mutex
+	auth       b2Auth
+	bucketID   string
+	uploadURLs []b2UploadURL // idle upload URLs to reuse
+}
+
+// NewB2 creates a client for the native Backblaze B2 API
+func NewB2(ctx context.Context, cfg Config) (S3Interface, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Profile != "" || cfg.UseInstanceRole {
+		return nil, fmt.Errorf("the B2 backend needs an application key ID and key, not a profile or instance role")
+	}
+	if cfg.objectACL() != "" {
+		return nil, fmt.Errorf("B2 sets access per bucket, so ACL %s is not supported by the B2 backend", cfg.ACL)
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &B2Client{
+		config:     cfg,
+		httpClient: httpClient,
+		authURL:    b2AuthURL(cfg),
+	}
+
+	if err := c.authorize(ctx); err != nil {
+		return nil, fmt.Errorf("failed to authorize B2 account: %w", err)
+	}
+	if err := c.findBucket(ctx); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Successfully connected to B2 bucket %s using the B2 native API", cfg.Bucket)
+	return c, nil
+}
+
+// b2AuthURL returns the base URL accounts are authorized with
+func b2AuthURL(cfg Config) string {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultB2Endpoint
+	}
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	if cfg.UseSSL {
+		return "https://" + endpoint
+	}
+	return "http://" + endpoint
+}
+
+// authorize gets the API URL and a token for the account
+func (c *B2Client) authorize(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.authURL+"/b2api/v2/b2_authorize_account", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.config.AccessKey, c.config.SecretKey)
+
+	var auth b2Auth
+	if err := c.do(req, &auth); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.auth = auth
+	c.uploadURLs = nil
+	return nil
+}
+
+// currentAuth returns the authorization of the account
+func (c *B2Client) currentAuth() b2Auth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.auth
+}
+
+// findBucket looks up the ID of the bucket, creating it if it doesn't exist
+// and CreateBucket is set
+func (c *B2Client) findBucket(ctx context.Context) error {
+	auth := c.currentAuth()
+
+	// Keys restricted to one bucket already name it
+	if auth.Allowed.BucketName == c.config.Bucket && auth.Allowed.BucketID != "" {
+		c.bucketID = auth.Allowed.BucketID
+		return nil
+	}
+
+	var list struct {
+		Buckets []struct {
+			BucketID   string `json:"bucketId"`
+			BucketName string `json:"bucketName"`
+		} `json:"buckets"`
+	}
+	err := c.call(ctx, "b2_list_buckets", map[string]any{
+		"accountId":  auth.AccountID,
+		"bucketName": c.config.Bucket,
+	}, &list)
+	if err != nil {
+		return fmt.Errorf("failed to check if bucket exists: %w", err)
+	}
+
+	for _, bucket := range list.Buckets {
+		if bucket.BucketName == c.config.Bucket {
+			c.bucketID = bucket.BucketID
+			return nil
+		}
+	}
+
+	if !c.config.CreateBucket {
+		return fmt.Errorf("bucket %s does not exist: %w", c.config.Bucket, ErrBucketNotFound)
+	}
+
+	var created struct {
+		BucketID string `json:"bucketId"`
+	}
+	err = c.call(ctx, "b2_create_bucket", map[string]any{
+		"accountId":  auth.AccountID,
+		"bucketName": c.config.Bucket,
+		"bucketType": "allPrivate",
+	}, &created)
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", c.config.Bucket, err)
+	}
+
+	logger.Info("Created bucket %s", c.config.Bucket)
+	c.bucketID = created.BucketID
+	return nil
+}
+
+// call sends a request to an API operation and decodes the response into
+// out. An expired token is renewed once.
+func (c *B2Client) call(ctx context.Context, operation string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	for renewed := false; ; renewed = true {
+		auth := c.currentAuth()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.APIURL+"/b2api/v2/"+operation, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		err = c.do(req, out)
+		if !renewed && isB2TokenExpired(err) {
+			if err := c.authorize(ctx); err != nil {
+				return fmt.Errorf("failed to renew B2 authorization: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+		return nil
+	}
+}
+
+// do sends a request and decodes a JSON response into out, or the error
+// response into a *B2Error
+func (c *B2Client) do(req *http.Request, out any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return b2ResponseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode B2 response: %w", err)
+	}
+	return nil
+}
+
+// b2ResponseError reads the error of a failed response
+func b2ResponseError(resp *http.Response) error {
+	b2Err := &B2Error{}
+	if err := json.NewDecoder(resp.Body).Decode(b2Err); err != nil || b2Err.Code == "" {
+		b2Err.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(resp.StatusCode), " ", "_"))
+		b2Err.Message = resp.Status
+	}
+	b2Err.Status = resp.StatusCode
+	b2Err.RetryAfter, _ = parseRetryAfter(resp, time.Now())
+	return b2Err
+}
+
+// isB2TokenExpired reports whether a request failed because the account
+// token is no longer valid
+func isB2TokenExpired(err error) bool {
+	var b2Err *B2Error
+	return errors.As(err, &b2Err) && b2Err.Status == http.StatusUnauthorized &&
+		(b2Err.Code == "expired_auth_token" || b2Err.Code == "bad_auth_token")
+}
+
+// UploadFile uploads a file to the bucket. Files from the multipart threshold
+// on that span more than one part are uploaded as B2 large files.
+func (c *B2Client) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions) (UploadInfo, error) {
+	objectKey = c.getObjectKey(objectKey)
+
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	fileInfo := b2FileInfo(objectKey, opts)
+
+	// B2 needs at least two parts for a large file
+	var file b2File
+	var err error
+	if size < c.config.multipartThreshold() || size <= c.config.partSize() {
+		file, err = c.uploadSmall(ctx, reader, objectKey, size, contentType, fileInfo)
+	} else {
+		file, err = c.uploadLarge(ctx, reader, objectKey, size, contentType, fileInfo)
+	}
+	if err != nil {
+		return UploadInfo{}, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	etag := b2ETag(file.ContentSHA1)
+	logger.Debug("Uploaded file to %s (%d bytes, sha1: %s)", objectKey, file.ContentLength, etag)
+	return UploadInfo{Key: objectKey, ETag: etag, Size: file.ContentLength}, nil
+}
+
+// b2FileInfo converts user metadata to B2 file info, which holds at most
+// b2MaxFileInfo entries. The original capture time becomes the modification
+// time B2 shows, the content encoding and disposition are served as headers,
+// and the entries this program reads back are kept first.
+func b2FileInfo(objectKey string, opts UploadOptions) map[string]string {
+	metadata := opts.Metadata
+	info := make(map[string]string, len(metadata)+3)
+	if opts.ContentEncoding != "" {
+		info[b2FileInfoContentEncoding] = opts.ContentEncoding
+	}
+	if opts.ContentDisposition != "" {
+		info[b2FileInfoContentDisposition] = opts.ContentDisposition
+	}
+	if originalDate, ok := metadata[MetadataOriginalDate]; ok {
+		if mtime, err := time.Parse(time.RFC3339, originalDate); err == nil {
+			info[b2FileInfoMTime] = strconv.FormatInt(mtime.UnixMilli(), 10)
+		}
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		iKnown, jKnown := isKnownMetadata(keys[i]), isKnownMetadata(keys[j])
+		if iKnown != jKnown {
+			return iKnown
+		}
+		return keys[i] < keys[j]
+	})
+
+	var dropped []string
+	for _, k := range keys {
+		if len(info) == b2MaxFileInfo {
+			dropped = append(dropped, k)
+			continue
+		}
+		info[strings.ToLower(k)] = metadata[k]
+	}
+	if len(dropped) > 0 {
+		logger.Warn("B2 stores at most %d metadata entries, leaving out %s for %s", b2MaxFileInfo, strings.Join(dropped, ", "), objectKey)
+	}
+	return info
+}
+
+// isKnownMetadata reports whether a metadata key is read back by this program
+func isKnownMetadata(key string) bool {
+	switch key {
+	case MetadataOriginalDate, MetadataLivePhotoGroup, MetadataSHA256:
+		return true
+	default:
+		return false
+	}
+}
+
+// b2ETag returns the SHA1 B2 reports for a file as its ETag. Large files have
+// no SHA1 of their whole content, so their ETag is empty.
+func b2ETag(sha1 string) string {
+	sha1 = strings.TrimPrefix(sha1, "unverified:")
+	if sha1 == "none" {
+		return ""
+	}
+	return sha1
+}
+
+// uploadSmall uploads a file in one request. The SHA1 is computed while the
+// file is sent and appended to the body, so the file isn't read twice.
+func (c *B2Client) uploadSmall(ctx context.Context, reader io.Reader, objectKey string, size int64,
+	contentType string, fileInfo map[string]string) (b2File, error) {
+	upload, err := c.uploadURL(ctx)
+	if err != nil {
+		return b2File{}, err
+	}
+
+	sum := sha1.New()
+	body := io.MultiReader(io.TeeReader(io.LimitReader(reader, size), sum), &sha1Trailer{hash: sum})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upload.UploadURL, body)
+	if err != nil {
+		return b2File{}, err
+	}
+	req.ContentLength = size + sha1.Size*2
+	req.Header.Set("Authorization", upload.AuthorizationToken)
+	req.Header.Set("X-Bz-File-Name", b2EncodeName(objectKey))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Bz-Content-Sha1", "hex_digits_at_end")
+	for k, v := range fileInfo {
+		req.Header.Set("X-Bz-Info-"+k, b2Escape(v, false))
+	}
+
+	// An upload URL that failed may be busy or expired, so only reuse good ones
+	var file b2File
+	if err := c.do(req, &file); err != nil {
+		return b2File{}, err
+	}
+	c.releaseUploadURL(upload)
+	return file, nil
+}
+
+// uploadURL returns an idle upload URL for the bucket, getting a new one if
+// there is none
+func (c *B2Client) uploadURL(ctx context.Context) (b2UploadURL, error) {
+	c.mu.Lock()
+	for len(c.uploadURLs) > 0 {
+		upload := c.uploadURLs[len(c.uploadURLs)-1]
+		c.uploadURLs = c.uploadURLs[:len(c.uploadURLs)-1]
+		if time.Since(upload.issued) < b2UploadURLLifetime {
+			c.mu.Unlock()
+			return upload, nil
+		}
+	}
+	c.mu.Unlock()
+
+	var upload b2UploadURL
+	if err := c.call(ctx, "b2_get_upload_url", map[string]any{"bucketId": c.bucketID}, &upload); err != nil {
+		return b2UploadURL{}, err
+	}
+	upload.issued = time.Now()
+	return upload, nil
+}
+
+// releaseUploadURL makes an upload URL available to the next upload
+func (c *B2Client) releaseUploadURL(upload b2UploadURL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.uploadURLs = append(c.uploadURLs, upload)
+}
+
+// uploadLarge uploads a file as a B2 large file in parts of PartSize bytes.
+// A failed upload is cancelled so its parts don't linger.
+func (c *B2Client) uploadLarge(ctx context.Context, reader io.Reader, objectKey string, size int64,
+	contentType string, fileInfo map[string]string) (b2File, error) {
+	var started b2File
+	err := c.call(ctx, "b2_start_large_file", map[string]any{
+		"bucketId":    c.bucketID,
+		"fileName":    objectKey,
+		"contentType": contentType,
+		"fileInfo":    fileInfo,
+	}, &started)
+	if err != nil {
+		return b2File{}, err
+	}
+
+	file, err := c.uploadParts(ctx, reader, started.FileID, size)
+	if err != nil {
+		// Use a fresh context so an interrupted upload is still cancelled
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if cancelErr := c.call(cancelCtx, "b2_cancel_large_file", map[string]any{"fileId": started.FileID}, nil); cancelErr != nil {
+			logger.Warn("Failed to cancel large file upload of %s: %v", objectKey, cancelErr)
+		}
+		return b2File{}, err
+	}
+	return file, nil
+}
+
+// uploadParts sends the parts of a large file and finishes it once all size
+// bytes are sent
+func (c *B2Client) uploadParts(ctx context.Context, reader io.Reader, fileID string, size int64) (b2File, error) {
+	var upload b2UploadURL
+	if err := c.call(ctx, "b2_get_upload_part_url", map[string]any{"fileId": fileID}, &upload); err != nil {
+		return b2File{}, err
+	}
+
+	buf := make([]byte, c.config.partSize())
+	var sums []string
+	var sent int64
+	for part := 1; ; part++ {
+		n, readErr := io.ReadFull(reader, buf)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return b2File{}, fmt.Errorf("failed to read part %d: %w", part, readErr)
+		}
+		if n == 0 {
+			break
+		}
+
+		sum := sha1.Sum(buf[:n])
+		hexSum := hex.EncodeToString(sum[:])
+		if err := c.uploadPart(ctx, upload, part, buf[:n], hexSum); err != nil {
+			return b2File{}, fmt.Errorf("failed to upload part %d: %w", part, err)
+		}
+		sums = append(sums, hexSum)
+		sent += int64(n)
+
+		if readErr != nil {
+			break
+		}
+	}
+	if sent != size {
+		return b2File{}, fmt.Errorf("read %d of %d bytes", sent, size)
+	}
+
+	var file b2File
+	err := c.call(ctx, "b2_finish_large_file", map[string]any{
+		"fileId":        fileID,
+		"partSha1Array": sums,
+	}, &file)
+	return file, err
+}
+
+// uploadPart sends one part of a large file
+func (c *B2Client) uploadPart(ctx context.Context, upload b2UploadURL, part int, data []byte, sha1Sum string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upload.UploadURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", upload.AuthorizationToken)
+	req.Header.Set("X-Bz-Part-Number", strconv.Itoa(part))
+	req.Header.Set("X-Bz-Content-Sha1", sha1Sum)
+	return c.do(req, nil)
+}
+
+// sha1Trailer reads the hex encoded SHA1 of the bytes before it in the body,
+// once they have all been read
+type sha1Trailer struct {
+	hash hash.Hash
+	sum  []byte
+}
+
+func (t *sha1Trailer) Read(p []byte) (int, error) {
+	if t.sum == nil {
+		t.sum = []byte(hex.EncodeToString(t.hash.Sum(nil)))
+	}
+	if len(t.sum) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, t.sum)
+	t.sum = t.sum[n:]
+	return n, nil
+}
+
+// b2EncodeName percent-encodes a file name for headers and download URLs,
+// keeping the slashes that separate folders
+func b2EncodeName(name string) string {
+	return b2Escape(name, true)
+}
+
+// b2Escape percent-encodes every byte of s but letters, digits and -._~,
+// and slashes if keepSlash is set
+func b2Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// ObjectExists checks if an object exists in the bucket
+func (c *B2Client) ObjectExists(ctx context.Context, objectKey string) (bool, error) {
+	objectKey = c.getObjectKey(objectKey)
+
+	files, _, err := c.listFileNames(ctx, objectKey, objectKey, 1)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if object exists: %w", err)
+	}
+	return len(files) > 0 && files[0].FileName == objectKey, nil
+}
+
+// listFileNames lists up to count files under the prefix, starting at the
+// start name, and returns the name to continue from, or "" at the end
+func (c *B2Client) listFileNames(ctx context.Context, prefix, start string, count int) ([]b2File, string, error) {
+	var list struct {
+		Files        []b2File `json:"files"`
+		NextFileName *string  `json:"nextFileName"`
+	}
+	err := c.call(ctx, "b2_list_file_names", map[string]any{
+		"bucketId":      c.bucketID,
+		"prefix":        prefix,
+		"startFileName": start,
+		"maxFileCount":  count,
+	}, &list)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if list.NextFileName != nil {
+		next = *list.NextFileName
+	}
+	return list.Files, next, nil
+}
+
+// ListObjects lists objects in the bucket with the given prefix
+func (c *B2Client) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	return collectObjects(ctx, c, prefix)
+}
+
+// WalkObjects calls fn for each object in the bucket with the given prefix,
+// until it returns false
+func (c *B2Client) WalkObjects(ctx context.Context, prefix string, fn func(object minio.ObjectInfo) bool) error {
+	prefix = c.getObjectKey(prefix)
+
+	start := ""
+	for {
+		files, next, err := c.listFileNames(ctx, prefix, start, b2MaxListCount)
+		if err != nil {
+			return fmt.Errorf("error listing objects: %w", err)
+		}
+
+		for _, file := range files {
+			if file.Action != "upload" {
+				continue
+			}
+			if !fn(minio.ObjectInfo{
+				Key:          file.FileName,
+				Size:         file.ContentLength,
+				ETag:         b2ETag(file.ContentSHA1),
+				ContentType:  file.ContentType,
+				LastModified: time.UnixMilli(file.UploadTimestamp),
+			}) {
+				return nil
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// GetObject retrieves an object from the bucket. The caller must close the
+// returned reader.
+func (c *B2Client) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error) {
+	objectKey = c.getObjectKey(objectKey)
+
+	resp, err := c.download(ctx, http.MethodGet, objectKey)
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get object: %w", err)
+	}
+	return resp.Body, b2ObjectInfo(objectKey, resp), nil
+}
+
+// StatObject returns the attributes of an object without downloading it
+func (c *B2Client) StatObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	objectKey = c.getObjectKey(objectKey)
+
+	resp, err := c.download(ctx, http.MethodHead, objectKey)
+	if err != nil {
+		var b2Err *B2Error
+		if errors.As(err, &b2Err) && b2Err.Status == http.StatusNotFound {
+			return ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+	resp.Body.Close()
+	return b2ObjectInfo(objectKey, resp), nil
+}
+
+// download sends a GET or HEAD request for an object to the download URL,
+// renewing the authorization once if it expired. HEAD responses have no body
+// with an error code, so any 401 to them renews it.
+func (c *B2Client) download(ctx context.Context, method, objectKey string) (*http.Response, error) {
+	for renewed := false; ; renewed = true {
+		auth := c.currentAuth()
+		req, err := http.NewRequestWithContext(ctx, method, c.downloadURL(auth, objectKey), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		err = b2ResponseError(resp)
+		resp.Body.Close()
+		expired := isB2TokenExpired(err) || (method == http.MethodHead && resp.StatusCode == http.StatusUnauthorized)
+		if renewed || !expired {
+			return nil, err
+		}
+		if err := c.authorize(ctx); err != nil {
+			return nil, fmt.Errorf("failed to renew B2 authorization: %w", err)
+		}
+	}
+}
+
+// downloadURL returns the URL an object is downloaded from
+func (c *B2Client) downloadURL(auth b2Auth, objectKey string) string {
+	return auth.DownloadURL + "/file/" + url.PathEscape(c.config.Bucket) + "/" + b2EncodeName(objectKey)
+}
+
+// b2ObjectInfo describes a downloaded object from the headers of the response
+func b2ObjectInfo(objectKey string, resp *http.Response) ObjectInfo {
+	info := ObjectInfo{
+		Key:         objectKey,
+		Size:        resp.ContentLength,
+		ETag:        b2ETag(resp.Header.Get("X-Bz-Content-Sha1")),
+		ContentType: resp.Header.Get("Content-Type"),
+		Metadata:    make(map[string]string),
+	}
+	if millis, err := strconv.ParseInt(resp.Header.Get("X-Bz-Upload-Timestamp"), 10, 64); err == nil {
+		info.LastModified = time.UnixMilli(millis)
+	}
+
+	for name, values := range resp.Header {
+		key, ok := strings.CutPrefix(strings.ToLower(name), "x-bz-info-")
+		if !ok || len(values) == 0 {
+			continue
+		}
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			value = values[0]
+		}
+		info.Metadata[key] = value
+	}
+	return info
+}
+
+// DeleteObject deletes every version of an object from the bucket
+func (c *B2Client) DeleteObject(ctx context.Context, objectKey string) error {
+	objectKey = c.getObjectKey(objectKey)
+
+	var list struct {
+		Files []b2File `json:"files"`
+	}
+	err := c.call(ctx, "b2_list_file_versions", map[string]any{
+		"bucketId":      c.bucketID,
+		"prefix":        objectKey,
+		"startFileName": objectKey,
+		"maxFileCount":  b2MaxListCount,
+	}, &list)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	for _, file := range list.Files {
+		if file.FileName != objectKey {
+			continue
+		}
+		err := c.call(ctx, "b2_delete_file_version", map[string]any{
+			"fileName": file.FileName,
+			"fileId":   file.FileID,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete object: %w", err)
+		}
+	}
+
+	logger.Debug("Deleted object %s", objectKey)
+	return nil
+}
+
+// ListIncompleteUploads lists the large files under the prefix that were
+// never finished or cancelled, with the size of the parts uploaded so far
+func (c *B2Client) ListIncompleteUploads(ctx context.Context, prefix string) ([]IncompleteUpload, error) {
+	prefix = c.getObjectKey(prefix)
+
+	// Stay inside the configured prefix instead of matching keys that merely start with it
+	if prefix != "" && prefix == strings.TrimSuffix(c.config.Prefix, "/") {
+		prefix += "/"
+	}
+
+	var uploads []IncompleteUpload
+	var startFileID *string
+	for {
+		var list struct {
+			Files      []b2File `json:"files"`
+			NextFileID *string  `json:"nextFileId"`
+		}
+		request := map[string]any{
+			"bucketId":     c.bucketID,
+			"namePrefix":   prefix,
+			"maxFileCount": 100,
+		}
+		if startFileID != nil {
+			request["startFileId"] = *startFileID
+		}
+		err := c.call(ctx, "b2_list_unfinished_large_files", request, &list)
+		if err != nil {
+			return nil, fmt.Errorf("error listing incomplete uploads: %w", err)
+		}
+
+		for _, file := range list.Files {
+			size, err := c.partsSize(ctx, file.FileID)
+			if err != nil {
+				return nil, fmt.Errorf("error listing parts of %s: %w", file.FileName, err)
+			}
+			uploads = append(uploads, IncompleteUpload{
+				Key:       file.FileName,
+				UploadID:  file.FileID,
+				Initiated: time.UnixMilli(file.UploadTimestamp),
+				Size:      size,
+			})
+		}
+
+		if list.NextFileID == nil {
+			return uploads, nil
+		}
+		startFileID = list.NextFileID
+	}
+}
+
+// partsSize adds up the size of the parts of an unfinished large file
+func (c *B2Client) partsSize(ctx context.Context, fileID string) (int64, error) {
+	var size int64
+	startPart := 1
+	for {
+		var list struct {
+			Parts []struct {
+				ContentLength int64 `json:"contentLength"`
+			} `json:"parts"`
+			NextPartNumber *int `json:"nextPartNumber"`
+		}
+		err := c.call(ctx, "b2_list_parts", map[string]any{
+			"fileId":          fileID,
+			"startPartNumber": startPart,
+			"maxPartCount":    b2MaxListCount,
+		}, &list)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, part := range list.Parts {
+			size += part.ContentLength
+		}
+		if list.NextPartNumber == nil {
+			return size, nil
+		}
+		startPart = *list.NextPartNumber
+	}
+}
+
+// AbortIncompleteUpload cancels an unfinished large file, deleting its parts
+func (c *B2Client) AbortIncompleteUpload(ctx context.Context, upload IncompleteUpload) error {
+	if err := c.call(ctx, "b2_cancel_large_file", map[string]any{"fileId": upload.UploadID}, nil); err != nil {
+		return fmt.Errorf("failed to abort upload of %s: %w", upload.Key, err)
+	}
+
+	logger.Debug("Aborted incomplete upload %s of %s", upload.UploadID, upload.Key)
+	return nil
+}
+
+// GetPresignedURL returns a download URL for an object that carries its own
+// authorization, valid for at most a week
+func (c *B2Client) GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
+	objectKey = c.getObjectKey(objectKey)
+	if expiry > b2MaxDownloadAuthorization {
+		expiry = b2MaxDownloadAuthorization
+	}
+
+	var authorization struct {
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	err := c.call(ctx, "b2_get_download_authorization", map[string]any{
+		"bucketId":               c.bucketID,
+		"fileNamePrefix":         objectKey,
+		"validDurationInSeconds": int64(expiry / time.Second),
+	}, &authorization)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return c.downloadURL(c.currentAuth(), objectKey) + "?Authorization=" + url.QueryEscape(authorization.AuthorizationToken), nil
+}
+
+// getObjectKey returns the full object key with prefix
+func (c *B2Client) getObjectKey(key string) string {
+	return joinKey(c.config.Prefix, key)
+}
+
+// GetBucketName returns the bucket name
+func (c *B2Client) GetBucketName() string {
+	return c.config.Bucket
+}
+
+// GetEndpoint returns the host the account is authorized with
+func (c *B2Client) GetEndpoint() string {
+	if c.config.Endpoint == "" {
+		return DefaultB2Endpoint
+	}
+	return c.config.Endpoint
+}
+
+// GetPrefix returns the prefix
+func (c *B2Client) GetPrefix() string {
+	return c.config.Prefix
+}
@@ -0,0 +1,376 @@
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeB2 implements the parts of the B2 native API the client uses, keeping
+// files in memory
+type fakeB2 struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	files     map[string]b2File
+	content   map[string][]byte
+	parts     map[string]map[int][]byte
+	large     map[string]b2File
+	tokens    int
+	expireAll bool // reject the current token once, as if it expired
+}
+
+func newFakeB2(t *testing.T) *fakeB2 {
+	f := &fakeB2{
+		t:       t,
+		files:   make(map[string]b2File),
+		content: make(map[string][]byte),
+		parts:   make(map[string]map[int][]byte),
+		large:   make(map[string]b2File),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeB2) token() string {
+	return "token-" + strconv.Itoa(f.tokens)
+}
+
+func (f *fakeB2) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(B2Error{Status: status, Code: code, Message: code})
+}
+
+func (f *fakeB2) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/b2api/v2/b2_authorize_account":
+		if key, secret, _ := r.BasicAuth(); key != "key-id" || secret != "app-key" {
+			f.fail(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		f.tokens++
+		json.NewEncoder(w).Encode(map[string]any{
+			"accountId":          "account",
+			"authorizationToken": f.token(),
+			"apiUrl":             f.server.URL,
+			"downloadUrl":        f.server.URL,
+		})
+		return
+	case r.URL.Path == "/upload":
+		f.uploadFile(w, r)
+		return
+	case r.URL.Path == "/upload-part":
+		f.uploadPart(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/file/photos/"):
+		f.download(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != f.token() || f.expireAll {
+		f.expireAll = false
+		f.fail(w, http.StatusUnauthorized, "expired_auth_token")
+		return
+	}
+
+	var in map[string]any
+	require.NoError(f.t, json.NewDecoder(r.Body).Decode(&in))
+
+	switch strings.TrimPrefix(r.URL.Path, "/b2api/v2/") {
+	case "b2_list_buckets":
+		var buckets []map[string]string
+		if in["bucketName"] == "photos" {
+			buckets = append(buckets, map[string]string{"bucketId": "bucket-id", "bucketName": "photos"})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"buckets": buckets})
+	case "b2_get_upload_url":
+		json.NewEncoder(w).Encode(map[string]string{"uploadUrl": f.server.URL + "/upload", "authorizationToken": "upload-token"})
+	case "b2_start_large_file":
+		file := b2File{FileID: "large-" + in["fileName"].(string), FileName: in["fileName"].(string), ContentType: in["contentType"].(string)}
+		f.large[file.FileID] = file
+		f.parts[file.FileID] = make(map[int][]byte)
+		json.NewEncoder(w).Encode(file)
+	case "b2_get_upload_part_url":
+		json.NewEncoder(w).Encode(map[string]string{"uploadUrl": f.server.URL + "/upload-part?fileId=" + in["fileId"].(string), "authorizationToken": "upload-token"})
+	case "b2_finish_large_file":
+		file := f.large[in["fileId"].(string)]
+		var data []byte
+		for i := range in["partSha1Array"].([]any) {
+			data = append(data, f.parts[file.FileID][i+1]...)
+		}
+		delete(f.large, file.FileID)
+		file.Action, file.ContentLength, file.ContentSHA1 = "upload", int64(len(data)), "none"
+		f.files[file.FileName], f.content[file.FileName] = file, data
+		json.NewEncoder(w).Encode(file)
+	case "b2_list_file_names", "b2_list_file_versions":
+		var files []b2File
+		for name, file := range f.files {
+			if strings.HasPrefix(name, in["prefix"].(string)) && name >= in["startFileName"].(string) {
+				files = append(files, file)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"files": files})
+	case "b2_delete_file_version":
+		delete(f.files, in["fileName"].(string))
+		json.NewEncoder(w).Encode(map[string]any{})
+	case "b2_list_unfinished_large_files":
+		var files []b2File
+		for _, file := range f.large {
+			files = append(files, file)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"files": files})
+	case "b2_list_parts":
+		var parts []map[string]int
+		for _, data := range f.parts[in["fileId"].(string)] {
+			parts = append(parts, map[string]int{"contentLength": len(data)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"parts": parts})
+	case "b2_cancel_large_file":
+		delete(f.large, in["fileId"].(string))
+		json.NewEncoder(w).Encode(map[string]any{})
+	default:
+		f.fail(w, http.StatusBadRequest, "bad_request")
+	}
+}
+
+func (f *fakeB2) uploadFile(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(f.t, err)
+	require.Equal(f.t, "hex_digits_at_end", r.Header.Get("X-Bz-Content-Sha1"))
+
+	data, sum := body[:len(body)-40], string(body[len(body)-40:])
+	if actual := sha1.Sum(data); hex.EncodeToString(actual[:]) != sum {
+		f.fail(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	name, err := url.PathUnescape(r.Header.Get("X-Bz-File-Name"))
+	require.NoError(f.t, err)
+	info := make(map[string]string)
+	for header, values := range r.Header {
+		if key, ok := strings.CutPrefix(strings.ToLower(header), "x-bz-info-"); ok {
+			info[key] = values[0]
+		}
+	}
+
+	file := b2File{
+		FileID:          "id-" + name,
+		FileName:        name,
+		Action:          "upload",
+		ContentLength:   int64(len(data)),
+		ContentSHA1:     sum,
+		ContentType:     r.Header.Get("Content-Type"),
+		FileInfo:        info,
+		UploadTimestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli(),
+	}
+	f.files[name], f.content[name] = file, data
+	json.NewEncoder(w).Encode(file)
+}
+
+func (f *fakeB2) uploadPart(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	require.NoError(f.t, err)
+	if sum := sha1.Sum(data); hex.EncodeToString(sum[:]) != r.Header.Get("X-Bz-Content-Sha1") {
+		f.fail(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	part, err := strconv.Atoi(r.Header.Get("X-Bz-Part-Number"))
+	require.NoError(f.t, err)
+	f.parts[r.URL.Query().Get("fileId")][part] = data
+	json.NewEncoder(w).Encode(map[string]any{"partNumber": part})
+}
+
+func (f *fakeB2) download(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/file/photos/"))
+	require.NoError(f.t, err)
+	file, ok := f.files[name]
+	if !ok {
+		f.fail(w, http.StatusNotFound, "not_found")
+		return
+	}
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(f.content[name])))
+	w.Header().Set("X-Bz-Content-Sha1", file.ContentSHA1)
+	w.Header().Set("X-Bz-Upload-Timestamp", strconv.FormatInt(file.UploadTimestamp, 10))
+	for k, v := range file.FileInfo {
+		w.Header().Set("X-Bz-Info-"+k, v)
+	}
+	w.Write(f.content[name])
+}
+
+func (f *fakeB2) config() Config {
+	return Config{
+		Endpoint:  f.server.URL,
+		Bucket:    "photos",
+		AccessKey: "key-id",
+		SecretKey: "app-key",
+		Prefix:    "backup",
+		Backend:   BackendB2,
+	}
+}
+
+func TestB2Client(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeB2(t)
+
+	client, err := NewB2(ctx, fake.config())
+	require.NoError(t, err)
+
+	data := []byte("not really a jpeg")
+	info, err := client.UploadFile(ctx, bytes.NewReader(data), "Trip 2023/IMG 0001.jpg", int64(len(data)), UploadOptions{
+		ContentType: "image/jpeg",
+		Metadata: map[string]string{
+			MetadataOriginalDate: "2023-07-01T12:00:00Z",
+			"Title":              "Beach & sun",
+		},
+	})
+	require.NoError(t, err)
+	sum := sha1.Sum(data)
+	assert.Equal(t, UploadInfo{Key: "backup/Trip 2023/IMG 0001.jpg", ETag: hex.EncodeToString(sum[:]), Size: int64(len(data))}, info)
+
+	exists, err := client.ObjectExists(ctx, "Trip 2023/IMG 0001.jpg")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = client.ObjectExists(ctx, "Trip 2023/IMG 0002.jpg")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	objects, err := client.ListObjects(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "backup/Trip 2023/IMG 0001.jpg", objects[0].Key)
+	assert.Equal(t, int64(len(data)), objects[0].Size)
+
+	// Metadata comes back the way the S3 clients return it
+	body, object, err := client.GetObject(ctx, "Trip 2023/IMG 0001.jpg")
+	require.NoError(t, err)
+	content, err := io.ReadAll(body)
+	require.NoError(t, body.Close())
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+	assert.Equal(t, "image/jpeg", object.ContentType)
+	assert.Equal(t, "2023-07-01T12:00:00Z", object.Metadata[MetadataOriginalDate])
+	assert.Equal(t, "Beach & sun", object.Metadata["title"])
+	assert.Equal(t, "1688212800000", object.Metadata[b2FileInfoMTime])
+
+	// Stat returns the same without the content
+	stat, err := client.StatObject(ctx, "Trip 2023/IMG 0001.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, object, stat)
+	assert.Equal(t, int64(len(data)), stat.Size)
+
+	require.NoError(t, client.DeleteObject(ctx, "Trip 2023/IMG 0001.jpg"))
+	_, _, err = client.GetObject(ctx, "Trip 2023/IMG 0001.jpg")
+	assert.True(t, IsNotFoundError(err))
+	_, err = client.StatObject(ctx, "Trip 2023/IMG 0001.jpg")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestB2Client_LargeFile(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeB2(t)
+
+	cfg := fake.config()
+	cfg.MultipartThreshold = MinPartSize
+	cfg.PartSize = MinPartSize
+	client, err := NewB2(ctx, cfg)
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789"), (2*MinPartSize+100)/10)
+	info, err := client.UploadFile(ctx, bytes.NewReader(data), "video.mp4", int64(len(data)), UploadOptions{ContentType: "video/mp4"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size)
+	assert.Empty(t, info.ETag)
+	assert.Equal(t, data, fake.content["backup/video.mp4"])
+	assert.Empty(t, fake.large)
+
+	// An upload that stops part way is cancelled
+	_, err = client.UploadFile(ctx, io.LimitReader(bytes.NewReader(data), MinPartSize), "broken.mp4", int64(len(data)), UploadOptions{})
+	assert.ErrorContains(t, err, "bytes")
+	assert.Empty(t, fake.large)
+	assert.NotContains(t, fake.files, "backup/broken.mp4")
+
+	fake.large["large-stale"] = b2File{FileID: "large-stale", FileName: "backup/stale.mp4"}
+	fake.parts["large-stale"] = map[int][]byte{1: []byte("part")}
+	uploads, err := client.ListIncompleteUploads(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, int64(4), uploads[0].Size)
+	require.NoError(t, client.AbortIncompleteUpload(ctx, uploads[0]))
+	assert.Empty(t, fake.large)
+}
+
+func TestB2Client_RenewsExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeB2(t)
+
+	client, err := NewB2(ctx, fake.config())
+	require.NoError(t, err)
+
+	fake.expireAll = true
+	_, err = client.ObjectExists(ctx, "a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.tokens)
+}
+
+func TestNewB2_Errors(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeB2(t)
+
+	cfg := fake.config()
+	cfg.Bucket = "other"
+	_, err := NewB2(ctx, cfg)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+
+	cfg = fake.config()
+	cfg.SecretKey = "wrong"
+	_, err = NewB2(ctx, cfg)
+	assert.True(t, IsAuthError(err))
+
+	cfg = fake.config()
+	cfg.ACL = "public-read"
+	_, err = NewB2(ctx, cfg)
+	assert.ErrorContains(t, err, "per bucket")
+}
+
+func TestB2FileInfo(t *testing.T) {
+	metadata := map[string]string{MetadataSHA256: "abc", MetadataOriginalDate: "2023-07-01T12:00:00Z"}
+	for i := 0; i < 12; i++ {
+		metadata["Extra"+strconv.Itoa(i)] = "x"
+	}
+
+	// The modification time and the entries read back are kept first
+	info := b2FileInfo("a.jpg", UploadOptions{Metadata: metadata})
+	assert.Len(t, info, b2MaxFileInfo)
+	assert.Equal(t, "abc", info[MetadataSHA256])
+	assert.Equal(t, "2023-07-01T12:00:00Z", info[MetadataOriginalDate])
+	assert.Contains(t, info, b2FileInfoMTime)
+
+	// The headers count towards the limit
+	info = b2FileInfo("a.json", UploadOptions{Metadata: metadata, ContentEncoding: "gzip", ContentDisposition: "inline"})
+	assert.Len(t, info, b2MaxFileInfo)
+	assert.Equal(t, "gzip", info[b2FileInfoContentEncoding])
+	assert.Equal(t, "inline", info[b2FileInfoContentDisposition])
+	assert.Contains(t, info, b2FileInfoMTime)
+}
@@ -0,0 +1,72 @@
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// maxBufferedUploads is the number of small uploads that can be buffered in memory at once
+const maxBufferedUploads = 8
+
+// uploadBuffers is shared by all clients so memory use stays bounded
+// regardless of how many archives and workers are running
+var uploadBuffers = newBufferPool(maxBufferedUploads)
+
+// bufferPool is a fixed-size pool of reusable buffers. Callers block until a
+// buffer is available, which bounds the total memory used for buffering.
+type bufferPool struct {
+	buffers chan *bytes.Buffer
+}
+
+// newBufferPool creates a pool holding the given number of buffers
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{
+		buffers: make(chan *bytes.Buffer, size),
+	}
+	for i := 0; i < size; i++ {
+		p.buffers <- new(bytes.Buffer)
+	}
+	return p
+}
+
+// get waits for a free buffer or until the context is done
+func (p *bufferPool) get(ctx context.Context) (*bytes.Buffer, error) {
+	select {
+	case buf := <-p.buffers:
+		return buf, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put resets a buffer and returns it to the pool
+func (p *bufferPool) put(buf *bytes.Buffer) {
+	buf.Reset()
+	p.buffers <- buf
+}
+
+// seekableBody returns a seekable body for a small upload. Readers that can
+// already seek are used directly; anything else is copied into a pooled
+// buffer. The returned release function must be called once the body is no
+// longer needed.
+func seekableBody(ctx context.Context, pool *bufferPool, reader io.Reader, size int64) (io.ReadSeeker, func(), error) {
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		return seeker, func() {}, nil
+	}
+
+	buf, err := pool.get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if size > 0 {
+		buf.Grow(int(size))
+	}
+	if _, err := io.Copy(buf, reader); err != nil {
+		pool.put(buf)
+		return nil, nil, err
+	}
+
+	return bytes.NewReader(buf.Bytes()), func() { pool.put(buf) }, nil
+}
@@ -0,0 +1,76 @@
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamReader hides any Seek method so the buffered path is exercised
+type streamReader struct {
+	io.Reader
+}
+
+func TestSeekableBody(t *testing.T) {
+	ctx := context.Background()
+	pool := newBufferPool(1)
+	data := []byte("small file content")
+
+	// Seekable readers are used directly without taking a buffer
+	seeker := bytes.NewReader(data)
+	body, release, err := seekableBody(ctx, pool, seeker, int64(len(data)))
+	require.NoError(t, err)
+	assert.Same(t, seeker, body)
+	release()
+	assert.Len(t, pool.buffers, 1)
+
+	// Non-seekable readers are copied into a pooled buffer
+	body, release, err = seekableBody(ctx, pool, streamReader{bytes.NewReader(data)}, int64(len(data)))
+	require.NoError(t, err)
+	assert.Len(t, pool.buffers, 0)
+
+	content, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+
+	// The pool is exhausted until the buffer is released
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = seekableBody(cancelled, pool, streamReader{bytes.NewReader(data)}, int64(len(data)))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	release()
+	assert.Len(t, pool.buffers, 1)
+}
+
+func BenchmarkSmallUploadBody(b *testing.B) {
+	data := bytes.Repeat([]byte{0xAB}, 4*1024*1024)
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := &bytes.Buffer{}
+			if _, err := io.Copy(buf, streamReader{bytes.NewReader(data)}); err != nil {
+				b.Fatal(err)
+			}
+			_ = bytes.NewReader(buf.Bytes())
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		ctx := context.Background()
+		pool := newBufferPool(1)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, release, err := seekableBody(ctx, pool, streamReader{bytes.NewReader(data)}, int64(len(data)))
+			if err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	})
+}
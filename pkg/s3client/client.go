@@ -2,6 +2,10 @@ package s3client
 
 import (
 	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
 )
 
 // Config represents the configuration for an S3 client
@@ -11,18 +15,286 @@ type Config struct {
 	Bucket           string
 	AccessKey        string
 	SecretKey        string
+	SessionToken     string
+	Profile          string
+	UseInstanceRole  bool
 	UseSSL           bool
 	Prefix           string
 	DisableChecksums bool
+
+	// PathStyle sends requests to endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most S3-compatible providers accept path-style
+	// requests, but some only support virtual-hosted-style ones. The MinIO
+	// client still uses virtual-hosted-style for AWS endpoints with it.
+	PathStyle bool
+
+	// Files smaller than MultipartThreshold are sent with a single PUT, larger
+	// ones in parts of PartSize bytes. The AWS client sends PartConcurrency
+	// parts of a file at a time. Zero uses the defaults.
+	MultipartThreshold int64
+	PartSize           int64
+	PartConcurrency    int
+
+	// CreateBucket creates the bucket in Region if it doesn't exist, instead
+	// of failing
+	CreateBucket bool
+
+	// ACL is the canned ACL of uploaded objects. Objects are private unless
+	// an ACL is given, so no header is sent for "" or ACLPrivate.
+	ACL string
+
+	// CACert is a PEM file of certificates to trust besides the system ones,
+	// such as the private CA of a self-hosted endpoint
+	CACert string
+
+	// TLSSkipVerify accepts any certificate from the endpoint. It is meant
+	// for testing only.
+	TLSSkipVerify bool
+
+	// MaxIdleConns is the number of connections to the endpoint kept open
+	// for reuse between requests, and MaxConnsPerHost caps the connections
+	// open at once. Zero keeps the defaults of the client, with enough idle
+	// connections for the Concurrency uploads the client sends at a time.
+	MaxIdleConns    int
+	MaxConnsPerHost int
+	Concurrency     int
+
+	// Backend selects the client implementation. Empty uses the MinIO client,
+	// or the AWS SDK client if DisableChecksums is set.
+	Backend string
+}
+
+// Client implementations selected by Config.Backend
+const (
+	BackendMinIO = "minio"
+	BackendAWS   = "aws"
+
+	// BackendB2 uses the native Backblaze B2 API instead of its S3 API. The
+	// access key is the application key ID and Endpoint, if set, the host
+	// the account is authorized with.
+	BackendB2 = "b2"
+)
+
+// Backends are the accepted values of Config.Backend besides ""
+var Backends = []string{BackendMinIO, BackendAWS, BackendB2}
+
+// ValidateBackend checks that backend is empty or one of Backends
+func ValidateBackend(backend string) error {
+	if backend == "" || slices.Contains(Backends, backend) {
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q (expected one of %s)", backend, strings.Join(Backends, ", "))
+}
+
+// ACLPrivate is the canned ACL that only gives the owner access, the default
+// for new objects
+const ACLPrivate = "private"
+
+// CannedACLs are the canned ACLs accepted by S3
+var CannedACLs = []string{
+	ACLPrivate,
+	"public-read",
+	"public-read-write",
+	"authenticated-read",
+	"aws-exec-read",
+	"bucket-owner-read",
+	"bucket-owner-full-control",
+}
+
+// ValidateACL checks that acl is empty or one of the canned ACLs
+func ValidateACL(acl string) error {
+	if acl == "" || slices.Contains(CannedACLs, acl) {
+		return nil
+	}
+	return fmt.Errorf("unknown ACL %q (expected one of %s)", acl, strings.Join(CannedACLs, ", "))
+}
+
+// objectACL returns the ACL to send with uploads, or "" to send none
+func (c Config) objectACL() string {
+	if c.ACL == ACLPrivate {
+		return ""
+	}
+	return c.ACL
+}
+
+// Multipart upload limits
+const (
+	// DefaultMultipartThreshold is the file size from which multipart uploads are used
+	DefaultMultipartThreshold = 10 * 1024 * 1024
+
+	// DefaultPartSize is the size of each part of a multipart upload
+	DefaultPartSize = 10 * 1024 * 1024
+
+	// DefaultPartConcurrency is the number of parts of a file uploaded at a time
+	DefaultPartConcurrency = 4
+
+	// MinPartSize is the smallest part S3 and Backblaze B2 accept, except for the last part
+	MinPartSize = 5 * 1024 * 1024
+
+	// MaxSinglePutSize is the largest object S3 accepts in a single PUT
+	MaxSinglePutSize = 5 * 1024 * 1024 * 1024
+
+	// MaxObjectSize is the largest object S3 accepts
+	MaxObjectSize = 5 * 1024 * 1024 * 1024 * 1024
+
+	// MaxParts is the most parts S3 and Backblaze B2 accept in a multipart upload
+	MaxParts = 10000
+)
+
+// validate checks the settings shared by all client implementations
+func (c Config) validate() error {
+	if err := ValidateBackend(c.Backend); err != nil {
+		return err
+	}
+	// B2 accounts are authorized with a well-known host
+	if c.Endpoint == "" && c.Backend != BackendB2 {
+		return fmt.Errorf("S3 endpoint is required")
+	}
+	if c.Bucket == "" {
+		return fmt.Errorf("S3 bucket name is required")
+	}
+	if !c.UseInstanceRole && c.Profile == "" && (c.AccessKey == "" || c.SecretKey == "") {
+		return fmt.Errorf("S3 access key and secret key are required unless a profile or instance role is used")
+	}
+	if c.PartSize != 0 && c.PartSize < MinPartSize {
+		return fmt.Errorf("part size of %d bytes is below the 5MB minimum: S3 and Backblaze B2 reject multipart uploads with smaller parts", c.PartSize)
+	}
+	if c.PartSize > MaxSinglePutSize {
+		return fmt.Errorf("part size of %d bytes is above the 5GB maximum part size of S3", c.PartSize)
+	}
+	if c.MultipartThreshold < 0 {
+		return fmt.Errorf("multipart threshold must not be negative")
+	}
+	if c.PartConcurrency < 0 {
+		return fmt.Errorf("multipart concurrency must not be negative")
+	}
+	if c.MultipartThreshold > MaxSinglePutSize {
+		return fmt.Errorf("multipart threshold of %d bytes is above 5GB, the largest object S3 accepts in a single PUT", c.MultipartThreshold)
+	}
+	return ValidateACL(c.ACL)
+}
+
+// multipartThreshold returns the file size from which multipart uploads are used
+func (c Config) multipartThreshold() int64 {
+	if c.MultipartThreshold == 0 {
+		return DefaultMultipartThreshold
+	}
+	return c.MultipartThreshold
+}
+
+// partSize returns the size of each part of a multipart upload
+func (c Config) partSize() int64 {
+	if c.PartSize == 0 {
+		return DefaultPartSize
+	}
+	return c.PartSize
+}
+
+// partConcurrency returns the number of parts of a file uploaded at a time
+func (c Config) partConcurrency() int {
+	if c.PartConcurrency == 0 {
+		return DefaultPartConcurrency
+	}
+	return c.PartConcurrency
+}
+
+// joinKey adds the prefix to an object key. Keys always use forward slashes,
+// so backslashes, such as from paths in archives made on Windows, are
+// replaced whatever the OS.
+func joinKey(prefix, key string) string {
+	key = strings.ReplaceAll(key, "\\", "/")
+	if prefix == "" {
+		return key
+	}
+
+	// Ensure prefix doesn't have trailing slash
+	prefix = strings.TrimSuffix(strings.ReplaceAll(prefix, "\\", "/"), "/")
+
+	// Ensure key doesn't have leading slash
+	key = strings.TrimPrefix(key, "/")
+
+	return path.Join(prefix, key)
+}
+
+// RelativeKey returns an object key listed from the bucket relative to the
+// prefix, and whether it is under the prefix at all. The prefix only matches
+// whole path segments, so the prefix photos doesn't match photos-old/x, which
+// a listing of the prefix also returns.
+func RelativeKey(prefix, key string) (string, bool) {
+	prefix = strings.TrimSuffix(strings.ReplaceAll(prefix, "\\", "/"), "/")
+	if prefix == "" {
+		return strings.TrimPrefix(key, "/"), true
+	}
+	rel, ok := strings.CutPrefix(key, prefix+"/")
+	if !ok {
+		return "", false
+	}
+	return rel, true
+}
+
+// MetadataOriginalDate is the user metadata key holding the original capture
+// time of a file in RFC3339 format (sent as X-Amz-Meta-Original-Date)
+const MetadataOriginalDate = "original-date"
+
+// MetadataLivePhotoGroup is the user metadata key shared by the still and video
+// halves of a Motion Photo or Live Photo (sent as X-Amz-Meta-Live-Photo-Group)
+const MetadataLivePhotoGroup = "live-photo-group"
+
+// MetadataSourceArchive is the user metadata key naming the archive or folder
+// a file was uploaded from (sent as X-Amz-Meta-Source-Archive)
+const MetadataSourceArchive = "source-archive"
+
+// MetadataSHA256 is the user metadata key holding the hex encoded SHA-256 of
+// the object content (sent as X-Amz-Meta-Sha256)
+const MetadataSHA256 = "sha256"
+
+// MetadataSidecar is the user metadata key naming the JSON object next to an
+// object that holds metadata too large to store on it (sent as
+// X-Amz-Meta-Metadata-Sidecar)
+const MetadataSidecar = "metadata-sidecar"
+
+// MaxMetadataSize is the most user metadata S3 stores on an object, counted
+// as the bytes of the keys and values
+const MaxMetadataSize = 2 * 1024
+
+// MetadataSize returns the size of user metadata as S3 counts it against
+// MaxMetadataSize
+func MetadataSize(metadata map[string]string) int {
+	size := 0
+	for k, v := range metadata {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// userMetadata normalizes user metadata returned by a backend to lower case
+// keys without the X-Amz-Meta- prefix, so both clients return the same keys
+func userMetadata(metadata map[string]string) map[string]string {
+	normalized := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		k = strings.ToLower(k)
+		normalized[strings.TrimPrefix(k, "x-amz-meta-")] = v
+	}
+	return normalized
 }
 
 // Define function variables that point to the actual implementations
 // These can be overridden in tests
 var NewMinIOFunc = NewMinIO
 var NewAWSFunc = NewAWS
+var NewB2Func = NewB2
 
 // New creates a new S3 client based on configuration
 func New(ctx context.Context, cfg Config) (S3Interface, error) {
+	switch cfg.Backend {
+	case BackendB2:
+		return NewB2Func(ctx, cfg)
+	case BackendAWS:
+		return NewAWSFunc(ctx, cfg)
+	case BackendMinIO:
+		return NewMinIOFunc(ctx, cfg)
+	}
+
 	if cfg.DisableChecksums {
 		// Use AWS SDK client when checksums are disabled
 		return NewAWSFunc(ctx, cfg)
@@ -74,13 +74,15 @@ func TestNew(t *testing.T) {
 	// Store the original functions
 	origNewMinIO := NewMinIOFunc
 	origNewAWS := NewAWSFunc
+	origNewB2 := NewB2Func
 	defer func() {
 		// Restore original functions after test
 		NewMinIOFunc = origNewMinIO
 		NewAWSFunc = origNewAWS
+		NewB2Func = origNewB2
 	}()
 
-	var usedMinIO, usedAWS bool
+	var usedMinIO, usedAWS, usedB2 bool
 
 	// Replace the functions with test versions
 	NewMinIOFunc = func(ctx context.Context, cfg Config) (S3Interface, error) {
@@ -93,6 +95,11 @@ func TestNew(t *testing.T) {
 		return &AWSClient{}, nil
 	}
 
+	NewB2Func = func(ctx context.Context, cfg Config) (S3Interface, error) {
+		usedB2 = true
+		return &B2Client{}, nil
+	}
+
 	// Test with checksums disabled = false (should use MinIO)
 	client, err := New(context.Background(), cfg)
 	assert.NoError(t, err)
@@ -111,6 +118,51 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, client)
 	assert.False(t, usedMinIO)
 	assert.True(t, usedAWS)
+
+	// An explicit backend wins over --disable-checksums
+	usedAWS = false
+	cfg.Backend = BackendB2
+	_, err = New(context.Background(), cfg)
+	assert.NoError(t, err)
+	assert.True(t, usedB2)
+	assert.False(t, usedAWS)
+}
+
+func TestConfigValidate(t *testing.T) {
+	base := Config{Endpoint: "test-endpoint", Bucket: "test-bucket"}
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{"static keys", func(c *Config) { c.AccessKey, c.SecretKey = "key", "secret" }, false},
+		{"missing keys", func(c *Config) {}, true},
+		{"secret only", func(c *Config) { c.SecretKey = "secret" }, true},
+		{"profile", func(c *Config) { c.Profile = "photos" }, false},
+		{"instance role", func(c *Config) { c.UseInstanceRole = true }, false},
+		{"missing bucket", func(c *Config) { c.Bucket, c.UseInstanceRole = "", true }, true},
+		{"custom part size", func(c *Config) { c.UseInstanceRole, c.PartSize = true, 64*1024*1024 }, false},
+		{"part size below 5MB", func(c *Config) { c.UseInstanceRole, c.PartSize = true, 4*1024*1024 }, true},
+		{"small threshold", func(c *Config) { c.UseInstanceRole, c.MultipartThreshold = true, 1024 }, false},
+		{"negative multipart concurrency", func(c *Config) { c.UseInstanceRole, c.PartConcurrency = true, -1 }, true},
+		{"threshold above 5GB", func(c *Config) { c.UseInstanceRole, c.MultipartThreshold = true, 6*1024*1024*1024 }, true},
+		{"public ACL", func(c *Config) { c.UseInstanceRole, c.ACL = true, "public-read" }, false},
+		{"unknown ACL", func(c *Config) { c.UseInstanceRole, c.ACL = true, "public" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			tt.modify(&cfg)
+			err := cfg.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
 }
 
 // TestUploadFile and TestObjectExists need a different approach
@@ -132,26 +184,38 @@ func TestMinioClient_Interface(t *testing.T) {
 // Mock S3 Client for testing the interface
 type MockS3Client struct{}
 
-func (m *MockS3Client) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, metadata map[string]string, contentType string) error {
-	return nil
+func (m *MockS3Client) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions) (UploadInfo, error) {
+	return UploadInfo{Key: objectKey, Size: size}, nil
 }
 
 func (m *MockS3Client) ObjectExists(ctx context.Context, objectKey string) (bool, error) {
 	return true, nil
 }
 
+func (m *MockS3Client) StatObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	return ObjectInfo{Key: objectKey}, nil
+}
+
 func (m *MockS3Client) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
 	return []minio.ObjectInfo{}, nil
 }
 
-func (m *MockS3Client) GetObject(ctx context.Context, objectKey string) (*minio.Object, error) {
-	return nil, nil
+func (m *MockS3Client) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error) {
+	return nil, ObjectInfo{}, nil
 }
 
 func (m *MockS3Client) DeleteObject(ctx context.Context, objectKey string) error {
 	return nil
 }
 
+func (m *MockS3Client) ListIncompleteUploads(ctx context.Context, prefix string) ([]IncompleteUpload, error) {
+	return nil, nil
+}
+
+func (m *MockS3Client) AbortIncompleteUpload(ctx context.Context, upload IncompleteUpload) error {
+	return nil
+}
+
 func (m *MockS3Client) GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
 	return "", nil
 }
@@ -167,3 +231,51 @@ func (m *MockS3Client) GetEndpoint() string {
 func (m *MockS3Client) GetPrefix() string {
 	return ""
 }
+
+func TestJoinKey(t *testing.T) {
+	tests := []struct {
+		prefix string
+		key    string
+		want   string
+	}{
+		{"", "2020/photo.jpg", "2020/photo.jpg"},
+		{"photos", "2020/photo.jpg", "photos/2020/photo.jpg"},
+		{"photos/", "/2020/photo.jpg", "photos/2020/photo.jpg"},
+		{"photos", `Takeout\Google Photos\2020\photo.jpg`, "photos/Takeout/Google Photos/2020/photo.jpg"},
+		{`backup\photos\`, "photo.jpg", "backup/photos/photo.jpg"},
+		{"photos", "", "photos"},
+	}
+
+	for _, tt := range tests {
+		got := joinKey(tt.prefix, tt.key)
+		assert.Equal(t, tt.want, got)
+		assert.NotContains(t, got, `\`)
+	}
+
+	// Both clients build keys the same way
+	cfg := Config{Prefix: "photos"}
+	assert.Equal(t, "photos/2020/photo.jpg", (&MinioClient{config: cfg}).getObjectKey(`2020\photo.jpg`))
+	assert.Equal(t, "photos/2020/photo.jpg", (&AWSClient{config: cfg}).getObjectKey(`2020\photo.jpg`))
+}
+
+func TestRelativeKey(t *testing.T) {
+	tests := []struct {
+		prefix string
+		key    string
+		want   string
+		ok     bool
+	}{
+		{"", "2020/photo.jpg", "2020/photo.jpg", true},
+		{"photos", "photos/2020/photo.jpg", "2020/photo.jpg", true},
+		{"photos/", "photos/2020/photo.jpg", "2020/photo.jpg", true},
+		{`backup\photos`, "backup/photos/photo.jpg", "photo.jpg", true},
+		{"photos", "photos-old/2020/photo.jpg", "", false},
+		{"photos", "photos", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := RelativeKey(tt.prefix, tt.key)
+		assert.Equal(t, tt.ok, ok, tt.key)
+		assert.Equal(t, tt.want, got, tt.key)
+	}
+}
@@ -1,7 +1,11 @@
 package s3client
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"mime"
+	"net/http"
 	"path/filepath"
 	"strings"
 )
@@ -27,6 +31,7 @@ var commonMimeTypes = map[string]string{
 	".webm": "video/webm",
 	".flv":  "video/x-flv",
 	".m4v":  "video/x-m4v",
+	".mp":   "video/mp4", // Video half of a Pixel Motion Photo, e.g. PXL_20230101_120000000.MP
 	".json": "application/json",
 	".txt":  "text/plain",
 	".pdf":  "application/pdf",
@@ -39,9 +44,68 @@ var commonMimeTypes = map[string]string{
 	".gz":   "application/gzip",
 }
 
+// sniffLen is the number of bytes inspected when sniffing content types
+const sniffLen = 512
+
+// ftypBrands maps ISO base media file brands to content types. The standard
+// library only recognizes a few MP4 brands, which misses HEIC and QuickTime.
+var ftypBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"hevc": "image/heic-sequence",
+	"hevx": "image/heic-sequence",
+	"mif1": "image/heif",
+	"msf1": "image/heif-sequence",
+	"qt  ": "video/quicktime",
+	"isom": "video/mp4",
+	"iso2": "video/mp4",
+	"mp41": "video/mp4",
+	"mp42": "video/mp4",
+	"avc1": "video/mp4",
+	"M4V ": "video/x-m4v",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3gp6": "video/3gpp",
+}
+
 // DetectContentType determines the content type of a file based on its extension
 func DetectContentType(filename string) string {
+	if mimeType := contentTypeByExtension(filename); mimeType != "" {
+		return mimeType
+	}
+
+	// Default to binary data
+	return "application/octet-stream"
+}
+
+// DetectContentTypeFromReader determines the content type of a file based on
+// its extension, falling back to sniffing the first bytes of its content when
+// the extension is unknown. The returned reader yields the complete content,
+// including any bytes consumed while sniffing, and must be used in place of r.
+func DetectContentTypeFromReader(filename string, r io.Reader) (string, io.Reader, error) {
+	if mimeType := contentTypeByExtension(filename); mimeType != "" {
+		return mimeType, r, nil
+	}
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	header = header[:n]
+
+	return sniffContentType(header), io.MultiReader(bytes.NewReader(header), r), nil
+}
+
+// contentTypeByExtension returns the content type for a file extension, or an
+// empty string if the extension is unknown
+func contentTypeByExtension(filename string) string {
 	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return ""
+	}
 
 	// Check our common types first
 	if mimeType, ok := commonMimeTypes[ext]; ok {
@@ -49,13 +113,23 @@ func DetectContentType(filename string) string {
 	}
 
 	// Fall back to the standard library
-	mimeType := mime.TypeByExtension(ext)
-	if mimeType != "" {
-		return mimeType
+	return mime.TypeByExtension(ext)
+}
+
+// sniffContentType determines the content type from the first bytes of a file
+func sniffContentType(header []byte) string {
+	if len(header) == 0 {
+		return "application/octet-stream"
 	}
 
-	// Default to binary data
-	return "application/octet-stream"
+	// ISO base media files start with a size followed by an ftyp box and the major brand
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" {
+		if mimeType, ok := ftypBrands[string(header[8:12])]; ok {
+			return mimeType
+		}
+	}
+
+	return http.DetectContentType(header)
 }
 
 // IsImageFile checks if a file is an image based on its extension
@@ -73,7 +147,7 @@ func IsImageFile(filename string) bool {
 func IsVideoFile(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	switch ext {
-	case ".mp4", ".mov", ".avi", ".wmv", ".mkv", ".webm", ".flv", ".m4v", ".3gp":
+	case ".mp4", ".mov", ".avi", ".wmv", ".mkv", ".webm", ".flv", ".m4v", ".3gp", ".mp":
 		return true
 	default:
 		return false
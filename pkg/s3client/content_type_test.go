@@ -0,0 +1,39 @@
+package s3client
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectContentTypeFromReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		expected string
+	}{
+		{"known extension", "photo.jpg", "not really a jpeg", "image/jpeg"},
+		{"heic without extension", "IMG_0001", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", "image/heic"},
+		{"quicktime without extension", "IMG_0002", "\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00qt  ", "video/quicktime"},
+		{"png with unknown extension", "image.unknownext", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"unrecognized content", "blob", "\x00\x01\x02\x03", "application/octet-stream"},
+		{"empty file", "empty", "", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, reader, err := DetectContentTypeFromReader(tt.filename, strings.NewReader(tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, contentType)
+
+			// The returned reader must still yield the complete content
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(content))
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package s3client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dispositions accepted by ContentDisposition
+const (
+	// DispositionInline lets browsers show the object, saving it under the
+	// file name only when asked to
+	DispositionInline = "inline"
+
+	// DispositionAttachment makes browsers download the object under the
+	// file name
+	DispositionAttachment = "attachment"
+)
+
+// ContentDisposition builds a Content-Disposition header that names the
+// object filename. Names that aren't plain ASCII are also sent RFC 5987
+// encoded as filename*, with an ASCII approximation in filename for clients
+// that don't understand it.
+func ContentDisposition(disposition, filename string) string {
+	fallback := asciiFilename(filename)
+	if fallback == filename {
+		return fmt.Sprintf("%s; filename=%q", disposition, filename)
+	}
+	return fmt.Sprintf("%s; filename=%q; filename*=UTF-8''%s", disposition, fallback, encodeRFC5987(filename))
+}
+
+// asciiFilename replaces the characters of a file name that can't be sent as
+// a quoted string in a header with underscores
+func asciiFilename(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+}
+
+// encodeRFC5987 percent-encodes the UTF-8 bytes of s that aren't attr-char
+// as defined by RFC 5987
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// isAttrChar reports whether c may appear unencoded in an RFC 5987 value
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,27 @@
+package s3client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition string
+		filename    string
+		want        string
+	}{
+		{DispositionAttachment, "IMG_1234.jpg", `attachment; filename="IMG_1234.jpg"`},
+		{DispositionInline, "Beach day.jpg", `inline; filename="Beach day.jpg"`},
+		{DispositionAttachment, "Café.jpg", `attachment; filename="Caf_.jpg"; filename*=UTF-8''Caf%C3%A9.jpg`},
+		{DispositionInline, `say "hi".jpg`, `inline; filename="say _hi_.jpg"; filename*=UTF-8''say%20%22hi%22.jpg`},
+		{DispositionAttachment, "東京.heic", `attachment; filename="__.heic"; filename*=UTF-8''%E6%9D%B1%E4%BA%AC.heic`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			assert.Equal(t, tt.want, ContentDisposition(tt.disposition, tt.filename))
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package s3client
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
 	"github.com/minio/minio-go/v7"
 )
 
@@ -15,6 +22,7 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrPermissionDenied   = errors.New("permission denied")
 	ErrConnectionFailed   = errors.New("connection failed")
+	ErrAddressingStyle    = errors.New("the endpoint may not support this addressing style")
 )
 
 // IsNotFoundError checks if an error is a "not found" error
@@ -36,11 +44,54 @@ func IsNotFoundError(err error) bool {
 		}
 	}
 
+	// Check B2 error
+	var b2Err *B2Error
+	if errors.As(err, &b2Err) && b2Err.Status == http.StatusNotFound {
+		return true
+	}
+
 	// Check error string
 	errStr := strings.ToLower(err.Error())
 	return strings.Contains(errStr, "not found") || strings.Contains(errStr, "no such")
 }
 
+// isAWSNotFound reports whether an AWS error means the object doesn't exist.
+// HEAD responses have no body, so the SDK reports them as "NotFound" with a 404
+// status rather than the NoSuchKey code returned by GET.
+func isAWSNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBucketOwned reports whether creating a bucket failed because the
+// credentials already own it, such as when another run created it first
+func isBucketOwned(err error) bool {
+	_, code, ok := ErrorStatus(err)
+	return ok && code == s3.ErrCodeBucketAlreadyOwnedByYou
+}
+
+// logBucketCreated logs the outcome of creating a missing bucket, given the
+// error that isBucketOwned accepted if there was one
+func logBucketCreated(cfg Config, err error) {
+	if err != nil {
+		logger.Info("Bucket %s was created by someone else in the meantime", cfg.Bucket)
+		return
+	}
+	logger.Info("Created bucket %s in region %s", cfg.Bucket, cfg.Region)
+}
+
 // IsAuthError checks if an error is an authentication error
 func IsAuthError(err error) bool {
 	if err == nil {
@@ -60,6 +111,12 @@ func IsAuthError(err error) bool {
 		}
 	}
 
+	// Check B2 error
+	var b2Err *B2Error
+	if errors.As(err, &b2Err) && (b2Err.Status == http.StatusUnauthorized || b2Err.Status == http.StatusForbidden) {
+		return true
+	}
+
 	// Check error string
 	errStr := strings.ToLower(err.Error())
 	return strings.Contains(errStr, "access denied") ||
@@ -68,6 +125,135 @@ func IsAuthError(err error) bool {
 		strings.Contains(errStr, "permission denied")
 }
 
+// addressingStyleError explains bucket check errors that are typical of using
+// path-style requests with a provider that only accepts virtual-hosted-style
+// requests, or the other way around. Other errors are returned unchanged.
+func addressingStyleError(err error, cfg Config) error {
+	if err == nil {
+		return nil
+	}
+
+	if cfg.PathStyle {
+		status, code, _ := ErrorStatus(err)
+		if status == http.StatusMovedPermanently || code == "PermanentRedirect" || code == "SecondLevelDomainForbidden" {
+			return fmt.Errorf("%w: the provider rejected a path-style request, try --path-style=false: %v", ErrAddressingStyle, err)
+		}
+		return err
+	}
+
+	// Virtual-hosted-style requests go to a host name made from the bucket,
+	// which may not resolve or, for buckets with dots, match the certificate
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return fmt.Errorf("%w: could not resolve %s, try --path-style=true: %v", ErrAddressingStyle, dnsErr.Name, err)
+	}
+	var hostErr x509.HostnameError
+	if errors.As(err, &hostErr) {
+		return fmt.Errorf("%w: the certificate does not cover the bucket host name, try --path-style=true: %v", ErrAddressingStyle, err)
+	}
+
+	return err
+}
+
+// ExplainConnectError turns an error from connecting to the endpoint and
+// checking the bucket into one that says what is likely wrong: the host name
+// doesn't resolve, TLS fails, nothing listens on the endpoint, the
+// credentials are rejected or the bucket is missing. The original error is
+// wrapped.
+func ExplainConnectError(err error, cfg Config) error {
+	if err == nil || errors.Is(err, ErrAddressingStyle) {
+		return err
+	}
+
+	var dnsErr *net.DNSError
+	if asCause(err, &dnsErr) {
+		return fmt.Errorf("%w: could not resolve %s, check --endpoint: %w", ErrConnectionFailed, dnsErr.Name, err)
+	}
+
+	var recordErr tls.RecordHeaderError
+	if asCause(err, &recordErr) {
+		return fmt.Errorf("%w: %s did not answer with TLS, try --use-ssl=false: %w", ErrConnectionFailed, cfg.Endpoint, err)
+	}
+	if isTLSError(err) {
+		return fmt.Errorf("%w: TLS handshake with %s failed, check its certificate or pass the CA that signed it with --ca-cert: %w", ErrConnectionFailed, cfg.Endpoint, err)
+	}
+
+	var opErr *net.OpError
+	if asCause(err, &opErr) {
+		return fmt.Errorf("%w: could not connect to %s, check --endpoint and that the service is up: %w", ErrConnectionFailed, cfg.Endpoint, err)
+	}
+
+	if IsAuthError(err) {
+		return fmt.Errorf("%w: %s rejected the credentials for bucket %s, check --access-key and --secret-key or --profile: %w",
+			ErrInvalidCredentials, cfg.Endpoint, cfg.Bucket, err)
+	}
+
+	if errors.Is(err, ErrBucketNotFound) || isAWSNotFound(err) {
+		return fmt.Errorf("%w: bucket %s does not exist at %s, create it or pass --create-bucket: %w",
+			ErrBucketNotFound, cfg.Bucket, cfg.Endpoint, err)
+	}
+
+	return fmt.Errorf("failed to connect to %s: %w", cfg.Endpoint, err)
+}
+
+// isTLSError reports whether err comes from verifying the certificate of the
+// endpoint
+func isTLSError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var hostErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	return asCause(err, &verifyErr) || asCause(err, &hostErr) ||
+		asCause(err, &authorityErr) || asCause(err, &invalidErr)
+}
+
+// asCause is errors.As that also follows the original errors of AWS errors,
+// which don't implement Unwrap
+func asCause(err error, target any) bool {
+	for err != nil {
+		if errors.As(err, target) {
+			return true
+		}
+
+		var awsErr awserr.Error
+		if !errors.As(err, &awsErr) {
+			return false
+		}
+		err = awsErr.OrigErr()
+	}
+	return false
+}
+
+// ErrorStatus returns the HTTP status and error code of the first MinIO or AWS
+// error response in the chain of err, and whether there is one
+func ErrorStatus(err error) (status int, code string, ok bool) {
+	var minioErr minio.ErrorResponse
+	if errors.As(err, &minioErr) {
+		return minioErr.StatusCode, minioErr.Code, true
+	}
+
+	var b2Err *B2Error
+	if errors.As(err, &b2Err) {
+		return b2Err.Status, b2Err.Code, true
+	}
+
+	// AWS errors don't implement Unwrap, so follow their original errors by hand
+	for err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) {
+			return reqErr.StatusCode(), reqErr.Code(), true
+		}
+
+		var awsErr awserr.Error
+		if !errors.As(err, &awsErr) {
+			break
+		}
+		err = awsErr.OrigErr()
+	}
+
+	return 0, "", false
+}
+
 // FormatError formats an error for display
 func FormatError(err error) string {
 	if err == nil {
@@ -0,0 +1,146 @@
+package s3client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSClient_ObjectExists(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantExists bool
+		wantErr    bool
+	}{
+		{"exists", nil, true, false},
+		{"no such key", awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), false, false},
+		{"head not found", awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "req"), false, false},
+		{"404 with other code", awserr.NewRequestFailure(awserr.New("UnknownError", "", nil), http.StatusNotFound, "req"), false, false},
+		{"wrapped not found", fmt.Errorf("head: %w", awserr.New("NotFound", "Not Found", nil)), false, false},
+		{"forbidden", awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), http.StatusForbidden, "req"), false, true},
+		{"access denied", awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "req"), false, true},
+		{"plain error mentioning NotFound", errors.New("proxy: upstream NotFound handler crashed"), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess, err := session.NewSession(&aws.Config{
+				Region:      aws.String("us-east-1"),
+				Endpoint:    aws.String("http://localhost"),
+				Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+				MaxRetries:  aws.Int(0),
+			})
+			require.NoError(t, err)
+
+			// Replace the HTTP round trip with the simulated outcome
+			client := s3.New(sess)
+			client.Handlers.Send.Clear()
+			client.Handlers.Send.PushBack(func(r *request.Request) {
+				if tt.err != nil {
+					r.Error = tt.err
+					return
+				}
+				r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}
+			})
+
+			c := &AWSClient{client: client, config: Config{Bucket: "test-bucket"}}
+			exists, err := c.ObjectExists(context.Background(), "photo.jpg")
+
+			assert.Equal(t, tt.wantExists, exists)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAddressingStyleError(t *testing.T) {
+	redirect := awserr.NewRequestFailure(awserr.New("PermanentRedirect", "use the bucket endpoint", nil), http.StatusMovedPermanently, "")
+	dnsErr := fmt.Errorf("request failed: %w", &net.DNSError{Name: "photos.s3.example.com", Err: "no such host", IsNotFound: true})
+	denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "denied", nil), http.StatusForbidden, "")
+
+	tests := []struct {
+		name      string
+		err       error
+		pathStyle bool
+		want      bool
+	}{
+		{"redirect with path style", redirect, true, true},
+		{"redirect with virtual hosts", redirect, false, false},
+		{"unresolved bucket host", dnsErr, false, true},
+		{"unresolved endpoint with path style", dnsErr, true, false},
+		{"access denied", denied, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := addressingStyleError(tt.err, Config{PathStyle: tt.pathStyle})
+			assert.Equal(t, tt.want, errors.Is(err, ErrAddressingStyle))
+			assert.ErrorContains(t, err, tt.err.Error())
+		})
+	}
+}
+
+func TestExplainConnectError(t *testing.T) {
+	// The AWS SDK hides transport errors behind a RequestError without Unwrap
+	requestError := func(err error) error {
+		return awserr.New(request.ErrCodeRequestError, "send request failed",
+			&url.Error{Op: "Head", URL: "https://s3.example.com/photos", Err: err})
+	}
+	cfg := Config{Endpoint: "s3.example.com", Bucket: "photos", PathStyle: true}
+
+	tests := []struct {
+		name     string
+		err      error
+		sentinel error
+		want     string
+	}{
+		{"unresolved endpoint", requestError(&net.OpError{Op: "dial", Err: &net.DNSError{Name: "s3.example.com", Err: "no such host"}}),
+			ErrConnectionFailed, "could not resolve s3.example.com"},
+		{"plain HTTP endpoint", requestError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}),
+			ErrConnectionFailed, "--use-ssl=false"},
+		{"untrusted certificate", requestError(x509.UnknownAuthorityError{}), ErrConnectionFailed, "TLS handshake"},
+		{"connection refused", requestError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+			ErrConnectionFailed, "check --endpoint"},
+		{"bad key", fmt.Errorf("failed to check if bucket exists: %w", minio.ErrorResponse{Code: "InvalidAccessKeyId"}),
+			ErrInvalidCredentials, "rejected the credentials"},
+		{"missing bucket", fmt.Errorf("bucket photos does not exist: %w", ErrBucketNotFound), ErrBucketNotFound, "--create-bucket"},
+		{"missing bucket from head", awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, ""),
+			ErrBucketNotFound, "--create-bucket"},
+		{"other", errors.New("internal error"), nil, "failed to connect to s3.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExplainConnectError(tt.err, cfg)
+			assert.ErrorContains(t, err, tt.want)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.sentinel != nil {
+				assert.ErrorIs(t, err, tt.sentinel)
+			}
+		})
+	}
+
+	addressing := fmt.Errorf("%w: try --path-style=false", ErrAddressingStyle)
+	assert.Equal(t, addressing, ExplainConnectError(addressing, cfg))
+	assert.NoError(t, ExplainConnectError(nil, cfg))
+}
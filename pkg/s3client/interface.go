@@ -3,20 +3,114 @@ package s3client
 import (
 	"context"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 )
 
+// UploadInfo describes an object written by UploadFile. ServerSideEncryption
+// is the encryption the server reported for it, empty if the backend doesn't
+// report it.
+type UploadInfo struct {
+	Key                  string
+	ETag                 string
+	Size                 int64
+	ServerSideEncryption string
+}
+
+// UploadOptions holds the optional attributes of an uploaded object
+type UploadOptions struct {
+	ContentType string
+	Metadata    map[string]string
+	Tags        map[string]string
+
+	// ContentEncoding, such as "gzip", is served with the object so clients
+	// decode it on download
+	ContentEncoding string
+
+	// ContentDisposition, as built by ContentDisposition, tells browsers
+	// whether to show the object or save it and under which name
+	ContentDisposition string
+}
+
+// ObjectInfo describes an object read by GetObject or StatObject. Key is the
+// full object key, including the prefix. Metadata holds the user metadata
+// with lower case keys and without the X-Amz-Meta- prefix.
+type ObjectInfo struct {
+	Key                  string
+	Size                 int64
+	ETag                 string
+	ContentType          string
+	LastModified         time.Time
+	Metadata             map[string]string
+	ServerSideEncryption string
+}
+
+// SSECustomer is the ServerSideEncryption of objects encrypted with a key
+// provided by the client (SSE-C), which S3 reports in a header of its own
+const SSECustomer = "SSE-C"
+
+// EncryptedWithKey reports whether sse, the ServerSideEncryption of an object,
+// is SSE-KMS or SSE-C. S3 doesn't use the MD5 of the content as the ETag of
+// such objects, even if they were uploaded in a single part.
+func EncryptedWithKey(sse string) bool {
+	return sse == SSECustomer || strings.HasPrefix(sse, "aws:kms")
+}
+
+// serverSideEncryption returns the ServerSideEncryption of an object from its
+// x-amz-server-side-encryption and SSE-C algorithm headers
+func serverSideEncryption(sse, customerAlgorithm string) string {
+	if customerAlgorithm != "" {
+		return SSECustomer
+	}
+	return sse
+}
+
+// IncompleteUpload describes a multipart upload that was started but never
+// completed or aborted. Key is the full object key, including the prefix.
+type IncompleteUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+	Size      int64 // Total size of the parts uploaded so far
+}
+
 // S3Interface defines the operations that an S3 client must implement
 type S3Interface interface {
-	UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, metadata map[string]string, contentType string) error
+	UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions) (UploadInfo, error)
 	ObjectExists(ctx context.Context, objectKey string) (bool, error)
+	// StatObject returns the size, ETag, modification time, content type and
+	// user metadata of an object without downloading it. The error wraps
+	// ErrObjectNotFound if there is no such object.
+	StatObject(ctx context.Context, objectKey string) (ObjectInfo, error)
 	ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error)
-	GetObject(ctx context.Context, objectKey string) (*minio.Object, error)
+	GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error)
 	DeleteObject(ctx context.Context, objectKey string) error
+	ListIncompleteUploads(ctx context.Context, prefix string) ([]IncompleteUpload, error)
+	AbortIncompleteUpload(ctx context.Context, upload IncompleteUpload) error
 	GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error)
 	GetBucketName() string
 	GetEndpoint() string
 	GetPrefix() string
 }
+
+// ObjectWalker is implemented by clients that can list objects a page at a
+// time. WalkObjects calls fn for each object under the prefix, and stops
+// without requesting further pages once fn returns false.
+type ObjectWalker interface {
+	WalkObjects(ctx context.Context, prefix string, fn func(object minio.ObjectInfo) bool) error
+}
+
+// collectObjects reads the whole listing of a walker, for ListObjects
+func collectObjects(ctx context.Context, w ObjectWalker, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	err := w.WalkObjects(ctx, prefix, func(object minio.ObjectInfo) bool {
+		objects = append(objects, object)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
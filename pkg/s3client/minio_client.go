@@ -1,10 +1,10 @@
 package s3client
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -23,14 +23,8 @@ type MinioClient struct {
 // NewMinIO creates a new MinIO S3 client
 func NewMinIO(ctx context.Context, cfg Config) (S3Interface, error) {
 	// Validate configuration
-	if cfg.Endpoint == "" {
-		return nil, fmt.Errorf("S3 endpoint is required")
-	}
-	if cfg.Bucket == "" {
-		return nil, fmt.Errorf("S3 bucket name is required")
-	}
-	if cfg.AccessKey == "" || cfg.SecretKey == "" {
-		return nil, fmt.Errorf("S3 access key and secret key are required")
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
 	// Remove protocol prefix if present
@@ -38,14 +32,31 @@ func NewMinIO(ctx context.Context, cfg Config) (S3Interface, error) {
 	endpoint = strings.TrimPrefix(endpoint, "https://")
 	endpoint = strings.TrimPrefix(endpoint, "http://")
 
+	// Path-style leaves the choice to the client as before, which uses
+	// virtual-hosted-style for AWS and Aliyun endpoints only
+	bucketLookup := minio.BucketLookupDNS
+	if cfg.PathStyle {
+		bucketLookup = minio.BucketLookupAuto
+	}
+
 	// Initialize MinIO client with minimal options
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
-		Secure: cfg.UseSSL,
-		Region: cfg.Region,
-		// Only add BucketLookup for better compatibility
-		BucketLookup: minio.BucketLookupAuto,
-	})
+	opts := &minio.Options{
+		Creds:        minioCredentials(cfg),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: bucketLookup,
+	}
+	// Keep the timeouts and SSL_CERT_FILE handling of the MinIO transport
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err == nil && cfg.customTransport() {
+		transport, err = newTransport(transport, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opts.Transport = recordRetryAfter(transport)
+
+	client, err := minio.New(endpoint, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
@@ -53,10 +64,17 @@ func NewMinIO(ctx context.Context, cfg Config) (S3Interface, error) {
 	// Check if bucket exists
 	exists, err := client.BucketExists(ctx, cfg.Bucket)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if bucket exists: %w", err)
+		return nil, fmt.Errorf("failed to check if bucket exists: %w", addressingStyleError(err, cfg))
+	}
+	if !exists && !cfg.CreateBucket {
+		return nil, fmt.Errorf("bucket %s does not exist: %w", cfg.Bucket, ErrBucketNotFound)
 	}
 	if !exists {
-		return nil, fmt.Errorf("bucket %s does not exist", cfg.Bucket)
+		err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region})
+		if err != nil && !isBucketOwned(err) {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", cfg.Bucket, err)
+		}
+		logBucketCreated(cfg, err)
 	}
 
 	logger.Info("Successfully connected to S3 endpoint %s, bucket %s using MinIO SDK", endpoint, cfg.Bucket)
@@ -67,20 +85,64 @@ func NewMinIO(ctx context.Context, cfg Config) (S3Interface, error) {
 	}, nil
 }
 
+// minioCredentials returns the instance role, named profile or static key
+// credentials, in that order of preference
+func minioCredentials(cfg Config) *credentials.Credentials {
+	switch {
+	case cfg.UseInstanceRole:
+		logger.Debug("Using EC2 instance role credentials")
+		return credentials.NewIAM("")
+	case cfg.Profile != "":
+		logger.Debug("Using credentials from profile %s", cfg.Profile)
+		return credentials.NewFileAWSCredentials("", cfg.Profile)
+	default:
+		return credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken)
+	}
+}
+
 // UploadFile uploads a file to S3
-func (c *MinioClient) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, metadata map[string]string, contentType string) error {
+func (c *MinioClient) UploadFile(ctx context.Context, reader io.Reader, objectKey string, size int64, uploadOpts UploadOptions) (UploadInfo, error) {
 	// Ensure the object key has the prefix
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	// Set default content type if not provided
+	contentType := uploadOpts.ContentType
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
 	// Create a custom options struct with minimal settings
 	opts := minio.PutObjectOptions{
-		ContentType:  contentType,
-		UserMetadata: metadata,
+		ContentType:        contentType,
+		ContentEncoding:    uploadOpts.ContentEncoding,
+		ContentDisposition: uploadOpts.ContentDisposition,
+		UserMetadata:       uploadOpts.Metadata,
+		UserTags:           uploadOpts.Tags,
+		PartSize:           uint64(c.config.partSize()),
+	}
+
+	// minio-go has no ACL option, but sends x-amz-acl from the user metadata as
+	// a header of its own
+	if acl := c.config.objectACL(); acl != "" {
+		opts.UserMetadata = make(map[string]string, len(uploadOpts.Metadata)+1)
+		for k, v := range uploadOpts.Metadata {
+			opts.UserMetadata[k] = v
+		}
+		opts.UserMetadata["x-amz-acl"] = acl
+	}
+
+	// MinIO only splits files larger than the part size, so also keep files
+	// below the threshold in a single PUT
+	if size < c.config.multipartThreshold() {
+		opts.DisableMultipart = true
+	}
+
+	// Let servers that support it use the original capture time as the object mtime
+	if originalDate, ok := uploadOpts.Metadata[MetadataOriginalDate]; ok {
+		if mtime, err := time.Parse(time.RFC3339, originalDate); err == nil {
+			opts.Internal.SourceMTime = mtime
+		}
 	}
 
 	// Check if we need to disable checksums for this upload
@@ -97,16 +159,17 @@ func (c *MinioClient) UploadFile(ctx context.Context, reader io.Reader, objectKe
 
 	info, err := c.client.PutObject(ctx, c.config.Bucket, objectKey, reader, size, opts)
 	if err != nil {
-		return fmt.Errorf("failed to upload file: %w", err)
+		return UploadInfo{}, fmt.Errorf("failed to upload file: %w", hint.wrap(err))
 	}
 
 	logger.Debug("Uploaded file to %s (%d bytes, etag: %s)", objectKey, info.Size, info.ETag)
-	return nil
+	return UploadInfo{Key: objectKey, ETag: info.ETag, Size: info.Size}, nil
 }
 
 // ObjectExists checks if an object exists in the bucket
 func (c *MinioClient) ObjectExists(ctx context.Context, objectKey string) (bool, error) {
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	// Try to get object info
 	_, err := c.client.StatObject(ctx, c.config.Bucket, objectKey, minio.StatObjectOptions{})
@@ -115,17 +178,52 @@ func (c *MinioClient) ObjectExists(ctx context.Context, objectKey string) (bool,
 		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			return false, nil
 		}
-		return false, fmt.Errorf("failed to check if object exists: %w", err)
+		return false, fmt.Errorf("failed to check if object exists: %w", hint.wrap(err))
 	}
 
 	return true, nil
 }
 
+// StatObject returns the attributes of an object without downloading it
+func (c *MinioClient) StatObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
+
+	stat, err := c.client.StatObject(ctx, c.config.Bucket, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to stat object: %w", hint.wrap(err))
+	}
+
+	sse := serverSideEncryption(stat.Metadata.Get("X-Amz-Server-Side-Encryption"),
+		stat.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+	return ObjectInfo{
+		Key:                  objectKey,
+		Size:                 stat.Size,
+		ETag:                 stat.ETag,
+		ContentType:          stat.ContentType,
+		LastModified:         stat.LastModified,
+		Metadata:             userMetadata(stat.UserMetadata),
+		ServerSideEncryption: sse,
+	}, nil
+}
+
 // ListObjects lists objects in the bucket with the given prefix
 func (c *MinioClient) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	return collectObjects(ctx, c, prefix)
+}
+
+// WalkObjects calls fn for each object in the bucket with the given prefix,
+// until it returns false
+func (c *MinioClient) WalkObjects(ctx context.Context, prefix string, fn func(object minio.ObjectInfo) bool) error {
 	prefix = c.getObjectKey(prefix)
+	ctx, hint := withRetryAfter(ctx)
 
-	var objects []minio.ObjectInfo
+	// Cancelling stops the listing goroutine when fn stops early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Create a channel to receive objects
 	objectCh := c.client.ListObjects(ctx, c.config.Bucket, minio.ListObjectsOptions{
@@ -136,41 +234,207 @@ func (c *MinioClient) ListObjects(ctx context.Context, prefix string) ([]minio.O
 	// Read objects from the channel
 	for object := range objectCh {
 		if object.Err != nil {
-			return nil, fmt.Errorf("error listing objects: %w", object.Err)
+			return fmt.Errorf("error listing objects: %w", hint.wrap(object.Err))
+		}
+		if !fn(object) {
+			return nil
 		}
-		objects = append(objects, object)
 	}
 
-	return objects, nil
+	return nil
 }
 
-// GetObject retrieves an object from the bucket
-func (c *MinioClient) GetObject(ctx context.Context, objectKey string) (*minio.Object, error) {
+// GetObject retrieves an object from the bucket. The caller must close the
+// returned reader.
+func (c *MinioClient) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error) {
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	// Get the object
 	obj, err := c.client.GetObject(ctx, c.config.Bucket, objectKey, minio.GetObjectOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get object: %w", err)
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	// MinIO only sends the request on the first read, so stat the object to
+	// report missing objects here
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get object: %w", hint.wrap(err))
 	}
 
-	return obj, nil
+	return obj, ObjectInfo{
+		Key:          objectKey,
+		Size:         stat.Size,
+		ETag:         stat.ETag,
+		ContentType:  stat.ContentType,
+		LastModified: stat.LastModified,
+		Metadata:     userMetadata(stat.UserMetadata),
+	}, nil
 }
 
 // DeleteObject deletes an object from the bucket
 func (c *MinioClient) DeleteObject(ctx context.Context, objectKey string) error {
 	objectKey = c.getObjectKey(objectKey)
+	ctx, hint := withRetryAfter(ctx)
 
 	// Delete the object
 	err := c.client.RemoveObject(ctx, c.config.Bucket, objectKey, minio.RemoveObjectOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to delete object: %w", err)
+		return fmt.Errorf("failed to delete object: %w", hint.wrap(err))
 	}
 
 	logger.Debug("Deleted object %s", objectKey)
 	return nil
 }
 
+// ListIncompleteUploads lists the multipart uploads under the prefix that were
+// never completed, with the size of the parts uploaded so far
+func (c *MinioClient) ListIncompleteUploads(ctx context.Context, prefix string) ([]IncompleteUpload, error) {
+	prefix = c.getObjectKey(prefix)
+
+	// Stay inside the configured prefix instead of matching keys that merely start with it
+	if prefix != "" && prefix == strings.TrimSuffix(c.config.Prefix, "/") {
+		prefix += "/"
+	}
+	core := minio.Core{Client: c.client}
+
+	var uploads []IncompleteUpload
+	for info := range c.client.ListIncompleteUploads(ctx, c.config.Bucket, prefix, true) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("error listing incomplete uploads: %w", info.Err)
+		}
+
+		upload := IncompleteUpload{
+			Key:       info.Key,
+			UploadID:  info.UploadID,
+			Initiated: info.Initiated,
+		}
+
+		// The listing doesn't include sizes, so add up the parts
+		marker := 0
+		for {
+			parts, err := core.ListObjectParts(ctx, c.config.Bucket, info.Key, info.UploadID, marker, 1000)
+			if err != nil {
+				return nil, fmt.Errorf("error listing parts of %s: %w", info.Key, err)
+			}
+			for _, part := range parts.ObjectParts {
+				upload.Size += part.Size
+			}
+			if !parts.IsTruncated {
+				break
+			}
+			marker = parts.NextPartNumberMarker
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, nil
+}
+
+// AbortIncompleteUpload aborts a multipart upload, deleting its parts
+func (c *MinioClient) AbortIncompleteUpload(ctx context.Context, upload IncompleteUpload) error {
+	core := minio.Core{Client: c.client}
+	if err := core.AbortMultipartUpload(ctx, c.config.Bucket, upload.Key, upload.UploadID); err != nil {
+		return fmt.Errorf("failed to abort upload of %s: %w", upload.Key, err)
+	}
+
+	logger.Debug("Aborted incomplete upload %s of %s", upload.UploadID, upload.Key)
+	return nil
+}
+
+// ResumeState checks a saved multipart upload against the parts the server has
+func (c *MinioClient) ResumeState(ctx context.Context, objectKey string, size int64, state MultipartState) (MultipartState, error) {
+	return resumeState(ctx, c, c.config, c.getObjectKey(objectKey), size, state)
+}
+
+// UploadResumable uploads a file in parts that a later run can continue
+func (c *MinioClient) UploadResumable(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions,
+	state MultipartState, save func(MultipartState)) (UploadInfo, error) {
+	if size < c.config.multipartThreshold() {
+		return c.UploadFile(ctx, reader, objectKey, size, opts)
+	}
+	return uploadResumable(ctx, c, c.config, reader, c.getObjectKey(objectKey), size, opts, state, save)
+}
+
+// createMultipart starts a multipart upload with the attributes of the object
+func (c *MinioClient) createMultipart(ctx context.Context, key string, uploadOpts UploadOptions) (string, error) {
+	opts := minio.PutObjectOptions{
+		ContentType:        uploadOpts.ContentType,
+		ContentEncoding:    uploadOpts.ContentEncoding,
+		ContentDisposition: uploadOpts.ContentDisposition,
+		UserMetadata:       uploadOpts.Metadata,
+		UserTags:           uploadOpts.Tags,
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+	if acl := c.config.objectACL(); acl != "" {
+		opts.UserMetadata = make(map[string]string, len(uploadOpts.Metadata)+1)
+		for k, v := range uploadOpts.Metadata {
+			opts.UserMetadata[k] = v
+		}
+		opts.UserMetadata["x-amz-acl"] = acl
+	}
+
+	core := minio.Core{Client: c.client}
+	return core.NewMultipartUpload(ctx, c.config.Bucket, key, opts)
+}
+
+// uploadPart uploads one part of a multipart upload, returning its ETag
+func (c *MinioClient) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	core := minio.Core{Client: c.client}
+	part, err := core.PutObjectPart(ctx, c.config.Bucket, key, uploadID, number,
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+// listParts lists the parts the server has of a multipart upload
+func (c *MinioClient) listParts(ctx context.Context, key, uploadID string) ([]CompletedPart, error) {
+	core := minio.Core{Client: c.client}
+
+	var parts []CompletedPart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, c.config.Bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, CompletedPart{Number: part.PartNumber, ETag: part.ETag, Size: part.Size})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// completeMultipart assembles the parts of a multipart upload into the object
+func (c *MinioClient) completeMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) (string, error) {
+	completed := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		completed[i] = minio.CompletePart{PartNumber: part.Number, ETag: part.ETag}
+	}
+
+	core := minio.Core{Client: c.client}
+	info, err := core.CompleteMultipartUpload(ctx, c.config.Bucket, key, uploadID, completed, minio.PutObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	return info.ETag, nil
+}
+
+// abortMultipart aborts a multipart upload, deleting its parts
+func (c *MinioClient) abortMultipart(ctx context.Context, key, uploadID string) error {
+	return c.AbortIncompleteUpload(ctx, IncompleteUpload{Key: key, UploadID: uploadID})
+}
+
 // GetPresignedURL generates a presigned URL for an object
 func (c *MinioClient) GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
 	objectKey = c.getObjectKey(objectKey)
@@ -186,17 +450,7 @@ func (c *MinioClient) GetPresignedURL(ctx context.Context, objectKey string, exp
 
 // getObjectKey returns the full object key with prefix
 func (c *MinioClient) getObjectKey(key string) string {
-	if c.config.Prefix == "" {
-		return key
-	}
-
-	// Ensure prefix doesn't have trailing slash
-	prefix := strings.TrimSuffix(c.config.Prefix, "/")
-
-	// Ensure key doesn't have leading slash
-	key = strings.TrimPrefix(key, "/")
-
-	return filepath.Join(prefix, key)
+	return joinKey(c.config.Prefix, key)
 }
 
 // GetBucketName returns the bucket name
@@ -0,0 +1,83 @@
+package s3client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMinIO returns a MinIO client for the photos bucket served by handler
+func newTestMinIO(t *testing.T, handler http.HandlerFunc) *MinioClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:        credentials.NewStaticV4("access", "secret", ""),
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+	})
+	require.NoError(t, err)
+	return &MinioClient{client: client, config: Config{Bucket: "photos", Region: "us-east-1"}}
+}
+
+func TestMinioClient_UploadFile_ACL(t *testing.T) {
+	var acls []string
+	c := newTestMinIO(t, func(w http.ResponseWriter, r *http.Request) {
+		acls = append(acls, r.Header.Get("X-Amz-Acl"))
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	})
+
+	// The default private ACL isn't sent
+	_, err := c.UploadFile(context.Background(), strings.NewReader("abc"), "a.jpg", 3, UploadOptions{})
+	require.NoError(t, err)
+
+	c.config.ACL = "public-read"
+	metadata := map[string]string{"title": "a.jpg"}
+	_, err = c.UploadFile(context.Background(), strings.NewReader("abc"), "a.jpg", 3, UploadOptions{Metadata: metadata})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", "public-read"}, acls)
+	assert.NotContains(t, metadata, "x-amz-acl")
+}
+
+func TestMinioClient_StatObject(t *testing.T) {
+	c := newTestMinIO(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path != "/photos/backup/a.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "1024")
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", `"0123456789abcdef0123456789abcdef"`)
+		w.Header().Set("Last-Modified", "Tue, 07 Apr 2020 20:00:00 GMT")
+		w.Header().Set("X-Amz-Meta-Original-Date", "2020-04-07T20:00:00Z")
+		w.Header().Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	})
+	c.config.Prefix = "backup"
+
+	info, err := c.StatObject(context.Background(), "a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, ObjectInfo{
+		Key:                  "backup/a.jpg",
+		Size:                 1024,
+		ETag:                 "0123456789abcdef0123456789abcdef",
+		ContentType:          "image/jpeg",
+		LastModified:         time.Date(2020, 4, 7, 20, 0, 0, 0, time.UTC),
+		Metadata:             map[string]string{MetadataOriginalDate: "2020-04-07T20:00:00Z"},
+		ServerSideEncryption: SSECustomer,
+	}, info)
+
+	_, err = c.StatObject(context.Background(), "missing.jpg")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
@@ -0,0 +1,71 @@
+package s3client
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// regionFirstHosts are the domains of providers whose endpoints start with
+// the region, such as nyc3.digitaloceanspaces.com
+var regionFirstHosts = []string{
+	"digitaloceanspaces.com",
+	"linodeobjects.com",
+}
+
+// regionLabel matches host labels shaped like a region name: a two letter
+// area, one or more words and an optional number, as in eu-central-1,
+// us-west-002 or fr-par. Other labels after s3, such as in
+// s3.storage.example.com, name a self-hosted service rather than a region.
+var regionLabel = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+(-[0-9]+)?$`)
+
+// RegionFromEndpoint returns the region named in the host of an endpoint,
+// such as us-west-002 for s3.us-west-002.backblazeb2.com or eu-central-1 for
+// s3.eu-central-1.amazonaws.com. Cloudflare R2 endpoints give "auto". It
+// returns false for IP addresses, local hosts and hosts without a region.
+func RegionFromEndpoint(endpoint string) (string, bool) {
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(endpoint), "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return "", false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(labels) < 3 {
+		return "", false
+	}
+
+	if strings.HasSuffix(host, ".r2.cloudflarestorage.com") {
+		return "auto", true
+	}
+	for _, domain := range regionFirstHosts {
+		if strings.HasSuffix(host, "."+domain) {
+			return labels[len(labels)-3], true
+		}
+	}
+
+	// The region follows the s3 label, or is joined to it with a dash right
+	// before the domain as in the legacy s3-us-west-2.amazonaws.com. The last
+	// two labels are the provider's domain and never a region.
+	for i, label := range labels[:len(labels)-2] {
+		if region, ok := strings.CutPrefix(label, "s3-"); ok && regionLabel.MatchString(region) && i == len(labels)-3 {
+			return region, true
+		}
+		if label != "s3" {
+			continue
+		}
+		for _, next := range labels[i+1 : len(labels)-2] {
+			if next == "dualstack" {
+				continue
+			}
+			if regionLabel.MatchString(next) {
+				return next, true
+			}
+			break
+		}
+	}
+	return "", false
+}
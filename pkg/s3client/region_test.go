@@ -0,0 +1,41 @@
+package s3client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionFromEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		region   string
+	}{
+		{"s3.us-west-002.backblazeb2.com", "us-west-002"},
+		{"https://s3.eu-central-1.amazonaws.com", "eu-central-1"},
+		{"s3.dualstack.ap-south-1.amazonaws.com", "ap-south-1"},
+		{"s3-us-west-2.amazonaws.com", "us-west-2"},
+		{"photos.s3.eu-west-1.amazonaws.com", "eu-west-1"},
+		{"s3.eu-central-2.wasabisys.com:443", "eu-central-2"},
+		{"s3.fr-par.scw.cloud", "fr-par"},
+		{"nyc3.digitaloceanspaces.com", "nyc3"},
+		{"us-east-1.linodeobjects.com", "us-east-1"},
+		{"0123abcd.r2.cloudflarestorage.com", "auto"},
+		{"s3.amazonaws.com", ""},
+		{"s3-backups.s3.amazonaws.com", ""},
+		{"minio.example.com", ""},
+		{"s3.storage.example.com", ""},
+		{"s3.nas.home.arpa", ""},
+		{"s3-backup.nas.example.com", ""},
+		{"localhost:9000", ""},
+		{"http://192.168.1.10:9000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			region, ok := RegionFromEndpoint(tt.endpoint)
+			assert.Equal(t, tt.region, region)
+			assert.Equal(t, tt.region != "", ok)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package s3client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// MultipartState is the progress of a multipart upload that can be continued
+// by a later run: the upload, the size of its parts and the parts uploaded so
+// far, in order from the first
+type MultipartState struct {
+	UploadID string
+	PartSize int64
+	Parts    []CompletedPart
+}
+
+// CompletedPart is a part of a multipart upload the server has stored
+type CompletedPart struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// Offset returns the number of bytes of the file the parts hold
+func (s MultipartState) Offset() int64 {
+	var offset int64
+	for _, part := range s.Parts {
+		offset += part.Size
+	}
+	return offset
+}
+
+// ResumableUploader is implemented by clients that can continue a multipart
+// upload an earlier run left unfinished instead of starting the file over
+type ResumableUploader interface {
+	// ResumeState checks a saved upload against the parts the server has,
+	// keeping the parts from the first on that match. It returns an empty
+	// state if the upload is gone or can't be continued.
+	ResumeState(ctx context.Context, objectKey string, size int64, state MultipartState) (MultipartState, error)
+
+	// UploadResumable uploads the rest of a file after the parts in state,
+	// starting a new upload if it has none, and calls save with the state
+	// once the upload is started and after every part. The reader must be
+	// positioned at the end of the parts in state. Files below the multipart
+	// threshold are uploaded with UploadFile. On failure the upload is left
+	// in place to be continued.
+	UploadResumable(ctx context.Context, reader io.Reader, objectKey string, size int64, opts UploadOptions,
+		state MultipartState, save func(MultipartState)) (UploadInfo, error)
+}
+
+// multipartAPI is the multipart requests of a backend that resumable uploads
+// are built on. Keys include the prefix.
+type multipartAPI interface {
+	createMultipart(ctx context.Context, key string, opts UploadOptions) (string, error)
+	uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error)
+	listParts(ctx context.Context, key, uploadID string) ([]CompletedPart, error)
+	completeMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) (string, error)
+	abortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// resumablePartSize returns the part size of a resumable upload of size
+// bytes: the configured part size, or more if the file would need more than
+// MaxParts parts
+func resumablePartSize(cfg Config, size int64) int64 {
+	partSize := cfg.partSize()
+	if size > partSize*MaxParts {
+		const mb = 1024 * 1024
+		partSize = ((size+MaxParts-1)/MaxParts + mb - 1) / mb * mb
+	}
+	return partSize
+}
+
+// resumeState implements ResumableUploader.ResumeState for a backend
+func resumeState(ctx context.Context, api multipartAPI, cfg Config, key string, size int64, state MultipartState) (MultipartState, error) {
+	if state.UploadID == "" {
+		return MultipartState{}, nil
+	}
+
+	// The parts can't be reused if they would be split differently now
+	if partSize := resumablePartSize(cfg, size); state.PartSize != partSize {
+		logger.Warn("Part size of the upload of %s changed from %d to %d bytes, starting over", key, state.PartSize, partSize)
+		if err := api.abortMultipart(ctx, key, state.UploadID); err != nil {
+			logger.Warn("Failed to abort the earlier upload of %s: %v", key, err)
+		}
+		return MultipartState{}, nil
+	}
+
+	ctx, hint := withRetryAfter(ctx)
+	listed, err := api.listParts(ctx, key, state.UploadID)
+	if isUploadGone(err) {
+		logger.Warn("Upload %s of %s no longer exists, starting over", state.UploadID, key)
+		return MultipartState{}, nil
+	}
+	if err != nil {
+		return MultipartState{}, fmt.Errorf("failed to list parts of %s: %w", key, hint.wrap(err))
+	}
+
+	stored := make(map[int]CompletedPart, len(listed))
+	for _, part := range listed {
+		stored[part.Number] = part
+	}
+
+	// Only full parts the server and the saved state agree on are kept, up
+	// to the first gap. Anything after it is uploaded again.
+	resumed := MultipartState{UploadID: state.UploadID, PartSize: state.PartSize}
+	for i, part := range state.Parts {
+		got, ok := stored[i+1]
+		if part.Number != i+1 || !ok || got.Size != state.PartSize || !sameETag(got.ETag, part.ETag) {
+			break
+		}
+		resumed.Parts = append(resumed.Parts, part)
+	}
+	return resumed, nil
+}
+
+// uploadResumable implements ResumableUploader.UploadResumable for a backend
+func uploadResumable(ctx context.Context, api multipartAPI, cfg Config, reader io.Reader, key string, size int64,
+	opts UploadOptions, state MultipartState, save func(MultipartState)) (UploadInfo, error) {
+	ctx, hint := withRetryAfter(ctx)
+	if state.UploadID == "" {
+		uploadID, err := api.createMultipart(ctx, key, opts)
+		if err != nil {
+			return UploadInfo{}, fmt.Errorf("failed to start upload: %w", hint.wrap(err))
+		}
+		state = MultipartState{UploadID: uploadID, PartSize: resumablePartSize(cfg, size)}
+		save(state)
+	}
+
+	// Each part is read in full before it is sent, so a part that fails
+	// is never recorded and the next run starts at its first byte
+	buf := make([]byte, state.PartSize)
+	offset := state.Offset()
+	for number := len(state.Parts) + 1; offset < size; number++ {
+		data := buf[:min(state.PartSize, size-offset)]
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return UploadInfo{}, fmt.Errorf("failed to read part %d: %w", number, err)
+		}
+
+		etag, err := api.uploadPart(ctx, key, state.UploadID, number, data)
+		if err != nil {
+			return UploadInfo{}, fmt.Errorf("failed to upload part %d: %w", number, hint.wrap(err))
+		}
+
+		state.Parts = append(state.Parts, CompletedPart{Number: number, ETag: etag, Size: int64(len(data))})
+		offset += int64(len(data))
+		save(state)
+	}
+
+	etag, err := api.completeMultipart(ctx, key, state.UploadID, state.Parts)
+	if err != nil {
+		return UploadInfo{}, fmt.Errorf("failed to complete upload: %w", hint.wrap(err))
+	}
+
+	logger.Debug("Uploaded file to %s in %d parts (%d bytes, etag: %s)", key, len(state.Parts), size, etag)
+	return UploadInfo{Key: key, ETag: etag, Size: size}, nil
+}
+
+// sameETag compares ETags, which some servers return without quotes
+func sameETag(a, b string) bool {
+	return strings.Trim(a, `"`) == strings.Trim(b, `"`)
+}
+
+// isUploadGone reports whether an error means a multipart upload no longer
+// exists, because it was completed, aborted or expired
+func isUploadGone(err error) bool {
+	_, code, ok := ErrorStatus(err)
+	return ok && code == s3.ErrCodeNoSuchUpload
+}
@@ -0,0 +1,142 @@
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMultipart is an in-memory multipart API that can fail a part
+type fakeMultipart struct {
+	uploads  map[string]map[int][]byte
+	failPart int
+	aborted  []string
+	object   []byte
+}
+
+func newFakeMultipart() *fakeMultipart {
+	return &fakeMultipart{uploads: make(map[string]map[int][]byte)}
+}
+
+func (f *fakeMultipart) createMultipart(ctx context.Context, key string, opts UploadOptions) (string, error) {
+	id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[id] = make(map[int][]byte)
+	return id, nil
+}
+
+func (f *fakeMultipart) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	if number == f.failPart {
+		return "", fmt.Errorf("connection reset")
+	}
+	f.uploads[uploadID][number] = bytes.Clone(data)
+	return fmt.Sprintf(`"etag-%d"`, number), nil
+}
+
+func (f *fakeMultipart) listParts(ctx context.Context, key, uploadID string) ([]CompletedPart, error) {
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		return nil, minio.ErrorResponse{Code: "NoSuchUpload", StatusCode: 404}
+	}
+	var listed []CompletedPart
+	for number, data := range parts {
+		listed = append(listed, CompletedPart{Number: number, ETag: fmt.Sprintf("etag-%d", number), Size: int64(len(data))})
+	}
+	return listed, nil
+}
+
+func (f *fakeMultipart) completeMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) (string, error) {
+	f.object = nil
+	for _, part := range parts {
+		f.object = append(f.object, f.uploads[uploadID][part.Number]...)
+	}
+	delete(f.uploads, uploadID)
+	return fmt.Sprintf(`"multipart-%d"`, len(parts)), nil
+}
+
+func (f *fakeMultipart) abortMultipart(ctx context.Context, key, uploadID string) error {
+	f.aborted = append(f.aborted, uploadID)
+	delete(f.uploads, uploadID)
+	return nil
+}
+
+func TestUploadResumable_ContinuesAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{PartSize: MinPartSize}
+	content := bytes.Repeat([]byte("0123456789"), (3*MinPartSize+1000)/10)
+	size := int64(len(content))
+	api := newFakeMultipart()
+
+	// The first run dies while sending the third part
+	var saved MultipartState
+	save := func(state MultipartState) { saved = state }
+	api.failPart = 3
+	_, err := uploadResumable(ctx, api, cfg, bytes.NewReader(content), "video.mp4", size, UploadOptions{}, MultipartState{}, save)
+	require.ErrorContains(t, err, "part 3")
+	require.Len(t, saved.Parts, 2)
+
+	// The next run keeps the two stored parts and sends the rest
+	api.failPart = 0
+	state, err := resumeState(ctx, api, cfg, "video.mp4", size, saved)
+	require.NoError(t, err)
+	assert.Equal(t, saved, state)
+
+	reader := bytes.NewReader(content)
+	_, err = io.CopyN(io.Discard, reader, state.Offset())
+	require.NoError(t, err)
+	info, err := uploadResumable(ctx, api, cfg, reader, "video.mp4", size, UploadOptions{}, state, save)
+	require.NoError(t, err)
+	assert.Equal(t, `"multipart-4"`, info.ETag)
+	assert.Equal(t, content, api.object)
+	assert.Len(t, saved.Parts, 4)
+}
+
+func TestResumeState(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{PartSize: MinPartSize}
+	size := int64(4 * MinPartSize)
+
+	api := newFakeMultipart()
+	id, err := api.createMultipart(ctx, "video.mp4", UploadOptions{})
+	require.NoError(t, err)
+	part := make([]byte, MinPartSize)
+	for _, number := range []int{1, 2, 4} {
+		_, err := api.uploadPart(ctx, "video.mp4", id, number, part)
+		require.NoError(t, err)
+	}
+	saved := MultipartState{UploadID: id, PartSize: MinPartSize}
+	for _, number := range []int{1, 2, 4} {
+		saved.Parts = append(saved.Parts, CompletedPart{Number: number, ETag: fmt.Sprintf(`"etag-%d"`, number), Size: MinPartSize})
+	}
+
+	// Parts after a gap are uploaded again
+	state, err := resumeState(ctx, api, cfg, "video.mp4", size, saved)
+	require.NoError(t, err)
+	assert.Equal(t, saved.Parts[:2], state.Parts)
+
+	// A different part size starts over and aborts the old upload
+	state, err = resumeState(ctx, api, Config{PartSize: 2 * MinPartSize}, "video.mp4", size, saved)
+	require.NoError(t, err)
+	assert.Equal(t, MultipartState{}, state)
+	assert.Equal(t, []string{id}, api.aborted)
+
+	// So does an upload the server no longer has
+	state, err = resumeState(ctx, api, cfg, "video.mp4", size, saved)
+	require.NoError(t, err)
+	assert.Equal(t, MultipartState{}, state)
+}
+
+func TestResumablePartSize(t *testing.T) {
+	cfg := Config{PartSize: MinPartSize}
+	assert.Equal(t, int64(MinPartSize), resumablePartSize(cfg, 1<<30))
+
+	// Files that would need more than MaxParts parts get larger ones
+	partSize := resumablePartSize(cfg, 100<<30)
+	assert.Greater(t, partSize, int64(MinPartSize))
+	assert.LessOrEqual(t, (int64(100<<30)+partSize-1)/partSize, int64(MaxParts))
+}
@@ -0,0 +1,129 @@
+package s3client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryAfterError is an error of a request the server throttled, asking in
+// a Retry-After header to wait before trying again
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns how long the server asked to wait before retrying the
+// request that failed with err, if it sent a Retry-After header
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return retryErr.After, true
+	}
+
+	var b2Err *B2Error
+	if errors.As(err, &b2Err) && b2Err.RetryAfter > 0 {
+		return b2Err.RetryAfter, true
+	}
+
+	return 0, false
+}
+
+// parseRetryAfter parses a Retry-After header of a throttled response, which
+// is either a number of seconds or an HTTP date
+func parseRetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryAfterKey is the context key of the retryAfterHint of a call
+type retryAfterKey struct{}
+
+// retryAfterHint holds the Retry-After of the last response to the requests
+// of a call, which the SDKs don't keep in their errors
+type retryAfterHint struct {
+	mu    sync.Mutex
+	after time.Duration
+	ok    bool
+}
+
+// withRetryAfter returns a context whose requests record their Retry-After
+// header in the returned hint, if the client's transport is wrapped with
+// recordRetryAfter
+func withRetryAfter(ctx context.Context) (context.Context, *retryAfterHint) {
+	hint := &retryAfterHint{}
+	return context.WithValue(ctx, retryAfterKey{}, hint), hint
+}
+
+// wrap adds the recorded Retry-After to the error of the call, if the last
+// response had one
+func (h *retryAfterHint) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ok {
+		return err
+	}
+	return &RetryAfterError{Err: err, After: h.after}
+}
+
+// retryAfterTransport records the Retry-After header of responses in the
+// hint of the request context
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+// recordRetryAfter wraps a transport, or the default one if it is nil, so
+// calls made with withRetryAfter learn how long the server asked them to wait
+func recordRetryAfter(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return retryAfterTransport{base: base}
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	// Only the last response counts, since the SDKs retry on their own
+	if hint, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHint); ok {
+		after, ok := parseRetryAfter(resp, time.Now())
+		hint.mu.Lock()
+		hint.after, hint.ok = after, ok
+		hint.mu.Unlock()
+	}
+	return resp, nil
+}
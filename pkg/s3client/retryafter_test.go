@@ -0,0 +1,103 @@
+package s3client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status int
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"seconds", http.StatusServiceUnavailable, "30", 30 * time.Second, true},
+		{"too many requests", http.StatusTooManyRequests, " 5 ", 5 * time.Second, true},
+		{"date", http.StatusServiceUnavailable, now.Add(2 * time.Minute).Format(http.TimeFormat), 2 * time.Minute, true},
+		{"date in the past", http.StatusServiceUnavailable, now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"no header", http.StatusServiceUnavailable, "", 0, false},
+		{"negative", http.StatusServiceUnavailable, "-1", 0, false},
+		{"garbage", http.StatusServiceUnavailable, "soon", 0, false},
+		{"not throttled", http.StatusInternalServerError, "30", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := parseRetryAfter(resp, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRecordRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: recordRetryAfter(nil)}
+	get := func(ctx context.Context, path string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	failed := errors.New("SlowDown")
+
+	// A throttled response adds its wait to the error of the call
+	ctx, hint := withRetryAfter(context.Background())
+	get(ctx, "/slow")
+	after, ok := RetryAfter(fmt.Errorf("failed to upload file: %w", hint.wrap(failed)))
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, after)
+	assert.ErrorIs(t, hint.wrap(failed), failed)
+	assert.NoError(t, hint.wrap(nil))
+
+	// Only the last response of the call counts
+	get(ctx, "/")
+	_, ok = RetryAfter(hint.wrap(failed))
+	assert.False(t, ok)
+
+	// Requests outside a call aren't recorded
+	get(context.Background(), "/slow")
+	_, ok = RetryAfter(failed)
+	assert.False(t, ok)
+}
+
+func TestB2ResponseError_RetryAfter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Retry-After", "3")
+	rec.WriteHeader(http.StatusTooManyRequests)
+	rec.WriteString(`{"status":429,"code":"too_many_requests","message":"slow down"}`)
+
+	err := fmt.Errorf("b2_upload_file: %w", b2ResponseError(rec.Result()))
+	after, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, after)
+
+	status, code, ok := ErrorStatus(err)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "too_many_requests", code)
+}
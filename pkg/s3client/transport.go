@@ -0,0 +1,99 @@
+package s3client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/bstardust/google-takeout-s3-importer/internal/logger"
+)
+
+// customTransport reports whether the connection needs TLS or connection
+// pool settings of its own instead of the defaults of each client
+func (c Config) customTransport() bool {
+	return c.CACert != "" || c.TLSSkipVerify || c.MaxIdleConns > 0 || c.MaxConnsPerHost > 0 ||
+		c.Concurrency > http.DefaultMaxIdleConnsPerHost
+}
+
+// newTransport returns a copy of the base transport of a client with the TLS
+// and connection pool settings of the config: the certificates in CACert are
+// trusted on top of those of the base, TLSSkipVerify accepts any certificate,
+// and the pool keeps up to MaxIdleConns connections to the endpoint open for
+// reuse. Everything else, such as the timeouts of the base, is kept.
+func newTransport(base *http.Transport, cfg Config) (*http.Transport, error) {
+	transport := base.Clone()
+
+	// Objects are read as they are stored, even if they were uploaded gzipped
+	transport.DisableCompression = true
+
+	// http.Transport keeps only 2 idle connections per host by default, so
+	// concurrent uploads would keep opening new ones
+	idlePerHost := transport.MaxIdleConnsPerHost
+	if idlePerHost == 0 {
+		idlePerHost = http.DefaultMaxIdleConnsPerHost
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	} else if cfg.Concurrency > idlePerHost {
+		transport.MaxIdleConnsPerHost = cfg.Concurrency
+		if transport.MaxIdleConns > 0 {
+			transport.MaxIdleConns = max(transport.MaxIdleConns, cfg.Concurrency)
+		}
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+
+	if cfg.CACert == "" && !cfg.TLSSkipVerify {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+
+		// Private CAs are usually added to the system ones, or those the base
+		// trusts, not used instead
+		pool := tlsConfig.RootCAs
+		if pool != nil {
+			pool = pool.Clone()
+		} else if pool, err = x509.SystemCertPool(); err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSSkipVerify {
+		logger.Warn("TLS certificate verification is DISABLED: the connection to %s can be intercepted, only use --tls-skip-verify for testing", cfg.Endpoint)
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// newHTTPClient returns an HTTP client for the AWS SDK with the transport
+// settings of the config
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	if !cfg.customTransport() {
+		return &http.Client{}, nil
+	}
+	transport, err := newTransport(http.DefaultTransport.(*http.Transport), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,88 @@
+package s3client
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caCert := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caCert, cert, 0600))
+
+	get := func(cfg Config) error {
+		client, err := newHTTPClient(cfg)
+		require.NoError(t, err)
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// The test server's certificate isn't trusted by default
+	assert.Error(t, get(Config{}))
+	assert.NoError(t, get(Config{CACert: caCert}))
+	assert.NoError(t, get(Config{TLSSkipVerify: true}))
+
+	notPEM := filepath.Join(dir, "ca.txt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+	_, err := newHTTPClient(Config{CACert: notPEM})
+	assert.ErrorContains(t, err, "no PEM certificates")
+
+	_, err = newHTTPClient(Config{CACert: filepath.Join(dir, "missing.pem")})
+	assert.ErrorContains(t, err, "failed to read CA certificates")
+}
+
+func TestNewTransport_MinIO(t *testing.T) {
+	base, err := minio.DefaultTransport(true)
+	require.NoError(t, err)
+
+	// Only the TLS settings of the MinIO transport change
+	transport, err := newTransport(base, Config{TLSSkipVerify: true})
+	require.NoError(t, err)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, base.ResponseHeaderTimeout, transport.ResponseHeaderTimeout)
+	assert.Equal(t, base.IdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(t, base.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.NotZero(t, transport.ResponseHeaderTimeout)
+	assert.False(t, base.TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestNewTransport_Pool(t *testing.T) {
+	transport, err := newTransport(http.DefaultTransport.(*http.Transport), Config{MaxIdleConns: 32, MaxConnsPerHost: 64})
+	require.NoError(t, err)
+	assert.Equal(t, 32, transport.MaxIdleConns)
+	assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 64, transport.MaxConnsPerHost)
+	assert.True(t, transport.DisableCompression)
+
+	// Without settings of their own, clients keep their default transport
+	assert.False(t, Config{}.customTransport())
+	assert.False(t, Config{Concurrency: 2}.customTransport())
+	assert.True(t, Config{MaxIdleConns: 32}.customTransport())
+
+	// By default the pool only grows to hold a connection per upload
+	transport, err = newTransport(http.DefaultTransport.(*http.Transport), Config{Concurrency: 8})
+	require.NoError(t, err)
+	assert.Equal(t, 8, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 100, transport.MaxIdleConns)
+
+	base, err := minio.DefaultTransport(true)
+	require.NoError(t, err)
+	transport, err = newTransport(base, Config{Concurrency: 8})
+	require.NoError(t, err)
+	assert.Equal(t, base.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+}
@@ -88,7 +88,7 @@ func TestIntegrationUpload(t *testing.T) {
 	progressReporter := progress.New()
 
 	// Create takeout adapter
-	takeout, err := googletakeout.New(ctx, takeoutPath, false)
+	takeout, err := googletakeout.New(ctx, takeoutPath, googletakeout.Options{ScanConcurrency: 2})
 	require.NoError(t, err, "Failed to create Google Takeout adapter")
 
 	// Create uploader